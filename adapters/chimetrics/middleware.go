@@ -0,0 +1,55 @@
+// Package chimetrics records the standard HTTP metrics of a Metrics instance
+// for go-chi/chi routers.
+package chimetrics
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	metrics "github.com/nexen-io/nexen-metrics"
+)
+
+// Middleware returns chi middleware recording every request in the HTTP
+// metrics of m, with the route pattern, such as /users/{id}, as the path
+// label. Requests matching no route are recorded as "unmatched". Add it to
+// the root router, where the pattern is complete once the handler returns:
+//
+//	r := chi.NewRouter()
+//	r.Use(chimetrics.Middleware(m))
+//
+// A handler panic is recorded with status 500 and counted with
+// WithPanicCapture, then left to middleware.Recoverer if added before this
+// one.
+//
+// Unlike Instrument with the ChiRoutePattern normalizer, it can be added to a
+// router without configuring m for chi.
+func Middleware(m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			o := m.StartRequest(r)
+			r = o.Request()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			completed := false
+			defer func() {
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				var route string
+				if rctx := chi.RouteContext(r.Context()); rctx != nil {
+					route = rctx.RoutePattern()
+				}
+				o.Finish(metrics.Response{
+					Route:       route,
+					Status:      status,
+					Size:        int64(ww.BytesWritten()),
+					ContentType: ww.Header().Get("Content-Type"),
+					Panicked:    !completed,
+				})
+			}()
+			next.ServeHTTP(ww, r)
+			completed = true
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package chimetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	metrics "github.com/nexen-io/nexen-metrics"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("test"))
+	r := chi.NewRouter()
+	r.Use(Middleware(m))
+	r.Route("/users", func(r chi.Router) {
+		r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("user"))
+		})
+	})
+
+	for _, path := range []string{"/users/1", "/users/2", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	body := scrape(m)
+	for _, want := range []string{
+		`nexen_service_http_requests_total{method="GET",path="/users/{id}",service="test"} 2`,
+		`nexen_service_http_errors_total{code="Not Found",method="GET",path="unmatched",service="test"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("test"), metrics.WithPanicCapture(false))
+	r := chi.NewRouter()
+	r.Use(Middleware(m))
+	r.Get("/boom", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected the panic to reach the caller")
+			}
+		}()
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/boom", nil))
+	}()
+
+	body := scrape(m)
+	for _, want := range []string{
+		`nexen_service_http_in_flight_requests{service="test"} 0`,
+		`nexen_service_http_panics_total{path="/boom",service="test"} 1`,
+		`nexen_service_http_errors_total{code="Internal Server Error",method="GET",path="/boom",service="test"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
+
+func scrape(m *metrics.Metrics) string {
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	return w.Body.String()
+}
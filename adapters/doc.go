@@ -0,0 +1,11 @@
+// Package adapters holds middleware recording the standard HTTP metrics of a
+// Metrics instance in web frameworks, with the route template of each
+// framework as the path label:
+//
+//   - ginmetrics for gin-gonic/gin
+//   - echometrics for labstack/echo
+//   - fibermetrics for gofiber/fiber
+//   - chimetrics for go-chi/chi
+//
+// Each is a separate package, so services only depend on their own framework.
+package adapters
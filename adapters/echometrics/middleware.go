@@ -0,0 +1,55 @@
+// Package echometrics records the standard HTTP metrics of a Metrics instance
+// for labstack/echo servers.
+package echometrics
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	metrics "github.com/nexen-io/nexen-metrics"
+)
+
+// Middleware returns echo middleware recording every request in the HTTP
+// metrics of m, with the route template, such as /users/:id, as the path
+// label. Requests matching no route are recorded as "unmatched". Handler
+// errors are recorded with the status of an *echo.HTTPError, or 500 for
+// other errors, as the error handler will answer once the middleware returns:
+//
+//	e := echo.New()
+//	e.Use(echometrics.Middleware(m))
+//
+// A handler panic is recorded with status 500 and counted with
+// WithPanicCapture, then left to the Recover middleware if added before this
+// one.
+func Middleware(m *metrics.Metrics) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			o := m.StartRequest(c.Request())
+			c.SetRequest(o.Request())
+			completed := false
+			var err error
+			defer func() {
+				resp := c.Response()
+				status := resp.Status
+				if err != nil && !resp.Committed {
+					status = http.StatusInternalServerError
+					var httpErr *echo.HTTPError
+					if errors.As(err, &httpErr) {
+						status = httpErr.Code
+					}
+				}
+				o.Finish(metrics.Response{
+					Route:       c.Path(),
+					Status:      status,
+					Size:        resp.Size,
+					ContentType: resp.Header().Get(echo.HeaderContentType),
+					Panicked:    !completed,
+				})
+			}()
+			err = next(c)
+			completed = true
+			return err
+		}
+	}
+}
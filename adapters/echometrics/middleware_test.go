@@ -0,0 +1,49 @@
+package echometrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	metrics "github.com/nexen-io/nexen-metrics"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("test"))
+	e := echo.New()
+	e.Use(Middleware(m))
+	e.GET("/users/:id", func(c echo.Context) error {
+		switch c.Param("id") {
+		case "forbidden":
+			return echo.NewHTTPError(http.StatusForbidden)
+		case "broken":
+			return errors.New("broken")
+		}
+		return c.String(http.StatusOK, "user")
+	})
+
+	for _, path := range []string{"/users/1", "/users/forbidden", "/users/broken", "/missing"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	body := scrape(m)
+	for _, want := range []string{
+		`nexen_service_http_requests_total{method="GET",path="/users/:id",service="test"} 3`,
+		`nexen_service_http_errors_total{code="Forbidden",method="GET",path="/users/:id",service="test"} 1`,
+		`nexen_service_http_errors_total{code="Internal Server Error",method="GET",path="/users/:id",service="test"} 1`,
+		`nexen_service_http_errors_total{code="Not Found",method="GET",path="unmatched",service="test"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
+
+func scrape(m *metrics.Metrics) string {
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	return w.Body.String()
+}
@@ -0,0 +1,70 @@
+// Package fibermetrics records the standard HTTP metrics of a Metrics
+// instance for gofiber/fiber applications.
+package fibermetrics
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+// Middleware returns fiber middleware recording every request in the HTTP
+// metrics of m, with the route path, such as /users/:id, as the path label.
+// Requests matching no route are recorded as "unmatched", provided the
+// middleware is added after any other app.Use middleware. Handler errors are
+// recorded with the status of a *fiber.Error, or 500 for other errors, as the
+// error handler will answer once the middleware returns:
+//
+//	app := fiber.New()
+//	app.Use(recover.New(), logger.New())
+//	app.Use(fibermetrics.Middleware(m))
+//
+// A handler panic is recorded with status 500 and counted with
+// WithPanicCapture, then left to the recover middleware.
+//
+// Fiber is not built on net/http, so the middleware converts each request to
+// an *http.Request for the request classifiers and exemplar extractors of m.
+// The context of that request, which carries the state read by SetLabel and
+// FromContext, is set as the user context of the fiber.Ctx.
+func Middleware(m *metrics.Metrics) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req http.Request
+		if err := fasthttpadaptor.ConvertRequest(c.Context(), &req, true); err != nil {
+			return c.Next()
+		}
+		o := m.StartRequest(req.WithContext(c.UserContext()))
+		c.SetUserContext(o.Request().Context())
+
+		// The route stays that of this middleware if no other route matches
+		own := c.Route()
+		completed := false
+		var err error
+		defer func() {
+			status := c.Response().StatusCode()
+			if err != nil {
+				status = http.StatusInternalServerError
+				var fiberErr *fiber.Error
+				if errors.As(err, &fiberErr) {
+					status = fiberErr.Code
+				}
+			}
+			var route string
+			if matched := c.Route(); matched != own {
+				route = matched.Path
+			}
+			o.Finish(metrics.Response{
+				Route:       route,
+				Status:      status,
+				Size:        int64(len(c.Response().Body())),
+				ContentType: string(c.Response().Header.ContentType()),
+				Panicked:    !completed,
+			})
+		}()
+		err = c.Next()
+		completed = true
+		return err
+	}
+}
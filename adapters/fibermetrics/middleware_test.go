@@ -0,0 +1,51 @@
+package fibermetrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	metrics "github.com/nexen-io/nexen-metrics"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("test"))
+	app := fiber.New()
+	app.Use(Middleware(m))
+	app.Get("/users/:id", func(c *fiber.Ctx) error {
+		if metrics.FromContext(c.UserContext()) != m {
+			t.Error("Expected the Metrics in the user context")
+		}
+		if c.Params("id") == "forbidden" {
+			return fiber.ErrForbidden
+		}
+		return c.SendString("user")
+	})
+
+	for _, path := range []string{"/users/1", "/users/forbidden", "/missing"} {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	body := scrape(m)
+	for _, want := range []string{
+		`nexen_service_http_requests_total{method="GET",path="/users/:id",service="test"} 2`,
+		`nexen_service_http_errors_total{code="Forbidden",method="GET",path="/users/:id",service="test"} 1`,
+		`nexen_service_http_errors_total{code="Not Found",method="GET",path="unmatched",service="test"} 1`,
+		`nexen_service_http_response_size_bytes_sum{method="GET",path="/users/:id",service="test"} 4`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
+
+func scrape(m *metrics.Metrics) string {
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	return w.Body.String()
+}
@@ -0,0 +1,42 @@
+// Package ginmetrics records the standard HTTP metrics of a Metrics instance
+// for gin-gonic/gin routers.
+package ginmetrics
+
+import (
+	"github.com/gin-gonic/gin"
+	metrics "github.com/nexen-io/nexen-metrics"
+)
+
+// Middleware returns gin middleware recording every request in the HTTP
+// metrics of m, with the route template, such as /users/:id, as the path
+// label. Requests matching no route are recorded as "unmatched". Add it first
+// so it times the whole handler chain:
+//
+//	r := gin.New()
+//	r.Use(ginmetrics.Middleware(m))
+//
+// A handler panic is recorded with status 500 and counted with
+// WithPanicCapture, then left to the recovery middleware of the router.
+func Middleware(m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		o := m.StartRequest(c.Request)
+		c.Request = o.Request()
+		completed := false
+		defer func() {
+			// Size is -1 until the body is written
+			size := int64(c.Writer.Size())
+			if size < 0 {
+				size = 0
+			}
+			o.Finish(metrics.Response{
+				Route:       c.FullPath(),
+				Status:      c.Writer.Status(),
+				Size:        size,
+				ContentType: c.Writer.Header().Get("Content-Type"),
+				Panicked:    !completed,
+			})
+		}()
+		c.Next()
+		completed = true
+	}
+}
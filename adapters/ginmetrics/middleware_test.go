@@ -0,0 +1,80 @@
+package ginmetrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	metrics "github.com/nexen-io/nexen-metrics"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := metrics.New(metrics.WithServiceName("test"))
+	r := gin.New()
+	r.Use(Middleware(m))
+	r.GET("/users/:id", func(c *gin.Context) {
+		if metrics.FromContext(c.Request.Context()) != m {
+			t.Error("Expected the Metrics in the request context")
+		}
+		c.String(http.StatusOK, "user")
+	})
+	r.DELETE("/users/:id", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/users/1", nil),
+		httptest.NewRequest("GET", "/users/2", nil),
+		httptest.NewRequest("DELETE", "/users/2", nil),
+		httptest.NewRequest("GET", "/missing", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	body := scrape(m)
+	for _, want := range []string{
+		`nexen_service_http_requests_total{method="GET",path="/users/:id",service="test"} 2`,
+		`nexen_service_http_requests_total{method="DELETE",path="/users/:id",service="test"} 1`,
+		`nexen_service_http_errors_total{code="Not Found",method="GET",path="unmatched",service="test"} 1`,
+		`nexen_service_http_response_size_bytes_sum{method="GET",path="/users/:id",service="test"} 8`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := metrics.New(metrics.WithServiceName("test"), metrics.WithPanicCapture(false))
+	r := gin.New()
+	r.Use(gin.CustomRecoveryWithWriter(io.Discard, gin.RecoveryFunc(func(c *gin.Context, _ any) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})), Middleware(m))
+	r.GET("/boom", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/boom", nil))
+
+	body := scrape(m)
+	for _, want := range []string{
+		`nexen_service_http_in_flight_requests{service="test"} 0`,
+		`nexen_service_http_panics_total{path="/boom",service="test"} 1`,
+		`nexen_service_http_errors_total{code="Internal Server Error",method="GET",path="/boom",service="test"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
+
+func scrape(m *metrics.Metrics) string {
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	return w.Body.String()
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// WithAsyncRecording moves the metric updates performed by Instrument off the
+// request path. Each completed request is queued in a channel of bufferSize
+// observations, which a background goroutine applies to the HTTP metrics.
+//
+// This trades accuracy for latency: metrics lag behind requests by the queue
+// depth, and when the queue is full observations are dropped and counted in
+// nexen_service_metrics_dropped_total{source="http"} instead of blocking the
+// request. Requests completing after Close are recorded synchronously. Only use
+// it for extremely hot paths where profiling shows metric updates in
+// Instrument as a bottleneck.
+func WithAsyncRecording(bufferSize int) Option {
+	return func(m *Metrics) {
+		m.asyncBuffer = bufferSize
+	}
+}
+
+// asyncRecorder queues HTTP observations for a background goroutine.
+type asyncRecorder struct {
+	queue   chan httpObservation
+	dropped prometheus.Counter
+}
+
+// startAsyncRecording creates the recording queue and its consumer when
+// WithAsyncRecording is set. The consumer drains queued observations and exits
+// when the instance is closed.
+func (m *Metrics) startAsyncRecording() {
+	if m.asyncBuffer <= 0 {
+		return
+	}
+
+	a := &asyncRecorder{
+		queue:   make(chan httpObservation, m.asyncBuffer),
+		dropped: m.droppedCounter("http"),
+	}
+	m.asyncHTTP = a
+
+	m.goBackground(func() {
+		for {
+			select {
+			case obs := <-a.queue:
+				m.observeHTTP(obs)
+			case <-m.done:
+				for {
+					select {
+					case obs := <-a.queue:
+						m.observeHTTP(obs)
+					default:
+						return
+					}
+				}
+			}
+		}
+	})
+}
+
+// enqueueHTTP queues obs without blocking, dropping it if the queue is full.
+// Once m is closed, obs is recorded synchronously instead.
+func (m *Metrics) enqueueHTTP(obs httpObservation) {
+	// Queue under doneMu so that Close cannot stop the consumer between the
+	// check and the send, which would lose the observation
+	m.doneMu.RLock()
+	defer m.doneMu.RUnlock()
+	if m.closed() {
+		m.observeHTTP(obs)
+		return
+	}
+	select {
+	case m.asyncHTTP.queue <- obs:
+	default:
+		m.asyncHTTP.dropped.Inc()
+	}
+}
+
+// droppedCounter returns the child of nexen_service_metrics_dropped_total for
+// source, registering the vector on first use. It is only called from New.
+func (m *Metrics) droppedCounter(source string) prometheus.Counter {
+	if m.dropped == nil {
+		m.dropped = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "metrics_dropped_total",
+				Help:      "Total number of observations dropped because the recording queue was full",
+			},
+			[]string{"source", "service"},
+		)
+		m.mustRegister(m.dropped)
+	}
+	return m.dropped.WithLabelValues(source, m.serviceName)
+}
@@ -0,0 +1,97 @@
+package metrics
+
+// BackpressurePolicy selects what RecordEventAsync does when its queue is
+// full.
+type BackpressurePolicy int
+
+const (
+	// DropWhenFull drops the event and counts it in
+	// nexen_service_metrics_dropped_total{source="event"}, so callers never
+	// wait.
+	DropWhenFull BackpressurePolicy = iota
+	// BlockWhenFull waits for room in the queue, so no event is lost.
+	BlockWhenFull
+)
+
+// WithAsyncEvents makes RecordEventAsync queue events in a channel of
+// bufferSize events, which a background goroutine applies to the event
+// counters. policy decides whether events are dropped or callers wait when the
+// queue is full. Without this option RecordEventAsync records synchronously.
+func WithAsyncEvents(bufferSize int, policy BackpressurePolicy) Option {
+	return func(m *Metrics) {
+		m.eventBuffer = bufferSize
+		m.eventPolicy = policy
+	}
+}
+
+// startAsyncEvents creates the event queue and its consumer when
+// WithAsyncEvents is set. The consumer drains queued events and exits when the
+// instance is closed.
+func (m *Metrics) startAsyncEvents() {
+	if m.eventBuffer <= 0 {
+		return
+	}
+
+	queue := make(chan string, m.eventBuffer)
+	m.asyncEvents = queue
+	if m.eventPolicy == DropWhenFull {
+		m.eventsDropped = m.droppedCounter("event")
+	}
+
+	m.goBackground(func() {
+		for {
+			select {
+			case event := <-queue:
+				m.RecordEvent(event)
+			case <-m.done:
+				for {
+					select {
+					case event := <-queue:
+						m.RecordEvent(event)
+					default:
+						return
+					}
+				}
+			}
+		}
+	})
+}
+
+// RecordEventAsync is like RecordEvent but, with WithAsyncEvents, only queues
+// the event, so latency-critical paths do not touch Prometheus structures
+// inline. Queued events are counted by a background goroutine, shortly after
+// the call. After Close, events are recorded synchronously.
+func (m *Metrics) RecordEventAsync(event string) {
+	if m.asyncEvents == nil {
+		m.RecordEvent(event)
+		return
+	}
+
+	// Queue under doneMu so that Close cannot stop the consumer between the
+	// check and the send, which would lose the event
+	m.doneMu.RLock()
+	defer m.doneMu.RUnlock()
+	if m.closed() {
+		m.RecordEvent(event)
+		return
+	}
+	if m.eventPolicy == BlockWhenFull {
+		m.asyncEvents <- event
+		return
+	}
+	select {
+	case m.asyncEvents <- event:
+	default:
+		m.eventsDropped.Inc()
+	}
+}
+
+// closed reports whether Close was called.
+func (m *Metrics) closed() bool {
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
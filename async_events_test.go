@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecordEventAsync(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithAsyncEvents(64, BlockWhenFull))
+	for i := 0; i < 100; i++ {
+		metrics.RecordEventAsync("user_login")
+	}
+
+	// Close drains the queue before returning
+	if err := metrics.Close(context.Background()); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.applicationEvent.WithLabelValues("user_login", "test-service")); got != 100 {
+		t.Fatalf("Expected 100 events, got %v", got)
+	}
+}
+
+func TestRecordEventAsyncDropsWhenFull(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithAsyncEvents(1, DropWhenFull))
+	defer metrics.Close(context.Background())
+	// Replace the queue with one nobody consumes
+	metrics.asyncEvents = make(chan string, 1)
+
+	metrics.RecordEventAsync("user_login")
+	metrics.RecordEventAsync("user_login")
+
+	if got := testutil.ToFloat64(metrics.dropped.WithLabelValues("event", "test-service")); got != 1 {
+		t.Fatalf("Expected 1 dropped event, got %v", got)
+	}
+}
+
+func TestRecordEventAsyncWithoutQueue(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	metrics.RecordEventAsync("user_login")
+
+	if got := testutil.ToFloat64(metrics.applicationEvent.WithLabelValues("user_login", "test-service")); got != 1 {
+		t.Fatalf("Expected the event to be recorded synchronously, got %v", got)
+	}
+}
+
+func TestRecordEventAsyncDuringClose(t *testing.T) {
+	for _, policy := range []BackpressurePolicy{BlockWhenFull, DropWhenFull} {
+		metrics := New(WithServiceName("test-service"), WithAsyncEvents(1024, policy))
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 200; j++ {
+					metrics.RecordEventAsync("user_login")
+				}
+			}()
+		}
+		metrics.Close(context.Background())
+		wg.Wait()
+
+		// Every event is either counted or, when dropped, counted as dropped
+		recorded := testutil.ToFloat64(metrics.applicationEvent.WithLabelValues("user_login", "test-service"))
+		if policy == DropWhenFull {
+			recorded += testutil.ToFloat64(metrics.dropped.WithLabelValues("event", "test-service"))
+		}
+		if recorded != 800 {
+			t.Fatalf("Expected 800 events with policy %d, got %v", policy, recorded)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAsyncRecording(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithAsyncRecording(64))
+	handler := metrics.Instrument(http.NotFoundHandler())
+	for i := 0; i < 10; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/async", nil))
+	}
+
+	// Close drains the queue before returning
+	if err := metrics.Close(context.Background()); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	if got := testutil.ToFloat64(metrics.httpRequests.WithLabelValues("GET", "/async", "test-service")); got != 10 {
+		t.Fatalf("Expected 10 requests to be recorded, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.httpErrors.WithLabelValues("GET", "/async", "Not Found", "test-service")); got != 10 {
+		t.Fatalf("Expected 10 errors to be recorded, got %v", got)
+	}
+}
+
+func TestAsyncRecorderDropsWhenFull(t *testing.T) {
+	dropped := prometheus.NewCounter(prometheus.CounterOpts{Name: "dropped"})
+	// An instance without a consumer, so the queue stays full
+	metrics := New()
+	metrics.asyncHTTP = &asyncRecorder{queue: make(chan httpObservation, 1), dropped: dropped}
+
+	metrics.enqueueHTTP(httpObservation{})
+	metrics.enqueueHTTP(httpObservation{})
+
+	if got := testutil.ToFloat64(dropped); got != 1 {
+		t.Fatalf("Expected 1 dropped observation, got %v", got)
+	}
+}
+
+func TestAsyncRecordingAfterClose(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithAsyncRecording(64))
+	if err := metrics.Close(context.Background()); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	metrics.Instrument(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/late", nil))
+
+	if got := testutil.ToFloat64(metrics.httpRequests.WithLabelValues("GET", "/late", "test-service")); got != 1 {
+		t.Fatalf("Expected a request completing after Close to be recorded, got %v", got)
+	}
+}
+
+func BenchmarkInstrument(b *testing.B) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	req := httptest.NewRequest("GET", "/bench", nil)
+
+	b.Run("sync", func(b *testing.B) {
+		h := New().Instrument(handler)
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			w := httptest.NewRecorder()
+			for pb.Next() {
+				h.ServeHTTP(w, req)
+			}
+		})
+	})
+	b.Run("async", func(b *testing.B) {
+		m := New(WithAsyncRecording(4096))
+		defer m.Close(context.Background())
+		h := m.Instrument(handler)
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			w := httptest.NewRecorder()
+			for pb.Next() {
+				h.ServeHTTP(w, req)
+			}
+		})
+	})
+	b.Run("sharded", func(b *testing.B) {
+		m := New(WithShardedRecording())
+		defer m.Close(context.Background())
+		h := m.Instrument(handler)
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			w := httptest.NewRecorder()
+			for pb.Next() {
+				h.ServeHTTP(w, req)
+			}
+		})
+	})
+}
@@ -0,0 +1,15 @@
+package metrics
+
+// WithBatchSizeBuckets configures custom buckets for the batch size histogram.
+func WithBatchSizeBuckets(buckets []float64) Option {
+	return func(m *Metrics) {
+		m.batchSizeBuckets = buckets
+	}
+}
+
+// ObserveBatchSize records the number of items in a batch pulled from queue into
+// the nexen_service_batch_size histogram.
+func (m *Metrics) ObserveBatchSize(queue string, size int) {
+	m.touchSeries(seriesKey{group: seriesBatch, service: m.serviceName, a: queue})
+	m.batchSize.WithLabelValues(queue, m.serviceName).Observe(float64(size))
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Bridge periodically pushes the metrics exposed by Handler to a Graphite or
+// StatsD endpoint. It is created stopped; call Start to begin pushing. A
+// running bridge is also stopped by Metrics.Close.
+type Bridge struct {
+	m    *Metrics
+	run  func(ctx context.Context)
+	push func() error
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// Start begins pushing in the background. Calling Start on a running bridge
+// has no effect.
+func (b *Bridge) Start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	b.cancel, b.stopped = cancel, stopped
+
+	b.m.goBackground(func() {
+		defer close(stopped)
+		go func() {
+			select {
+			case <-b.m.done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		b.run(ctx)
+	})
+}
+
+// Stop stops pushing and waits for the background goroutine to exit. Calling
+// Stop on a stopped bridge has no effect.
+func (b *Bridge) Stop() {
+	b.mu.Lock()
+	cancel, stopped := b.cancel, b.stopped
+	b.cancel, b.stopped = nil, nil
+	b.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-stopped
+}
+
+// Push pushes the current metrics once, returning any error. It can be used
+// whether or not the bridge is running, for example to flush on shutdown.
+func (b *Bridge) Push() error {
+	return b.push()
+}
+
+// runEvery returns a Bridge run function calling push every interval. Errors
+// are dropped; callers needing them use Push.
+func runEvery(interval time.Duration, push func() error) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = push()
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"context"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBuildInfo(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	defer metrics.Close(context.Background())
+
+	if err := metrics.BuildInfo(); err != nil {
+		t.Fatalf("BuildInfo failed: %v", err)
+	}
+	if err := metrics.BuildInfo(); err == nil {
+		t.Error("Expected registering build info twice to fail")
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	want := `go_version="` + runtime.Version() + `",service="test-service",version=`
+	if !strings.Contains(w.Body.String(), want) {
+		t.Errorf("Expected build info with %q, got:\n%s", want, w.Body.String())
+	}
+}
+
+func TestWithConstLabels(t *testing.T) {
+	metrics := New(
+		WithServiceName("test-service"),
+		WithEnvironment("production"),
+		WithConstLabels(prometheus.Labels{"region": "eu-west", "environment": "ignored"}),
+	)
+	defer metrics.Close(context.Background())
+	metrics.RecordEvent("signup")
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	want := `nexen_service_application_events_total{environment="production",event="signup",region="eu-west",service="test-service"} 1`
+	if !strings.Contains(w.Body.String(), want) {
+		t.Errorf("Expected scrape to contain %q, got:\n%s", want, w.Body.String())
+	}
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// FamilyCardinality describes the number of series exposed by a metric family.
+type FamilyCardinality struct {
+	Name string `json:"name"`
+	// LabelSets is the number of distinct label combinations.
+	LabelSets int `json:"label_sets"`
+	// Series is the number of exposed time series, counting every histogram
+	// bucket and summary quantile separately.
+	Series int `json:"series"`
+}
+
+// CardinalityHandler returns a debug handler reporting the cardinality of each
+// metric family exposed by Handler, sorted by series count in descending order.
+// The response is JSON by default, or plain text with ?format=text.
+func (m *Metrics) CardinalityHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		families, err := m.gatherer.Gather()
+		if err != nil && len(families) == 0 {
+			http.Error(w, fmt.Sprintf("failed to gather metrics: %v", err), http.StatusInternalServerError)
+			return
+		}
+		report := cardinality(families)
+
+		if r.URL.Query().Get("format") == "text" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			for _, fc := range report {
+				fmt.Fprintf(w, "%s\t%d\t%d\n", fc.Name, fc.Series, fc.LabelSets)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
+
+// cardinality computes per-family cardinality, sorted by series count descending.
+func cardinality(families []*dto.MetricFamily) []FamilyCardinality {
+	report := make([]FamilyCardinality, 0, len(families))
+	for _, mf := range families {
+		fc := FamilyCardinality{Name: mf.GetName(), LabelSets: len(mf.GetMetric())}
+		for _, metric := range mf.GetMetric() {
+			fc.Series += seriesCount(mf.GetType(), metric)
+		}
+		report = append(report, fc)
+	}
+
+	sort.SliceStable(report, func(i, j int) bool {
+		if report[i].Series != report[j].Series {
+			return report[i].Series > report[j].Series
+		}
+		return report[i].Name < report[j].Name
+	})
+	return report
+}
+
+// seriesCount returns the number of time series a single metric expands to.
+func seriesCount(t dto.MetricType, metric *dto.Metric) int {
+	switch t {
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		// One series per bucket plus +Inf, _sum and _count
+		return len(metric.GetHistogram().GetBucket()) + 3
+	case dto.MetricType_SUMMARY:
+		// One series per quantile plus _sum and _count
+		return len(metric.GetSummary().GetQuantile()) + 2
+	default:
+		return 1
+	}
+}
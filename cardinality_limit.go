@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// overflowLabel replaces label values beyond the cardinality limit.
+const overflowLabel = "other"
+
+// Metrics whose label values are tracked by the cardinality limiter, used as
+// the metric label of its own metrics. The HTTP metrics share the method and
+// path labels of http_requests_total.
+const (
+	limitHTTP   = "http_requests_total"
+	limitEvents = "application_events_total"
+	limitGauges = "gauge"
+	limitErrors = "errors_total"
+)
+
+// WithMaxLabelCardinality limits the number of distinct values recorded for the
+// labels taking caller-controlled values: the method and path combinations of
+// the HTTP metrics, the events of RecordEvent, the names of SetGauge,
+// IncrementGauge and DecrementGauge, the error types of RecordError, and the
+// label value combinations of RecordEventWithLabels and SetGaugeWithLabels,
+// limited per metric. Once n values have been seen for a metric, new ones are
+// recorded as "other"; for the HTTP metrics only the path is replaced, for
+// labeled metrics every label value is. Values seen before the limit was
+// reached keep being recorded as is. Each service recorded through a
+// ServiceScope has its own budget of n values per metric.
+//
+// The number of tracked values is exposed in nexen_service_metric_cardinality
+// and observations recorded as "other" are counted in
+// nexen_service_metric_series_dropped_total, both labeled by metric and
+// service.
+func WithMaxLabelCardinality(n int) Option {
+	return func(m *Metrics) {
+		m.cardinalityLimit = n
+	}
+}
+
+// limitKey identifies the label values limited together: those of a metric
+// recorded for a service.
+type limitKey struct {
+	metric, service string
+}
+
+// cardinalityLimiter tracks the distinct label values recorded per metric and
+// service.
+type cardinalityLimiter struct {
+	limit   int
+	tracked *prometheus.GaugeVec
+	dropped *prometheus.CounterVec
+
+	mu   sync.RWMutex
+	seen map[limitKey]map[string]struct{}
+}
+
+// registerCardinalityLimit creates the limiter and its metrics if a limit is
+// configured.
+func (m *Metrics) registerCardinalityLimit() {
+	if m.cardinalityLimit <= 0 {
+		return
+	}
+
+	m.cardinality = &cardinalityLimiter{
+		limit: m.cardinalityLimit,
+		tracked: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "metric_cardinality",
+				Help:      "Number of distinct label values tracked by the cardinality limit",
+			},
+			[]string{"metric", "service"},
+		),
+		dropped: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "metric_series_dropped_total",
+				Help:      "Total number of observations recorded as other because the cardinality limit was reached",
+			},
+			[]string{"metric", "service"},
+		),
+		seen: make(map[limitKey]map[string]struct{}),
+	}
+	m.mustRegister(m.cardinality.tracked, m.cardinality.dropped)
+}
+
+// allow reports whether key may be recorded for metric and service, tracking
+// it if the limit has not been reached yet.
+func (l *cardinalityLimiter) allow(metric, service, key string) bool {
+	lk := limitKey{metric: metric, service: service}
+	l.mu.RLock()
+	_, ok := l.seen[lk][key]
+	l.mu.RUnlock()
+	if ok {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	values := l.seen[lk]
+	if _, ok := values[key]; ok {
+		return true
+	}
+	if len(values) >= l.limit {
+		l.dropped.WithLabelValues(metric, service).Inc()
+		return false
+	}
+	if values == nil {
+		values = make(map[string]struct{})
+		l.seen[lk] = values
+	}
+	values[key] = struct{}{}
+	l.tracked.WithLabelValues(metric, service).Set(float64(len(values)))
+	return true
+}
+
+// forget stops tracking key for metric and service, freeing its slot once the
+// series recording it has been deleted.
+func (l *cardinalityLimiter) forget(metric, service, key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	values := l.seen[limitKey{metric: metric, service: service}]
+	if _, ok := values[key]; !ok {
+		return
+	}
+	delete(values, key)
+	l.tracked.WithLabelValues(metric, service).Set(float64(len(values)))
+}
+
+// limitLabel returns value if it may be recorded for metric and service, or
+// "other".
+func (m *Metrics) limitLabel(metric, service, value string) string {
+	if m.cardinality == nil || m.cardinality.allow(metric, service, value) {
+		return value
+	}
+	return overflowLabel
+}
+
+// forgetLabel stops tracking value for metric and service, see
+// cardinalityLimiter.forget.
+func (m *Metrics) forgetLabel(metric, service, value string) {
+	if m.cardinality != nil {
+		m.cardinality.forget(metric, service, value)
+	}
+}
+
+// limitPath returns path if its combination with method may be recorded by the
+// HTTP metrics of service, or "other".
+func (m *Metrics) limitPath(method, service, path string) string {
+	if m.cardinality == nil || m.cardinality.allow(limitHTTP, service, method+" "+path) {
+		return path
+	}
+	return overflowLabel
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMaxLabelCardinality(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithMaxLabelCardinality(2))
+
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, path := range []string{"/a", "/b", "/c", "/a", "/d"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	for _, event := range []string{"signup", "login", "logout", "signup"} {
+		metrics.RecordEvent(event)
+	}
+
+	expected := `
+# HELP nexen_service_http_requests_total Total number of HTTP requests received
+# TYPE nexen_service_http_requests_total counter
+nexen_service_http_requests_total{method="GET",path="/a",service="test-service"} 2
+nexen_service_http_requests_total{method="GET",path="/b",service="test-service"} 1
+nexen_service_http_requests_total{method="GET",path="other",service="test-service"} 2
+# HELP nexen_service_application_events_total Count of application-specific events
+# TYPE nexen_service_application_events_total counter
+nexen_service_application_events_total{event="login",service="test-service"} 1
+nexen_service_application_events_total{event="other",service="test-service"} 1
+nexen_service_application_events_total{event="signup",service="test-service"} 2
+# HELP nexen_service_metric_cardinality Number of distinct label values tracked by the cardinality limit
+# TYPE nexen_service_metric_cardinality gauge
+nexen_service_metric_cardinality{metric="application_events_total",service="test-service"} 2
+nexen_service_metric_cardinality{metric="http_requests_total",service="test-service"} 2
+# HELP nexen_service_metric_series_dropped_total Total number of observations recorded as other because the cardinality limit was reached
+# TYPE nexen_service_metric_series_dropped_total counter
+nexen_service_metric_series_dropped_total{metric="application_events_total",service="test-service"} 1
+nexen_service_metric_series_dropped_total{metric="http_requests_total",service="test-service"} 2
+`
+	if err := testutil.GatherAndCompare(metrics.Registry(), strings.NewReader(expected),
+		"nexen_service_http_requests_total",
+		"nexen_service_application_events_total",
+		"nexen_service_metric_cardinality",
+		"nexen_service_metric_series_dropped_total",
+	); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMaxLabelCardinalityGaugesAndErrors(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithMaxLabelCardinality(1))
+
+	metrics.SetGauge("queue_depth", 3)
+	metrics.SetGauge("workers", 4)
+	metrics.RecordError(errors.New("boom"))
+	metrics.RecordError(&httpError{})
+
+	if got := testutil.ToFloat64(metrics.serviceGauge.WithLabelValues("other", "test-service")); got != 4 {
+		t.Errorf("Expected overflowing gauge to be recorded as other, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.applicationError.WithLabelValues("other", "test-service")); got != 1 {
+		t.Errorf("Expected overflowing error type to be recorded as other, got %v", got)
+	}
+}
+
+func TestWithoutMaxLabelCardinality(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	for _, event := range []string{"a", "b", "c"} {
+		metrics.RecordEvent(event)
+	}
+
+	if got := testutil.CollectAndCount(metrics.applicationEvent); got != 3 {
+		t.Errorf("Expected 3 event series without a limit, got %d", got)
+	}
+	if metrics.cardinality != nil {
+		t.Error("Expected no cardinality limiter without WithMaxLabelCardinality")
+	}
+}
+
+type httpError struct{}
+
+func (*httpError) Error() string { return "http error" }
+
+func TestMaxLabelCardinalityPerService(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithMaxLabelCardinality(1))
+	noisy, quiet := metrics.ForService("noisy"), metrics.ForService("quiet")
+
+	noisyHandler := noisy.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, path := range []string{"/a", "/b", "/c"} {
+		noisyHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	quiet.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/z", nil))
+	noisy.RecordEvent("signup")
+	noisy.RecordEvent("login")
+	quiet.RecordEvent("logout")
+
+	expected := `
+# HELP nexen_service_http_requests_total Total number of HTTP requests received
+# TYPE nexen_service_http_requests_total counter
+nexen_service_http_requests_total{method="GET",path="/a",service="noisy"} 1
+nexen_service_http_requests_total{method="GET",path="other",service="noisy"} 2
+nexen_service_http_requests_total{method="GET",path="/z",service="quiet"} 1
+# HELP nexen_service_application_events_total Count of application-specific events
+# TYPE nexen_service_application_events_total counter
+nexen_service_application_events_total{event="other",service="noisy"} 1
+nexen_service_application_events_total{event="signup",service="noisy"} 1
+nexen_service_application_events_total{event="logout",service="quiet"} 1
+# HELP nexen_service_metric_series_dropped_total Total number of observations recorded as other because the cardinality limit was reached
+# TYPE nexen_service_metric_series_dropped_total counter
+nexen_service_metric_series_dropped_total{metric="application_events_total",service="noisy"} 1
+nexen_service_metric_series_dropped_total{metric="http_requests_total",service="noisy"} 2
+`
+	if err := testutil.GatherAndCompare(metrics.Registry(), strings.NewReader(expected),
+		"nexen_service_http_requests_total",
+		"nexen_service_application_events_total",
+		"nexen_service_metric_series_dropped_total",
+	); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCardinalityHandler(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	for _, event := range []string{"a", "b", "c"} {
+		metrics.RecordEvent(event)
+	}
+	metrics.SetGauge("depth", 1)
+
+	w := httptest.NewRecorder()
+	metrics.CardinalityHandler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/cardinality", nil))
+
+	var report []FamilyCardinality
+	if err := json.NewDecoder(w.Result().Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+
+	byName := make(map[string]FamilyCardinality)
+	for i, fc := range report {
+		if i > 0 && fc.Series > report[i-1].Series {
+			t.Fatal("Expected report to be sorted by series count descending")
+		}
+		byName[fc.Name] = fc
+	}
+	if got := byName["nexen_service_application_events_total"]; got.LabelSets != 3 || got.Series != 3 {
+		t.Fatalf("Expected 3 event series, got %+v", got)
+	}
+	if got := byName["nexen_service_gauge"]; got.Series != 1 {
+		t.Fatalf("Expected 1 gauge series, got %+v", got)
+	}
+}
+
+func TestCardinalityHandlerText(t *testing.T) {
+	metrics := New()
+	metrics.ObserveDuration("sync", 0)
+
+	w := httptest.NewRecorder()
+	metrics.CardinalityHandler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/cardinality?format=text", nil))
+	body, _ := io.ReadAll(w.Result().Body)
+
+	// 11 default buckets plus +Inf, _sum and _count
+	if !strings.Contains(string(body), "nexen_service_sync_duration_seconds\t14\t1\n") {
+		t.Fatalf("Expected text report to list histogram series, got:\n%s", body)
+	}
+}
@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithClientPhaseMetrics enables DNS, connect, TLS handshake and time-to-first-byte
+// histograms for transports wrapped by InstrumentRoundTripper. Phase timings are
+// opt-in because attaching a client trace adds overhead to every outbound request.
+func WithClientPhaseMetrics() Option {
+	return func(m *Metrics) {
+		m.clientPhases = true
+	}
+}
+
+// clientPhaseMetrics holds the outbound request phase histograms.
+type clientPhaseMetrics struct {
+	dns     *prometheus.HistogramVec
+	connect *prometheus.HistogramVec
+	tls     *prometheus.HistogramVec
+	ttfb    *prometheus.HistogramVec
+}
+
+// clientMetrics holds the outbound request metrics recorded for every request.
+type clientMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+// registerClientMetrics creates and registers the outbound HTTP client metrics.
+// Phase histograms are only registered if enabled through options.
+func (m *Metrics) registerClientMetrics() {
+	m.client = &clientMetrics{
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "http_client_requests_total",
+				Help:      "Total number of outbound HTTP requests",
+			},
+			[]string{"host", "method", "service"},
+		),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "http_client_request_duration_seconds",
+				Help:      "Histogram of outbound HTTP request durations until the response headers are received",
+				Buckets:   m.histogramBuckets,
+			},
+			[]string{"host", "method", "service"},
+		),
+		errors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "http_client_errors_total",
+				Help:      "Total number of outbound HTTP requests that failed or received an error status",
+			},
+			[]string{"host", "method", "code", "service"},
+		),
+	}
+	m.mustRegister(m.client.requests, m.client.duration, m.client.errors)
+
+	if !m.clientPhases {
+		return
+	}
+
+	phase := func(name, help string) *prometheus.HistogramVec {
+		h := prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      name,
+				Help:      help,
+				Buckets:   m.histogramBuckets,
+			},
+			[]string{"host", "service"},
+		)
+		m.mustRegister(h)
+		return h
+	}
+
+	m.clientPhase = &clientPhaseMetrics{
+		dns:     phase("http_client_dns_seconds", "Histogram of outbound HTTP DNS lookup durations"),
+		connect: phase("http_client_connect_seconds", "Histogram of outbound HTTP connection establishment durations"),
+		tls:     phase("http_client_tls_seconds", "Histogram of outbound HTTP TLS handshake durations"),
+		ttfb:    phase("http_client_ttfb_seconds", "Histogram of outbound HTTP time to first response byte"),
+	}
+}
+
+// InstrumentRoundTripper wraps an http.RoundTripper to collect metrics about
+// outbound requests, labeled by host and method: request counts, durations
+// until the response headers are received, and errors. Requests failing in the
+// transport are counted as errors with code "error", responses with a status
+// of 400 or above with their status code. If next is nil, http.DefaultTransport
+// is used.
+func (m *Metrics) InstrumentRoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		host := r.URL.Host
+		if m.clientPhase != nil {
+			trace := m.clientPhase.trace(host, m.serviceName, m.now)
+			r = r.WithContext(httptrace.WithClientTrace(r.Context(), trace))
+		}
+
+		start := m.now()
+		resp, err := next.RoundTrip(r)
+		m.client.requests.WithLabelValues(host, r.Method, m.serviceName).Inc()
+		m.client.duration.WithLabelValues(host, r.Method, m.serviceName).Observe(m.since(start).Seconds())
+		switch {
+		case err != nil:
+			m.client.errors.WithLabelValues(host, r.Method, "error", m.serviceName).Inc()
+		case resp.StatusCode >= 400:
+			m.client.errors.WithLabelValues(host, r.Method, m.codeLabel(resp.StatusCode), m.serviceName).Inc()
+		}
+		return resp, err
+	})
+}
+
+// trace returns a client trace observing connection phases for a single request.
+// Hooks may fire concurrently when dialing multiple addresses, so the start
+// timestamps are guarded by a mutex. Phases are timed with now.
+func (p *clientPhaseMetrics) trace(host, service string, now func() time.Time) *httptrace.ClientTrace {
+	var (
+		mu                               sync.Mutex
+		dnsStart, connectStart, tlsStart time.Time
+	)
+	start := now()
+
+	mark := func(t *time.Time) {
+		mu.Lock()
+		*t = now()
+		mu.Unlock()
+	}
+	observe := func(h *prometheus.HistogramVec, from *time.Time) {
+		mu.Lock()
+		began := *from
+		mu.Unlock()
+		if !began.IsZero() {
+			h.WithLabelValues(host, service).Observe(now().Sub(began).Seconds())
+		}
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart:     func(httptrace.DNSStartInfo) { mark(&dnsStart) },
+		DNSDone:      func(httptrace.DNSDoneInfo) { observe(p.dns, &dnsStart) },
+		ConnectStart: func(_, _ string) { mark(&connectStart) },
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				observe(p.connect, &connectStart)
+			}
+		},
+		TLSHandshakeStart: func() { mark(&tlsStart) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				observe(p.tls, &tlsStart)
+			}
+		},
+		GotFirstResponseByte: func() {
+			p.ttfb.WithLabelValues(host, service).Observe(now().Sub(start).Seconds())
+		},
+	}
+}
+
+// roundTripperFunc adapts a function to the http.RoundTripper interface.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(r).
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Client classes recorded in the client_class label.
+const (
+	ClientInternal = "internal"
+	ClientExternal = "external"
+	ClientUnknown  = "unknown"
+)
+
+// WithClientClassifier adds a client_class label to http_requests_total whose
+// value is computed by classify for each request. To bound cardinality, results
+// other than ClientInternal, ClientExternal and ClientUnknown are recorded as
+// ClientUnknown. DefaultClientClassifier covers the common case.
+func WithClientClassifier(classify func(*http.Request) string) Option {
+	return func(m *Metrics) {
+		m.clientClassifier = classify
+	}
+}
+
+// DefaultClientClassifier classifies a request as internal when the originating
+// address is private (RFC 1918, IPv6 unique local) or loopback, and external
+// otherwise. The first X-Forwarded-For entry takes precedence over RemoteAddr;
+// since clients can set that header freely, only use this behind a proxy that
+// overwrites it.
+func DefaultClientClassifier(r *http.Request) string {
+	host := r.RemoteAddr
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		host, _, _ = strings.Cut(xff, ",")
+		host = strings.TrimSpace(host)
+	} else if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return ClientUnknown
+	}
+	addr = addr.Unmap()
+	if addr.IsPrivate() || addr.IsLoopback() {
+		return ClientInternal
+	}
+	return ClientExternal
+}
+
+// clientClass classifies a request, collapsing unexpected values to ClientUnknown.
+func (m *Metrics) clientClass(r *http.Request) string {
+	switch class := m.clientClassifier(r); class {
+	case ClientInternal, ClientExternal:
+		return class
+	default:
+		return ClientUnknown
+	}
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDefaultClientClassifier(t *testing.T) {
+	cases := []struct {
+		remoteAddr string
+		xff        string
+		want       string
+	}{
+		{"10.1.2.3:1234", "", ClientInternal},
+		{"192.168.0.10:80", "", ClientInternal},
+		{"172.16.5.4:80", "", ClientInternal},
+		{"127.0.0.1:80", "", ClientInternal},
+		{"[fd00::1]:80", "", ClientInternal},
+		{"8.8.8.8:53", "", ClientExternal},
+		{"10.0.0.1:80", "203.0.113.7, 10.0.0.2", ClientExternal},
+		{"8.8.8.8:80", "192.168.1.1", ClientInternal},
+		{"garbage", "", ClientUnknown},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remoteAddr
+		if c.xff != "" {
+			r.Header.Set("X-Forwarded-For", c.xff)
+		}
+		if got := DefaultClientClassifier(r); got != c.want {
+			t.Errorf("DefaultClientClassifier(%q, %q) = %q, want %q", c.remoteAddr, c.xff, got, c.want)
+		}
+	}
+}
+
+func TestInstrumentClientClass(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithClientClassifier(func(r *http.Request) string {
+		return r.Header.Get("X-Class")
+	}))
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, class := range []string{"internal", "external", "partner"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Class", class)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Result().Body)
+	bodyStr := string(body)
+
+	for _, want := range []string{
+		`nexen_service_http_requests_total{client_class="internal",method="GET",path="/",service="test-service"} 1`,
+		`nexen_service_http_requests_total{client_class="external",method="GET",path="/",service="test-service"} 1`,
+		`nexen_service_http_requests_total{client_class="unknown",method="GET",path="/",service="test-service"} 1`,
+	} {
+		if !strings.Contains(bodyStr, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
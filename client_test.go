@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentRoundTripperPhases(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	metrics := New(WithServiceName("test-service"), WithClientPhaseMetrics())
+	client := &http.Client{Transport: metrics.InstrumentRoundTripper(server.Client().Transport)}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Result().Body)
+
+	for _, name := range []string{
+		"nexen_service_http_client_connect_seconds_count",
+		"nexen_service_http_client_tls_seconds_count",
+		"nexen_service_http_client_ttfb_seconds_count",
+	} {
+		if !strings.Contains(string(body), name) {
+			t.Errorf("Expected metrics to contain %s", name)
+		}
+	}
+}
+
+func TestInstrumentRoundTripperWithoutPhases(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	metrics := New(WithServiceName("test-service"))
+	client := &http.Client{Transport: metrics.InstrumentRoundTripper(nil)}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Result().Body)
+
+	if strings.Contains(string(body), "nexen_service_http_client_ttfb_seconds") {
+		t.Fatal("Expected phase metrics to be disabled by default")
+	}
+}
+
+func TestInstrumentRoundTripperRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	metrics := New(WithServiceName("test-service"), WithStatusCodeGranularity(StatusCodeExact))
+	client := &http.Client{Transport: metrics.InstrumentRoundTripper(nil)}
+
+	for _, path := range []string{"/", "/missing"} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if _, err := client.Get("http://127.0.0.1:1/"); err == nil {
+		t.Fatal("Expected request to a closed port to fail")
+	}
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	if got := testutil.ToFloat64(metrics.client.requests.WithLabelValues(host, "GET", "test-service")); got != 2 {
+		t.Fatalf("Expected 2 requests to the test server, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.client.errors.WithLabelValues(host, "GET", "404", "test-service")); got != 1 {
+		t.Fatalf("Expected 1 404 error, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.client.errors.WithLabelValues("127.0.0.1:1", "GET", "error", "test-service")); got != 1 {
+		t.Fatalf("Expected 1 transport error, got %v", got)
+	}
+	if n := testutil.CollectAndCount(metrics.client.duration); n != 2 {
+		t.Fatalf("Expected 2 duration series, got %d", n)
+	}
+}
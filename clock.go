@@ -0,0 +1,25 @@
+package metrics
+
+import "time"
+
+// WithClock sets the clock that request, timer, outbound request, LLM,
+// connection, database and gRPC call durations, Server-Timing headers,
+// snapshot timestamps and the ages of WithMetricTTL label sets are measured
+// with. It defaults to time.Now. Tests can
+// pass a fake clock, such as metricstest.Clock, to record exact durations.
+func WithClock(now func() time.Time) Option {
+	return func(m *Metrics) {
+		m.now = now
+	}
+}
+
+// Now returns the current time on the clock set with WithClock, for packages
+// measuring durations recorded through m.
+func (m *Metrics) Now() time.Time {
+	return m.now()
+}
+
+// since returns the time elapsed since start on the clock of m.
+func (m *Metrics) since(start time.Time) time.Duration {
+	return m.now().Sub(start)
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestWithClock(t *testing.T) {
+	now := time.Unix(0, 0)
+	clock := func() time.Time { return now }
+	metrics := New(WithServiceName("test-service"), WithClock(clock))
+
+	timer := metrics.Timer("refresh")
+	now = now.Add(2 * time.Second)
+	if got := timer.Stop(); got != 2*time.Second {
+		t.Errorf("Expected the timer to measure 2s on the clock, got %v", got)
+	}
+
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now = now.Add(100 * time.Millisecond)
+		MarkHandlerStart(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now = now.Add(400 * time.Millisecond)
+		})).ServeHTTP(w, r)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/orders", nil))
+
+	if got := testutil.ToFloat64(metrics.httpRequests.WithLabelValues("GET", "/orders", "test-service")); got != 1 {
+		t.Fatalf("Expected 1 request, got %v", got)
+	}
+	sum := func(name string) float64 {
+		families, err := metrics.gatherer.Gather()
+		if err != nil {
+			t.Fatalf("Gather: %v", err)
+		}
+		for _, mf := range families {
+			if mf.GetName() == name {
+				return mf.GetMetric()[0].GetHistogram().GetSampleSum()
+			}
+		}
+		t.Fatalf("Expected %s to be exposed", name)
+		return 0
+	}
+	if got := sum("nexen_service_refresh_duration_seconds"); got != 2 {
+		t.Errorf("Expected the timer to record 2s, got %v", got)
+	}
+	if got := sum("nexen_service_http_request_duration_seconds"); got != 0.5 {
+		t.Errorf("Expected the request to take 0.5s, got %v", got)
+	}
+	if got := sum("nexen_service_http_middleware_seconds"); got != 0.1 {
+		t.Errorf("Expected 0.1s in middleware, got %v", got)
+	}
+}
+
+func TestWithClockServerTimingAndSnapshot(t *testing.T) {
+	now := time.Unix(100, 0)
+	metrics := New(WithServerTiming(), WithClock(func() time.Time { return now }))
+
+	rec := httptest.NewRecorder()
+	metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now = now.Add(250 * time.Millisecond)
+	})).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if got := rec.Header().Get("Server-Timing"); got != "total;dur=250.000" {
+		t.Errorf("Expected Server-Timing to use the clock, got %q", got)
+	}
+
+	snapshot, err := metrics.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if !snapshot.Timestamp.Equal(now) {
+		t.Errorf("Expected the snapshot timestamp %v, got %v", now, snapshot.Timestamp)
+	}
+}
@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix is the prefix of the environment variables read by FromEnv.
+const envPrefix = "NEXEN_METRICS_"
+
+// WithListenAddress sets the address Serve listens on, overriding the
+// -metrics.listen-address flag.
+func WithListenAddress(addr string) Option {
+	return func(m *Metrics) {
+		m.serveAddr = addr
+	}
+}
+
+// WithMetricsPath sets the path Serve exposes Handler at, overriding the
+// -metrics.path flag.
+func WithMetricsPath(path string) Option {
+	return func(m *Metrics) {
+		m.servePath = path
+	}
+}
+
+// Config holds the common settings of a Metrics instance as plain values, for
+// services configured through files or the environment rather than flags and
+// options. Zero values keep the defaults.
+type Config struct {
+	// ListenAddress is the address Serve listens on, e.g. ":9090" or
+	// "unix:///run/app/metrics.sock".
+	ListenAddress string
+	// Path is the path Serve exposes the metrics at, e.g. "/metrics".
+	Path string
+	// ServiceName is the value of the service label.
+	ServiceName string
+	// Environment is the value of the environment label.
+	Environment string
+	// Buckets are the HTTP duration histogram buckets, in increasing order.
+	Buckets []float64
+	// PathDepthLimit truncates the path label, see WithPathDepthLimit.
+	PathDepthLimit int
+	// MaxLabelCardinality limits label values, see WithMaxLabelCardinality.
+	MaxLabelCardinality int
+	// MetricTTL expires label sets, see WithMetricTTL.
+	MetricTTL time.Duration
+}
+
+// Validate reports every invalid setting of c.
+func (c Config) Validate() error {
+	var errs []error
+	if c.ListenAddress != "" {
+		if err := validListenAddress(c.ListenAddress); err != nil {
+			errs = append(errs, fmt.Errorf("invalid listen address %q: %w", c.ListenAddress, err))
+		}
+	}
+	if c.Path != "" && !strings.HasPrefix(c.Path, "/") {
+		errs = append(errs, fmt.Errorf("invalid path %q: must start with /", c.Path))
+	}
+	for i := 1; i < len(c.Buckets); i++ {
+		if c.Buckets[i] <= c.Buckets[i-1] {
+			errs = append(errs, fmt.Errorf("invalid buckets %v: must be in increasing order", c.Buckets))
+			break
+		}
+	}
+	if c.PathDepthLimit < 0 {
+		errs = append(errs, fmt.Errorf("invalid path depth limit %d: must not be negative", c.PathDepthLimit))
+	}
+	if c.MaxLabelCardinality < 0 {
+		errs = append(errs, fmt.Errorf("invalid max label cardinality %d: must not be negative", c.MaxLabelCardinality))
+	}
+	if c.MetricTTL < 0 {
+		errs = append(errs, fmt.Errorf("invalid metric TTL %v: must not be negative", c.MetricTTL))
+	}
+	return errors.Join(errs...)
+}
+
+// Options returns the options applying the non-zero settings of c.
+func (c Config) Options() []Option {
+	var opts []Option
+	if c.ListenAddress != "" {
+		opts = append(opts, WithListenAddress(c.ListenAddress))
+	}
+	if c.Path != "" {
+		opts = append(opts, WithMetricsPath(c.Path))
+	}
+	if c.ServiceName != "" {
+		opts = append(opts, WithServiceName(c.ServiceName))
+	}
+	if c.Environment != "" {
+		opts = append(opts, WithEnvironment(c.Environment))
+	}
+	if len(c.Buckets) > 0 {
+		opts = append(opts, WithHistogramBuckets(c.Buckets))
+	}
+	if c.PathDepthLimit > 0 {
+		opts = append(opts, WithPathDepthLimit(c.PathDepthLimit))
+	}
+	if c.MaxLabelCardinality > 0 {
+		opts = append(opts, WithMaxLabelCardinality(c.MaxLabelCardinality))
+	}
+	if c.MetricTTL > 0 {
+		opts = append(opts, WithMetricTTL(c.MetricTTL))
+	}
+	return opts
+}
+
+// NewFromConfig validates cfg and constructs a Metrics instance from it. opts
+// are applied after the settings of cfg, so they take precedence.
+func NewFromConfig(cfg Config, opts ...Option) (*Metrics, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid metrics config: %w", err)
+	}
+	return New(append(cfg.Options(), opts...)...), nil
+}
+
+// FromEnv reads a Config from the NEXEN_METRICS_* environment variables:
+//
+//	NEXEN_METRICS_LISTEN_ADDRESS          e.g. ":9090"
+//	NEXEN_METRICS_PATH                    e.g. "/metrics"
+//	NEXEN_METRICS_SERVICE_NAME
+//	NEXEN_METRICS_ENVIRONMENT
+//	NEXEN_METRICS_BUCKETS                 comma-separated, e.g. "0.1,0.5,1"
+//	NEXEN_METRICS_PATH_DEPTH_LIMIT
+//	NEXEN_METRICS_MAX_LABEL_CARDINALITY
+//	NEXEN_METRICS_TTL                     a duration, e.g. "1h"
+//
+// Unset variables keep their defaults. Values that cannot be parsed or are
+// invalid are reported together in the returned error.
+func FromEnv() (Config, error) {
+	cfg := Config{
+		ListenAddress: os.Getenv(envPrefix + "LISTEN_ADDRESS"),
+		Path:          os.Getenv(envPrefix + "PATH"),
+		ServiceName:   os.Getenv(envPrefix + "SERVICE_NAME"),
+		Environment:   os.Getenv(envPrefix + "ENVIRONMENT"),
+	}
+
+	var errs []error
+	if v := os.Getenv(envPrefix + "BUCKETS"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			b, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %sBUCKETS: %w", envPrefix, err))
+				break
+			}
+			cfg.Buckets = append(cfg.Buckets, b)
+		}
+	}
+	for _, setting := range []struct {
+		name string
+		dst  *int
+	}{
+		{"PATH_DEPTH_LIMIT", &cfg.PathDepthLimit},
+		{"MAX_LABEL_CARDINALITY", &cfg.MaxLabelCardinality},
+	} {
+		if v := os.Getenv(envPrefix + setting.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s%s: %w", envPrefix, setting.name, err))
+			}
+			*setting.dst = n
+		}
+	}
+	if v := os.Getenv(envPrefix + "TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %sTTL: %w", envPrefix, err))
+		}
+		cfg.MetricTTL = ttl
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
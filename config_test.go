@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("NEXEN_METRICS_LISTEN_ADDRESS", ":9090")
+	t.Setenv("NEXEN_METRICS_PATH", "/internal/metrics")
+	t.Setenv("NEXEN_METRICS_SERVICE_NAME", "orders")
+	t.Setenv("NEXEN_METRICS_BUCKETS", "0.1, 0.5,1")
+	t.Setenv("NEXEN_METRICS_PATH_DEPTH_LIMIT", "3")
+	t.Setenv("NEXEN_METRICS_TTL", "1h")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	want := Config{
+		ListenAddress:  ":9090",
+		Path:           "/internal/metrics",
+		ServiceName:    "orders",
+		Buckets:        []float64{0.1, 0.5, 1},
+		PathDepthLimit: 3,
+		MetricTTL:      time.Hour,
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("FromEnv() = %+v, want %+v", cfg, want)
+	}
+
+	metrics, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewFromConfig: %v", err)
+	}
+	if metrics.ServiceName() != "orders" || metrics.serveAddr != ":9090" || metrics.servePath != "/internal/metrics" {
+		t.Errorf("Expected config to be applied, got service %q, address %q, path %q",
+			metrics.ServiceName(), metrics.serveAddr, metrics.servePath)
+	}
+	if !reflect.DeepEqual(metrics.HistogramBuckets(), want.Buckets) {
+		t.Errorf("Expected buckets %v, got %v", want.Buckets, metrics.HistogramBuckets())
+	}
+}
+
+func TestFromEnvErrors(t *testing.T) {
+	t.Setenv("NEXEN_METRICS_BUCKETS", "0.1,fast")
+	t.Setenv("NEXEN_METRICS_MAX_LABEL_CARDINALITY", "many")
+	t.Setenv("NEXEN_METRICS_TTL", "1 hour")
+
+	_, err := FromEnv()
+	if err == nil {
+		t.Fatal("Expected an error for unparsable variables")
+	}
+	for _, name := range []string{"NEXEN_METRICS_BUCKETS", "NEXEN_METRICS_MAX_LABEL_CARDINALITY", "NEXEN_METRICS_TTL"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected error to mention %s, got %v", name, err)
+		}
+	}
+}
+
+func TestNewFromConfigInvalid(t *testing.T) {
+	_, err := NewFromConfig(Config{
+		ListenAddress: "9090",
+		Path:          "metrics",
+		Buckets:       []float64{1, 0.5},
+		MetricTTL:     -time.Second,
+	})
+	if err == nil {
+		t.Fatal("Expected an error for an invalid config")
+	}
+	for _, want := range []string{"listen address", "path", "buckets", "metric TTL"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %s, got %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nexen-io/nexen-metrics/internal"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Values of the protocol label of the connection metrics.
+const (
+	protocolWebSocket = "websocket"
+	protocolSSE       = "sse"
+)
+
+// connectionMetrics are the metrics of long-lived connections, registered on
+// the first call to InstrumentWebSocket or InstrumentSSE.
+type connectionMetrics struct {
+	active   *prometheus.GaugeVec
+	duration *prometheus.HistogramVec
+	messages *prometheus.CounterVec
+	abnormal *prometheus.CounterVec
+}
+
+// connectionMetrics returns the connection metrics, registering them on first use.
+func (m *Metrics) connectionMetrics() *connectionMetrics {
+	m.lazyMu.Lock()
+	defer m.lazyMu.Unlock()
+
+	if m.connections != nil {
+		return m.connections
+	}
+
+	connections := &connectionMetrics{
+		active: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "connections_active",
+				Help:      "Number of open WebSocket and server-sent events connections",
+			},
+			[]string{"protocol", "path", "service"},
+		),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "connection_duration_seconds",
+				Help:      "Histogram of the lifetimes of WebSocket and server-sent events connections",
+				Buckets:   internal.DefaultConnectionDurationBuckets(),
+			},
+			[]string{"protocol", "path", "service"},
+		),
+		messages: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "connection_messages_total",
+				Help:      "Total number of messages sent and received over WebSocket and server-sent events connections",
+			},
+			[]string{"protocol", "path", "direction", "service"},
+		),
+		abnormal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "connection_abnormal_closes_total",
+				Help:      "Total number of WebSocket and server-sent events connections closed abnormally",
+			},
+			[]string{"protocol", "path", "reason", "service"},
+		),
+	}
+	m.mustRegister(connections.active, connections.duration, connections.messages, connections.abnormal)
+	m.connections = connections
+	return connections
+}
+
+// Connection records the messages of a connection served by InstrumentWebSocket
+// or InstrumentSSE. Obtain it with ConnectionFromContext. Its methods are safe
+// for concurrent use and do nothing on a nil Connection, so handlers can be
+// served without instrumentation.
+type Connection struct {
+	metrics  *connectionMetrics
+	protocol string
+	path     string
+	service  string
+	now      func() time.Time
+	sent     prometheus.Counter
+	received prometheus.Counter
+
+	start    time.Time
+	opened   atomic.Bool
+	closed   sync.Once
+	abnormal atomic.Bool
+}
+
+// ConnectionFromContext returns the connection of a request served by
+// InstrumentWebSocket or InstrumentSSE, or nil for other requests.
+func ConnectionFromContext(ctx context.Context) *Connection {
+	conn, _ := ctx.Value(connectionKey).(*Connection)
+	return conn
+}
+
+func (c *connectionMetrics) newConnection(protocol, path, service string, now func() time.Time) *Connection {
+	return &Connection{
+		metrics:  c,
+		protocol: protocol,
+		path:     path,
+		service:  service,
+		now:      now,
+		sent:     c.messages.WithLabelValues(protocol, path, "sent", service),
+		received: c.messages.WithLabelValues(protocol, path, "received", service),
+	}
+}
+
+// MessageSent counts a message sent to the client.
+func (c *Connection) MessageSent() {
+	if c != nil {
+		c.sent.Inc()
+	}
+}
+
+// MessageReceived counts a message received from the client.
+func (c *Connection) MessageReceived() {
+	if c != nil {
+		c.received.Inc()
+	}
+}
+
+// Abnormal counts the connection in connection_abnormal_closes_total with the
+// given reason, such as a WebSocket close code ("1006") or "timeout". Only the
+// first call per connection is counted. A panicking handler is counted with
+// reason "panic".
+func (c *Connection) Abnormal(reason string) {
+	if c != nil && c.abnormal.CompareAndSwap(false, true) {
+		c.metrics.abnormal.WithLabelValues(c.protocol, c.path, reason, c.service).Inc()
+	}
+}
+
+// open counts the connection as active.
+func (c *Connection) open() {
+	c.start = c.now()
+	c.opened.Store(true)
+	c.metrics.active.WithLabelValues(c.protocol, c.path, c.service).Inc()
+}
+
+// close records the lifetime of an opened connection, once.
+func (c *Connection) close() {
+	if !c.opened.Load() {
+		return
+	}
+	c.closed.Do(func() {
+		c.metrics.active.WithLabelValues(c.protocol, c.path, c.service).Dec()
+		c.metrics.duration.WithLabelValues(c.protocol, c.path, c.service).Observe(c.now().Sub(c.start).Seconds())
+	})
+}
+
+// recoverPanic counts a panicking handler as an abnormal close and re-panics.
+func (c *Connection) recoverPanic() {
+	if p := recover(); p != nil {
+		c.Abnormal("panic")
+		c.close()
+		panic(p)
+	}
+}
+
+// InstrumentWebSocket returns a handler recording the WebSocket connections
+// upgraded by next:
+//
+//   - nexen_service_connections_active{protocol, path}: open connections
+//   - nexen_service_connection_duration_seconds{protocol, path}: lifetimes
+//   - nexen_service_connection_messages_total{protocol, path, direction}:
+//     messages counted with MessageSent and MessageReceived
+//   - nexen_service_connection_abnormal_closes_total{protocol, path, reason}:
+//     connections marked with Abnormal
+//
+// A connection opens when next hijacks it, as WebSocket libraries do on
+// upgrade, and closes when the hijacked net.Conn is closed, even if next has
+// returned by then. Requests that are not upgraded are not recorded. The
+// Connection to count messages on is in the request context:
+//
+//	conn := metrics.ConnectionFromContext(r.Context())
+//	for {
+//		_, msg, err := ws.ReadMessage()
+//		if err != nil {
+//			break
+//		}
+//		conn.MessageReceived()
+//		...
+//	}
+func (m *Metrics) InstrumentWebSocket(next http.Handler) http.Handler {
+	connections := m.connectionMetrics()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn := connections.newConnection(protocolWebSocket, m.limitPath(r.Method, m.serviceName, m.pathLabel(r)), m.serviceName, m.now)
+		defer conn.recoverPanic()
+
+		r = r.WithContext(context.WithValue(r.Context(), connectionKey, conn))
+		next.ServeHTTP(&hijackWriter{ResponseWriter: w, conn: conn}, r)
+	})
+}
+
+// InstrumentSSE returns a handler recording the server-sent events streams
+// served by next, with the metrics of InstrumentWebSocket. A connection is
+// open for as long as next runs. Count the events written with
+// ConnectionFromContext(r.Context()).MessageSent().
+func (m *Metrics) InstrumentSSE(next http.Handler) http.Handler {
+	connections := m.connectionMetrics()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn := connections.newConnection(protocolSSE, m.limitPath(r.Method, m.serviceName, m.pathLabel(r)), m.serviceName, m.now)
+		conn.open()
+		defer conn.close()
+		defer conn.recoverPanic()
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), connectionKey, conn)))
+	})
+}
+
+// hijackWriter opens the connection when the handler hijacks it.
+type hijackWriter struct {
+	http.ResponseWriter
+	conn *Connection
+}
+
+// Hijack takes over the underlying connection and opens the Connection, which
+// closes with the returned net.Conn.
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	c, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.conn.open()
+	return &hijackedConn{Conn: c, conn: w.conn}, rw, nil
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *hijackWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// hijackedConn closes the Connection when the network connection is closed.
+type hijackedConn struct {
+	net.Conn
+	conn *Connection
+}
+
+// Close closes the network connection and records the connection lifetime.
+func (c *hijackedConn) Close() error {
+	c.conn.close()
+	return c.Conn.Close()
+}
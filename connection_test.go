@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentWebSocket(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	handlerDone := make(chan struct{}, 1)
+	upgrade := metrics.InstrumentWebSocket(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() { handlerDone <- struct{}{} }()
+		if r.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		c, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("Hijack: %v", err)
+			return
+		}
+		conn := ConnectionFromContext(r.Context())
+
+		// Echo lines from a goroutine outliving the handler, like a read pump
+		go func() {
+			defer c.Close()
+			fmt.Fprint(rw, "HTTP/1.1 101 Switching Protocols\r\n\r\n")
+			rw.Flush()
+			for {
+				line, err := rw.ReadString('\n')
+				if err != nil {
+					conn.Abnormal("1006")
+					return
+				}
+				conn.MessageReceived()
+				if line == "bye\n" {
+					return
+				}
+				fmt.Fprint(rw, line)
+				rw.Flush()
+				conn.MessageSent()
+			}
+		}()
+	}))
+	server := httptest.NewServer(metrics.Instrument(upgrade))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	<-handlerDone
+
+	dial := func() (net.Conn, *bufio.Reader) {
+		c, err := net.Dial("tcp", server.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(c, "GET /ws HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		r := bufio.NewReader(c)
+		if status, _ := r.ReadString('\n'); !strings.Contains(status, "101") {
+			t.Fatalf("Expected 101 Switching Protocols, got %q", status)
+		}
+		r.ReadString('\n')
+		<-handlerDone
+		return c, r
+	}
+
+	c, r := dial()
+	active := metrics.connections.active.WithLabelValues("websocket", "/ws", "test-service")
+	if got := testutil.ToFloat64(active); got != 1 {
+		t.Errorf("Expected 1 active connection, got %v", got)
+	}
+	fmt.Fprint(c, "hello\n")
+	r.ReadString('\n')
+	fmt.Fprint(c, "bye\n")
+	r.ReadString('\n') // EOF once the server closes
+
+	c, _ = dial()
+	c.Close()
+
+	// Wait for the server side of the second connection to close
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(active) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the connection to close")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	messages := metrics.connections.messages
+	if got := testutil.ToFloat64(messages.WithLabelValues("websocket", "/ws", "received", "test-service")); got != 2 {
+		t.Errorf("Expected 2 received messages, got %v", got)
+	}
+	if got := testutil.ToFloat64(messages.WithLabelValues("websocket", "/ws", "sent", "test-service")); got != 1 {
+		t.Errorf("Expected 1 sent message, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.connections.abnormal.WithLabelValues("websocket", "/ws", "1006", "test-service")); got != 1 {
+		t.Errorf("Expected 1 abnormal close, got %v", got)
+	}
+	if got := histogramCount(t, metrics, "nexen_service_connection_duration_seconds"); got != 2 {
+		t.Errorf("Expected 2 connection durations, got %d", got)
+	}
+}
+
+func TestInstrumentSSE(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	handler := metrics.InstrumentSSE(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			http.NewResponseController(w).Flush()
+			ConnectionFromContext(r.Context()).MessageSent()
+		}
+		if r.URL.Query().Has("panic") {
+			panic(http.ErrAbortHandler)
+		}
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/events", nil))
+	func() {
+		defer func() { recover() }()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/events?panic", nil))
+	}()
+
+	connections := metrics.connections
+	if got := testutil.ToFloat64(connections.active.WithLabelValues("sse", "/events", "test-service")); got != 0 {
+		t.Errorf("Expected no active connections, got %v", got)
+	}
+	if got := testutil.ToFloat64(connections.messages.WithLabelValues("sse", "/events", "sent", "test-service")); got != 6 {
+		t.Errorf("Expected 6 sent messages, got %v", got)
+	}
+	if got := testutil.ToFloat64(connections.abnormal.WithLabelValues("sse", "/events", "panic", "test-service")); got != 1 {
+		t.Errorf("Expected 1 abnormal close, got %v", got)
+	}
+	if got := histogramCount(t, metrics, "nexen_service_connection_duration_seconds"); got != 2 {
+		t.Errorf("Expected 2 connection durations, got %d", got)
+	}
+
+	// Handlers served without instrumentation see a nil Connection
+	ConnectionFromContext(httptest.NewRequest("GET", "/", nil).Context()).MessageSent()
+}
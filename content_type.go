@@ -0,0 +1,65 @@
+package metrics
+
+import "strings"
+
+// knownContentTypes bounds the values of the content_type label.
+var knownContentTypes = map[string]bool{
+	"application/grpc":                  true,
+	"application/javascript":            true,
+	"application/json":                  true,
+	"application/octet-stream":          true,
+	"application/pdf":                   true,
+	"application/problem+json":          true,
+	"application/protobuf":              true,
+	"application/x-ndjson":              true,
+	"application/x-protobuf":            true,
+	"application/x-www-form-urlencoded": true,
+	"application/xml":                   true,
+	"image/gif":                         true,
+	"image/jpeg":                        true,
+	"image/png":                         true,
+	"image/svg+xml":                     true,
+	"image/webp":                        true,
+	"multipart/form-data":               true,
+	"text/css":                          true,
+	"text/csv":                          true,
+	"text/event-stream":                 true,
+	"text/html":                         true,
+	"text/javascript":                   true,
+	"text/plain":                        true,
+	"text/xml":                          true,
+}
+
+// WithContentTypeLabel adds a content_type label to the HTTP duration, request
+// size and response size histograms, taken from the Content-Type response
+// header, or detected from the body like net/http does when the handler sets
+// none. Parameters such as charset are stripped, and empty or unrecognised
+// media types are recorded as "unknown" to keep cardinality bounded.
+func WithContentTypeLabel() Option {
+	return func(m *Metrics) {
+		m.contentTypeLabel = true
+	}
+}
+
+// normalizeContentType reduces a Content-Type header value to a known media
+// type, or "unknown".
+func normalizeContentType(header string) string {
+	mediaType, _, _ := strings.Cut(header, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if knownContentTypes[mediaType] {
+		return mediaType
+	}
+	return "unknown"
+}
+
+// responseContentType returns the Content-Type of a response written through
+// rw: the header set by the handler, or else the type sniffed from the body.
+func responseContentType(rw CapturingWriter) string {
+	if contentType := rw.Header().Get("Content-Type"); contentType != "" {
+		return contentType
+	}
+	if w, ok := rw.(*responseWriter); ok {
+		return w.sniffedType
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeContentType(t *testing.T) {
+	cases := map[string]string{
+		"application/json":          "application/json",
+		"application/JSON; charset": "application/json",
+		"text/html; charset=utf-8":  "text/html",
+		"":                          "unknown",
+		"application/x-custom":      "unknown",
+	}
+	for header, want := range cases {
+		if got := normalizeContentType(header); got != want {
+			t.Errorf("normalizeContentType(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestInstrumentContentTypeLabel(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithContentTypeLabel())
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/json" {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/json", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/none", nil))
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Result().Body)
+	bodyStr := string(body)
+
+	for _, want := range []string{
+		`nexen_service_http_request_duration_seconds_count{content_type="application/json",method="GET",path="/json",service="test-service"} 1`,
+		`nexen_service_http_request_duration_seconds_count{content_type="unknown",method="GET",path="/none",service="test-service"} 1`,
+		`nexen_service_http_request_size_bytes_count{content_type="application/json",method="GET",path="/json",service="test-service"} 1`,
+		`nexen_service_http_response_size_bytes_count{content_type="unknown",method="GET",path="/none",service="test-service"} 1`,
+	} {
+		if !strings.Contains(bodyStr, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
+
+func TestInstrumentContentTypeLabelSniffed(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithContentTypeLabel())
+	// A real server, because net/http sends the sniffed type without adding
+	// it to the handler's header map
+	server := httptest.NewServer(metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<!DOCTYPE html><html><body>hello</body></html>")
+	})))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/page")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Fatalf("Expected net/http to sniff text/html, got %q", got)
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	want := `nexen_service_http_request_duration_seconds_count{content_type="text/html",method="GET",path="/page",service="test-service"} 1`
+	if !strings.Contains(w.Body.String(), want) {
+		t.Errorf("Expected metrics to contain %q", want)
+	}
+}
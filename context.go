@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"context"
+)
+
+// FromContext returns the Metrics that Instrument recorded the request with,
+// or that was attached with NewContext, so code deep in a request can record
+// without the instance being passed through every constructor:
+//
+//	func (s *OrderService) Place(ctx context.Context, o Order) error {
+//		metrics.FromContext(ctx).RecordEvent("order_placed")
+//		...
+//	}
+//
+// It returns nil if ctx carries none.
+func FromContext(ctx context.Context) *Metrics {
+	if s := ScopeFromContext(ctx); s != nil {
+		return s.m
+	}
+	return nil
+}
+
+// ScopeFromContext is like FromContext, but returns a scope recording with the
+// service label of the request, which differs from that of the Metrics for
+// requests instrumented by ServiceScope.Instrument.
+func ScopeFromContext(ctx context.Context) *ServiceScope {
+	s, _ := ctx.Value(scopeKey).(*ServiceScope)
+	return s
+}
+
+// NewContext returns a copy of ctx carrying m, for code not served through
+// Instrument such as background jobs and tests.
+func NewContext(ctx context.Context, m *Metrics) context.Context {
+	return withScope(ctx, m.ForService(m.serviceName))
+}
+
+// withScope returns a copy of ctx carrying s.
+func withScope(ctx context.Context, s *ServiceScope) context.Context {
+	return context.WithValue(ctx, scopeKey, s)
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFromContext(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	record := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if FromContext(r.Context()) != metrics {
+			t.Error("Expected the instrumenting Metrics in the request context")
+		}
+		ScopeFromContext(r.Context()).RecordEvent("order_placed")
+	})
+
+	metrics.Instrument(record).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	metrics.ForService("billing").Instrument(record).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	for _, service := range []string{"test-service", "billing"} {
+		if got := testutil.ToFloat64(metrics.applicationEvent.WithLabelValues("order_placed", service)); got != 1 {
+			t.Errorf("Expected 1 event for %s, got %v", service, got)
+		}
+	}
+
+	if FromContext(context.Background()) != nil {
+		t.Error("Expected no Metrics in an empty context")
+	}
+	if FromContext(NewContext(context.Background(), metrics)) != metrics {
+		t.Error("Expected NewContext to attach the Metrics")
+	}
+}
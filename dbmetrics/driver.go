@@ -0,0 +1,333 @@
+package dbmetrics
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Operation label values.
+const (
+	opQuery = "query"
+	opExec  = "exec"
+	opTx    = "tx"
+)
+
+// recorder records statement latencies and errors for one database.
+type recorder struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	db       string
+	service  string
+	// now is the clock of the Metrics instance
+	now func() time.Time
+}
+
+// statementKey is the context key of the statement name.
+type statementKey struct{}
+
+// WithStatementName returns a context labeling the statements run with it with
+// name, so latencies of individual queries can be told apart:
+//
+//	rows, err := db.QueryContext(dbmetrics.WithStatementName(ctx, "get_user"), query, id)
+//
+// Statements run without a name have an empty statement label. Names should
+// come from a small fixed set, never from user input or the query text.
+func WithStatementName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, statementKey{}, name)
+}
+
+// WrapDriver returns a driver recording the latency and errors of the
+// statements run through d in nexen_service_db_query_duration_seconds and
+// nexen_service_db_errors_total, labeled with dbName and the operation: query,
+// exec or tx (from begin to commit or rollback). Query latencies cover the time
+// until the first rows are available, not reading them. Register the returned
+// driver with sql.Register, or use its OpenConnector with sql.OpenDB.
+func WrapDriver(m *metrics.Metrics, d driver.Driver, dbName string) (driver.Driver, error) {
+	duration, err := m.GetOrRegisterHistogram("db_query_duration_seconds",
+		"Histogram of database statement latencies", nil,
+		[]string{"db", "operation", "statement"})
+	if err != nil {
+		return nil, err
+	}
+	errs, err := m.GetOrRegisterCounter("db_errors_total",
+		"Total number of failed database statements",
+		[]string{"db", "operation", "statement"})
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &recorder{duration: duration, errors: errs, db: dbName, service: m.ServiceName(), now: m.Now}
+	return &instrumentedDriver{Driver: d, rec: rec}, nil
+}
+
+// observe records a statement run for op that started at start. driver.ErrSkip
+// is not an error but a request to fall back to another method, so it is not
+// recorded.
+func (r *recorder) observe(ctx context.Context, op string, start time.Time, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		return
+	}
+	statement, _ := ctx.Value(statementKey{}).(string)
+	r.duration.WithLabelValues(r.db, op, statement, r.service).Observe(r.now().Sub(start).Seconds())
+	if err != nil && !errors.Is(err, driver.ErrBadConn) {
+		r.errors.WithLabelValues(r.db, op, statement, r.service).Inc()
+	}
+}
+
+// instrumentedDriver wraps the connections of a driver.
+type instrumentedDriver struct {
+	driver.Driver
+	rec *recorder
+}
+
+// Open opens a connection with the wrapped driver.
+func (d *instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn, rec: d.rec}, nil
+}
+
+// OpenConnector returns a connector for name, using the connector of the
+// wrapped driver if it provides one.
+func (d *instrumentedDriver) OpenConnector(name string) (driver.Connector, error) {
+	if dc, ok := d.Driver.(driver.DriverContext); ok {
+		connector, err := dc.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return &instrumentedConnector{Connector: connector, driver: d}, nil
+	}
+	return &dsnConnector{name: name, driver: d}, nil
+}
+
+// instrumentedConnector wraps the connections of a driver.Connector.
+type instrumentedConnector struct {
+	driver.Connector
+	driver *instrumentedDriver
+}
+
+// Connect opens a connection with the wrapped connector.
+func (c *instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn, rec: c.driver.rec}, nil
+}
+
+// Driver returns the instrumented driver.
+func (c *instrumentedConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// dsnConnector is the connector of drivers without their own.
+type dsnConnector struct {
+	name   string
+	driver *instrumentedDriver
+}
+
+// Connect opens a connection to the data source name.
+func (c *dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.name)
+}
+
+// Driver returns the instrumented driver.
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// instrumentedConn records the statements run on a connection. It implements
+// the optional driver interfaces, falling back to the behavior database/sql
+// has when the wrapped connection does not implement them.
+type instrumentedConn struct {
+	driver.Conn
+	rec *recorder
+}
+
+// Prepare prepares a statement on the wrapped connection.
+func (c *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, rec: c.rec}, nil
+}
+
+// PrepareContext prepares a statement on the wrapped connection.
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	pc, ok := c.Conn.(driver.ConnPrepareContext)
+	if !ok {
+		return c.Prepare(query)
+	}
+	stmt, err := pc.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, rec: c.rec}, nil
+}
+
+// QueryContext runs a query on the wrapped connection.
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := c.rec.now()
+	rows, err := qc.QueryContext(ctx, query, args)
+	c.rec.observe(ctx, opQuery, start, err)
+	return rows, err
+}
+
+// ExecContext runs a statement on the wrapped connection.
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := c.rec.now()
+	result, err := ec.ExecContext(ctx, query, args)
+	c.rec.observe(ctx, opExec, start, err)
+	return result, err
+}
+
+// BeginTx starts a transaction on the wrapped connection.
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := c.rec.now()
+	var tx driver.Tx
+	var err error
+	if bc, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = bc.BeginTx(ctx, opts)
+	} else {
+		if opts.Isolation != 0 || opts.ReadOnly {
+			return nil, errors.New("dbmetrics: driver does not support transaction options")
+		}
+		tx, err = c.Conn.Begin() //nolint:staticcheck // fallback for drivers without BeginTx
+	}
+	if err != nil {
+		c.rec.observe(ctx, opTx, start, err)
+		return nil, err
+	}
+	return &instrumentedTx{Tx: tx, ctx: ctx, start: start, rec: c.rec}, nil
+}
+
+// Ping pings the wrapped connection if it supports it.
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// ResetSession resets the wrapped connection if it supports it.
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if sr, ok := c.Conn.(driver.SessionResetter); ok {
+		return sr.ResetSession(ctx)
+	}
+	return nil
+}
+
+// IsValid reports whether the wrapped connection is valid if it can tell.
+func (c *instrumentedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// CheckNamedValue checks arguments with the wrapped connection if it supports it.
+func (c *instrumentedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// instrumentedTx records the duration of a transaction when it ends.
+type instrumentedTx struct {
+	driver.Tx
+	ctx   context.Context
+	start time.Time
+	rec   *recorder
+}
+
+// Commit commits the wrapped transaction.
+func (t *instrumentedTx) Commit() error {
+	err := t.Tx.Commit()
+	t.rec.observe(t.ctx, opTx, t.start, err)
+	return err
+}
+
+// Rollback rolls the wrapped transaction back.
+func (t *instrumentedTx) Rollback() error {
+	err := t.Tx.Rollback()
+	t.rec.observe(t.ctx, opTx, t.start, err)
+	return err
+}
+
+// instrumentedStmt records the runs of a prepared statement.
+type instrumentedStmt struct {
+	driver.Stmt
+	rec *recorder
+}
+
+// ExecContext runs the wrapped statement.
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := s.rec.now()
+	var result driver.Result
+	var err error
+	if ec, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = ec.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			result, err = s.Stmt.Exec(values) //nolint:staticcheck // fallback for drivers without ExecContext
+		}
+	}
+	s.rec.observe(ctx, opExec, start, err)
+	return result, err
+}
+
+// QueryContext runs the wrapped statement.
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := s.rec.now()
+	var rows driver.Rows
+	var err error
+	if qc, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = qc.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			rows, err = s.Stmt.Query(values) //nolint:staticcheck // fallback for drivers without QueryContext
+		}
+	}
+	s.rec.observe(ctx, opQuery, start, err)
+	return rows, err
+}
+
+// CheckNamedValue checks arguments with the wrapped statement if it supports it.
+func (s *instrumentedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// namedValues converts arguments for drivers without context support, which
+// cannot take named arguments.
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("dbmetrics: driver does not support named arguments")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,163 @@
+package dbmetrics
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeDriver is a database/sql driver implementing only the required
+// interfaces, so the wrapper's fallbacks are exercised. Statements whose text
+// contains "fail" return an error.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{query: query}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct{ query string }
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	if strings.Contains(s.query, "fail") {
+		return nil, errors.New("exec failed")
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	if strings.Contains(s.query, "fail") {
+		return nil, errors.New("query failed")
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeRows struct{ done bool }
+
+func (r *fakeRows) Columns() []string { return []string{"id"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+func openDB(t *testing.T, m *metrics.Metrics) *sql.DB {
+	t.Helper()
+	d, err := WrapDriver(m, fakeDriver{}, "orders")
+	if err != nil {
+		t.Fatalf("Failed to wrap driver: %v", err)
+	}
+	connector, err := d.(driver.DriverContext).OpenConnector("")
+	if err != nil {
+		t.Fatalf("Failed to open connector: %v", err)
+	}
+	db := sql.OpenDB(connector)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestWrapDriver(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("test-service"))
+	db := openDB(t, m)
+	ctx := WithStatementName(context.Background(), "get_order")
+
+	var id int
+	if err := db.QueryRowContext(ctx, "SELECT id FROM orders").Scan(&id); err != nil || id != 1 {
+		t.Fatalf("Expected query to return 1, got %v, %v", id, err)
+	}
+	if _, err := db.ExecContext(context.Background(), "UPDATE orders"); err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	if _, err := db.ExecContext(context.Background(), "fail"); err == nil {
+		t.Fatal("Expected exec error to be passed through")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	registry := m.Registry()
+	expected := map[string]int{
+		`nexen_service_db_query_duration_seconds`: 3, // query/get_order, exec, tx
+		`nexen_service_db_errors_total`:           1,
+	}
+	for name, want := range expected {
+		if n, err := testutil.GatherAndCount(registry, name); err != nil || n != want {
+			t.Errorf("Expected %d series of %s, got %d (%v)", want, name, n, err)
+		}
+	}
+
+	d, err := WrapDriver(m, fakeDriver{}, "users")
+	if err != nil || d == nil {
+		t.Fatalf("Expected a second database to share the metrics, got %v", err)
+	}
+}
+
+func TestWrapDriverStatementLabels(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("test-service"))
+	db := openDB(t, m)
+
+	ctx := WithStatementName(context.Background(), "load_report")
+	if _, err := db.QueryContext(ctx, "fail"); err == nil {
+		t.Fatal("Expected query error to be passed through")
+	}
+
+	expected := `
+# HELP nexen_service_db_errors_total Total number of failed database statements
+# TYPE nexen_service_db_errors_total counter
+nexen_service_db_errors_total{db="orders",operation="query",service="test-service",statement="load_report"} 1
+`
+	if err := testutil.GatherAndCompare(m.Registry(), strings.NewReader(expected), "nexen_service_db_errors_total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWrapDriverUsesClock(t *testing.T) {
+	now := time.Unix(0, 0)
+	m := metrics.New(metrics.WithServiceName("test-service"), metrics.WithClock(func() time.Time { return now }))
+	db := openDB(t, m)
+
+	if _, err := db.ExecContext(context.Background(), "UPDATE orders"); err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	families, err := m.Registry().Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == "nexen_service_db_query_duration_seconds" {
+			if sum := mf.GetMetric()[0].GetHistogram().GetSampleSum(); sum != 0 {
+				t.Errorf("Expected no time to pass on a stopped clock, got %v", sum)
+			}
+			return
+		}
+	}
+	t.Fatal("Expected the query duration to be exposed")
+}
@@ -0,0 +1,80 @@
+// Package dbmetrics instruments database/sql: InstrumentDB exports connection
+// pool statistics and WrapDriver records query latencies and errors, using the
+// same nexen_service namespace and service label as the HTTP metrics.
+package dbmetrics
+
+import (
+	"database/sql"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InstrumentDB registers a collector exporting the connection pool statistics
+// of db, labeled with dbName, with m. The statistics are read from db.Stats at
+// scrape time.
+func InstrumentDB(m *metrics.Metrics, db *sql.DB, dbName string) error {
+	return m.Register(newPoolCollector(db, dbName, m.ServiceName()))
+}
+
+// poolCollector exports sql.DBStats as metrics.
+type poolCollector struct {
+	db *sql.DB
+
+	maxOpen      *prometheus.Desc
+	open         *prometheus.Desc
+	inUse        *prometheus.Desc
+	idle         *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitDuration *prometheus.Desc
+	closedIdle   *prometheus.Desc
+	closedLife   *prometheus.Desc
+}
+
+// newPoolCollector creates a collector for the pool stats of db.
+func newPoolCollector(db *sql.DB, dbName, service string) *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName("nexen", "service", name),
+			help,
+			nil,
+			prometheus.Labels{"db": dbName, "service": service},
+		)
+	}
+	return &poolCollector{
+		db:           db,
+		maxOpen:      desc("db_max_open_connections", "Maximum number of open connections to the database"),
+		open:         desc("db_open_connections", "Number of established connections, both in use and idle"),
+		inUse:        desc("db_in_use_connections", "Number of connections currently in use"),
+		idle:         desc("db_idle_connections", "Number of idle connections"),
+		waitCount:    desc("db_wait_count_total", "Total number of connections waited for"),
+		waitDuration: desc("db_wait_duration_seconds_total", "Total time blocked waiting for a new connection"),
+		closedIdle:   desc("db_max_idle_closed_total", "Total number of connections closed due to SetMaxIdleConns"),
+		closedLife:   desc("db_max_lifetime_closed_total", "Total number of connections closed due to SetConnMaxLifetime"),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.closedIdle
+	ch <- c.closedLife
+}
+
+// Collect implements prometheus.Collector.
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.closedIdle, prometheus.CounterValue, float64(stats.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(c.closedLife, prometheus.CounterValue, float64(stats.MaxLifetimeClosed))
+}
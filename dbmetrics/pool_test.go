@@ -0,0 +1,44 @@
+package dbmetrics
+
+import (
+	"strings"
+	"testing"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentDB(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("test-service"))
+	db := openDB(t, m)
+	db.SetMaxOpenConns(5)
+	if err := db.Ping(); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+
+	if err := InstrumentDB(m, db, "orders"); err != nil {
+		t.Fatalf("Failed to instrument db: %v", err)
+	}
+	if err := InstrumentDB(m, db, "orders"); err == nil {
+		t.Fatal("Expected an error when instrumenting the same database twice")
+	}
+
+	expected := `
+# HELP nexen_service_db_max_open_connections Maximum number of open connections to the database
+# TYPE nexen_service_db_max_open_connections gauge
+nexen_service_db_max_open_connections{db="orders",service="test-service"} 5
+# HELP nexen_service_db_open_connections Number of established connections, both in use and idle
+# TYPE nexen_service_db_open_connections gauge
+nexen_service_db_open_connections{db="orders",service="test-service"} 1
+# HELP nexen_service_db_idle_connections Number of idle connections
+# TYPE nexen_service_db_idle_connections gauge
+nexen_service_db_idle_connections{db="orders",service="test-service"} 1
+`
+	if err := testutil.GatherAndCompare(m.Registry(), strings.NewReader(expected),
+		"nexen_service_db_max_open_connections",
+		"nexen_service_db_open_connections",
+		"nexen_service_db_idle_connections",
+	); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	defaultOnce     sync.Once
+	defaultInstance atomic.Pointer[Metrics]
+)
+
+// Default returns the package-level Metrics instance used by the package-level
+// helpers such as RecordEvent and Instrument, so small services do not have to
+// pass an instance around. Unless SetDefault was called first, it is created
+// on first use with New and no options; expose it with Default().Handler() or
+// Default().Serve.
+func Default() *Metrics {
+	defaultOnce.Do(func() {
+		defaultInstance.CompareAndSwap(nil, New())
+	})
+	return defaultInstance.Load()
+}
+
+// SetDefault makes m the instance returned by Default. Call it during
+// initialization, before anything records through the package-level helpers:
+// observations recorded earlier stay in the previous instance, which keeps its
+// metrics registered until it is closed.
+func SetDefault(m *Metrics) {
+	defaultOnce.Do(func() {})
+	defaultInstance.Store(m)
+}
+
+// Instrument is like Metrics.Instrument, recording into the instance that is
+// the default when each request is served.
+func Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := Default()
+		m.serveInstrumented(w, r, next, m.serviceName)
+	})
+}
+
+// Handler returns the handler exposing the metrics of Default. It serves
+// the instance that is the default at the time of each scrape.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Default().Handler().ServeHTTP(w, r)
+	})
+}
+
+// RecordEvent calls Default().RecordEvent.
+func RecordEvent(event string) {
+	Default().RecordEvent(event)
+}
+
+// RecordEventAsync calls Default().RecordEventAsync.
+func RecordEventAsync(event string) {
+	Default().RecordEventAsync(event)
+}
+
+// RecordError calls Default().RecordError.
+func RecordError(err error) {
+	Default().RecordError(err)
+}
+
+// SetGauge calls Default().SetGauge.
+func SetGauge(name string, value float64) {
+	Default().SetGauge(name, value)
+}
+
+// IncrementGauge calls Default().IncrementGauge.
+func IncrementGauge(name string) {
+	Default().IncrementGauge(name)
+}
+
+// DecrementGauge calls Default().DecrementGauge.
+func DecrementGauge(name string) {
+	Default().DecrementGauge(name)
+}
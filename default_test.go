@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDefault(t *testing.T) {
+	// Start from an uninitialized default, restoring it afterwards
+	previous := defaultInstance.Swap(nil)
+	defaultOnce = sync.Once{}
+	t.Cleanup(func() {
+		defaultInstance.Store(previous)
+		defaultOnce = sync.Once{}
+	})
+
+	var wg sync.WaitGroup
+	instances := make([]*Metrics, 8)
+	for i := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instances[i] = Default()
+		}()
+	}
+	wg.Wait()
+	for _, m := range instances {
+		if m == nil || m != instances[0] {
+			t.Fatal("Expected every caller to get the same default instance")
+		}
+	}
+
+	m := New(WithServiceName("test-service"))
+	SetDefault(m)
+	if Default() != m {
+		t.Fatal("Expected SetDefault to replace the default instance")
+	}
+
+	RecordEvent("signup")
+	SetGauge("queue_depth", 3)
+	IncrementGauge("queue_depth")
+	Instrument(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if got := testutil.ToFloat64(m.applicationEvent.WithLabelValues("signup", "test-service")); got != 1 {
+		t.Errorf("Expected 1 event, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.serviceGauge.WithLabelValues("queue_depth", "test-service")); got != 4 {
+		t.Errorf("Expected a gauge of 4, got %v", got)
+	}
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `nexen_service_http_requests_total{method="GET",path="/",service="test-service"} 1`) {
+		t.Errorf("Expected the instrumented request in the default handler, got:\n%s", body)
+	}
+}
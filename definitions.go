@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+)
+
+// Metric types of a MetricDefinition.
+const (
+	DefinitionCounter   = "counter"
+	DefinitionGauge     = "gauge"
+	DefinitionHistogram = "histogram"
+)
+
+// MetricDefinition declares a custom metric in a definitions file.
+type MetricDefinition struct {
+	// Name is the metric name without the nexen_service_ prefix.
+	Name string `json:"name" yaml:"name"`
+	// Type is "counter", "gauge" or "histogram".
+	Type string `json:"type" yaml:"type"`
+	Help string `json:"help" yaml:"help"`
+	// Labels are added before the service label.
+	Labels []string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	// Buckets of a histogram; the HTTP duration buckets if empty.
+	Buckets []float64 `json:"buckets,omitempty" yaml:"buckets,omitempty"`
+}
+
+// definitionsFile is the layout of a definitions file.
+type definitionsFile struct {
+	Metrics []MetricDefinition `json:"metrics" yaml:"metrics"`
+}
+
+// DefinedMetrics maps the names of the metrics registered by LoadDefinitions to
+// their vectors.
+type DefinedMetrics map[string]prometheus.Collector
+
+// Counter returns the counter defined as name, or nil if there is none.
+func (d DefinedMetrics) Counter(name string) *prometheus.CounterVec {
+	c, _ := d[name].(*prometheus.CounterVec)
+	return c
+}
+
+// Gauge returns the gauge defined as name, or nil if there is none.
+func (d DefinedMetrics) Gauge(name string) *prometheus.GaugeVec {
+	g, _ := d[name].(*prometheus.GaugeVec)
+	return g
+}
+
+// Histogram returns the histogram defined as name, or nil if there is none.
+func (d DefinedMetrics) Histogram(name string) *prometheus.HistogramVec {
+	h, _ := d[name].(*prometheus.HistogramVec)
+	return h
+}
+
+// LoadDefinitions registers the metrics declared in the YAML or JSON file at
+// path, chosen by its .yaml, .yml or .json extension, so a catalog of metrics
+// can be shared across services:
+//
+//	metrics:
+//	  - name: orders_placed_total
+//	    type: counter
+//	    help: Total number of orders placed
+//	    labels: [channel]
+//	  - name: order_value_dollars
+//	    type: histogram
+//	    help: Histogram of order values
+//	    buckets: [10, 50, 100, 500]
+//
+// The file is validated as a whole before anything is registered. If a metric
+// fails to register, the metrics registered before it are unregistered again.
+func (m *Metrics) LoadDefinitions(path string) (DefinedMetrics, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metric definitions: %w", err)
+	}
+
+	var file definitionsFile
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	case ".json":
+		err = json.Unmarshal(data, &file)
+	default:
+		return nil, fmt.Errorf("failed to parse metric definitions %s: unsupported extension %q", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metric definitions %s: %w", path, err)
+	}
+	if err := validateDefinitions(file.Metrics); err != nil {
+		return nil, fmt.Errorf("invalid metric definitions %s: %w", path, err)
+	}
+
+	defined := make(DefinedMetrics, len(file.Metrics))
+	for _, def := range file.Metrics {
+		c, err := m.registerDefinition(def)
+		if err != nil {
+			for name, registered := range defined {
+				m.unregister(name, registered)
+			}
+			return nil, err
+		}
+		defined[def.Name] = c
+	}
+	return defined, nil
+}
+
+// validateDefinitions reports every incomplete, unknown or duplicate
+// definition.
+func validateDefinitions(defs []MetricDefinition) error {
+	var errs []error
+	seen := make(map[string]bool, len(defs))
+	for i, def := range defs {
+		switch {
+		case def.Name == "":
+			errs = append(errs, fmt.Errorf("metric %d: missing name", i))
+			continue
+		case seen[def.Name]:
+			errs = append(errs, fmt.Errorf("metric %s: defined more than once", def.Name))
+		}
+		seen[def.Name] = true
+
+		if def.Help == "" {
+			errs = append(errs, fmt.Errorf("metric %s: missing help", def.Name))
+		}
+		switch def.Type {
+		case DefinitionCounter, DefinitionGauge:
+			if len(def.Buckets) > 0 {
+				errs = append(errs, fmt.Errorf("metric %s: buckets are only valid for histograms", def.Name))
+			}
+		case DefinitionHistogram:
+		default:
+			errs = append(errs, fmt.Errorf("metric %s: unknown type %q", def.Name, def.Type))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// registerDefinition registers the metric declared by def.
+func (m *Metrics) registerDefinition(def MetricDefinition) (prometheus.Collector, error) {
+	labels := append([]string(nil), def.Labels...)
+	switch def.Type {
+	case DefinitionCounter:
+		return m.RegisterCounter(def.Name, def.Help, labels)
+	case DefinitionGauge:
+		return m.RegisterGauge(def.Name, def.Help, labels)
+	default:
+		return m.RegisterHistogram(def.Name, def.Help, def.Buckets, labels)
+	}
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLoadDefinitions(t *testing.T) {
+	for _, path := range []string{"testdata/definitions.yaml", "testdata/definitions.json"} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			metrics := New(WithServiceName("test-service"))
+			defined, err := metrics.LoadDefinitions(path)
+			if err != nil {
+				t.Fatalf("LoadDefinitions: %v", err)
+			}
+			if len(defined) != 3 {
+				t.Fatalf("Expected 3 defined metrics, got %d", len(defined))
+			}
+
+			defined.Counter("orders_placed_total").WithLabelValues("web", "test-service").Inc()
+			defined.Gauge("open_carts").WithLabelValues("test-service").Set(4)
+			defined.Histogram("order_value_dollars").WithLabelValues("test-service").Observe(75)
+
+			expected := `
+# HELP nexen_service_order_value_dollars Histogram of order values
+# TYPE nexen_service_order_value_dollars histogram
+nexen_service_order_value_dollars_bucket{service="test-service",le="10"} 0
+nexen_service_order_value_dollars_bucket{service="test-service",le="50"} 0
+nexen_service_order_value_dollars_bucket{service="test-service",le="100"} 1
+nexen_service_order_value_dollars_bucket{service="test-service",le="500"} 1
+nexen_service_order_value_dollars_bucket{service="test-service",le="+Inf"} 1
+nexen_service_order_value_dollars_sum{service="test-service"} 75
+nexen_service_order_value_dollars_count{service="test-service"} 1
+# HELP nexen_service_orders_placed_total Total number of orders placed
+# TYPE nexen_service_orders_placed_total counter
+nexen_service_orders_placed_total{channel="web",service="test-service"} 1
+`
+			if err := testutil.GatherAndCompare(metrics.Registry(), strings.NewReader(expected),
+				"nexen_service_orders_placed_total", "nexen_service_order_value_dollars"); err != nil {
+				t.Error(err)
+			}
+			if defined.Counter("open_carts") != nil {
+				t.Error("Expected Counter to return nil for a gauge")
+			}
+		})
+	}
+}
+
+func TestLoadDefinitionsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "definitions.yaml")
+	content := `
+metrics:
+  - name: jobs_total
+    type: counter
+    help: Total number of jobs
+  - name: jobs_total
+    type: counter
+    help: Total number of jobs
+  - name: queue_depth
+    type: summary
+    help: Depth of the queue
+  - name: workers
+    type: gauge
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := New(WithServiceName("test-service"))
+	_, err := metrics.LoadDefinitions(path)
+	if err == nil {
+		t.Fatal("Expected an error for invalid definitions")
+	}
+	for _, want := range []string{"jobs_total: defined more than once", `unknown type "summary"`, "workers: missing help"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got %v", want, err)
+		}
+	}
+	if n, _ := testutil.GatherAndCount(metrics.Registry(), "nexen_service_jobs_total"); n != 0 {
+		t.Error("Expected nothing to be registered from invalid definitions")
+	}
+}
+
+func TestLoadDefinitionsRollback(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	if _, err := metrics.RegisterGauge("order_value_dollars", "Conflicting gauge", nil); err != nil {
+		t.Fatal(err)
+	}
+	before := len(metrics.Collectors())
+
+	defined, err := metrics.LoadDefinitions("testdata/definitions.yaml")
+	if err == nil || defined != nil {
+		t.Fatalf("Expected an error for a conflicting definition, got %v", err)
+	}
+
+	// The definitions registered before the conflict were rolled back
+	if _, ok := metrics.Counter("orders_placed_total"); ok {
+		t.Error("Expected rolled back counter not to be found by name")
+	}
+	for _, info := range metrics.ListMetrics() {
+		if info.Name == "nexen_service_orders_placed_total" {
+			t.Error("Expected rolled back counter not to be listed")
+		}
+	}
+	if n := len(metrics.Collectors()); n != before {
+		t.Errorf("Expected %d tracked collectors after rollback, got %d", before, n)
+	}
+	if _, err := metrics.RegisterCounter("orders_placed_total", "Total number of orders placed", []string{"channel"}); err != nil {
+		t.Errorf("Expected rolled back counter to be registrable again: %v", err)
+	}
+}
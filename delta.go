@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Delta returns the change of every metric exposed by Handler since the
+// previous call, which makes counter increments easy to follow while debugging.
+// Counters, gauges and the counts, sums and buckets of histograms and
+// summaries are reported as differences; summary quantiles keep their current
+// value. Series that did not change are left out. The first call reports the
+// change since the start of the process, as does a counter that was reset.
+func (m *Metrics) Delta() (MetricsSnapshot, error) {
+	return m.delta(true)
+}
+
+// DeltaHandler returns a debug handler serving Delta as JSON:
+//
+//	mux.Handle("/metrics/delta", m.DeltaHandler())
+//
+// With ?peek=true, the change is reported without becoming the baseline of the
+// next request.
+func (m *Metrics) DeltaHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delta, err := m.delta(r.URL.Query().Get("peek") != "true")
+		if err != nil && len(delta.Families) == 0 {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(delta)
+	})
+}
+
+// delta computes the change since the baseline, replacing the baseline if
+// reset is set.
+func (m *Metrics) delta(reset bool) (MetricsSnapshot, error) {
+	snapshot, err := m.Snapshot()
+
+	m.deltaMu.Lock()
+	defer m.deltaMu.Unlock()
+
+	base := make(map[string]MetricSnapshot)
+	delta := MetricsSnapshot{Timestamp: snapshot.Timestamp, Families: []FamilySnapshot{}}
+	for _, family := range snapshot.Families {
+		changed := family
+		changed.Metrics = nil
+		for _, metric := range family.Metrics {
+			key := deltaKey(family.Name, metric.Labels)
+			base[key] = metric
+			if d, ok := metricDelta(family.Type, metric, m.deltaBase[key]); ok {
+				changed.Metrics = append(changed.Metrics, d)
+			}
+		}
+		if len(changed.Metrics) > 0 {
+			delta.Families = append(delta.Families, changed)
+		}
+	}
+	if reset {
+		m.deltaBase = base
+	}
+	return delta, err
+}
+
+// deltaKey identifies a series across snapshots.
+func deltaKey(name string, labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"\xff"+v)
+	}
+	sort.Strings(pairs)
+	return name + "\xfe" + strings.Join(pairs, "\xfe")
+}
+
+// metricDelta returns the change from prev, which is the zero value for new
+// series, to cur, and whether there is any.
+func metricDelta(kind string, cur, prev MetricSnapshot) (MetricSnapshot, bool) {
+	d := MetricSnapshot{Labels: cur.Labels}
+	if cur.Value != nil {
+		now, before := float64(*cur.Value), 0.0
+		if prev.Value != nil {
+			before = float64(*prev.Value)
+		}
+		if now == before || (math.IsNaN(now) && math.IsNaN(before)) {
+			return d, false
+		}
+		v := SnapshotValue(now - before)
+		if kind == "counter" && now < before {
+			v = SnapshotValue(now)
+		}
+		d.Value = &v
+		return d, true
+	}
+
+	if cur.Count == nil {
+		return d, false
+	}
+	var before uint64
+	if prev.Count != nil {
+		before = *prev.Count
+	}
+	if *cur.Count == before {
+		return d, false
+	}
+	if *cur.Count < before || len(prev.Buckets) != len(cur.Buckets) {
+		// Reset, or a new series
+		return cur, true
+	}
+
+	count := *cur.Count - before
+	sum := *cur.Sum
+	if prev.Sum != nil {
+		sum -= *prev.Sum
+	}
+	d.Count, d.Sum = &count, &sum
+	for i, b := range cur.Buckets {
+		d.Buckets = append(d.Buckets, BucketSnapshot{UpperBound: b.UpperBound, Count: b.Count - prev.Buckets[i].Count})
+	}
+	d.Quantiles = cur.Quantiles
+	return d, true
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDelta(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	latency, err := metrics.RegisterHistogram("job_seconds", "Job latency", []float64{1}, nil)
+	if err != nil {
+		t.Fatalf("RegisterHistogram: %v", err)
+	}
+	metrics.RecordEvent("signup")
+	latency.WithLabelValues("test-service").Observe(0.5)
+	if _, err := metrics.Delta(); err != nil {
+		t.Fatalf("Delta: %v", err)
+	}
+
+	metrics.RecordEvent("signup")
+	metrics.RecordEvent("signup")
+	latency.WithLabelValues("test-service").Observe(2)
+
+	fetch := func(target string) map[string]FamilySnapshot {
+		w := httptest.NewRecorder()
+		metrics.DeltaHandler().ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		var delta MetricsSnapshot
+		if err := json.NewDecoder(w.Body).Decode(&delta); err != nil {
+			t.Fatalf("Failed to decode delta: %v", err)
+		}
+		families := make(map[string]FamilySnapshot)
+		for _, f := range delta.Families {
+			families[f.Name] = f
+		}
+		return families
+	}
+
+	families := fetch("/metrics/delta?peek=true")
+	events := families["nexen_service_application_events_total"].Metrics
+	if len(events) != 1 || *events[0].Value != 2 {
+		t.Errorf("Expected 2 signups since the previous delta, got %+v", events)
+	}
+	job := families["nexen_service_job_seconds"].Metrics
+	if len(job) != 1 || *job[0].Count != 1 || *job[0].Sum != 2 || job[0].Buckets[0].Count != 0 {
+		t.Errorf("Expected one observation of 2s since the previous delta, got %+v", job)
+	}
+	if _, ok := families["nexen_service_http_requests_total"]; ok {
+		t.Error("Expected unchanged families to be left out")
+	}
+
+	if families := fetch("/metrics/delta"); len(families["nexen_service_application_events_total"].Metrics) != 1 {
+		t.Error("Expected peeking to keep the baseline")
+	}
+	if _, ok := fetch("/metrics/delta")["nexen_service_application_events_total"]; ok {
+		t.Error("Expected no change after the baseline moved")
+	}
+}
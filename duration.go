@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ObserveDuration records d into the nexen_service_<name>_duration_seconds
+// histogram, registering it with the default buckets on first use. Observations
+// for names that cannot be registered (for example, invalid metric names or
+// names already used by another metric) are dropped.
+func (m *Metrics) ObserveDuration(name string, d time.Duration) {
+	if observer := m.timerObserver(name, nil); observer != nil {
+		observer.Observe(d.Seconds())
+	}
+}
+
+// Timer measures a block of code into a duration histogram, see
+// Metrics.Timer.
+type Timer struct {
+	observer prometheus.Observer
+	now      func() time.Time
+	start    time.Time
+}
+
+// Timer starts timing a block of code recorded into the
+// nexen_service_<name>_duration_seconds histogram when Stop is called:
+//
+//	defer m.Timer("cache_refresh").Stop()
+//
+// labels are label name and value pairs, e.g. "op", "insert". The label names
+// of a histogram are fixed by its first use; observations with other label
+// names, an odd number of labels or names that cannot be registered are
+// dropped, as with ObserveDuration.
+func (m *Metrics) Timer(name string, labels ...string) *Timer {
+	return &Timer{observer: m.timerObserver(name, labels), now: m.now, start: m.now()}
+}
+
+// Stop records the time since the timer was started and returns it.
+func (t *Timer) Stop() time.Duration {
+	elapsed := t.now().Sub(t.start)
+	if t.observer != nil {
+		t.observer.Observe(elapsed.Seconds())
+	}
+	return elapsed
+}
+
+// Time runs fn, records its duration like Timer and, if it returns an error,
+// increments the nexen_service_<name>_errors_total counter. It returns the
+// error of fn.
+func (m *Metrics) Time(name string, fn func() error) error {
+	timer := m.Timer(name)
+	err := fn()
+	timer.Stop()
+	if err != nil {
+		if counter := m.timerErrorCounter(name); counter != nil {
+			counter.WithLabelValues(m.serviceName).Inc()
+		}
+	}
+	return err
+}
+
+// timerObserver returns the child of the duration histogram for name with
+// the given label pairs, or nil if it cannot be recorded.
+func (m *Metrics) timerObserver(name string, labels []string) prometheus.Observer {
+	if len(labels)%2 != 0 {
+		return nil
+	}
+	names := make([]string, 0, len(labels)/2)
+	values := make([]string, 0, len(labels)/2+1)
+	for i := 0; i < len(labels); i += 2 {
+		names = append(names, labels[i])
+		values = append(values, labels[i+1])
+	}
+
+	histogram := m.durationHistogram(name, names)
+	if histogram == nil {
+		return nil
+	}
+	return histogram.WithLabelValues(append(values, m.serviceName)...)
+}
+
+// durationHistogram returns the lazily registered duration histogram for name,
+// or nil if it could not be registered or was registered with other label
+// names. Failed registrations are remembered so they are not retried on every
+// observation.
+func (m *Metrics) durationHistogram(name string, labels []string) *prometheus.HistogramVec {
+	m.lazyMu.Lock()
+	defer m.lazyMu.Unlock()
+
+	if d, ok := m.durations[name]; ok {
+		if !slices.Equal(d.labels, labels) {
+			return nil
+		}
+		return d.vec
+	}
+
+	// RegisterHistogram returns nil on failure, which is cached like a success
+	histogram, _ := m.RegisterHistogram(name+"_duration_seconds", "Duration of "+name+" in seconds", nil, slices.Clone(labels))
+	if m.durations == nil {
+		m.durations = make(map[string]labeledVec[*prometheus.HistogramVec])
+	}
+	m.durations[name] = labeledVec[*prometheus.HistogramVec]{vec: histogram, labels: labels}
+	return histogram
+}
+
+// timerErrorCounter returns the lazily registered error counter of Time for
+// name, or nil if it could not be registered.
+func (m *Metrics) timerErrorCounter(name string) *prometheus.CounterVec {
+	m.lazyMu.Lock()
+	defer m.lazyMu.Unlock()
+
+	if counter, ok := m.timerErrors[name]; ok {
+		return counter
+	}
+
+	counter, _ := m.RegisterCounter(name+"_errors_total", "Total number of failed runs of "+name, nil)
+	if m.timerErrors == nil {
+		m.timerErrors = make(map[string]*prometheus.CounterVec)
+	}
+	m.timerErrors[name] = counter
+	return counter
+}
@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"net/http"
+)
+
+// WithErrorClassifier adds a class label to http_errors_total whose value is
+// computed by classify from the status code and request of each error
+// response, so dashboards can aggregate errors by class while the code label
+// keeps the individual status. The code label then defaults to the numeric
+// status, e.g. "404", unless WithStatusCodeGranularity is also set. classify
+// must return values from a small fixed set. DefaultErrorClassifier covers the
+// common case.
+func WithErrorClassifier(classify func(status int, r *http.Request) string) Option {
+	return func(m *Metrics) {
+		m.errorClassifier = classify
+	}
+}
+
+// DefaultErrorClassifier classifies an error response by its status class,
+// e.g. "4xx" or "5xx".
+func DefaultErrorClassifier(status int, _ *http.Request) string {
+	return statusClass(status)
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestErrorClassifier(t *testing.T) {
+	metrics := New(
+		WithServiceName("test-service"),
+		WithErrorClassifier(DefaultErrorClassifier),
+	)
+
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/broken":
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	for _, path := range []string{"/ok", "/missing", "/broken", "/broken"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	expected := `
+# HELP nexen_service_http_errors_total Total number of HTTP responses with error status codes
+# TYPE nexen_service_http_errors_total counter
+nexen_service_http_errors_total{class="4xx",code="404",method="GET",path="/missing",service="test-service"} 1
+nexen_service_http_errors_total{class="5xx",code="502",method="GET",path="/broken",service="test-service"} 2
+`
+	if err := testutil.GatherAndCompare(metrics.Registry(), strings.NewReader(expected), "nexen_service_http_errors_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCustomErrorClassifier(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithStatusCodeGranularity(StatusCodeText), WithErrorClassifier(func(status int, r *http.Request) string {
+		if status == http.StatusTooManyRequests {
+			return "throttled"
+		}
+		if status < 500 {
+			return "client"
+		}
+		return "server"
+	}))
+
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api", nil))
+
+	if got := testutil.ToFloat64(metrics.httpErrors.WithLabelValues("GET", "/api", "Too Many Requests", "test-service", "throttled")); got != 1 {
+		t.Errorf("Expected 1 throttled error, got %v", got)
+	}
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// fmtWrapperType is the type of errors created by fmt.Errorf with a single %w
+// verb. It carries no taxonomy information, so RecordError looks through it.
+var fmtWrapperType = reflect.TypeOf(fmt.Errorf("%w", errors.New("")))
+
+// WithErrorTypeName maps errors of the same dynamic type as prototype to a
+// stable name in the type label of nexen_service_errors_total, so renaming or
+// moving the Go type does not break dashboards. It may be given multiple times.
+//
+//	metrics.WithErrorTypeName(&ValidationError{}, "validation")
+func WithErrorTypeName(prototype error, name string) Option {
+	return func(m *Metrics) {
+		if m.errorTypeNames == nil {
+			m.errorTypeNames = make(map[reflect.Type]string)
+		}
+		m.errorTypeNames[reflect.TypeOf(prototype)] = name
+	}
+}
+
+// RecordError increments nexen_service_errors_total for err, labeled by its type.
+// If any error in the errors.Unwrap chain has a type named with WithErrorTypeName,
+// the first such name is used. Otherwise the label is the Go type of the first
+// error that is not an fmt.Errorf wrapper, e.g. "*fs.PathError". Nil errors are
+// ignored.
+func (m *Metrics) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	errType := m.limitLabel(limitErrors, m.serviceName, m.errorType(err))
+	m.touchSeries(seriesKey{group: seriesError, service: m.serviceName, a: errType})
+	m.applicationError.WithLabelValues(errType, m.serviceName).Inc()
+}
+
+// errorType returns the type label for err.
+func (m *Metrics) errorType(err error) string {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if name, ok := m.errorTypeNames[reflect.TypeOf(e)]; ok {
+			return name
+		}
+	}
+	for reflect.TypeOf(err) == fmtWrapperType {
+		next := errors.Unwrap(err)
+		if next == nil {
+			break
+		}
+		err = next
+	}
+	return reflect.TypeOf(err).String()
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type validationError struct{ field string }
+
+func (e *validationError) Error() string { return "invalid " + e.field }
+
+func TestRecordError(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithErrorTypeName(&validationError{}, "validation"))
+
+	_, statErr := os.Stat("/does/not/exist")
+	metrics.RecordError(fmt.Errorf("loading config: %w", statErr))
+	metrics.RecordError(fmt.Errorf("request: %w", &validationError{field: "name"}))
+	metrics.RecordError(errors.New("plain"))
+	metrics.RecordError(nil)
+
+	cases := map[string]float64{
+		fmt.Sprintf("%T", &fs.PathError{}): 1,
+		"validation":                       1,
+		"*errors.errorString":              1,
+	}
+	for errType, want := range cases {
+		got := testutil.ToFloat64(metrics.applicationError.WithLabelValues(errType, "test-service"))
+		if got != want {
+			t.Errorf("errors_total{type=%q} = %v, want %v", errType, got, want)
+		}
+	}
+	if n := testutil.CollectAndCount(metrics.applicationError); n != 3 {
+		t.Fatalf("Expected 3 error series, got %d", n)
+	}
+}
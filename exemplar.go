@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// ExemplarExtractor returns the exemplar labels, typically a trace ID, to attach
+// to the metrics recorded for a request, or nil to record no exemplar. The
+// labels may total at most 128 runes and must have valid names and UTF-8
+// values; other exemplars are dropped and the request is recorded without one.
+type ExemplarExtractor func(*http.Request) prometheus.Labels
+
+// WithExemplars makes Instrument attach exemplars to the HTTP duration histogram
+// and error counter, so dashboards can link latency spikes and errors to
+// traces. Exemplars come from TraceparentExemplar unless WithExemplarExtractor
+// is given. They are only exposed when the scraper negotiates the OpenMetrics
+// format.
+func WithExemplars(enabled bool) Option {
+	return func(m *Metrics) {
+		m.exemplars = enabled
+	}
+}
+
+// WithExemplarExtractor sets the function extracting exemplar labels from a
+// request when exemplars are enabled with WithExemplars. For OpenTelemetry
+// instrumented services, the trace ID can be taken from the span context:
+//
+//	metrics.WithExemplarExtractor(func(r *http.Request) prometheus.Labels {
+//	    sc := trace.SpanContextFromContext(r.Context())
+//	    if !sc.IsSampled() {
+//	        return nil
+//	    }
+//	    return prometheus.Labels{"trace_id": sc.TraceID().String()}
+//	})
+func WithExemplarExtractor(extract ExemplarExtractor) Option {
+	return func(m *Metrics) {
+		m.exemplarLabels = extract
+	}
+}
+
+// TraceparentExemplar returns the trace and span ID of the W3C Trace Context
+// traceparent header of r as trace_id and span_id exemplar labels. It returns
+// nil if the header is missing, malformed or not sampled.
+func TraceparentExemplar(r *http.Request) prometheus.Labels {
+	// version-traceid-parentid-flags, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+	parts := strings.Split(r.Header.Get("traceparent"), "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return nil
+	}
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if !isLowerHex(traceID) || !isLowerHex(spanID) || !isLowerHex(flags) {
+		return nil
+	}
+	if strings.Trim(traceID, "0") == "" || strings.Trim(spanID, "0") == "" {
+		return nil
+	}
+	// The sampled flag is the least significant bit of the trace flags
+	if !strings.ContainsRune("13579bdf", rune(flags[1])) {
+		return nil
+	}
+	return prometheus.Labels{"trace_id": traceID, "span_id": spanID}
+}
+
+// isLowerHex reports whether s consists of lowercase hexadecimal digits only.
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// exemplar returns the exemplar labels of r, or nil if there are none or they
+// cannot be attached, counting them as dropped with WithSelfMetrics.
+func (m *Metrics) exemplar(r *http.Request) prometheus.Labels {
+	labels := m.exemplarLabels(r)
+	if labels == nil || validExemplar(labels) {
+		return labels
+	}
+	if m.self != nil {
+		m.self.droppedExemplars.Inc()
+	}
+	return nil
+}
+
+// validExemplar reports whether labels can be attached as an exemplar without
+// client_golang panicking: valid, non-reserved names and UTF-8 values totalling
+// at most prometheus.ExemplarMaxRunes runes.
+func validExemplar(labels prometheus.Labels) bool {
+	runes := 0
+	for name, value := range labels {
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix) || !utf8.ValidString(value) {
+			return false
+		}
+		runes += utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
+	}
+	return runes <= prometheus.ExemplarMaxRunes
+}
+
+// observeWithExemplar observes v, attaching exemplar if it is non-nil.
+func observeWithExemplar(o prometheus.Observer, v float64, exemplar prometheus.Labels) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && exemplar != nil {
+		eo.ObserveWithExemplar(v, exemplar)
+		return
+	}
+	o.Observe(v)
+}
+
+// incWithExemplar increments c, attaching exemplar if it is non-nil.
+func incWithExemplar(c prometheus.Counter, exemplar prometheus.Labels) {
+	if ea, ok := c.(prometheus.ExemplarAdder); ok && exemplar != nil {
+		ea.AddWithExemplar(1, exemplar)
+		return
+	}
+	c.Inc()
+}
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTraceparentExemplar(t *testing.T) {
+	tests := []struct {
+		header string
+		want   prometheus.Labels
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", prometheus.Labels{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736", "span_id": "00f067aa0ba902b7"}},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", nil},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", nil},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", nil},
+		{"garbage", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			r.Header.Set("traceparent", tt.header)
+		}
+		got := TraceparentExemplar(r)
+		if len(got) != len(tt.want) || got["trace_id"] != tt.want["trace_id"] || got["span_id"] != tt.want["span_id"] {
+			t.Errorf("TraceparentExemplar(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestInstrumentExemplars(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithExemplars(true))
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	r := httptest.NewRequest("GET", "/fail", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	scrape := httptest.NewRequest("GET", "/metrics", nil)
+	scrape.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, scrape)
+	body, _ := io.ReadAll(w.Result().Body)
+	bodyStr := string(body)
+
+	for _, series := range []string{
+		`nexen_service_http_request_duration_seconds_bucket{method="GET",path="/fail",service="test-service",le="0.005"} 1 # {`,
+		`nexen_service_http_errors_total{code="Internal Server Error",method="GET",path="/fail",service="test-service"} 1.0 # {`,
+	} {
+		if !hasLineWith(bodyStr, series, `trace_id="4bf92f3577b34da6a3ce929d0e0e4736"`) {
+			t.Errorf("Expected an exemplar with the trace ID on %q", series)
+		}
+	}
+}
+
+// hasLineWith reports whether a line of s starts with prefix and contains substr.
+func hasLineWith(s, prefix, substr string) bool {
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(line, prefix) && strings.Contains(line, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWithExemplarExtractor(t *testing.T) {
+	metrics := New(WithExemplars(true), WithExemplarExtractor(func(r *http.Request) prometheus.Labels {
+		return prometheus.Labels{"request_id": r.Header.Get("X-Request-Id")}
+	}))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-Id", "abc123")
+	metrics.Instrument(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), r)
+
+	scrape := httptest.NewRequest("GET", "/metrics", nil)
+	scrape.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, scrape)
+	body, _ := io.ReadAll(w.Result().Body)
+
+	if !strings.Contains(string(body), `# {request_id="abc123"}`) {
+		t.Fatal("Expected exemplar from the custom extractor")
+	}
+}
+
+func TestInvalidExemplarDropped(t *testing.T) {
+	extractors := map[string]ExemplarExtractor{
+		"too long":      func(*http.Request) prometheus.Labels { return prometheus.Labels{"trace_id": strings.Repeat("a", 200)} },
+		"reserved name": func(*http.Request) prometheus.Labels { return prometheus.Labels{"__trace_id": "abc"} },
+		"invalid utf8":  func(*http.Request) prometheus.Labels { return prometheus.Labels{"trace_id": "\xff"} },
+	}
+	for name, extract := range extractors {
+		for _, async := range []bool{false, true} {
+			opts := []Option{WithServiceName("test-service"), WithSelfMetrics(), WithExemplars(true), WithExemplarExtractor(extract)}
+			if async {
+				opts = append(opts, WithAsyncRecording(16))
+			}
+			metrics := New(opts...)
+			metrics.Instrument(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+			// Close drains the asynchronous recorder
+			metrics.Close(context.Background())
+
+			if got := testutil.ToFloat64(metrics.httpRequests.WithLabelValues("GET", "/", "test-service")); got != 1 {
+				t.Errorf("%s, async %v: expected the request to be recorded, got %v", name, async, got)
+			}
+			if got := testutil.ToFloat64(metrics.self.droppedExemplars); got != 1 {
+				t.Errorf("%s, async %v: expected 1 dropped exemplar, got %v", name, async, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// WithExtraHTTPLabels adds labels whose values are set per request with
+// SetLabel to http_requests_total, http_request_duration_seconds and
+// http_errors_total. Labels not set during a request are recorded as empty.
+// Every distinct value creates new series, so only use labels with a small,
+// bounded set of values, such as a tenant tier rather than a tenant ID.
+func WithExtraHTTPLabels(names []string) Option {
+	return func(m *Metrics) {
+		m.extraLabels = append([]string(nil), names...)
+	}
+}
+
+// requestLabels holds the values of the extra HTTP labels of a request.
+type requestLabels struct {
+	names  []string
+	mu     sync.Mutex
+	values []string
+}
+
+// SetLabel sets the value of the extra HTTP label name, declared with
+// WithExtraHTTPLabels, for the request whose context is ctx:
+//
+//	func handler(w http.ResponseWriter, r *http.Request) {
+//		metrics.SetLabel(r.Context(), "tenant", tenantTier(r))
+//		...
+//	}
+//
+// Calls for undeclared labels or outside a handler wrapped by Instrument are
+// ignored.
+func SetLabel(ctx context.Context, name, value string) {
+	labels, ok := ctx.Value(requestLabelsKey).(*requestLabels)
+	if !ok {
+		return
+	}
+	for i, n := range labels.names {
+		if n == name {
+			labels.mu.Lock()
+			labels.values[i] = value
+			labels.mu.Unlock()
+			return
+		}
+	}
+}
+
+// withRequestLabels returns a context carrying unset extra HTTP labels.
+func (m *Metrics) withRequestLabels(ctx context.Context) (context.Context, *requestLabels) {
+	labels := &requestLabels{names: m.extraLabels, values: make([]string, len(m.extraLabels))}
+	return context.WithValue(ctx, requestLabelsKey, labels), labels
+}
+
+// snapshot returns the values set for the request.
+func (l *requestLabels) snapshot() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.values...)
+}
+
+// extraKey joins extra label values into a comparable cache key.
+func extraKey(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.Join(values, "\xff")
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestExtraHTTPLabels(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithExtraHTTPLabels([]string{"tenant", "plan"}))
+
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tenant := r.URL.Query().Get("tenant"); tenant != "" {
+			SetLabel(r.Context(), "tenant", tenant)
+		}
+		SetLabel(r.Context(), "undeclared", "ignored")
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	for _, target := range []string{"/orders?tenant=acme", "/orders?tenant=acme&fail=1", "/orders?tenant=globex", "/orders"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	expected := `
+# HELP nexen_service_http_errors_total Total number of HTTP responses with error status codes
+# TYPE nexen_service_http_errors_total counter
+nexen_service_http_errors_total{code="Internal Server Error",method="GET",path="/orders",plan="",service="test-service",tenant="acme"} 1
+# HELP nexen_service_http_requests_total Total number of HTTP requests received
+# TYPE nexen_service_http_requests_total counter
+nexen_service_http_requests_total{method="GET",path="/orders",plan="",service="test-service",tenant=""} 1
+nexen_service_http_requests_total{method="GET",path="/orders",plan="",service="test-service",tenant="acme"} 2
+nexen_service_http_requests_total{method="GET",path="/orders",plan="",service="test-service",tenant="globex"} 1
+`
+	if err := testutil.GatherAndCompare(metrics.Registry(), strings.NewReader(expected),
+		"nexen_service_http_errors_total", "nexen_service_http_requests_total"); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.CollectAndCount(metrics.httpDuration); got != 3 {
+		t.Errorf("Expected a duration series per tenant, got %d", got)
+	}
+}
+
+func TestSetLabelOutsideInstrument(t *testing.T) {
+	// Must not panic without labels in the context
+	SetLabel(context.Background(), "tenant", "acme")
+}
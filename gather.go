@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// WithMetricRename renames metric families at scrape time. Keys are the
+// fully-qualified names emitted by the registry and values are the names exposed
+// by Handler. Help text, type and samples are preserved; families that do not
+// match are left untouched. A rename that collides with another exposed family
+// causes the scrape to fail.
+func WithMetricRename(renames map[string]string) Option {
+	return func(m *Metrics) {
+		m.renames = renames
+	}
+}
+
+// buildGatherer returns the gatherer used by Handler, layering the configured
+// post-processing steps on top of the registry.
+func (m *Metrics) buildGatherer() prometheus.Gatherer {
+	var g prometheus.Gatherer = m.baseGatherer
+	g = m.startMultiProcess(g)
+	if m.self != nil {
+		g = m.self.countingGatherer(g)
+	}
+	g = m.deprecatingGatherer(g)
+	if len(m.renames) > 0 {
+		g = renamingGatherer(g, m.renames)
+	}
+	return g
+}
+
+// renamingGatherer wraps g and renames the families listed in renames.
+func renamingGatherer(g prometheus.Gatherer, renames map[string]string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+
+		renamed := false
+		for _, mf := range families {
+			if to, ok := renames[mf.GetName()]; ok {
+				mf.Name = &to
+				renamed = true
+			}
+		}
+		if !renamed {
+			return families, err
+		}
+
+		sort.Slice(families, func(i, j int) bool {
+			return families[i].GetName() < families[j].GetName()
+		})
+		for i := 1; i < len(families); i++ {
+			if families[i].GetName() == families[i-1].GetName() {
+				return nil, fmt.Errorf("renamed metric %s collides with an existing metric", families[i].GetName())
+			}
+		}
+		return families, err
+	})
+}
+
+// DeprecateMetric marks a metric family as deprecated by appending a note to its
+// HELP text, e.g. "DEPRECATED: use nexen_service_events_total", so consumers
+// discover renames before the metric is removed. name is the fully-qualified
+// name as registered; values and types are left intact. An empty replacement
+// only marks the metric as deprecated.
+func (m *Metrics) DeprecateMetric(name, replacement string) {
+	note := "DEPRECATED"
+	if replacement != "" {
+		note += ": use " + replacement
+	}
+
+	m.deprecationsMu.Lock()
+	defer m.deprecationsMu.Unlock()
+	if m.deprecations == nil {
+		m.deprecations = make(map[string]string)
+	}
+	m.deprecations[name] = note
+}
+
+// deprecatingGatherer wraps g and appends deprecation notes to HELP texts.
+func (m *Metrics) deprecatingGatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+
+		m.deprecationsMu.RLock()
+		defer m.deprecationsMu.RUnlock()
+		if len(m.deprecations) == 0 {
+			return families, err
+		}
+
+		for _, mf := range families {
+			if note, ok := m.deprecations[mf.GetName()]; ok {
+				help := note
+				if mf.GetHelp() != "" {
+					help = mf.GetHelp() + " " + note
+				}
+				mf.Help = &help
+			}
+		}
+		return families, err
+	})
+}
+
+// FilteredHandler returns a scrape handler exposing a subset of the metrics
+// served by Handler. Families are matched by name prefix: when include is
+// non-empty only families starting with one of its prefixes are kept, and
+// families starting with any exclude prefix are then dropped. For example,
+// include {"nexen_"} with exclude {"nexen_service_http_"} exposes only business
+// metrics. Handler itself stays unfiltered.
+func (m *Metrics) FilteredHandler(include, exclude []string) http.Handler {
+	return promhttp.HandlerFor(filteringGatherer(m.gatherer, include, exclude), m.handlerOpts())
+}
+
+// filteringGatherer wraps g and keeps only families matching the include and
+// exclude prefixes.
+func filteringGatherer(g prometheus.Gatherer, include, exclude []string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+
+		kept := families[:0]
+		for _, mf := range families {
+			name := mf.GetName()
+			if len(include) > 0 && !hasAnyPrefix(name, include) {
+				continue
+			}
+			if hasAnyPrefix(name, exclude) {
+				continue
+			}
+			kept = append(kept, mf)
+		}
+		return kept, err
+	})
+}
+
+// hasAnyPrefix reports whether s starts with any of the prefixes.
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
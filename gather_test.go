@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricRename(t *testing.T) {
+	metrics := New(
+		WithServiceName("test-service"),
+		WithMetricRename(map[string]string{
+			"nexen_service_application_events_total": "nexen_service_events_total",
+		}),
+	)
+	metrics.RecordEvent("signup")
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Result().Body)
+	bodyStr := string(body)
+
+	if strings.Contains(bodyStr, "nexen_service_application_events_total") {
+		t.Fatal("Expected original metric name to be replaced")
+	}
+	for _, want := range []string{
+		"# HELP nexen_service_events_total Count of application-specific events",
+		"# TYPE nexen_service_events_total counter",
+		`nexen_service_events_total{event="signup",service="test-service"} 1`,
+	} {
+		if !strings.Contains(bodyStr, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
+
+func TestMetricRenameCollision(t *testing.T) {
+	metrics := New(WithMetricRename(map[string]string{
+		"nexen_service_gauge": "nexen_service_http_requests_total",
+	}))
+	metrics.SetGauge("depth", 1)
+	metrics.Instrument(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status code 500 on colliding rename, got %d", w.Code)
+	}
+}
+
+func TestFilteredHandler(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	metrics.RecordEvent("signup")
+	metrics.Instrument(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	scrape := func(h http.Handler) string {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		body, _ := io.ReadAll(w.Result().Body)
+		return string(body)
+	}
+
+	public := scrape(metrics.FilteredHandler([]string{"nexen_"}, []string{"nexen_service_http_"}))
+	if !strings.Contains(public, "nexen_service_application_events_total") {
+		t.Fatal("Expected included family to be exposed")
+	}
+	if strings.Contains(public, "nexen_service_http_requests_total") {
+		t.Fatal("Expected excluded family to be dropped")
+	}
+	if strings.Contains(public, "go_goroutines") {
+		t.Fatal("Expected families outside include prefixes to be dropped")
+	}
+
+	internal := scrape(metrics.FilteredHandler(nil, []string{"go_"}))
+	if strings.Contains(internal, "go_goroutines") || !strings.Contains(internal, "nexen_service_http_requests_total") {
+		t.Fatal("Expected exclude-only filter to drop only matching families")
+	}
+
+	if !strings.Contains(scrape(metrics.Handler()), "go_goroutines") {
+		t.Fatal("Expected Handler to stay unfiltered")
+	}
+}
+
+func TestDeprecateMetric(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	metrics.RecordEvent("signup")
+	metrics.SetGauge("depth", 2)
+
+	metrics.DeprecateMetric("nexen_service_application_events_total", "nexen_service_events_total")
+	metrics.DeprecateMetric("nexen_service_gauge", "")
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Result().Body)
+	bodyStr := string(body)
+
+	for _, want := range []string{
+		"# HELP nexen_service_application_events_total Count of application-specific events DEPRECATED: use nexen_service_events_total",
+		"# TYPE nexen_service_application_events_total counter",
+		`nexen_service_application_events_total{event="signup",service="test-service"} 1`,
+		"# HELP nexen_service_gauge Service-specific gauge for arbitrary values DEPRECATED\n",
+	} {
+		if !strings.Contains(bodyStr, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
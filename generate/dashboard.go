@@ -0,0 +1,270 @@
+package generate
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+)
+
+// dashboard is the subset of the Grafana dashboard model that is generated.
+type dashboard struct {
+	Title         string     `json:"title"`
+	UID           string     `json:"uid"`
+	Tags          []string   `json:"tags"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Time          timeRange  `json:"time"`
+	Refresh       string     `json:"refresh"`
+	Templating    templating `json:"templating"`
+	Panels        []panel    `json:"panels"`
+}
+
+type timeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type templating struct {
+	List []variable `json:"list"`
+}
+
+type variable struct {
+	Name       string      `json:"name"`
+	Label      string      `json:"label,omitempty"`
+	Type       string      `json:"type"`
+	Query      string      `json:"query"`
+	Datasource *datasource `json:"datasource,omitempty"`
+	Current    *current    `json:"current,omitempty"`
+	Refresh    int         `json:"refresh,omitempty"`
+}
+
+type current struct {
+	Text  string `json:"text"`
+	Value string `json:"value"`
+}
+
+type datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type panel struct {
+	ID          int          `json:"id"`
+	Type        string       `json:"type"`
+	Title       string       `json:"title"`
+	Description string       `json:"description,omitempty"`
+	GridPos     gridPos      `json:"gridPos"`
+	Datasource  *datasource  `json:"datasource,omitempty"`
+	Targets     []target     `json:"targets,omitempty"`
+	FieldConfig *fieldConfig `json:"fieldConfig,omitempty"`
+	Collapsed   *bool        `json:"collapsed,omitempty"`
+}
+
+type gridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+}
+
+type fieldConfig struct {
+	Defaults fieldDefaults `json:"defaults"`
+}
+
+type fieldDefaults struct {
+	Unit string `json:"unit"`
+}
+
+var prometheusDatasource = &datasource{Type: "prometheus", UID: "${datasource}"}
+
+// layout places panels in rows of two, each section starting with a row.
+type layout struct {
+	panels []panel
+	y      int
+	column int
+}
+
+func (l *layout) row(title string) {
+	if l.column > 0 {
+		l.y += 8
+		l.column = 0
+	}
+	collapsed := false
+	l.panels = append(l.panels, panel{
+		ID:        len(l.panels) + 1,
+		Type:      "row",
+		Title:     title,
+		GridPos:   gridPos{H: 1, W: 24, Y: l.y},
+		Collapsed: &collapsed,
+	})
+	l.y++
+}
+
+func (l *layout) graph(title, description, unit string, targets ...target) {
+	for i := range targets {
+		targets[i].RefID = string(rune('A' + i))
+	}
+	l.panels = append(l.panels, panel{
+		ID:          len(l.panels) + 1,
+		Type:        "timeseries",
+		Title:       title,
+		Description: description,
+		GridPos:     gridPos{H: 8, W: 12, X: l.column * 12, Y: l.y},
+		Datasource:  prometheusDatasource,
+		Targets:     targets,
+		FieldConfig: &fieldConfig{Defaults: fieldDefaults{Unit: unit}},
+	})
+	if l.column++; l.column == 2 {
+		l.y += 8
+		l.column = 0
+	}
+}
+
+// Dashboard returns a Grafana dashboard for the metrics registered in m, with
+// a row for the HTTP request rate, errors and latency (RED), one for each SLO
+// tracker and one with a panel per other counter, gauge and histogram. The
+// dashboard has variables for the Prometheus data source and the service,
+// which defaults to the service name of m.
+func Dashboard(m *metrics.Metrics, opts ...Option) ([]byte, error) {
+	c := newConfig(m, opts)
+	inv := inspect(m)
+
+	var l layout
+	if inv.has(httpRequests) {
+		l.row("HTTP")
+		l.graph("Request rate", "Requests per second by path", "reqps", target{
+			Expr:         fmt.Sprintf(`sum by (path) (rate(%s{service="$service"}[$__rate_interval]))`, httpRequests),
+			LegendFormat: "{{path}}",
+		})
+		if inv.has(httpErrors) {
+			l.graph("Error ratio", "Share of requests answered with an error status", "percentunit", target{
+				Expr: fmt.Sprintf(`sum by (path) (rate(%s{service="$service"}[$__rate_interval])) / sum by (path) (rate(%s{service="$service"}[$__rate_interval]))`,
+					httpErrors, httpRequests),
+				LegendFormat: "{{path}}",
+			})
+		}
+		if inv.has(httpDuration) {
+			var targets []target
+			for _, q := range []string{"0.5", "0.95", "0.99"} {
+				targets = append(targets, target{
+					Expr:         fmt.Sprintf(`histogram_quantile(%s, sum by (le) (rate(%s_bucket{service="$service"}[$__rate_interval])))`, q, httpDuration),
+					LegendFormat: "p" + strings.TrimPrefix(q, "0."),
+				})
+			}
+			l.graph("Latency", "Request duration percentiles", "s", targets...)
+		}
+	}
+
+	if len(inv.trackers) > 0 {
+		l.row("SLOs")
+	}
+	for _, t := range inv.trackers {
+		for _, o := range t.Objectives() {
+			l.graph(o.Name+" burn rate", fmt.Sprintf("Error budget burn rate, target %v of requests within %v", o.Target, o.Threshold), "short", target{
+				Expr:         fmt.Sprintf(`%s{service="$service",slo=%q}`, sloBurnRate, o.Name),
+				LegendFormat: "{{window}}",
+			})
+			l.graph(o.Name+" good ratio", "Share of requests within the threshold", "percentunit", target{
+				Expr: fmt.Sprintf(`sum(rate(%s{service="$service",slo=%q,result="good"}[$__rate_interval])) / sum(rate(%s{service="$service",slo=%q}[$__rate_interval]))`,
+					sloEvents, o.Name, sloEvents, o.Name),
+				LegendFormat: "good",
+			})
+		}
+	}
+
+	others := slices.DeleteFunc(slices.Clone(inv.families), func(f family) bool {
+		return f.name == httpRequests || f.name == httpErrors || f.name == httpDuration
+	})
+	if len(others) > 0 {
+		l.row("Metrics")
+		for _, f := range others {
+			l.graph(strings.TrimPrefix(f.name, "nexen_service_"), f.help, unitOf(f), familyTarget(f))
+		}
+	}
+
+	service := inv.service
+	d := dashboard{
+		Title:         c.title,
+		UID:           "nexen-" + service,
+		Tags:          []string{"nexen"},
+		SchemaVersion: 39,
+		Time:          timeRange{From: "now-6h", To: "now"},
+		Refresh:       "30s",
+		Templating: templating{List: []variable{
+			{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"},
+			{
+				Name:       "service",
+				Label:      "Service",
+				Type:       "query",
+				Query:      "label_values(service)",
+				Datasource: prometheusDatasource,
+				Current:    &current{Text: service, Value: service},
+				Refresh:    1,
+			},
+		}},
+		Panels: l.panels,
+	}
+	out, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode dashboard: %w", err)
+	}
+	return append(out, '\n'), nil
+}
+
+// familyTarget returns the query graphing f: the per-second rate of counters,
+// the value of gauges, the p95 of histograms and the mean of summaries, each
+// summed by the labels of f.
+func familyTarget(f family) target {
+	labels := f.groupLabels()
+	by, legend := "", f.name
+	if len(labels) > 0 {
+		by = " by (" + strings.Join(labels, ", ") + ")"
+		var parts []string
+		for _, label := range labels {
+			parts = append(parts, "{{"+label+"}}")
+		}
+		legend = strings.Join(parts, " ")
+	}
+	selector := ""
+	if slices.Contains(f.labels, "service") {
+		selector = `{service="$service"}`
+	}
+
+	var expr string
+	switch f.kind {
+	case "counter":
+		expr = fmt.Sprintf("sum%s (rate(%s%s[$__rate_interval]))", by, f.name, selector)
+	case "gauge":
+		expr = fmt.Sprintf("sum%s (%s%s)", by, f.name, selector)
+	case "histogram":
+		buckets := " by (" + strings.Join(append([]string{"le"}, labels...), ", ") + ")"
+		expr = fmt.Sprintf("histogram_quantile(0.95, sum%s (rate(%s_bucket%s[$__rate_interval])))", buckets, f.name, selector)
+	default:
+		expr = fmt.Sprintf("sum%s (rate(%s_sum%s[$__rate_interval])) / sum%s (rate(%s_count%s[$__rate_interval]))",
+			by, f.name, selector, by, f.name, selector)
+	}
+	return target{Expr: expr, LegendFormat: legend}
+}
+
+// unitOf picks the Grafana unit of f from its name.
+func unitOf(f family) string {
+	base := strings.TrimSuffix(f.name, "_total")
+	switch {
+	case strings.HasSuffix(base, "_seconds"):
+		return "s"
+	case strings.HasSuffix(base, "_bytes"):
+		return "bytes"
+	case f.kind == "counter":
+		return "ops"
+	default:
+		return "short"
+	}
+}
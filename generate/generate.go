@@ -0,0 +1,259 @@
+// Package generate emits a Grafana dashboard and Prometheus alerting rules for
+// the metrics registered in a Metrics instance, so every service gets the same
+// dashboards and alerts without writing them by hand.
+package generate
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/nexen-io/nexen-metrics/slo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Names of the HTTP metrics recorded by Instrument.
+const (
+	httpRequests = "nexen_service_http_requests_total"
+	httpErrors   = "nexen_service_http_errors_total"
+	httpDuration = "nexen_service_http_request_duration_seconds"
+	sloBurnRate  = "nexen_service_slo_burn_rate"
+	sloEvents    = "nexen_service_slo_events_total"
+)
+
+// Option configures the generated dashboard and rules.
+type Option func(*config)
+
+type config struct {
+	title      string
+	errorRatio float64
+	latency    time.Duration
+}
+
+// WithTitle sets the dashboard title. It defaults to the service name.
+func WithTitle(title string) Option {
+	return func(c *config) {
+		c.title = title
+	}
+}
+
+// WithErrorRatioThreshold sets the ratio of HTTP error responses to requests
+// above which an alert fires. It defaults to 0.05.
+func WithErrorRatioThreshold(ratio float64) Option {
+	return func(c *config) {
+		c.errorRatio = ratio
+	}
+}
+
+// WithLatencyThreshold sets the p99 HTTP latency above which an alert fires.
+// It defaults to one second.
+func WithLatencyThreshold(d time.Duration) Option {
+	return func(c *config) {
+		c.latency = d
+	}
+}
+
+// Run implements a "generate" subcommand writing the dashboard and rules to
+// the files named by the -dashboard and -rules flags in args, "-" meaning
+// standard output:
+//
+//	if len(os.Args) > 1 && os.Args[1] == "generate" {
+//		if err := generate.Run(m, os.Args[2:]); err != nil {
+//			log.Fatal(err)
+//		}
+//		return
+//	}
+func Run(m *metrics.Metrics, args []string, opts ...Option) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	dashboardPath := fs.String("dashboard", "", "Write the Grafana dashboard JSON to this file")
+	rulesPath := fs.String("rules", "", "Write the Prometheus alerting rules YAML to this file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dashboardPath == "" && *rulesPath == "" {
+		return errors.New("nothing to generate: set -dashboard or -rules")
+	}
+
+	if *dashboardPath != "" {
+		dashboard, err := Dashboard(m, opts...)
+		if err != nil {
+			return err
+		}
+		if err := writeOutput(*dashboardPath, dashboard); err != nil {
+			return err
+		}
+	}
+	if *rulesPath != "" {
+		rules, err := AlertRules(m, opts...)
+		if err != nil {
+			return err
+		}
+		if err := writeOutput(*rulesPath, rules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeOutput writes data to path, or to standard output if path is "-".
+func writeOutput(path string, data []byte) error {
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", path, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func newConfig(m *metrics.Metrics, opts []Option) config {
+	c := config{
+		title:      m.ServiceName(),
+		errorRatio: 0.05,
+		latency:    time.Second,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// family describes a registered metric family.
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+// inventory is what is registered in a Metrics instance.
+type inventory struct {
+	service  string
+	families []family
+	byName   map[string]family
+	trackers []*slo.Tracker
+}
+
+// has reports whether all named families are registered.
+func (inv inventory) has(names ...string) bool {
+	for _, name := range names {
+		if _, ok := inv.byName[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// inspect lists the counter, gauge, histogram and summary vectors and the SLO
+// trackers registered through m, sorted by name. Other collectors, such as the
+// Go and process collectors, are skipped.
+func inspect(m *metrics.Metrics) inventory {
+	inv := inventory{service: m.ServiceName(), byName: map[string]family{}}
+	for _, c := range m.Collectors() {
+		if t, ok := c.(*slo.Tracker); ok {
+			inv.trackers = append(inv.trackers, t)
+			continue
+		}
+		kind := kindOf(c)
+		if kind == "" {
+			continue
+		}
+		for _, d := range describe(c) {
+			f, ok := parseDesc(d)
+			if !ok {
+				continue
+			}
+			f.kind = kind
+			inv.families = append(inv.families, f)
+			inv.byName[f.name] = f
+		}
+	}
+	sort.Slice(inv.families, func(i, j int) bool {
+		return inv.families[i].name < inv.families[j].name
+	})
+	return inv
+}
+
+// kindOf returns the metric type of the vector c, or "" for other collectors.
+func kindOf(c prometheus.Collector) string {
+	switch c.(type) {
+	case *prometheus.CounterVec:
+		return "counter"
+	case *prometheus.GaugeVec:
+		return "gauge"
+	case *prometheus.HistogramVec:
+		return "histogram"
+	case *prometheus.SummaryVec:
+		return "summary"
+	default:
+		return ""
+	}
+}
+
+func describe(c prometheus.Collector) []*prometheus.Desc {
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(ch)
+		close(ch)
+	}()
+	var descs []*prometheus.Desc
+	for d := range ch {
+		descs = append(descs, d)
+	}
+	return descs
+}
+
+// descPattern matches the String form of a prometheus.Desc, which is the only
+// way to read its name, help and labels.
+var descPattern = regexp.MustCompile(`^Desc\{fqName: ("(?:[^"\\]|\\.)*"), help: ("(?:[^"\\]|\\.)*"), constLabels: \{.*\}, variableLabels: \{([^}]*)\}\}$`)
+
+// parseDesc extracts the name, help and variable labels of d.
+func parseDesc(d *prometheus.Desc) (family, bool) {
+	match := descPattern.FindStringSubmatch(d.String())
+	if match == nil {
+		return family{}, false
+	}
+	name, err := strconv.Unquote(match[1])
+	if err != nil {
+		return family{}, false
+	}
+	help, err := strconv.Unquote(match[2])
+	if err != nil {
+		return family{}, false
+	}
+	var labels []string
+	for _, label := range strings.Split(match[3], ",") {
+		// Constrained labels are rendered as c(name)
+		label = strings.TrimSuffix(strings.TrimPrefix(label, "c("), ")")
+		if label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return family{name: name, help: help, labels: labels}, true
+}
+
+// groupLabels returns the labels of f to aggregate by, leaving out the
+// service label the dashboard and rules filter on.
+func (f family) groupLabels() []string {
+	var labels []string
+	for _, label := range f.labels {
+		if label != "service" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
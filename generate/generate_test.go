@@ -0,0 +1,115 @@
+package generate
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/nexen-io/nexen-metrics/slo"
+	"gopkg.in/yaml.v3"
+)
+
+func newTestMetrics(t *testing.T) *metrics.Metrics {
+	t.Helper()
+	m := metrics.New(metrics.WithServiceName("checkout"), metrics.WithHistogramBuckets([]float64{0.1, 0.3, 1}))
+	if _, err := m.RegisterCounter("orders_total", "Orders placed", []string{"region"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := slo.New(m, []slo.Objective{{Name: "api", Target: 0.99, Threshold: 300 * time.Millisecond}}); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestDashboard(t *testing.T) {
+	out, err := Dashboard(newTestMetrics(t), WithTitle("Checkout"))
+	if err != nil {
+		t.Fatalf("Dashboard: %v", err)
+	}
+
+	var d dashboard
+	if err := json.Unmarshal(out, &d); err != nil {
+		t.Fatalf("Dashboard is not valid JSON: %v", err)
+	}
+	if d.Title != "Checkout" || d.UID != "nexen-checkout" {
+		t.Errorf("Unexpected title %q and uid %q", d.Title, d.UID)
+	}
+
+	exprs := map[string]string{}
+	for _, p := range d.Panels {
+		if len(p.Targets) > 0 {
+			exprs[p.Title] = p.Targets[0].Expr
+		}
+	}
+	for title, want := range map[string]string{
+		"Request rate":            `rate(nexen_service_http_requests_total{service="$service"}`,
+		"Error ratio":             `nexen_service_http_errors_total`,
+		"Latency":                 `histogram_quantile(0.5, sum by (le) (rate(nexen_service_http_request_duration_seconds_bucket`,
+		"api burn rate":           `nexen_service_slo_burn_rate{service="$service",slo="api"}`,
+		"orders_total":            `sum by (region) (rate(nexen_service_orders_total{service="$service"}[$__rate_interval]))`,
+		"batch_size":              `histogram_quantile(0.95, sum by (le, queue)`,
+		"api good ratio":          `result="good"`,
+		"http_in_flight_requests": `sum (nexen_service_http_in_flight_requests{service="$service"})`,
+	} {
+		if !strings.Contains(exprs[title], want) {
+			t.Errorf("Expected panel %q to query %q, got %q", title, want, exprs[title])
+		}
+	}
+}
+
+func TestAlertRules(t *testing.T) {
+	out, err := AlertRules(newTestMetrics(t), WithLatencyThreshold(500*time.Millisecond))
+	if err != nil {
+		t.Fatalf("AlertRules: %v", err)
+	}
+
+	var rules ruleFile
+	if err := yaml.Unmarshal(out, &rules); err != nil {
+		t.Fatalf("Rules are not valid YAML: %v", err)
+	}
+	if len(rules.Groups) != 1 {
+		t.Fatalf("Expected 1 rule group, got %d", len(rules.Groups))
+	}
+
+	var alerts []string
+	for _, r := range rules.Groups[0].Rules {
+		alerts = append(alerts, r.Alert+" "+r.Expr)
+	}
+	got := strings.Join(alerts, "\n")
+	for _, want := range []string{
+		`NexenHTTPHighErrorRatio sum(rate(nexen_service_http_errors_total{service="checkout"}[5m])) / sum(rate(nexen_service_http_requests_total{service="checkout"}[5m])) > 0.05`,
+		`NexenHTTPHighLatency histogram_quantile(0.99, sum by (le) (rate(nexen_service_http_request_duration_seconds_bucket{service="checkout"}[5m]))) > 0.5`,
+		`NexenSLOBurnRate nexen_service_slo_burn_rate{service="checkout",slo="api",window="1h"} > 14.4 and ignoring(window) nexen_service_slo_burn_rate{service="checkout",slo="api",window="5m"} > 14.4`,
+		`window="6h"} > 6 and ignoring(window)`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected rule %q, got\n%s", want, got)
+		}
+	}
+	// The default windows do not cover the slower burn rate alerts
+	if strings.Contains(got, `window="1d"`) {
+		t.Errorf("Expected no alert on windows the tracker does not compute, got\n%s", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	m := newTestMetrics(t)
+	dir := t.TempDir()
+	dashboardPath, rulesPath := filepath.Join(dir, "dashboard.json"), filepath.Join(dir, "rules.yaml")
+
+	if err := Run(m, nil); err == nil {
+		t.Error("Expected Run without outputs to fail")
+	}
+	if err := Run(m, []string{"-dashboard", dashboardPath, "-rules", rulesPath}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, path := range []string{dashboardPath, rulesPath} {
+		if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+			t.Errorf("Expected %s to be written: %v", path, err)
+		}
+	}
+}
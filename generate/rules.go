@@ -0,0 +1,119 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/nexen-io/nexen-metrics/slo"
+	"gopkg.in/yaml.v3"
+)
+
+// ruleFile is the Prometheus rule file format.
+type ruleFile struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name  string `yaml:"name"`
+	Rules []rule `yaml:"rules"`
+}
+
+type rule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// burnRateAlert is a pair of windows of the multiwindow, multi-burn-rate SLO
+// alerts: the long window detects the burn and the short one resets the
+// alert quickly once it stops.
+type burnRateAlert struct {
+	long, short time.Duration
+	factor      float64
+	severity    string
+}
+
+// burnRateAlerts are the standard pairs, paging when 2% of a 30-day budget is
+// spent in an hour or 5% in six hours.
+var burnRateAlerts = []burnRateAlert{
+	{time.Hour, 5 * time.Minute, 14.4, "critical"},
+	{6 * time.Hour, 30 * time.Minute, 6, "critical"},
+	{24 * time.Hour, 2 * time.Hour, 3, "warning"},
+	{72 * time.Hour, 6 * time.Hour, 1, "warning"},
+}
+
+// AlertRules returns a Prometheus rule file with alerts for the metrics
+// registered in m: the HTTP error ratio and p99 latency, and the burn rate of
+// every SLO for each standard window pair its tracker computes.
+func AlertRules(m *metrics.Metrics, opts ...Option) ([]byte, error) {
+	c := newConfig(m, opts)
+	inv := inspect(m)
+	service := inv.service
+
+	var rules []rule
+	if inv.has(httpRequests, httpErrors) {
+		rules = append(rules, rule{
+			Alert: "NexenHTTPHighErrorRatio",
+			Expr: fmt.Sprintf(`sum(rate(%s{service=%q}[5m])) / sum(rate(%s{service=%q}[5m])) > %s`,
+				httpErrors, service, httpRequests, service, formatFloat(c.errorRatio)),
+			For:    "10m",
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary": fmt.Sprintf("More than %s%% of %s requests fail", formatFloat(c.errorRatio*100), service),
+			},
+		})
+	}
+	if inv.has(httpDuration) {
+		rules = append(rules, rule{
+			Alert: "NexenHTTPHighLatency",
+			Expr: fmt.Sprintf(`histogram_quantile(0.99, sum by (le) (rate(%s_bucket{service=%q}[5m]))) > %s`,
+				httpDuration, service, formatFloat(c.latency.Seconds())),
+			For:    "10m",
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary": fmt.Sprintf("p99 latency of %s is above %v", service, c.latency),
+			},
+		})
+	}
+
+	for _, t := range inv.trackers {
+		windows := t.Windows()
+		for _, o := range t.Objectives() {
+			for _, a := range burnRateAlerts {
+				if !slices.Contains(windows, a.long) || !slices.Contains(windows, a.short) {
+					continue
+				}
+				factor := formatFloat(a.factor)
+				rules = append(rules, rule{
+					Alert: "NexenSLOBurnRate",
+					Expr: fmt.Sprintf(`%s{service=%q,slo=%q,window=%q} > %s and ignoring(window) %s{service=%q,slo=%q,window=%q} > %s`,
+						sloBurnRate, service, o.Name, slo.FormatWindow(a.long), factor,
+						sloBurnRate, service, o.Name, slo.FormatWindow(a.short), factor),
+					Labels: map[string]string{"severity": a.severity, "slo": o.Name},
+					Annotations: map[string]string{
+						"summary": fmt.Sprintf("SLO %s of %s is burning its error budget %sx too fast over %s",
+							o.Name, service, factor, slo.FormatWindow(a.long)),
+					},
+				})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(ruleFile{Groups: []ruleGroup{{Name: "nexen-" + service, Rules: rules}}}); err != nil {
+		return nil, fmt.Errorf("failed to encode alert rules: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
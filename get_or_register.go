@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// GetOrRegisterCounter is like RegisterCounter, but returns the counter already
+// registered with the same name, help text and labels instead of failing, so
+// independent modules can declare the metrics they share.
+func (m *Metrics) GetOrRegisterCounter(name, help string, labels []string) (*prometheus.CounterVec, error) {
+	return getOrRegister(m, name, "counter", help, labels, func() (*prometheus.CounterVec, error) {
+		return m.registerCounter(name, help, labels, m.registerShared)
+	})
+}
+
+// GetOrRegisterHistogram is like RegisterHistogram, but returns the histogram
+// already registered with the same name, help text, buckets and labels instead
+// of failing.
+func (m *Metrics) GetOrRegisterHistogram(name, help string, buckets []float64, labels []string) (*prometheus.HistogramVec, error) {
+	return getOrRegister(m, name, "histogram", help, labels, func() (*prometheus.HistogramVec, error) {
+		return m.registerHistogram(name, help, buckets, labels, m.registerShared)
+	})
+}
+
+// GetOrRegisterGauge is like RegisterGauge, but returns the gauge already
+// registered with the same name, help text and labels instead of failing.
+func (m *Metrics) GetOrRegisterGauge(name, help string, labels []string) (*prometheus.GaugeVec, error) {
+	return getOrRegister(m, name, "gauge", help, labels, func() (*prometheus.GaugeVec, error) {
+		return m.registerGauge(name, help, labels, m.registerShared)
+	})
+}
+
+// getOrRegister registers a collector with register, falling back to the
+// collector it collides with if that has type C. Registrations with the same
+// name but other labels or help text still fail, and only those collisions
+// count as registration failures.
+func getOrRegister[C prometheus.Collector](m *Metrics, name, typ, help string, labels []string, register func() (C, error)) (C, error) {
+	c, err := register()
+	if err == nil {
+		return c, nil
+	}
+	c, err = existing[C](err)
+	if err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			m.registrationFailed(err)
+		}
+		return c, err
+	}
+	m.index(name, c, typ, help, append(labels[:len(labels):len(labels)], "service"))
+	return c, nil
+}
+
+// existing returns the collector of type C that err reports as already
+// registered.
+func existing[C prometheus.Collector](err error) (C, error) {
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if c, ok := are.ExistingCollector.(C); ok {
+			return c, nil
+		}
+	}
+	var zero C
+	return zero, err
+}
+
+// indexedMetric is a collector registered by name by one of the Register
+// methods.
+type indexedMetric struct {
+	collector prometheus.Collector
+	info      MetricInfo
+}
+
+// index remembers c as the collector registered under name by one of the
+// Register methods, with its type, help text and label names.
+func (m *Metrics) index(name string, c prometheus.Collector, typ, help string, labels []string) {
+	info := MetricInfo{
+		Name:   prometheus.BuildFQName(namespace, subsystem, name),
+		Type:   typ,
+		Help:   help,
+		Labels: labels,
+	}
+
+	m.registeredMu.Lock()
+	defer m.registeredMu.Unlock()
+	if m.named == nil {
+		m.named = make(map[string]indexedMetric)
+	}
+	m.named[name] = indexedMetric{collector: c, info: info}
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import "testing"
+
+func TestGetOrRegister(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+
+	first, err := metrics.GetOrRegisterCounter("jobs_total", "Jobs", []string{"kind"})
+	if err != nil {
+		t.Fatalf("GetOrRegisterCounter: %v", err)
+	}
+	second, err := metrics.GetOrRegisterCounter("jobs_total", "Jobs", []string{"kind"})
+	if err != nil {
+		t.Fatalf("Expected the existing counter, got %v", err)
+	}
+	if first != second {
+		t.Error("Expected the same counter from both calls")
+	}
+	if _, err := metrics.RegisterCounter("jobs_total", "Jobs", []string{"kind"}); err == nil {
+		t.Error("Expected RegisterCounter to still fail for a duplicate")
+	}
+
+	if _, err := metrics.GetOrRegisterCounter("jobs_total", "Jobs", []string{"queue"}); err == nil {
+		t.Error("Expected different labels to fail")
+	}
+	if _, err := metrics.GetOrRegisterGauge("jobs_total", "Jobs", []string{"kind"}); err == nil {
+		t.Error("Expected a different type to fail")
+	}
+
+	for i := 0; i < 2; i++ {
+		h, err := metrics.GetOrRegisterHistogram("job_seconds", "Job latency", []float64{1}, nil)
+		if err != nil {
+			t.Fatalf("GetOrRegisterHistogram: %v", err)
+		}
+		g, err := metrics.GetOrRegisterGauge("queue_depth", "Queue depth", nil)
+		if err != nil {
+			t.Fatalf("GetOrRegisterGauge: %v", err)
+		}
+		if metrics.named["job_seconds"].collector != h || metrics.named["queue_depth"].collector != g {
+			t.Error("Expected the collectors to be indexed by name")
+		}
+	}
+}
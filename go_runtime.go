@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Presets of runtime/metrics for WithGoRuntimeMetrics. collectors.MetricsGC,
+// collectors.MetricsMemory, collectors.MetricsScheduler and
+// collectors.MetricsAll select wider sets.
+var (
+	// GoRuntimeSchedulerLatency exports the time goroutines spend runnable
+	// before running, as go_sched_latencies_seconds.
+	GoRuntimeSchedulerLatency = collectors.GoRuntimeMetricsRule{Matcher: regexp.MustCompile(`^/sched/latencies:seconds$`)}
+	// GoRuntimeGCPauses exports the stop-the-world pauses of the garbage
+	// collector, as go_gc_pauses_seconds and go_sched_pauses_total_gc_seconds.
+	GoRuntimeGCPauses = collectors.GoRuntimeMetricsRule{Matcher: regexp.MustCompile(`^/(gc/pauses|sched/pauses/total/gc):seconds$`)}
+	// GoRuntimeMemoryClasses exports the breakdown of memory mapped by the
+	// runtime, as go_memory_classes_*_bytes.
+	GoRuntimeMemoryClasses = collectors.GoRuntimeMetricsRule{Matcher: regexp.MustCompile(`^/memory/classes/.*`)}
+)
+
+// WithGoRuntimeMetrics adds the runtime/metrics selected by rules to the Go
+// collector, on top of its default memstats-based metrics:
+//
+//	metrics.New(metrics.WithGoRuntimeMetrics(metrics.GoRuntimeSchedulerLatency, metrics.GoRuntimeGCPauses))
+func WithGoRuntimeMetrics(rules ...collectors.GoRuntimeMetricsRule) Option {
+	return func(m *Metrics) {
+		m.goRuntimeRules = append(m.goRuntimeRules, rules...)
+	}
+}
+
+// newGoCollector returns the Go collector, with the runtime metrics selected
+// by WithGoRuntimeMetrics.
+func (m *Metrics) newGoCollector() prometheus.Collector {
+	if len(m.goRuntimeRules) == 0 {
+		return collectors.NewGoCollector()
+	}
+	return collectors.NewGoCollector(collectors.WithGoCollectorRuntimeMetrics(m.goRuntimeRules...))
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWithGoRuntimeMetrics(t *testing.T) {
+	gathered := func(m *Metrics) map[string]bool {
+		families, err := m.Registry().Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather metrics: %v", err)
+		}
+		names := map[string]bool{}
+		for _, f := range families {
+			names[f.GetName()] = true
+		}
+		return names
+	}
+
+	defaults := New()
+	defer defaults.Close(context.Background())
+	if gathered(defaults)["go_sched_latencies_seconds"] {
+		t.Error("Expected scheduler latency to be off by default")
+	}
+
+	metrics := New(WithGoRuntimeMetrics(GoRuntimeSchedulerLatency, GoRuntimeGCPauses, GoRuntimeMemoryClasses))
+	defer metrics.Close(context.Background())
+	names := gathered(metrics)
+	for _, want := range []string{"go_sched_latencies_seconds", "go_gc_pauses_seconds", "go_memory_classes_heap_free_bytes", "go_goroutines"} {
+		if !names[want] {
+			t.Errorf("Expected %s to be exported", want)
+		}
+	}
+	for name := range names {
+		if strings.HasPrefix(name, "go_cpu_classes_") {
+			t.Errorf("Expected %s not to be selected by the presets", name)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/graphite"
+)
+
+// graphiteConfig holds the bridge configured with WithGraphiteBridge.
+type graphiteConfig struct {
+	address  string
+	interval time.Duration
+	prefix   string
+}
+
+// WithGraphiteBridge pushes all metrics to the Carbon endpoint at addr
+// (host:port) every interval, with metric paths prefixed by prefix, and once
+// more when the instance is closed. Labels are encoded into the metric path,
+// or sent as tags with WithGraphiteTags. Errors of periodic pushes are
+// dropped; the error of the final push is returned by Close. An invalid
+// configuration, such as an empty addr, starts no bridge and its error is
+// returned by Close instead.
+func WithGraphiteBridge(addr string, interval time.Duration, prefix string) Option {
+	return func(m *Metrics) {
+		m.graphite = &graphiteConfig{address: addr, interval: interval, prefix: prefix}
+	}
+}
+
+// WithGraphiteTags makes Graphite bridges send labels as tags, as in
+// prefix.name;label=value, instead of encoding them into the metric path.
+// Tagged series require Graphite 1.1 or later.
+func WithGraphiteTags() Option {
+	return func(m *Metrics) {
+		m.graphiteTags = true
+	}
+}
+
+// GraphiteBridge creates a Bridge pushing to the Carbon endpoint at address
+// (host:port) every interval, with metric paths prefixed by prefix. It is
+// intended for feeding legacy Graphite dashboards while Prometheus remains the
+// primary scrape target. A non-positive interval defaults to 15s.
+func (m *Metrics) GraphiteBridge(address string, interval time.Duration, prefix string) (*Bridge, error) {
+	interval = positiveInterval(interval, defaultInterval)
+	if m.graphiteTags {
+		if address == "" {
+			return nil, errors.New("failed to create graphite bridge: missing address")
+		}
+		g := &graphiteTagged{gatherer: m.gatherer, address: address, prefix: prefix, timeout: interval}
+		return &Bridge{m: m, run: runEvery(interval, g.push), push: g.push}, nil
+	}
+
+	bridge, err := graphite.NewBridge(&graphite.Config{
+		URL:           address,
+		Gatherer:      m.gatherer,
+		Prefix:        prefix,
+		Interval:      interval,
+		Timeout:       interval,
+		ErrorHandling: graphite.ContinueOnError,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create graphite bridge: %w", err)
+	}
+	return &Bridge{m: m, run: bridge.Run, push: bridge.Push}, nil
+}
+
+// startGraphite starts the bridge configured with WithGraphiteBridge and adds
+// a final push on Close. If the bridge cannot be created, Close returns the
+// error instead.
+func (m *Metrics) startGraphite() {
+	cfg := m.graphite
+	if cfg == nil {
+		return
+	}
+
+	bridge, err := m.GraphiteBridge(cfg.address, cfg.interval, cfg.prefix)
+	if err != nil {
+		m.onClose(func(context.Context) error {
+			return err
+		})
+		return
+	}
+	bridge.Start()
+	m.onClose(func(ctx context.Context) error {
+		return bridge.Push()
+	})
+}
+
+// graphiteTagged pushes the gathered metrics as Graphite tagged series.
+type graphiteTagged struct {
+	gatherer prometheus.Gatherer
+	address  string
+	prefix   string
+	timeout  time.Duration
+}
+
+// push writes every sample as "prefix.name;label=value value timestamp".
+// Histograms and summaries are written as their _bucket or quantile, _sum and
+// _count series.
+func (g *graphiteTagged) push() error {
+	families, err := g.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %w", err)
+	}
+
+	conn, err := net.DialTimeout("tcp", g.address, g.timeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to graphite: %w", err)
+	}
+	defer conn.Close()
+	_ = conn.SetWriteDeadline(time.Now().Add(g.timeout))
+
+	w := bufio.NewWriter(conn)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	for _, mf := range families {
+		for _, metric := range mf.GetMetric() {
+			write := func(name string, value float64, extra ...string) {
+				if g.prefix != "" {
+					name = g.prefix + "." + name
+				}
+				_, _ = w.WriteString(name)
+				for _, l := range metric.GetLabel() {
+					// Graphite rejects empty tag values.
+					if l.GetValue() != "" {
+						_, _ = w.WriteString(";" + l.GetName() + "=" + graphiteTagValue(l.GetValue()))
+					}
+				}
+				for i := 0; i+1 < len(extra); i += 2 {
+					_, _ = w.WriteString(";" + extra[i] + "=" + extra[i+1])
+				}
+				_, _ = w.WriteString(" " + formatGraphite(value) + " " + now + "\n")
+			}
+
+			name := mf.GetName()
+			switch {
+			case metric.Counter != nil:
+				write(name, metric.GetCounter().GetValue())
+			case metric.Gauge != nil:
+				write(name, metric.GetGauge().GetValue())
+			case metric.Untyped != nil:
+				write(name, metric.GetUntyped().GetValue())
+			case metric.Summary != nil:
+				s := metric.GetSummary()
+				for _, q := range s.GetQuantile() {
+					write(name, q.GetValue(), "quantile", formatGraphite(q.GetQuantile()))
+				}
+				write(name+"_sum", s.GetSampleSum())
+				write(name+"_count", float64(s.GetSampleCount()))
+			case metric.Histogram != nil:
+				h := metric.GetHistogram()
+				for _, b := range h.GetBucket() {
+					if !math.IsInf(b.GetUpperBound(), +1) {
+						write(name+"_bucket", float64(b.GetCumulativeCount()), "le", formatGraphite(b.GetUpperBound()))
+					}
+				}
+				write(name+"_bucket", float64(h.GetSampleCount()), "le", "+Inf")
+				write(name+"_sum", h.GetSampleSum())
+				write(name+"_count", float64(h.GetSampleCount()))
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write to graphite: %w", err)
+	}
+	return nil
+}
+
+// formatGraphite formats a sample value or bound in its shortest form.
+func formatGraphite(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// graphiteTagValue replaces the characters Graphite does not allow in tag
+// values.
+func graphiteTagValue(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r == ';' || r == ' ' || r == '\n' {
+			return '_'
+		}
+		return r
+	}, value)
+	if strings.HasPrefix(value, "~") {
+		value = "_" + value[1:]
+	}
+	return value
+}
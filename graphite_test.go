@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenCarbon accepts connections on a local port and forwards received lines.
+func listenCarbon(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	lines := make(chan string, 1024)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					select {
+					case lines <- scanner.Text():
+					default:
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), lines
+}
+
+func TestGraphiteBridge(t *testing.T) {
+	addr, lines := listenCarbon(t)
+
+	metrics := New(WithServiceName("test-service"))
+	metrics.RecordEvent("signup")
+
+	bridge, err := metrics.GraphiteBridge(addr, 10*time.Millisecond, "nexen")
+	if err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+	bridge.Start()
+	bridge.Start() // no-op while running
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line := <-lines:
+			if strings.HasPrefix(line, "nexen.nexen_service_application_events_total.event.signup.service.test-service 1 ") {
+				bridge.Stop()
+				bridge.Stop() // no-op once stopped
+				return
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for graphite push")
+		}
+	}
+}
+
+func TestGraphiteBridgeStopsOnClose(t *testing.T) {
+	addr, _ := listenCarbon(t)
+
+	metrics := New()
+	bridge, err := metrics.GraphiteBridge(addr, time.Hour, "")
+	if err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+	bridge.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := metrics.Close(ctx); err != nil {
+		t.Fatalf("Expected Close to stop the bridge, got %v", err)
+	}
+	bridge.Stop()
+}
+
+func TestGraphiteBridgeRequiresAddress(t *testing.T) {
+	if _, err := New().GraphiteBridge("", time.Second, ""); err == nil {
+		t.Fatal("Expected an error for an empty address")
+	}
+}
+
+func TestWithGraphiteBridgeInvalid(t *testing.T) {
+	metrics := New(WithGraphiteBridge("", time.Second, ""))
+	if err := metrics.Close(context.Background()); err == nil || !strings.Contains(err.Error(), "failed to create graphite bridge") {
+		t.Fatalf("Expected Close to return the configuration error, got %v", err)
+	}
+}
+
+func TestWithGraphiteBridge(t *testing.T) {
+	addr, lines := listenCarbon(t)
+
+	metrics := New(WithServiceName("test-service"), WithGraphiteBridge(addr, time.Hour, "nexen"))
+	metrics.RecordEvent("signup")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := metrics.Close(ctx); err != nil {
+		t.Fatalf("Expected a final push on Close, got %v", err)
+	}
+
+	for {
+		select {
+		case line := <-lines:
+			if strings.HasPrefix(line, "nexen.nexen_service_application_events_total.event.signup.service.test-service 1 ") {
+				return
+			}
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for graphite push")
+		}
+	}
+}
+
+func TestGraphiteTags(t *testing.T) {
+	addr, lines := listenCarbon(t)
+
+	metrics := New(WithServiceName("test-service"), WithGraphiteTags())
+	metrics.RecordEvent("sign up;now")
+	latency, err := metrics.RegisterHistogram("job_seconds", "Job latency", []float64{1}, nil)
+	if err != nil {
+		t.Fatalf("RegisterHistogram: %v", err)
+	}
+	latency.WithLabelValues("test-service").Observe(0.5)
+
+	bridge, err := metrics.GraphiteBridge(addr, time.Second, "legacy")
+	if err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+	if err := bridge.Push(); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+
+	expected := map[string]bool{
+		"legacy.nexen_service_application_events_total;event=sign_up_now;service=test-service 1": false,
+		"legacy.nexen_service_job_seconds_bucket;service=test-service;le=1 1":                    false,
+		"legacy.nexen_service_job_seconds_bucket;service=test-service;le=+Inf 1":                 false,
+		"legacy.nexen_service_job_seconds_sum;service=test-service 0.5":                          false,
+	}
+	timeout := time.After(5 * time.Second)
+	for missing := len(expected); missing > 0; {
+		select {
+		case line := <-lines:
+			key := line[:strings.LastIndex(line, " ")]
+			if seen, ok := expected[key]; ok && !seen {
+				expected[key] = true
+				missing--
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for tagged series: %v", expected)
+		}
+	}
+}
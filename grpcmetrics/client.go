@@ -0,0 +1,191 @@
+package grpcmetrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// ClientMetrics holds the gRPC client metrics registered with a Metrics instance.
+type ClientMetrics struct {
+	handled  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	retries  *prometheus.CounterVec
+	service  string
+	// now is the clock of the Metrics instance
+	now func() time.Time
+}
+
+// NewClientMetrics registers the gRPC client metrics with m, or reuses them if
+// already registered, so it may be called more than once. Durations use the
+// buckets of the HTTP duration histogram.
+func NewClientMetrics(m *metrics.Metrics) (*ClientMetrics, error) {
+	handled, err := m.GetOrRegisterCounter("grpc_client_handled_total",
+		"Total number of gRPC calls completed by the client, by status code",
+		[]string{"grpc_service", "grpc_method", "grpc_code"})
+	if err != nil {
+		return nil, err
+	}
+	duration, err := m.GetOrRegisterHistogram("grpc_client_handling_seconds",
+		"Duration of gRPC calls made by the client in seconds, including retries", nil,
+		[]string{"grpc_service", "grpc_method"})
+	if err != nil {
+		return nil, err
+	}
+	retries, err := m.GetOrRegisterCounter("grpc_client_retries_total",
+		"Total number of gRPC call attempts retried by the client",
+		[]string{"grpc_service", "grpc_method"})
+	if err != nil {
+		return nil, err
+	}
+	return &ClientMetrics{
+		handled:  handled,
+		duration: duration,
+		retries:  retries,
+		service:  m.ServiceName(),
+		now:      m.Now,
+	}, nil
+}
+
+// DialOptions returns the dial options installing the client interceptors and
+// the stats handler counting retries.
+func (c *ClientMetrics) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(c.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(c.StreamClientInterceptor()),
+		grpc.WithStatsHandler(c.StatsHandler()),
+	}
+}
+
+// UnaryClientInterceptor returns an interceptor recording metrics for unary calls.
+func (c *ClientMetrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, attempts := withAttemptCounter(ctx)
+		start := c.now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		c.observe(method, c.now().Sub(start), attempts, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns an interceptor recording metrics for
+// streaming calls. A stream is complete once receiving from it fails, with
+// io.EOF recorded as OK, once its single response is received if the server
+// does not stream, or once sending or closing fails.
+func (c *ClientMetrics) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, attempts := withAttemptCounter(ctx)
+		start := c.now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			c.observe(method, c.now().Sub(start), attempts, err)
+			return nil, err
+		}
+		return &observedClientStream{ClientStream: stream, serverStreams: desc.ServerStreams, finish: func(err error) {
+			c.observe(method, c.now().Sub(start), attempts, err)
+		}}, nil
+	}
+}
+
+// StatsHandler returns a stats handler counting the attempts of calls made
+// through the client interceptors, so retries performed by gRPC itself, which
+// are invisible to interceptors, are recorded. Without it, no retries are
+// recorded.
+func (c *ClientMetrics) StatsHandler() stats.Handler {
+	return attemptHandler{}
+}
+
+// observe records a completed call.
+func (c *ClientMetrics) observe(fullMethod string, elapsed time.Duration, attempts *atomic.Int32, err error) {
+	service, method := splitMethod(fullMethod)
+	code := status.Code(err).String()
+	c.handled.WithLabelValues(service, method, code, c.service).Inc()
+	c.duration.WithLabelValues(service, method, c.service).Observe(elapsed.Seconds())
+	if n := attempts.Load(); n > 1 {
+		c.retries.WithLabelValues(service, method, c.service).Add(float64(n - 1))
+	}
+}
+
+// observedClientStream calls finish once when the stream completes.
+type observedClientStream struct {
+	grpc.ClientStream
+	serverStreams bool
+	once          sync.Once
+	finish        func(error)
+}
+
+// done finishes the stream with err, once.
+func (s *observedClientStream) done(err error) {
+	s.once.Do(func() { s.finish(err) })
+}
+
+// SendMsg sends on the stream, finishing it on error. io.EOF means the stream
+// was aborted, and its status is returned by RecvMsg, so it is left to RecvMsg.
+func (s *observedClientStream) SendMsg(m any) error {
+	err := s.ClientStream.SendMsg(m)
+	if err != nil && !errors.Is(err, io.EOF) {
+		s.done(err)
+	}
+	return err
+}
+
+// CloseSend closes the sending side of the stream, finishing it on error.
+func (s *observedClientStream) CloseSend() error {
+	err := s.ClientStream.CloseSend()
+	if err != nil {
+		s.done(err)
+	}
+	return err
+}
+
+// RecvMsg receives from the stream, finishing it on error or, if the server
+// does not stream, on its single response.
+func (s *observedClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case errors.Is(err, io.EOF):
+		s.done(nil)
+	case err != nil:
+		s.done(err)
+	case !s.serverStreams:
+		s.done(nil)
+	}
+	return err
+}
+
+// attemptCounterKey is the context key of the attempt counter of a call.
+type attemptCounterKey struct{}
+
+// withAttemptCounter adds a counter of call attempts to ctx.
+func withAttemptCounter(ctx context.Context) (context.Context, *atomic.Int32) {
+	attempts := new(atomic.Int32)
+	return context.WithValue(ctx, attemptCounterKey{}, attempts), attempts
+}
+
+// attemptHandler is a stats.Handler counting call attempts. gRPC tags every
+// attempt of a call, including retries, with TagRPC.
+type attemptHandler struct{}
+
+func (attemptHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	if attempts, ok := ctx.Value(attemptCounterKey{}).(*atomic.Int32); ok {
+		attempts.Add(1)
+	}
+	return ctx
+}
+
+func (attemptHandler) HandleRPC(context.Context, stats.RPCStats) {}
+
+func (attemptHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (attemptHandler) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,142 @@
+package grpcmetrics
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	c, err := NewClientMetrics(metrics.New(metrics.WithServiceName("test-service")))
+	if err != nil {
+		t.Fatalf("Failed to create client metrics: %v", err)
+	}
+	handler := c.StatsHandler()
+
+	// Simulate gRPC retrying the call twice before it fails
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		for i := 0; i < 3; i++ {
+			handler.TagRPC(ctx, &stats.RPCTagInfo{FullMethodName: method})
+		}
+		return status.Error(codes.Unavailable, "backend down")
+	}
+	err = c.UnaryClientInterceptor()(context.Background(), "/nexen.Users/GetUser", nil, nil, nil, invoker)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("Expected invoker error to be passed through, got %v", err)
+	}
+
+	if got := testutil.ToFloat64(c.handled.WithLabelValues("nexen.Users", "GetUser", "Unavailable", "test-service")); got != 1 {
+		t.Fatalf("Expected 1 Unavailable call, got %v", got)
+	}
+	if got := testutil.ToFloat64(c.retries.WithLabelValues("nexen.Users", "GetUser", "test-service")); got != 2 {
+		t.Fatalf("Expected 2 retries, got %v", got)
+	}
+	if n := testutil.CollectAndCount(c.duration); n != 1 {
+		t.Fatalf("Expected 1 duration series, got %d", n)
+	}
+}
+
+type fakeClientStream struct {
+	grpc.ClientStream
+	msgs int
+}
+
+func (s *fakeClientStream) RecvMsg(m any) error {
+	if s.msgs == 0 {
+		return io.EOF
+	}
+	s.msgs--
+	return nil
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	c, err := NewClientMetrics(metrics.New(metrics.WithServiceName("test-service")))
+	if err != nil {
+		t.Fatalf("Failed to create client metrics: %v", err)
+	}
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &fakeClientStream{msgs: 2}, nil
+	}
+	stream, err := c.StreamClientInterceptor()(context.Background(), &grpc.StreamDesc{ServerStreams: true}, nil, "/nexen.Events/Watch", streamer)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+
+	handled := c.handled.WithLabelValues("nexen.Events", "Watch", "OK", "test-service")
+	for stream.RecvMsg(nil) == nil {
+		if got := testutil.ToFloat64(handled); got != 0 {
+			t.Fatalf("Expected no completed call while the stream is open, got %v", got)
+		}
+	}
+	stream.RecvMsg(nil)
+
+	if got := testutil.ToFloat64(handled); got != 1 {
+		t.Fatalf("Expected 1 OK call after io.EOF, got %v", got)
+	}
+	if n := testutil.CollectAndCount(c.retries); n != 0 {
+		t.Fatalf("Expected no retries, got %d series", n)
+	}
+}
+
+type sendFailingClientStream struct {
+	grpc.ClientStream
+	err error
+}
+
+func (s *sendFailingClientStream) SendMsg(m any) error { return s.err }
+
+func (s *sendFailingClientStream) RecvMsg(m any) error { return nil }
+
+func TestClientStreamingInterceptor(t *testing.T) {
+	c, err := NewClientMetrics(metrics.New(metrics.WithServiceName("test-service")))
+	if err != nil {
+		t.Fatalf("Failed to create client metrics: %v", err)
+	}
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &fakeClientStream{msgs: 1}, nil
+	}
+	stream, err := c.StreamClientInterceptor()(context.Background(), &grpc.StreamDesc{ClientStreams: true}, nil, "/nexen.Events/Upload", streamer)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+
+	// CloseAndRecv receives the single response without an error
+	if err := stream.RecvMsg(nil); err != nil {
+		t.Fatalf("Failed to receive: %v", err)
+	}
+	if got := testutil.ToFloat64(c.handled.WithLabelValues("nexen.Events", "Upload", "OK", "test-service")); got != 1 {
+		t.Fatalf("Expected 1 OK call after the response, got %v", got)
+	}
+}
+
+func TestClientStreamSendFailure(t *testing.T) {
+	c, err := NewClientMetrics(metrics.New(metrics.WithServiceName("test-service")))
+	if err != nil {
+		t.Fatalf("Failed to create client metrics: %v", err)
+	}
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &sendFailingClientStream{err: status.Error(codes.Unavailable, "gone")}, nil
+	}
+	stream, err := c.StreamClientInterceptor()(context.Background(), &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, nil, "/nexen.Events/Chat", streamer)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+
+	if err := stream.SendMsg(nil); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Expected the send error to be passed through, got %v", err)
+	}
+	stream.RecvMsg(nil)
+	if got := testutil.ToFloat64(c.handled.WithLabelValues("nexen.Events", "Chat", "Unavailable", "test-service")); got != 1 {
+		t.Fatalf("Expected 1 Unavailable call after the failed send, got %v", got)
+	}
+	if n := testutil.CollectAndCount(c.handled); n != 1 {
+		t.Fatalf("Expected the call to be recorded once, got %d series", n)
+	}
+}
@@ -0,0 +1,33 @@
+module github.com/nexen-io/nexen-metrics/grpcmetrics
+
+go 1.22
+
+toolchain go1.23.5
+
+require (
+	github.com/nexen-io/nexen-metrics v0.0.0-20261016070310-dd9f7e03a243
+	github.com/prometheus/client_golang v1.22.0
+	github.com/prometheus/common v0.62.0
+	google.golang.org/grpc v1.67.3
+	google.golang.org/protobuf v1.36.5
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/kylelemons/godebug v1.1.0 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
+	golang.org/x/net v0.33.0 // indirect
+	golang.org/x/sync v0.10.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// Local development only: modules depending on this one ignore replace
+// directives and use the required version of the core module.
+replace github.com/nexen-io/nexen-metrics => ../
@@ -0,0 +1,100 @@
+// Package grpcmetrics provides gRPC server and client interceptors recording
+// call counts, durations and status codes through a metrics.Metrics instance,
+// using the same nexen_service namespace and service label as the HTTP metrics.
+package grpcmetrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// ServerMetrics holds the gRPC server metrics registered with a Metrics instance.
+type ServerMetrics struct {
+	handled  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+	service  string
+	// now is the clock of the Metrics instance
+	now func() time.Time
+}
+
+// NewServerMetrics registers the gRPC server metrics with m, or reuses them if
+// already registered, so it may be called more than once. Durations use the
+// buckets of the HTTP duration histogram.
+func NewServerMetrics(m *metrics.Metrics) (*ServerMetrics, error) {
+	handled, err := m.GetOrRegisterCounter("grpc_server_handled_total",
+		"Total number of gRPC calls completed on the server, by status code",
+		[]string{"grpc_service", "grpc_method", "grpc_code"})
+	if err != nil {
+		return nil, err
+	}
+	duration, err := m.GetOrRegisterHistogram("grpc_server_handling_seconds",
+		"Duration of gRPC calls handled by the server in seconds", nil,
+		[]string{"grpc_service", "grpc_method"})
+	if err != nil {
+		return nil, err
+	}
+	inFlight, err := m.GetOrRegisterGauge("grpc_server_in_flight_streams",
+		"Number of gRPC streams currently open on the server",
+		[]string{"grpc_service", "grpc_method"})
+	if err != nil {
+		return nil, err
+	}
+	return &ServerMetrics{
+		handled:  handled,
+		duration: duration,
+		inFlight: inFlight,
+		service:  m.ServiceName(),
+		now:      m.Now,
+	}, nil
+}
+
+// UnaryServerInterceptor returns an interceptor recording metrics for unary calls.
+func (s *ServerMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := s.now()
+		resp, err := handler(ctx, req)
+		s.observe(info.FullMethod, s.now().Sub(start), err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor recording metrics for
+// streaming calls. The duration covers the whole stream.
+func (s *ServerMetrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		service, method := splitMethod(info.FullMethod)
+		inFlight := s.inFlight.WithLabelValues(service, method, s.service)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := s.now()
+		err := handler(srv, ss)
+		s.observe(info.FullMethod, s.now().Sub(start), err)
+		return err
+	}
+}
+
+// observe records a completed call.
+func (s *ServerMetrics) observe(fullMethod string, elapsed time.Duration, err error) {
+	service, method := splitMethod(fullMethod)
+	code := status.Code(err).String()
+	s.handled.WithLabelValues(service, method, code, s.service).Inc()
+	s.duration.WithLabelValues(service, method, s.service).Observe(elapsed.Seconds())
+}
+
+// splitMethod splits a full method name such as /pkg.Service/Method into its
+// service and method parts.
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndexByte(fullMethod, '/'); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
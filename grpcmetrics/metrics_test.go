@@ -0,0 +1,120 @@
+package grpcmetrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/nexen-io/nexen-metrics/metricstest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	s, err := NewServerMetrics(metrics.New(metrics.WithServiceName("test-service")))
+	if err != nil {
+		t.Fatalf("Failed to create server metrics: %v", err)
+	}
+	interceptor := s.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/nexen.Users/GetUser"}
+
+	ok := func(ctx context.Context, req any) (any, error) { return "user", nil }
+	notFound := func(ctx context.Context, req any) (any, error) {
+		return nil, status.Error(codes.NotFound, "no such user")
+	}
+	if resp, err := interceptor(context.Background(), nil, info, ok); resp != "user" || err != nil {
+		t.Fatalf("Expected handler result to be passed through, got %v, %v", resp, err)
+	}
+	if _, err := interceptor(context.Background(), nil, info, notFound); status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected handler error to be passed through, got %v", err)
+	}
+
+	if got := testutil.ToFloat64(s.handled.WithLabelValues("nexen.Users", "GetUser", "OK", "test-service")); got != 1 {
+		t.Fatalf("Expected 1 OK call, got %v", got)
+	}
+	if got := testutil.ToFloat64(s.handled.WithLabelValues("nexen.Users", "GetUser", "NotFound", "test-service")); got != 1 {
+		t.Fatalf("Expected 1 NotFound call, got %v", got)
+	}
+	if n := testutil.CollectAndCount(s.duration); n != 1 {
+		t.Fatalf("Expected 1 duration series, got %d", n)
+	}
+}
+
+func TestNewServerMetricsTwice(t *testing.T) {
+	clock := metricstest.NewClock(time.Unix(0, 0))
+	m := metrics.New(metrics.WithServiceName("test-service"), metrics.WithClock(clock.Now))
+	first, err := NewServerMetrics(m)
+	if err != nil {
+		t.Fatalf("Failed to create server metrics: %v", err)
+	}
+	second, err := NewServerMetrics(m)
+	if err != nil {
+		t.Fatalf("Expected server metrics to be reused, got %v", err)
+	}
+	if first.handled != second.handled || first.duration != second.duration || first.inFlight != second.inFlight {
+		t.Fatal("Expected both server metrics to share their vectors")
+	}
+	if _, err := NewServer(m); err != nil {
+		t.Fatalf("Expected NewServer to reuse the server metrics, got %v", err)
+	}
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/nexen.Users/GetUser"}
+	slow := func(ctx context.Context, req any) (any, error) {
+		clock.Advance(2 * time.Second)
+		return nil, nil
+	}
+	if _, err := second.UnaryServerInterceptor()(context.Background(), nil, info, slow); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(first.handled.WithLabelValues("nexen.Users", "GetUser", "OK", "test-service")); got != 1 {
+		t.Fatalf("Expected 1 OK call, got %v", got)
+	}
+	metricstest.AssertHistogramSum(t, m, "nexen_service_grpc_server_handling_seconds",
+		map[string]string{"grpc_service": "nexen.Users", "grpc_method": "GetUser"}, 2)
+}
+
+type fakeServerStream struct {
+	grpc.ServerStream
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	s, err := NewServerMetrics(metrics.New(metrics.WithServiceName("test-service")))
+	if err != nil {
+		t.Fatalf("Failed to create server metrics: %v", err)
+	}
+	inFlight := s.inFlight.WithLabelValues("nexen.Events", "Watch", "test-service")
+	info := &grpc.StreamServerInfo{FullMethod: "/nexen.Events/Watch", IsServerStream: true}
+
+	err = s.StreamServerInterceptor()(nil, fakeServerStream{}, info, func(srv any, stream grpc.ServerStream) error {
+		if got := testutil.ToFloat64(inFlight); got != 1 {
+			t.Errorf("Expected 1 in-flight stream, got %v", got)
+		}
+		return errors.New("stream broken")
+	})
+	if err == nil {
+		t.Fatal("Expected handler error to be passed through")
+	}
+
+	if got := testutil.ToFloat64(inFlight); got != 0 {
+		t.Fatalf("Expected no in-flight streams after the handler returned, got %v", got)
+	}
+	if got := testutil.ToFloat64(s.handled.WithLabelValues("nexen.Events", "Watch", "Unknown", "test-service")); got != 1 {
+		t.Fatalf("Expected 1 Unknown call, got %v", got)
+	}
+}
+
+func TestSplitMethod(t *testing.T) {
+	for _, tt := range []struct{ full, service, method string }{
+		{"/nexen.Users/GetUser", "nexen.Users", "GetUser"},
+		{"GetUser", "unknown", "GetUser"},
+	} {
+		service, method := splitMethod(tt.full)
+		if service != tt.service || method != tt.method {
+			t.Errorf("splitMethod(%q) = %q, %q, want %q, %q", tt.full, service, method, tt.service, tt.method)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package grpcmetrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	// scrapeFile is the name of the file descriptor describing the Metrics
+	// service, for server reflection.
+	scrapeFile = "nexen/metrics/v1/metrics.proto"
+	// scrapeMethod is the full name of the Scrape method.
+	scrapeMethod = "/nexen.metrics.v1.Metrics/Scrape"
+)
+
+func init() {
+	// Register the service so that reflection clients such as grpcurl can
+	// describe it, as generated code would
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String(scrapeFile),
+		Package:    proto.String("nexen.metrics.v1"),
+		Dependency: []string{"google/protobuf/empty.proto", "google/protobuf/wrappers.proto"},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Metrics"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Scrape"),
+				InputType:  proto.String(".google.protobuf.Empty"),
+				OutputType: proto.String(".google.protobuf.StringValue"),
+			}},
+		}},
+		Syntax: proto.String("proto3"),
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		panic(fmt.Sprintf("grpcmetrics: invalid Metrics service descriptor: %v", err))
+	}
+	if err := protoregistry.GlobalFiles.RegisterFile(fd); err != nil {
+		panic(fmt.Sprintf("grpcmetrics: failed to register Metrics service descriptor: %v", err))
+	}
+}
+
+// scrapeServer implements the nexen.metrics.v1.Metrics service.
+type scrapeServer interface {
+	scrape(ctx context.Context) (*wrapperspb.StringValue, error)
+}
+
+// scrapeServiceDesc describes the nexen.metrics.v1.Metrics service, whose
+// Scrape method takes a google.protobuf.Empty and returns the text exposition
+// in a google.protobuf.StringValue.
+var scrapeServiceDesc = grpc.ServiceDesc{
+	ServiceName: "nexen.metrics.v1.Metrics",
+	HandlerType: (*scrapeServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Scrape",
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			in := new(emptypb.Empty)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, _ any) (any, error) {
+				return srv.(scrapeServer).scrape(ctx)
+			}
+			if interceptor == nil {
+				return handler(ctx, in)
+			}
+			return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: scrapeMethod}, handler)
+		},
+	}},
+	Metadata: scrapeFile,
+}
+
+// scraper serves the metrics of a Metrics instance.
+type scraper struct {
+	m *metrics.Metrics
+}
+
+// scrape gathers the metrics and encodes them in the text exposition format.
+func (s scraper) scrape(context.Context) (*wrapperspb.StringValue, error) {
+	families, err := s.m.Gatherer().Gather()
+	if err != nil && len(families) == 0 {
+		return nil, status.Errorf(codes.Internal, "failed to gather metrics: %v", err)
+	}
+
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, mf := range families {
+		if err := enc.Encode(mf); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to encode metrics: %v", err)
+		}
+	}
+	return wrapperspb.String(buf.String()), nil
+}
+
+// RegisterScrapeService registers the nexen.metrics.v1.Metrics service on s,
+// exposing the metrics of m over gRPC for environments where only gRPC traffic
+// is allowed between pods. Its Scrape method returns what Handler would serve
+// in the text exposition format; fetch it with Scrape or, given server
+// reflection, with:
+//
+//	grpcurl -plaintext host:port nexen.metrics.v1.Metrics/Scrape
+func RegisterScrapeService(s grpc.ServiceRegistrar, m *metrics.Metrics) {
+	s.RegisterService(&scrapeServiceDesc, scraper{m: m})
+}
+
+// Scrape calls the Scrape method of the nexen.metrics.v1.Metrics service on
+// conn and returns the text exposition, for example to re-expose it over HTTP
+// on the scraping side.
+func Scrape(ctx context.Context, conn grpc.ClientConnInterface) (string, error) {
+	out := new(wrapperspb.StringValue)
+	if err := conn.Invoke(ctx, scrapeMethod, new(emptypb.Empty), out); err != nil {
+		return "", fmt.Errorf("failed to scrape metrics: %w", err)
+	}
+	return out.GetValue(), nil
+}
+
+// healthServer implements the gRPC health checking protocol with the checks
+// added with Metrics.Health.
+type healthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+	m *metrics.Metrics
+}
+
+// Check runs the checks and reports SERVING if all passed. The empty service
+// name and the name of the Metrics instance are known; other names are not.
+func (h healthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	if name := req.GetService(); name != "" && name != h.m.ServiceName() {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", name)
+	}
+	resp := &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}
+	for _, result := range h.m.Health().Run(ctx) {
+		if result.Err != nil {
+			resp.Status = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+			break
+		}
+	}
+	return resp, nil
+}
+
+// NewServer returns a gRPC server with the Metrics service, the gRPC health
+// service backed by the checks added with Metrics.Health, and server
+// reflection. Calls to the server are recorded in the gRPC server metrics.
+// opts are passed to grpc.NewServer, for example for TLS credentials.
+func NewServer(m *metrics.Metrics, opts ...grpc.ServerOption) (*grpc.Server, error) {
+	sm, err := NewServerMetrics(m)
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(sm.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(sm.StreamServerInterceptor()),
+	}, opts...)
+
+	srv := grpc.NewServer(opts...)
+	RegisterScrapeService(srv, m)
+	grpc_health_v1.RegisterHealthServer(srv, healthServer{m: m})
+	reflection.Register(srv)
+	return srv, nil
+}
+
+// Serve runs the server of NewServer on addr, the gRPC counterpart of
+// Metrics.Serve. It blocks until ctx is cancelled, then stops the server
+// gracefully and returns nil. It returns an error if the server cannot be
+// created, fails to listen or stops serving unexpectedly.
+func Serve(ctx context.Context, m *metrics.Metrics, addr string, opts ...grpc.ServerOption) error {
+	srv, err := NewServer(m, opts...)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("metrics gRPC server failed: %w", err)
+	case <-ctx.Done():
+	}
+	srv.GracefulStop()
+	if err := <-serveErr; err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return fmt.Errorf("metrics gRPC server failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package grpcmetrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// dialServer serves the server of NewServer for m in memory and returns a
+// connection to it.
+func dialServer(t *testing.T, m *metrics.Metrics) *grpc.ClientConn {
+	t.Helper()
+	srv, err := NewServer(m)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ln := bufconn.Listen(1 << 20)
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestScrape(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("test-service"))
+	m.RecordEvent("user_login")
+	conn := dialServer(t, m)
+
+	text, err := Scrape(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if !strings.Contains(text, `nexen_service_application_events_total{event="user_login",service="test-service"} 1`) {
+		t.Fatalf("Expected the event counter in the exposition, got:\n%s", text)
+	}
+
+	// The scrape itself is recorded in the gRPC server metrics
+	text, err = Scrape(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if !strings.Contains(text, `nexen_service_grpc_server_handled_total{grpc_code="OK",grpc_method="Scrape",grpc_service="nexen.metrics.v1.Metrics",service="test-service"} 1`) {
+		t.Fatalf("Expected the first scrape to be recorded, got:\n%s", text)
+	}
+}
+
+func TestHealthServer(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("test-service"))
+	conn := dialServer(t, m)
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	check := func(service string) grpc_health_v1.HealthCheckResponse_ServingStatus {
+		t.Helper()
+		resp, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("Failed to check health: %v", err)
+		}
+		return resp.GetStatus()
+	}
+	if got := check(""); got != grpc_health_v1.HealthCheckResponse_SERVING {
+		t.Fatalf("Expected SERVING, got %v", got)
+	}
+
+	m.Health().AddCheck("db", func(context.Context) error { return errors.New("down") })
+	if got := check("test-service"); got != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("Expected NOT_SERVING with a failing check, got %v", got)
+	}
+	if _, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "other"}); err == nil {
+		t.Fatal("Expected an error for an unknown service")
+	}
+}
+
+func TestScrapeServiceDescriptor(t *testing.T) {
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName("nexen.metrics.v1.Metrics")
+	if err != nil {
+		t.Fatalf("Expected the service to be registered for reflection: %v", err)
+	}
+	method := d.(protoreflect.ServiceDescriptor).Methods().ByName("Scrape")
+	if method == nil || method.Output().FullName() != "google.protobuf.StringValue" {
+		t.Fatalf("Expected Scrape to return a StringValue, got %v", method)
+	}
+}
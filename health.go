@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"github.com/nexen-io/nexen-metrics/health"
+)
+
+// Health returns the readiness checks of the service, created and registered
+// on first use. Serve exposes them as /healthz and /readyz, and their results
+// are exported as metrics:
+//
+//	m.Health().AddCheck("db", func(ctx context.Context) error {
+//		return db.PingContext(ctx)
+//	})
+func (m *Metrics) Health() *health.Checks {
+	m.lazyMu.Lock()
+	defer m.lazyMu.Unlock()
+
+	if m.health == nil {
+		m.health = health.New(m.serviceName)
+		m.mustRegister(m.health)
+	}
+	return m.health
+}
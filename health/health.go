@@ -0,0 +1,223 @@
+// Package health runs liveness and readiness checks, serves them as /healthz
+// and /readyz handlers and exports their results as metrics. Metrics.Health
+// returns the checks of a Metrics instance, which are served by Serve.
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultTimeout bounds how long a readiness probe waits for the checks.
+const DefaultTimeout = 5 * time.Second
+
+// CheckFunc reports whether a dependency is usable by returning nil. It must
+// return once ctx is done.
+type CheckFunc func(ctx context.Context) error
+
+// Checks is a set of named readiness checks. It is a prometheus.Collector
+// exporting the result of the last run:
+//
+//   - nexen_service_health_check_status{check}: 1 if the check passed, 0 if not
+//   - nexen_service_health_check_duration_seconds{check}: histogram of check latencies
+//   - nexen_service_ready: 1 if all checks passed, 0 if not
+//
+// Nothing is exported until a check is added, and nexen_service_ready is 1
+// until the checks first run.
+type Checks struct {
+	service string
+	timeout time.Duration
+
+	status   *prometheus.GaugeVec
+	duration *prometheus.HistogramVec
+	ready    prometheus.Gauge
+
+	mu     sync.RWMutex
+	checks map[string]CheckFunc
+}
+
+// New returns an empty set of checks recording with the service label.
+func New(service string) *Checks {
+	c := &Checks{
+		service: service,
+		timeout: DefaultTimeout,
+		status: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "nexen",
+				Subsystem: "service",
+				Name:      "health_check_status",
+				Help:      "Whether the health check passed (1) or not (0) when last run",
+			},
+			[]string{"check", "service"},
+		),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: "nexen",
+				Subsystem: "service",
+				Name:      "health_check_duration_seconds",
+				Help:      "Histogram of health check latencies",
+				Buckets:   []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5},
+			},
+			[]string{"check", "service"},
+		),
+		ready: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   "nexen",
+			Subsystem:   "service",
+			Name:        "ready",
+			Help:        "Whether all health checks passed (1) or not (0) when last run",
+			ConstLabels: prometheus.Labels{"service": service},
+		}),
+		checks: make(map[string]CheckFunc),
+	}
+	// No check has failed yet, as /readyz would answer
+	c.ready.Set(1)
+	return c
+}
+
+// AddCheck adds or replaces the check name.
+func (c *Checks) AddCheck(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = fn
+}
+
+// SetTimeout sets how long Run waits for the checks, DefaultTimeout unless
+// set.
+func (c *Checks) SetTimeout(timeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timeout = timeout
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name     string
+	Err      error
+	Duration time.Duration
+}
+
+// Run runs all checks concurrently, records their results and returns them
+// sorted by name. Checks still running after the timeout fail with the error
+// of the context.
+func (c *Checks) Run(ctx context.Context) []Result {
+	c.mu.RLock()
+	checks := make(map[string]CheckFunc, len(c.checks))
+	for name, fn := range c.checks {
+		checks[name] = fn
+	}
+	timeout := c.timeout
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	results := make(chan Result, len(checks))
+	for name, fn := range checks {
+		go func(name string, fn CheckFunc) {
+			start := time.Now()
+			err := fn(ctx)
+			results <- Result{Name: name, Err: err, Duration: time.Since(start)}
+		}(name, fn)
+	}
+
+	done := make(map[string]Result, len(checks))
+wait:
+	for len(done) < len(checks) {
+		select {
+		case r := <-results:
+			done[r.Name] = r
+		case <-ctx.Done():
+			break wait
+		}
+	}
+	// Checks that ignore ctx are reported as failed
+	for name := range checks {
+		if _, ok := done[name]; !ok {
+			done[name] = Result{Name: name, Err: ctx.Err(), Duration: timeout}
+		}
+	}
+
+	out := make([]Result, 0, len(done))
+	ready := 1.0
+	for _, r := range done {
+		status := 1.0
+		if r.Err != nil {
+			status, ready = 0, 0
+		}
+		c.status.WithLabelValues(r.Name, c.service).Set(status)
+		c.duration.WithLabelValues(r.Name, c.service).Observe(r.Duration.Seconds())
+		out = append(out, r)
+	}
+	c.ready.Set(ready)
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// LivenessHandler returns the /healthz handler, which reports the process as
+// alive whenever it can serve the request.
+func (c *Checks) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// ReadinessHandler returns the /readyz handler, which runs the checks and
+// answers 200 if all passed or 503 if not. With the verbose query parameter
+// it lists the result of each check.
+func (c *Checks) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		results := c.Run(r.Context())
+
+		var body strings.Builder
+		status := http.StatusOK
+		for _, result := range results {
+			if result.Err != nil {
+				status = http.StatusServiceUnavailable
+				fmt.Fprintf(&body, "[-]%s failed: %v\n", result.Name, result.Err)
+			} else {
+				fmt.Fprintf(&body, "[+]%s ok\n", result.Name)
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		if _, verbose := r.URL.Query()["verbose"]; verbose {
+			fmt.Fprint(w, body.String())
+		}
+		if status == http.StatusOK {
+			fmt.Fprintln(w, "ok")
+		} else {
+			fmt.Fprintln(w, "not ready")
+		}
+	})
+}
+
+// Describe implements prometheus.Collector.
+func (c *Checks) Describe(ch chan<- *prometheus.Desc) {
+	c.status.Describe(ch)
+	c.duration.Describe(ch)
+	c.ready.Describe(ch)
+}
+
+// Collect implements prometheus.Collector. It collects nothing until a check is
+// added, so services without checks do not export a readiness gauge.
+func (c *Checks) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	empty := len(c.checks) == 0
+	c.mu.RUnlock()
+	if empty {
+		return
+	}
+	c.status.Collect(ch)
+	c.duration.Collect(ch)
+	c.ready.Collect(ch)
+}
@@ -0,0 +1,96 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestChecks(t *testing.T) {
+	checks := New("test")
+	checks.SetTimeout(20 * time.Millisecond)
+	checks.AddCheck("db", func(ctx context.Context) error { return nil })
+	checks.AddCheck("cache", func(ctx context.Context) error { return errors.New("connection refused") })
+	checks.AddCheck("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond) // ignores the deadline for a moment
+		return nil
+	})
+
+	results := checks.Run(context.Background())
+	if len(results) != 3 || results[0].Name != "cache" || results[1].Name != "db" || results[2].Name != "slow" {
+		t.Fatalf("Expected results sorted by name, got %+v", results)
+	}
+	if results[1].Err != nil || results[0].Err == nil || !errors.Is(results[2].Err, context.DeadlineExceeded) {
+		t.Errorf("Unexpected results %+v", results)
+	}
+
+	expected := `
+# HELP nexen_service_health_check_status Whether the health check passed (1) or not (0) when last run
+# TYPE nexen_service_health_check_status gauge
+nexen_service_health_check_status{check="cache",service="test"} 0
+nexen_service_health_check_status{check="db",service="test"} 1
+nexen_service_health_check_status{check="slow",service="test"} 0
+# HELP nexen_service_ready Whether all health checks passed (1) or not (0) when last run
+# TYPE nexen_service_ready gauge
+nexen_service_ready{service="test"} 0
+`
+	if err := testutil.CollectAndCompare(checks, strings.NewReader(expected),
+		"nexen_service_health_check_status", "nexen_service_ready"); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.CollectAndCount(checks, "nexen_service_health_check_duration_seconds"); got != 3 {
+		t.Errorf("Expected 3 duration series, got %d", got)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	checks := New("test")
+	failing := true
+	checks.AddCheck("db", func(ctx context.Context) error {
+		if failing {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	checks.LivenessHandler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected liveness to ignore checks, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	checks.ReadinessHandler().ServeHTTP(w, httptest.NewRequest("GET", "/readyz?verbose", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "[-]db failed: connection refused") {
+		t.Errorf("Expected verbose failure, got %d %q", w.Code, w.Body.String())
+	}
+
+	failing = false
+	w = httptest.NewRecorder()
+	checks.ReadinessHandler().ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok\n" {
+		t.Errorf("Expected ready, got %d %q", w.Code, w.Body.String())
+	}
+	if got := testutil.ToFloat64(checks.ready); got != 1 {
+		t.Errorf("Expected ready gauge 1, got %v", got)
+	}
+}
+
+func TestChecksWithoutChecks(t *testing.T) {
+	checks := New("test")
+	if n := testutil.CollectAndCount(checks); n != 0 {
+		t.Fatalf("Expected no metrics without checks, got %d", n)
+	}
+
+	checks.AddCheck("db", func(ctx context.Context) error { return nil })
+	if got := testutil.ToFloat64(checks.ready); got != 1 {
+		t.Fatalf("Expected ready to be 1 before the checks run, got %v", got)
+	}
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"github.com/nexen-io/nexen-metrics/internal"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithoutInFlightGauge disables the nexen_service_http_in_flight_requests gauge.
+func WithoutInFlightGauge() Option {
+	return func(m *Metrics) {
+		m.noInFlight = true
+	}
+}
+
+// WithoutRequestSizeHistogram disables the
+// nexen_service_http_request_size_bytes histogram.
+func WithoutRequestSizeHistogram() Option {
+	return func(m *Metrics) {
+		m.noRequestSize = true
+	}
+}
+
+// WithoutResponseSizeHistogram disables the
+// nexen_service_http_response_size_bytes histogram.
+func WithoutResponseSizeHistogram() Option {
+	return func(m *Metrics) {
+		m.noResponseSize = true
+	}
+}
+
+// registerHTTPSizeMetrics creates and registers the in-flight gauge and the
+// request and response size histograms not disabled through options.
+func (m *Metrics) registerHTTPSizeMetrics() {
+	if !m.noInFlight {
+		m.httpInFlight = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "http_in_flight_requests",
+				Help:      "Number of HTTP requests currently being served",
+			},
+			[]string{"service"},
+		)
+		m.mustRegister(m.httpInFlight)
+	}
+
+	labels := []string{"method", "path", "service"}
+	if m.contentTypeLabel {
+		labels = append(labels, "content_type")
+	}
+	size := func(name, help string) *prometheus.HistogramVec {
+		h := prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      name,
+				Help:      help,
+				Buckets:   internal.DefaultSizeBuckets(),
+			},
+			labels,
+		)
+		m.mustRegister(h)
+		return h
+	}
+	if !m.noRequestSize {
+		m.httpRequestSize = size("http_request_size_bytes", "Histogram of HTTP request body sizes as given by Content-Length")
+	}
+	if !m.noResponseSize {
+		m.httpResponseSize = size("http_response_size_bytes", "Histogram of HTTP response body sizes")
+	}
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInFlightAndSizeMetrics(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	inFlight := metrics.httpInFlight.WithLabelValues("test-service")
+
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := testutil.ToFloat64(inFlight); got != 1 {
+			t.Errorf("Expected 1 in-flight request, got %v", got)
+		}
+		w.Write([]byte("hello"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/upload", strings.NewReader("0123456789")))
+
+	if got := testutil.ToFloat64(inFlight); got != 0 {
+		t.Fatalf("Expected no in-flight requests after the handler returned, got %v", got)
+	}
+
+	expected := `
+# HELP nexen_service_http_request_size_bytes Histogram of HTTP request body sizes as given by Content-Length
+# TYPE nexen_service_http_request_size_bytes histogram
+nexen_service_http_request_size_bytes_bucket{method="POST",path="/upload",service="test-service",le="100"} 1
+nexen_service_http_request_size_bytes_bucket{method="POST",path="/upload",service="test-service",le="1000"} 1
+nexen_service_http_request_size_bytes_bucket{method="POST",path="/upload",service="test-service",le="10000"} 1
+nexen_service_http_request_size_bytes_bucket{method="POST",path="/upload",service="test-service",le="100000"} 1
+nexen_service_http_request_size_bytes_bucket{method="POST",path="/upload",service="test-service",le="1e+06"} 1
+nexen_service_http_request_size_bytes_bucket{method="POST",path="/upload",service="test-service",le="1e+07"} 1
+nexen_service_http_request_size_bytes_bucket{method="POST",path="/upload",service="test-service",le="1e+08"} 1
+nexen_service_http_request_size_bytes_bucket{method="POST",path="/upload",service="test-service",le="+Inf"} 1
+nexen_service_http_request_size_bytes_sum{method="POST",path="/upload",service="test-service"} 10
+nexen_service_http_request_size_bytes_count{method="POST",path="/upload",service="test-service"} 1
+`
+	if err := testutil.CollectAndCompare(metrics.httpRequestSize, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+	if err := testutil.CollectAndCompare(metrics.httpResponseSize, strings.NewReader(strings.NewReplacer(
+		"request_size", "response_size",
+		"request body sizes as given by Content-Length", "response body sizes",
+		"} 10", "} 5",
+	).Replace(expected))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithoutInFlightAndSizeMetrics(t *testing.T) {
+	metrics := New(WithoutInFlightGauge(), WithoutRequestSizeHistogram(), WithoutResponseSizeHistogram())
+	metrics.Instrument(http.NotFoundHandler()).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	n, err := testutil.GatherAndCount(metrics.Registry(),
+		"nexen_service_http_in_flight_requests",
+		"nexen_service_http_request_size_bytes",
+		"nexen_service_http_response_size_bytes",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("Expected disabled metrics not to be exposed, got %d series", n)
+	}
+}
@@ -17,3 +17,25 @@ func DefaultLLMLatencyBuckets() []float64 {
 func DefaultMemoryBuckets() []float64 {
 	return []float64{50, 100, 250, 500, 1000, 2000, 5000, 10000}
 }
+
+// DefaultBatchSizeBuckets returns histogram buckets suitable for queue and batch sizes (item counts).
+func DefaultBatchSizeBuckets() []float64 {
+	return []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000}
+}
+
+// DefaultSizeBuckets returns histogram buckets suitable for HTTP request and response sizes (in bytes),
+// from 100 bytes to 100 MB.
+func DefaultSizeBuckets() []float64 {
+	return []float64{100, 1000, 10000, 100000, 1e6, 1e7, 1e8}
+}
+
+// DefaultTokenLatencyBuckets returns histogram buckets suitable for the latency between streamed LLM tokens.
+func DefaultTokenLatencyBuckets() []float64 {
+	return []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+}
+
+// DefaultConnectionDurationBuckets returns histogram buckets suitable for the lifetimes of long-lived
+// connections, from one second to a day.
+func DefaultConnectionDurationBuckets() []float64 {
+	return []float64{1, 5, 15, 60, 300, 900, 1800, 3600, 7200, 14400, 43200, 86400}
+}
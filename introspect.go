@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricInfo describes a metric family.
+type MetricInfo struct {
+	// Name is the fully-qualified name, e.g. nexen_service_jobs_total.
+	Name string `json:"name"`
+	// Type is counter, gauge, histogram, summary or untyped.
+	Type string `json:"type"`
+	Help string `json:"help"`
+	// Labels are the label names, including service.
+	Labels []string `json:"labels"`
+}
+
+// ListMetrics describes the metrics exposed by Handler and those created with
+// the Register methods, sorted by name. Metrics created with the Register
+// methods are listed with the labels they were registered with even before
+// anything is recorded; others are listed once they have a series, with the
+// label names of their series.
+func (m *Metrics) ListMetrics() []MetricInfo {
+	// Families of collectors failing to collect are missing from a failed
+	// gather, the others are still listed
+	families, _ := m.gatherer.Gather()
+
+	byName := make(map[string]MetricInfo, len(families))
+	for _, mf := range families {
+		labels := map[string]bool{}
+		for _, metric := range mf.GetMetric() {
+			for _, l := range metric.GetLabel() {
+				labels[l.GetName()] = true
+			}
+		}
+		info := MetricInfo{
+			Name:   mf.GetName(),
+			Type:   snapshotType(mf.GetType()),
+			Help:   mf.GetHelp(),
+			Labels: make([]string, 0, len(labels)),
+		}
+		for name := range labels {
+			info.Labels = append(info.Labels, name)
+		}
+		sort.Strings(info.Labels)
+		byName[info.Name] = info
+	}
+
+	m.registeredMu.Lock()
+	for _, indexed := range m.named {
+		info := indexed.info
+		if gathered, ok := byName[info.Name]; ok {
+			// The gathered help text carries deprecation notes
+			info.Help = gathered.Help
+		}
+		info.Labels = append([]string(nil), info.Labels...)
+		byName[info.Name] = info
+	}
+	m.registeredMu.Unlock()
+
+	infos := make([]MetricInfo, 0, len(byName))
+	for _, info := range byName {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// Counter returns the counter registered as name with RegisterCounter or
+// GetOrRegisterCounter, for code recording by configured names without
+// holding on to the vectors.
+func (m *Metrics) Counter(name string) (*prometheus.CounterVec, bool) {
+	return lookup[*prometheus.CounterVec](m, name)
+}
+
+// Gauge returns the gauge registered as name with RegisterGauge or
+// GetOrRegisterGauge.
+func (m *Metrics) Gauge(name string) (*prometheus.GaugeVec, bool) {
+	return lookup[*prometheus.GaugeVec](m, name)
+}
+
+// Histogram returns the histogram registered as name with RegisterHistogram,
+// RegisterNativeHistogram or GetOrRegisterHistogram.
+func (m *Metrics) Histogram(name string) (*prometheus.HistogramVec, bool) {
+	return lookup[*prometheus.HistogramVec](m, name)
+}
+
+// lookup returns the collector registered as name if it has type C.
+func lookup[C prometheus.Collector](m *Metrics, name string) (C, bool) {
+	m.registeredMu.Lock()
+	defer m.registeredMu.Unlock()
+	c, ok := m.named[name].collector.(C)
+	return c, ok
+}
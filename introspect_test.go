@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestListMetrics(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	if _, err := metrics.RegisterCounter("jobs_total", "Jobs", []string{"kind"}); err != nil {
+		t.Fatalf("RegisterCounter: %v", err)
+	}
+	if _, err := metrics.RegisterGaugeFunc("queue_depth", "Queue depth", func() float64 { return 1 }); err != nil {
+		t.Fatalf("RegisterGaugeFunc: %v", err)
+	}
+	metrics.RecordEvent("signup")
+
+	infos := metrics.ListMetrics()
+	if !sort.SliceIsSorted(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name }) {
+		t.Error("Expected the metrics to be sorted by name")
+	}
+	byName := map[string]MetricInfo{}
+	for _, info := range infos {
+		byName[info.Name] = info
+	}
+	for _, expected := range []MetricInfo{
+		{Name: "nexen_service_jobs_total", Type: "counter", Help: "Jobs", Labels: []string{"kind", "service"}},
+		{Name: "nexen_service_queue_depth", Type: "gauge", Help: "Queue depth", Labels: []string{"service"}},
+		{Name: "nexen_service_application_events_total", Type: "counter", Help: "Count of application-specific events", Labels: []string{"event", "service"}},
+	} {
+		if got := byName[expected.Name]; !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, got)
+		}
+	}
+	if _, ok := byName["nexen_service_http_requests_total"]; ok {
+		t.Error("Expected metrics without series to be omitted")
+	}
+}
+
+func TestMetricLookup(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	counter, err := metrics.RegisterCounter("jobs_total", "Jobs", nil)
+	if err != nil {
+		t.Fatalf("RegisterCounter: %v", err)
+	}
+	histogram, err := metrics.RegisterHistogram("job_seconds", "Job latency", nil, nil)
+	if err != nil {
+		t.Fatalf("RegisterHistogram: %v", err)
+	}
+	gauge, err := metrics.RegisterGauge("queue_depth", "Queue depth", nil)
+	if err != nil {
+		t.Fatalf("RegisterGauge: %v", err)
+	}
+
+	if got, ok := metrics.Counter("jobs_total"); !ok || got != counter {
+		t.Errorf("Expected the registered counter, got %v (%v)", got, ok)
+	}
+	if got, ok := metrics.Histogram("job_seconds"); !ok || got != histogram {
+		t.Errorf("Expected the registered histogram, got %v (%v)", got, ok)
+	}
+	if got, ok := metrics.Gauge("queue_depth"); !ok || got != gauge {
+		t.Errorf("Expected the registered gauge, got %v (%v)", got, ok)
+	}
+	if _, ok := metrics.Counter("job_seconds"); ok {
+		t.Error("Expected no counter for a histogram name")
+	}
+	if _, ok := metrics.Histogram("missing"); ok {
+		t.Error("Expected no histogram for an unknown name")
+	}
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Values of the outcome label of nexen_service_job_runs_total.
+const (
+	jobSuccess = "success"
+	jobFailure = "failure"
+)
+
+// jobMetrics are the metrics of batch jobs, registered on the first call to
+// Job.
+type jobMetrics struct {
+	lastSuccess  *prometheus.GaugeVec
+	lastDuration *prometheus.GaugeVec
+	runs         *prometheus.CounterVec
+	running      *prometheus.GaugeVec
+}
+
+// jobMetrics returns the job metrics, registering them on first use.
+func (m *Metrics) jobMetrics() *jobMetrics {
+	m.lazyMu.Lock()
+	defer m.lazyMu.Unlock()
+
+	if m.jobs != nil {
+		return m.jobs
+	}
+
+	jobs := &jobMetrics{
+		lastSuccess: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "job_last_success_timestamp_seconds",
+				Help:      "Time of the last successful run of the job",
+			},
+			[]string{"job_name", "service"},
+		),
+		lastDuration: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "job_last_duration_seconds",
+				Help:      "Duration of the last run of the job",
+			},
+			[]string{"job_name", "service"},
+		),
+		runs: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "job_runs_total",
+				Help:      "Total number of job runs by outcome",
+			},
+			[]string{"job_name", "outcome", "service"},
+		),
+		running: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "job_running",
+				Help:      "Number of running runs of the job",
+			},
+			[]string{"job_name", "service"},
+		),
+	}
+	m.mustRegister(jobs.lastSuccess, jobs.lastDuration, jobs.runs, jobs.running)
+	m.jobs = jobs
+	return jobs
+}
+
+// Job records the runs of a batch or cron job. Obtain it with Metrics.Job.
+type Job struct {
+	m       *Metrics
+	metrics *jobMetrics
+	name    string
+	gateway string
+	pushJob string
+}
+
+// Job returns the recorder of the batch or cron job name, exporting the
+// metrics recommended for batch jobs:
+//
+//   - nexen_service_job_last_success_timestamp_seconds{job_name}
+//   - nexen_service_job_last_duration_seconds{job_name}
+//   - nexen_service_job_runs_total{job_name, outcome}: runs by outcome,
+//     "success" or "failure"
+//   - nexen_service_job_running{job_name}
+//
+// The label is job_name because the Pushgateway reserves the job label for
+// the group. Alert on the age of the last success rather than on failures,
+// since a job that stopped running never fails.
+func (m *Metrics) Job(name string) *Job {
+	j := &Job{m: m, metrics: m.jobMetrics(), name: name}
+	if m.pushGateway != nil {
+		j.gateway, j.pushJob = m.pushGateway.url, m.pushGateway.job
+	}
+	return j
+}
+
+// PushTo makes Run push all metrics to the Pushgateway at gatewayURL under
+// jobName after every run, as Push does. With WithPushGateway, runs push to
+// its gateway and job by default, so short-lived jobs do not have to wait for
+// the next periodic push before exiting.
+func (j *Job) PushTo(gatewayURL, jobName string) *Job {
+	j.gateway, j.pushJob = gatewayURL, jobName
+	return j
+}
+
+// Run runs fn and records its duration and outcome. A panic counts as a failure
+// and continues. It returns the error of fn, joined with the error of the push
+// if one is configured and fails.
+func (j *Job) Run(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	service := j.m.serviceName
+	running := j.metrics.running.WithLabelValues(j.name, service)
+	running.Inc()
+	start := j.m.now()
+
+	succeeded := false
+	defer func() {
+		running.Dec()
+		end := j.m.now()
+		j.metrics.lastDuration.WithLabelValues(j.name, service).Set(end.Sub(start).Seconds())
+		outcome := jobFailure
+		if succeeded {
+			outcome = jobSuccess
+			j.metrics.lastSuccess.WithLabelValues(j.name, service).Set(float64(end.UnixNano()) / 1e9)
+		}
+		j.metrics.runs.WithLabelValues(j.name, outcome, service).Inc()
+
+		if j.gateway != "" {
+			err = errors.Join(err, j.m.Push(context.WithoutCancel(ctx), j.gateway, j.pushJob))
+		}
+	}()
+
+	err = fn(ctx)
+	succeeded = err == nil
+	return err
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestJob(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	metrics := New(WithServiceName("test-service"), WithClock(func() time.Time { return now }))
+	job := metrics.Job("export")
+
+	err := job.Run(context.Background(), func(ctx context.Context) error {
+		if got := testutil.ToFloat64(metrics.jobs.running.WithLabelValues("export", "test-service")); got != 1 {
+			t.Errorf("Expected the job to be running, got %v", got)
+		}
+		now = now.Add(3 * time.Second)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	failure := errors.New("disk full")
+	if err := job.Run(context.Background(), func(ctx context.Context) error { return failure }); !errors.Is(err, failure) {
+		t.Fatalf("Expected the error of the run, got %v", err)
+	}
+
+	expected := `
+# HELP nexen_service_job_last_duration_seconds Duration of the last run of the job
+# TYPE nexen_service_job_last_duration_seconds gauge
+nexen_service_job_last_duration_seconds{job_name="export",service="test-service"} 0
+# HELP nexen_service_job_last_success_timestamp_seconds Time of the last successful run of the job
+# TYPE nexen_service_job_last_success_timestamp_seconds gauge
+nexen_service_job_last_success_timestamp_seconds{job_name="export",service="test-service"} 1.700000003e+09
+# HELP nexen_service_job_running Number of running runs of the job
+# TYPE nexen_service_job_running gauge
+nexen_service_job_running{job_name="export",service="test-service"} 0
+# HELP nexen_service_job_runs_total Total number of job runs by outcome
+# TYPE nexen_service_job_runs_total counter
+nexen_service_job_runs_total{job_name="export",outcome="failure",service="test-service"} 1
+nexen_service_job_runs_total{job_name="export",outcome="success",service="test-service"} 1
+`
+	if err := testutil.GatherAndCompare(metrics.gatherer, strings.NewReader(expected),
+		"nexen_service_job_last_duration_seconds", "nexen_service_job_last_success_timestamp_seconds",
+		"nexen_service_job_running", "nexen_service_job_runs_total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJobPush(t *testing.T) {
+	gateway := &fakeGateway{}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	metrics := New(WithServiceName("test-service"), WithPushGateway(server.URL, "nightly", time.Hour))
+	if err := metrics.Job("export").Run(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if err := metrics.Job("cleanup").PushTo(server.URL, "cleanup").Run(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	got := gateway.received()
+	if len(got) != 2 || got[0] != "PUT /metrics/job/nightly" || got[1] != "PUT /metrics/job/cleanup" {
+		t.Fatalf("Expected a push after each run, got %v", got)
+	}
+	if !strings.Contains(gateway.bodies[0], "nexen_service_job_last_success_timestamp_seconds") {
+		t.Error("Expected the push to carry the job metrics")
+	}
+
+	server.Close()
+	if err := metrics.Job("export").Run(context.Background(), func(ctx context.Context) error { return nil }); err == nil {
+		t.Error("Expected the failed push to be returned")
+	}
+}
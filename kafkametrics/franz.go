@@ -0,0 +1,79 @@
+package kafkametrics
+
+import (
+	"context"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// FranzHooks records the activity of a franz-go client. Add it with
+// kgo.WithHooks, and pass its partition callbacks to count rebalances:
+//
+//	hooks := rec.FranzHooks("orders")
+//	cl, err := kgo.NewClient(
+//		kgo.WithHooks(hooks),
+//		kgo.ConsumerGroup("orders"),
+//		kgo.OnPartitionsAssigned(hooks.OnPartitionsAssigned),
+//		kgo.OnPartitionsRevoked(hooks.OnPartitionsRevoked),
+//		kgo.OnPartitionsLost(hooks.OnPartitionsLost),
+//	)
+//
+// Consumer lag is taken from the high watermarks of polled fetches, passed to
+// ObserveFetches.
+type FranzHooks struct {
+	rec   *Recorder
+	group string
+}
+
+var (
+	_ kgo.HookProduceBatchWritten = (*FranzHooks)(nil)
+	_ kgo.HookFetchBatchRead      = (*FranzHooks)(nil)
+)
+
+// FranzHooks returns hooks for a franz-go client consuming as group. Clients
+// that only produce or consume without a group may pass an empty group.
+func (r *Recorder) FranzHooks(group string) *FranzHooks {
+	return &FranzHooks{rec: r, group: group}
+}
+
+// OnProduceBatchWritten counts the records of a batch written to a broker.
+func (h *FranzHooks) OnProduceBatchWritten(_ kgo.BrokerMetadata, topic string, _ int32, m kgo.ProduceBatchMetrics) {
+	h.rec.observeProduced(topic, m.NumRecords)
+}
+
+// OnFetchBatchRead counts the records of a batch fetched from a broker.
+func (h *FranzHooks) OnFetchBatchRead(_ kgo.BrokerMetadata, topic string, _ int32, m kgo.FetchBatchMetrics) {
+	h.rec.observeConsumed(topic, h.group, m.NumRecords)
+	h.rec.observeFetchedBatch(topic, m.NumRecords)
+}
+
+// ObserveFetches records the consumer lag of each partition in fetches, the
+// result of PollFetches or PollRecords.
+func (h *FranzHooks) ObserveFetches(fetches kgo.Fetches) {
+	fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+		if len(p.Records) == 0 {
+			return
+		}
+		last := p.Records[len(p.Records)-1]
+		h.rec.setLag(p.Topic, p.Partition, h.group, last.Offset, p.HighWatermark)
+	})
+}
+
+// OnPartitionsAssigned counts an assignment, for kgo.OnPartitionsAssigned.
+func (h *FranzHooks) OnPartitionsAssigned(context.Context, *kgo.Client, map[string][]int32) {
+	h.rec.rebalance(h.group, eventAssigned)
+}
+
+// OnPartitionsRevoked counts a revocation and drops the lag of the revoked
+// partitions, for kgo.OnPartitionsRevoked.
+func (h *FranzHooks) OnPartitionsRevoked(_ context.Context, _ *kgo.Client, revoked map[string][]int32) {
+	h.rec.rebalance(h.group, eventRevoked)
+	h.rec.deleteLag(h.group, revoked)
+}
+
+// OnPartitionsLost counts a loss and drops the lag of the lost partitions,
+// for kgo.OnPartitionsLost.
+func (h *FranzHooks) OnPartitionsLost(_ context.Context, _ *kgo.Client, lost map[string][]int32) {
+	h.rec.rebalance(h.group, eventLost)
+	h.rec.deleteLag(h.group, lost)
+}
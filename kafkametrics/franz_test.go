@@ -0,0 +1,77 @@
+package kafkametrics
+
+import (
+	"context"
+	"testing"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func newRecorder(t *testing.T) *Recorder {
+	t.Helper()
+	rec, err := New(metrics.New(metrics.WithServiceName("test")))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return rec
+}
+
+func TestFranzHooks(t *testing.T) {
+	rec := newRecorder(t)
+	hooks := rec.FranzHooks("orders")
+
+	hooks.OnProduceBatchWritten(kgo.BrokerMetadata{}, "events", 0, kgo.ProduceBatchMetrics{NumRecords: 5})
+	hooks.OnFetchBatchRead(kgo.BrokerMetadata{}, "events", 0, kgo.FetchBatchMetrics{NumRecords: 3})
+	hooks.ObserveFetches(kgo.Fetches{{Topics: []kgo.FetchTopic{{
+		Topic: "events",
+		Partitions: []kgo.FetchPartition{
+			{Partition: 0, HighWatermark: 10, Records: []*kgo.Record{{Offset: 5}, {Offset: 6}}},
+			{Partition: 1, HighWatermark: 4},
+		},
+	}}}})
+	hooks.OnPartitionsAssigned(context.Background(), nil, map[string][]int32{"events": {0, 1}})
+
+	if got := testutil.ToFloat64(rec.produced.WithLabelValues("events", "test")); got != 5 {
+		t.Errorf("produced = %v, want 5", got)
+	}
+	if got := testutil.ToFloat64(rec.consumed.WithLabelValues("events", "orders", "test")); got != 3 {
+		t.Errorf("consumed = %v, want 3", got)
+	}
+	if got := testutil.CollectAndCount(rec.batchSize); got != 2 {
+		t.Errorf("batch size series = %d, want 2 (produce, consume)", got)
+	}
+	if got := testutil.ToFloat64(rec.lag.WithLabelValues("events", "0", "orders", "test")); got != 3 {
+		t.Errorf("lag = %v, want 3", got)
+	}
+	if got := testutil.CollectAndCount(rec.lag); got != 1 {
+		t.Errorf("lag series = %d, want 1 (partitions without records are skipped)", got)
+	}
+	if got := testutil.ToFloat64(rec.rebalances.WithLabelValues("orders", "assigned", "test")); got != 1 {
+		t.Errorf("assigned = %v, want 1", got)
+	}
+
+	hooks.OnPartitionsRevoked(context.Background(), nil, map[string][]int32{"events": {0}})
+	if got := testutil.CollectAndCount(rec.lag); got != 0 {
+		t.Errorf("lag series after revocation = %d, want 0", got)
+	}
+	if got := testutil.ToFloat64(rec.rebalances.WithLabelValues("orders", "revoked", "test")); got != 1 {
+		t.Errorf("revoked = %v, want 1", got)
+	}
+}
+
+func TestNewShared(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("test"))
+	first, err := New(m)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	second, err := New(m)
+	if err != nil {
+		t.Fatalf("second New: %v", err)
+	}
+	if first.produced != second.produced || first.lag != second.lag {
+		t.Error("second recorder does not share the registered metrics")
+	}
+}
@@ -0,0 +1,128 @@
+// Package kafkametrics instruments Kafka producers and consumers built on
+// franz-go or sarama: messages produced and consumed, batch sizes, consumer
+// lag and rebalances, using the same nexen_service namespace and service label
+// as the HTTP metrics.
+package kafkametrics
+
+import (
+	"strconv"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/nexen-io/nexen-metrics/internal"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Batch direction label values.
+const (
+	directionProduce = "produce"
+	directionConsume = "consume"
+)
+
+// Rebalance event label values.
+const (
+	eventAssigned = "assigned"
+	eventRevoked  = "revoked"
+	eventLost     = "lost"
+)
+
+// Recorder records Kafka client activity. Create one per Metrics with New and
+// attach it to clients through FranzHooks, SaramaProducerInterceptor,
+// WrapSyncProducer or WrapConsumerGroupHandler.
+type Recorder struct {
+	produced   *prometheus.CounterVec
+	consumed   *prometheus.CounterVec
+	batchSize  *prometheus.HistogramVec
+	lag        *prometheus.GaugeVec
+	rebalances *prometheus.CounterVec
+	service    string
+}
+
+// New registers the Kafka metrics with m:
+//
+//   - nexen_service_kafka_messages_produced_total{topic}
+//   - nexen_service_kafka_messages_consumed_total{topic, group}
+//   - nexen_service_kafka_batch_size{direction, topic}
+//   - nexen_service_kafka_consumer_lag{topic, partition, group}
+//   - nexen_service_kafka_rebalances_total{group, event}
+//
+// Calling New again for the same m returns a recorder sharing the metrics.
+func New(m *metrics.Metrics) (*Recorder, error) {
+	produced, err := m.GetOrRegisterCounter("kafka_messages_produced_total",
+		"Total number of messages produced to Kafka", []string{"topic"})
+	if err != nil {
+		return nil, err
+	}
+	consumed, err := m.GetOrRegisterCounter("kafka_messages_consumed_total",
+		"Total number of messages consumed from Kafka", []string{"topic", "group"})
+	if err != nil {
+		return nil, err
+	}
+	batchSize, err := m.GetOrRegisterHistogram("kafka_batch_size",
+		"Histogram of the number of messages per produced or fetched Kafka batch",
+		internal.DefaultBatchSizeBuckets(), []string{"direction", "topic"})
+	if err != nil {
+		return nil, err
+	}
+	lag, err := m.GetOrRegisterGauge("kafka_consumer_lag",
+		"Number of messages between the last consumed offset and the high watermark of a partition",
+		[]string{"topic", "partition", "group"})
+	if err != nil {
+		return nil, err
+	}
+	rebalances, err := m.GetOrRegisterCounter("kafka_rebalances_total",
+		"Total number of consumer group partition assignments, revocations and losses",
+		[]string{"group", "event"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recorder{
+		produced:   produced,
+		consumed:   consumed,
+		batchSize:  batchSize,
+		lag:        lag,
+		rebalances: rebalances,
+		service:    m.ServiceName(),
+	}, nil
+}
+
+// observeProduced records n messages produced to topic in one batch.
+func (r *Recorder) observeProduced(topic string, n int) {
+	r.produced.WithLabelValues(topic, r.service).Add(float64(n))
+	r.batchSize.WithLabelValues(directionProduce, topic, r.service).Observe(float64(n))
+}
+
+// observeConsumed records n messages of topic consumed by group.
+func (r *Recorder) observeConsumed(topic, group string, n int) {
+	r.consumed.WithLabelValues(topic, group, r.service).Add(float64(n))
+}
+
+// observeFetchedBatch records the size of a batch fetched from topic.
+func (r *Recorder) observeFetchedBatch(topic string, n int) {
+	r.batchSize.WithLabelValues(directionConsume, topic, r.service).Observe(float64(n))
+}
+
+// setLag records the lag of group on a partition, given the offset of the
+// last consumed message and the high watermark, the offset of the next
+// message to be written.
+func (r *Recorder) setLag(topic string, partition int32, group string, offset, highWatermark int64) {
+	lag := highWatermark - offset - 1
+	if lag < 0 {
+		lag = 0
+	}
+	r.lag.WithLabelValues(topic, strconv.Itoa(int(partition)), group, r.service).Set(float64(lag))
+}
+
+// deleteLag removes the lag of partitions no longer assigned to group.
+func (r *Recorder) deleteLag(group string, partitions map[string][]int32) {
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			r.lag.DeleteLabelValues(topic, strconv.Itoa(int(p)), group, r.service)
+		}
+	}
+}
+
+// rebalance counts a rebalance event of group.
+func (r *Recorder) rebalance(group, event string) {
+	r.rebalances.WithLabelValues(group, event, r.service).Inc()
+}
@@ -0,0 +1,88 @@
+package kafkametrics
+
+import (
+	"github.com/IBM/sarama"
+)
+
+// saramaInterceptor counts the messages sent through a sarama producer.
+type saramaInterceptor struct {
+	rec *Recorder
+}
+
+// SaramaProducerInterceptor returns an interceptor counting the messages sent
+// through a sarama producer, sync or async. Add it to the producer config:
+//
+//	config.Producer.Interceptors = []sarama.ProducerInterceptor{rec.SaramaProducerInterceptor()}
+//
+// Messages are counted when they are handed to the producer, before delivery.
+// sarama batches messages internally, so no batch sizes are recorded.
+func (r *Recorder) SaramaProducerInterceptor() sarama.ProducerInterceptor {
+	return saramaInterceptor{rec: r}
+}
+
+// OnSend counts msg.
+func (i saramaInterceptor) OnSend(msg *sarama.ProducerMessage) {
+	i.rec.produced.WithLabelValues(msg.Topic, i.rec.service).Inc()
+}
+
+// saramaHandler wraps a sarama consumer group handler.
+type saramaHandler struct {
+	sarama.ConsumerGroupHandler
+	rec   *Recorder
+	group string
+}
+
+// WrapConsumerGroupHandler returns a handler counting the messages h consumes
+// as group, recording the lag of each claimed partition after every message,
+// and counting the partition assignments and revocations of each session:
+//
+//	err := consumerGroup.Consume(ctx, topics, rec.WrapConsumerGroupHandler("orders", handler))
+func (r *Recorder) WrapConsumerGroupHandler(group string, h sarama.ConsumerGroupHandler) sarama.ConsumerGroupHandler {
+	return &saramaHandler{ConsumerGroupHandler: h, rec: r, group: group}
+}
+
+// Setup counts the assignment of a new session.
+func (h *saramaHandler) Setup(sess sarama.ConsumerGroupSession) error {
+	h.rec.rebalance(h.group, eventAssigned)
+	return h.ConsumerGroupHandler.Setup(sess)
+}
+
+// Cleanup counts the revocation of the session's claims and drops their lag.
+func (h *saramaHandler) Cleanup(sess sarama.ConsumerGroupSession) error {
+	h.rec.rebalance(h.group, eventRevoked)
+	h.rec.deleteLag(h.group, sess.Claims())
+	return h.ConsumerGroupHandler.Cleanup(sess)
+}
+
+// ConsumeClaim passes the messages of claim to the wrapped handler, recording
+// each message as it is handed over.
+func (h *saramaHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	messages := make(chan *sarama.ConsumerMessage)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(messages)
+		for msg := range claim.Messages() {
+			select {
+			case messages <- msg:
+				h.rec.observeConsumed(msg.Topic, h.group, 1)
+				h.rec.setLag(msg.Topic, msg.Partition, h.group, msg.Offset, claim.HighWaterMarkOffset())
+			case <-done:
+				return
+			}
+		}
+	}()
+	return h.ConsumerGroupHandler.ConsumeClaim(sess, &observedClaim{ConsumerGroupClaim: claim, messages: messages})
+}
+
+// observedClaim is a claim whose messages are relayed through the handler.
+type observedClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+// Messages returns the relayed messages.
+func (c *observedClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
@@ -0,0 +1,88 @@
+package kafkametrics
+
+import (
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+}
+
+func (fakeSession) Claims() map[string][]int32 { return map[string][]int32{"events": {2}} }
+
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+func (c fakeClaim) HighWaterMarkOffset() int64               { return 20 }
+
+// countingHandler consumes all messages of a claim.
+type countingHandler struct {
+	consumed int
+}
+
+func (h *countingHandler) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (h *countingHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *countingHandler) ConsumeClaim(_ sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for range claim.Messages() {
+		h.consumed++
+	}
+	return nil
+}
+
+func TestWrapConsumerGroupHandler(t *testing.T) {
+	rec := newRecorder(t)
+	inner := &countingHandler{}
+	handler := rec.WrapConsumerGroupHandler("orders", inner)
+
+	claim := fakeClaim{messages: make(chan *sarama.ConsumerMessage, 2)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "events", Partition: 2, Offset: 14}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "events", Partition: 2, Offset: 15}
+	close(claim.messages)
+
+	if err := handler.Setup(fakeSession{}); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	if err := handler.ConsumeClaim(fakeSession{}, claim); err != nil {
+		t.Fatalf("ConsumeClaim: %v", err)
+	}
+
+	if inner.consumed != 2 {
+		t.Errorf("handler consumed %d messages, want 2", inner.consumed)
+	}
+	if got := testutil.ToFloat64(rec.consumed.WithLabelValues("events", "orders", "test")); got != 2 {
+		t.Errorf("consumed = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(rec.lag.WithLabelValues("events", "2", "orders", "test")); got != 4 {
+		t.Errorf("lag = %v, want 4", got)
+	}
+
+	if err := handler.Cleanup(fakeSession{}); err != nil {
+		t.Fatalf("Cleanup: %v", err)
+	}
+	if got := testutil.CollectAndCount(rec.lag); got != 0 {
+		t.Errorf("lag series after cleanup = %d, want 0", got)
+	}
+	for _, event := range []string{"assigned", "revoked"} {
+		if got := testutil.ToFloat64(rec.rebalances.WithLabelValues("orders", event, "test")); got != 1 {
+			t.Errorf("%s = %v, want 1", event, got)
+		}
+	}
+}
+
+func TestSaramaProducerInterceptor(t *testing.T) {
+	rec := newRecorder(t)
+	interceptor := rec.SaramaProducerInterceptor()
+	interceptor.OnSend(&sarama.ProducerMessage{Topic: "events"})
+	interceptor.OnSend(&sarama.ProducerMessage{Topic: "events"})
+
+	if got := testutil.ToFloat64(rec.produced.WithLabelValues("events", "test")); got != 2 {
+		t.Errorf("produced = %v, want 2", got)
+	}
+}
@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxCachedLabelSets bounds the number of label combinations each child cache
+// holds. Beyond the bound, the least recently used combinations are evicted.
+const maxCachedLabelSets = 10000
+
+// cachedChild is a cache entry, with the bit the eviction sweep uses to spare
+// recently used entries.
+type cachedChild[V any] struct {
+	child V
+	used  atomic.Bool
+}
+
+// childCache caches metric children resolved through WithLabelValues, so hot,
+// fixed label combinations skip hashing and validating label values on every
+// request. Once full it evicts with the CLOCK algorithm, an approximation of
+// least recently used eviction that keeps hits under the read lock: hits only
+// mark their entry as used, and the sweep evicts the first entry not used
+// since the previous sweep passed it.
+type childCache[K comparable, V any] struct {
+	mu       sync.RWMutex
+	children map[K]*cachedChild[V]
+	// clock holds the cached keys in the order the sweep visits them
+	clock []K
+	hand  int
+}
+
+// get returns the cached child for key, calling resolve on a miss.
+func (c *childCache[K, V]) get(key K, resolve func() V) V {
+	c.mu.RLock()
+	entry, ok := c.children[key]
+	c.mu.RUnlock()
+	if ok {
+		if !entry.used.Load() {
+			entry.used.Store(true)
+		}
+		return entry.child
+	}
+
+	child := resolve()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.children[key]; ok {
+		return entry.child
+	}
+	if c.children == nil {
+		c.children = make(map[K]*cachedChild[V])
+	}
+	if len(c.clock) < maxCachedLabelSets {
+		c.clock = append(c.clock, key)
+	} else {
+		c.evict(key)
+	}
+	c.children[key] = &cachedChild[V]{child: child}
+	return child
+}
+
+// evict advances the hand to the first entry not used since the hand last
+// passed it, clearing used bits on the way, and replaces it with key. The
+// caller must hold the write lock.
+func (c *childCache[K, V]) evict(key K) {
+	for {
+		victim := c.children[c.clock[c.hand]]
+		if !victim.used.Load() {
+			break
+		}
+		victim.used.Store(false)
+		c.hand = (c.hand + 1) % len(c.clock)
+	}
+	delete(c.children, c.clock[c.hand])
+	c.clock[c.hand] = key
+	c.hand = (c.hand + 1) % len(c.clock)
+}
+
+// deleteFunc removes the cached children whose key matches, so children
+// deleted from their vector are resolved again on the next request.
+func (c *childCache[K, V]) deleteFunc(match func(K) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kept := c.clock[:0]
+	for _, key := range c.clock {
+		if match(key) {
+			delete(c.children, key)
+		} else {
+			kept = append(kept, key)
+		}
+	}
+	clear(c.clock[len(kept):])
+	c.clock = kept
+	c.hand = 0
+}
+
+// requestKey identifies the label values of http_requests_total.
+type requestKey struct {
+	service, method, path, clientClass, codeClass, extra string
+}
+
+// durationKey identifies the label values of http_request_duration_seconds.
+type durationKey struct {
+	service, method, path, contentType, extra string
+}
+
+// routeKey identifies the label values of the size histograms, labeled by
+// method, path and, with WithContentTypeLabel, content type.
+type routeKey struct {
+	service, method, path, contentType string
+}
+
+// incrementer is a counter child, either a client_golang counter or a sharded
+// one.
+type incrementer interface {
+	Inc()
+}
+
+// httpChildren caches the children of the per-request HTTP metrics.
+type httpChildren struct {
+	requests     childCache[requestKey, incrementer]
+	duration     childCache[durationKey, prometheus.Observer]
+	requestSize  childCache[routeKey, prometheus.Observer]
+	responseSize childCache[routeKey, prometheus.Observer]
+}
+
+// requestCounter returns the http_requests_total child for obs.
+func (m *Metrics) requestCounter(obs httpObservation) incrementer {
+	var codeClass string
+	if m.codeClassLabel {
+		// Handlers writing nothing are answered with 200 OK
+		status := obs.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		codeClass = statusClass(status)
+	}
+	key := requestKey{obs.service, obs.method, obs.path, obs.clientClass, codeClass, extraKey(obs.extra)}
+	return m.httpChildren.requests.get(key, func() incrementer {
+		labels := []string{obs.method, obs.path, obs.service}
+		if m.clientClassifier != nil {
+			labels = append(labels, obs.clientClass)
+		}
+		if m.codeClassLabel {
+			labels = append(labels, codeClass)
+		}
+		labels = append(labels, obs.extra...)
+		if m.shardedRequests != nil {
+			return m.shardedRequests.WithLabelValues(labels...)
+		}
+		return m.httpRequests.WithLabelValues(labels...)
+	})
+}
+
+// durationObserver returns the http_request_duration_seconds child for obs.
+func (m *Metrics) durationObserver(obs httpObservation) prometheus.Observer {
+	key := durationKey{obs.service, obs.method, obs.path, obs.contentType, extraKey(obs.extra)}
+	return m.httpChildren.duration.get(key, func() prometheus.Observer {
+		labels := []string{obs.method, obs.path, obs.service}
+		if m.contentTypeLabel {
+			labels = append(labels, obs.contentType)
+		}
+		labels = append(labels, obs.extra...)
+		if m.shardedDuration != nil {
+			return m.shardedDuration.WithLabelValues(labels...)
+		}
+		return m.httpDuration.WithLabelValues(labels...)
+	})
+}
+
+// sizeObserver returns the child of vec, one of the size histograms, for obs,
+// cached in c.
+func (m *Metrics) sizeObserver(c *childCache[routeKey, prometheus.Observer], vec *prometheus.HistogramVec, obs httpObservation) prometheus.Observer {
+	return c.get(routeKey{obs.service, obs.method, obs.path, obs.contentType}, func() prometheus.Observer {
+		if m.contentTypeLabel {
+			return vec.WithLabelValues(obs.method, obs.path, obs.service, obs.contentType)
+		}
+		return vec.WithLabelValues(obs.method, obs.path, obs.service)
+	})
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestChildCacheBounded(t *testing.T) {
+	var c childCache[int, int]
+	for i := 0; i < maxCachedLabelSets+10; i++ {
+		if got := c.get(i, func() int { return i * 2 }); got != i*2 {
+			t.Fatalf("get(%d) = %d, want %d", i, got, i*2)
+		}
+	}
+	if len(c.children) != maxCachedLabelSets {
+		t.Fatalf("Expected cache to be bounded at %d entries, got %d", maxCachedLabelSets, len(c.children))
+	}
+
+	calls := 0
+	c.get(maxCachedLabelSets+5, func() int { calls++; return 0 })
+	if calls != 0 {
+		t.Fatal("Expected cached entry to be reused")
+	}
+}
+
+func TestChildCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	var c childCache[int, int]
+	for i := 0; i < maxCachedLabelSets; i++ {
+		c.get(i, func() int { return i })
+	}
+	// Keep the first two entries hot
+	c.get(0, nil)
+	c.get(1, nil)
+
+	c.get(-1, func() int { return -1 })
+
+	for _, key := range []int{0, 1, -1} {
+		if _, ok := c.children[key]; !ok {
+			t.Fatalf("Expected key %d to stay cached", key)
+		}
+	}
+	if _, ok := c.children[2]; ok {
+		t.Fatal("Expected the least recently used key 2 to be evicted")
+	}
+	if len(c.children) != maxCachedLabelSets || len(c.clock) != maxCachedLabelSets {
+		t.Fatalf("Expected %d cached entries, got %d in the map and %d in the clock", maxCachedLabelSets, len(c.children), len(c.clock))
+	}
+}
+
+func TestChildCacheDeleteFunc(t *testing.T) {
+	var c childCache[int, int]
+	for i := 0; i < 10; i++ {
+		c.get(i, func() int { return i })
+	}
+	c.deleteFunc(func(k int) bool { return k%2 == 0 })
+
+	if len(c.children) != 5 || len(c.clock) != 5 {
+		t.Fatalf("Expected 5 cached entries, got %d in the map and %d in the clock", len(c.children), len(c.clock))
+	}
+	calls := 0
+	c.get(2, func() int { calls++; return 2 })
+	if calls != 1 {
+		t.Fatal("Expected a deleted entry to be resolved again")
+	}
+}
+
+func TestInstrumentCachedChildren(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithContentTypeLabel())
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("ct"))
+	}))
+	for _, target := range []string{"/a?ct=text/plain", "/a?ct=text/plain", "/a?ct=application/json", "/b?ct=text/plain"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	if got := testutil.ToFloat64(metrics.httpRequests.WithLabelValues("GET", "/a", "test-service")); got != 3 {
+		t.Fatalf("Expected 3 requests for /a, got %v", got)
+	}
+	if n := testutil.CollectAndCount(metrics.httpDuration); n != 3 {
+		t.Fatalf("Expected 3 duration series, got %d", n)
+	}
+	if n := len(metrics.httpChildren.responseSize.children); n != 3 {
+		t.Fatalf("Expected 3 cached response size children, got %d", n)
+	}
+}
+
+// BenchmarkObserveHTTP compares resolving children through WithLabelValues on
+// every request with the cached children used by Instrument.
+func BenchmarkObserveHTTP(b *testing.B) {
+	obs := httpObservation{method: "GET", path: "/api/v1/users", status: http.StatusOK}
+
+	b.Run("uncached", func(b *testing.B) {
+		m := New()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m.httpRequests.WithLabelValues(obs.method, obs.path, m.serviceName).Inc()
+			m.httpDuration.WithLabelValues(obs.method, obs.path, m.serviceName).Observe(0.1)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		m := New()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m.requestCounter(obs).Inc()
+			m.durationObserver(obs).Observe(0.1)
+		}
+	})
+}
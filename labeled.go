@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// labelValueSeparator joins the label values of a labeled series into the key
+// tracked by the cardinality limit and the TTL.
+const labelValueSeparator = "\xff"
+
+// labeledVec is a lazily registered vector and the label names, without
+// service, it was registered with.
+type labeledVec[V any] struct {
+	vec    V
+	labels []string
+}
+
+// RecordEventWithLabels increments the nexen_service_<event>_total counter
+// with the given labels, registered on first use with the label names of
+// that first call. Events whose counter cannot be registered or whose label
+// names differ from the first call are counted in the shared
+// application_events_total vector without their labels. Without labels it is
+// equivalent to RecordEvent.
+//
+// The event and label values are subject to WithLabelSanitizer, and each
+// combination of label values counts as one value of the counter for
+// WithMaxLabelCardinality and expires with WithMetricTTL.
+func (m *Metrics) RecordEventWithLabels(event string, labels map[string]string) {
+	if len(labels) == 0 {
+		m.RecordEvent(event)
+		return
+	}
+	event = m.limitLabel(limitEvents, m.serviceName, m.sanitizeLabel(limitEvents, event))
+	names, values := m.splitLabels(limitEvents, labels)
+	if vec := m.labeledEvent(event, names); vec != nil {
+		values = m.limitLabelValues(event+"_total", values)
+		m.touchSeries(seriesKey{group: seriesLabeledEvent, service: m.serviceName, a: event, b: strings.Join(values, labelValueSeparator)})
+		vec.WithLabelValues(append(values, m.serviceName)...).Inc()
+		return
+	}
+	m.limitedEventCounter(event, m.serviceName).Inc()
+}
+
+// SetGaugeWithLabels sets the nexen_service_<name> gauge with the given labels,
+// registered on first use with the label names of that first call. Values
+// whose gauge cannot be registered or whose label names differ from the first
+// call are set in the shared gauge vector without their labels. Without
+// labels it is equivalent to SetGauge.
+//
+// Like RecordEventWithLabels, the name and label values are subject to
+// WithLabelSanitizer, WithMaxLabelCardinality and WithMetricTTL.
+func (m *Metrics) SetGaugeWithLabels(name string, value float64, labels map[string]string) {
+	if len(labels) == 0 {
+		m.SetGauge(name, value)
+		return
+	}
+	name = m.limitLabel(limitGauges, m.serviceName, m.sanitizeLabel(limitGauges, name))
+	names, values := m.splitLabels(limitGauges, labels)
+	if vec := m.labeledGauge(name, names); vec != nil {
+		values = m.limitLabelValues(name, values)
+		m.touchSeries(seriesKey{group: seriesLabeledGauge, service: m.serviceName, a: name, b: strings.Join(values, labelValueSeparator)})
+		vec.WithLabelValues(append(values, m.serviceName)...).Set(value)
+		return
+	}
+	m.limitedGauge(name, m.serviceName).Set(value)
+}
+
+// AddGauge adds delta, which may be negative, to a named gauge.
+func (m *Metrics) AddGauge(name string, delta float64) {
+	m.gauge(name, m.serviceName).Add(delta)
+}
+
+// splitLabels returns the names of labels in sorted order and their values,
+// sanitized as labels of metric.
+func (m *Metrics) splitLabels(metric string, labels map[string]string) (names, values []string) {
+	names = make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values = make([]string, 0, len(labels)+1)
+	for _, name := range names {
+		values = append(values, m.sanitizeLabel(metric, labels[name]))
+	}
+	return names, values
+}
+
+// limitLabelValues returns values if their combination may be recorded for
+// metric, or "other" for each of them.
+func (m *Metrics) limitLabelValues(metric string, values []string) []string {
+	if m.limitLabel(metric, m.serviceName, strings.Join(values, labelValueSeparator)) != overflowLabel {
+		return values
+	}
+	limited := make([]string, len(values), len(values)+1)
+	for i := range limited {
+		limited[i] = overflowLabel
+	}
+	return limited
+}
+
+// labeledEvent returns the lazily registered counter for event with the given
+// label names, or nil if it could not be registered or has other labels.
+func (m *Metrics) labeledEvent(event string, names []string) *prometheus.CounterVec {
+	m.lazyMu.Lock()
+	defer m.lazyMu.Unlock()
+
+	if counter, ok := m.labeledEvents[event]; ok {
+		if !slices.Equal(counter.labels, names) {
+			return nil
+		}
+		return counter.vec
+	}
+
+	help := m.metricHelp[event]
+	if help == "" {
+		help = "Total number of " + event + " events"
+	}
+	// RegisterCounter returns nil on failure, which is cached like a success
+	counter, _ := m.RegisterCounter(event+"_total", help, slices.Clone(names))
+	if m.labeledEvents == nil {
+		m.labeledEvents = make(map[string]labeledVec[*prometheus.CounterVec])
+	}
+	m.labeledEvents[event] = labeledVec[*prometheus.CounterVec]{vec: counter, labels: names}
+	return counter
+}
+
+// labeledGauge returns the lazily registered gauge for name with the given
+// label names, or nil if it could not be registered or has other labels.
+func (m *Metrics) labeledGauge(name string, names []string) *prometheus.GaugeVec {
+	m.lazyMu.Lock()
+	defer m.lazyMu.Unlock()
+
+	if gauge, ok := m.labeledGauges[name]; ok {
+		if !slices.Equal(gauge.labels, names) {
+			return nil
+		}
+		return gauge.vec
+	}
+
+	help := m.metricHelp[name]
+	if help == "" {
+		help = "Service gauge " + name
+	}
+	// RegisterGauge returns nil on failure, which is cached like a success
+	gauge, _ := m.RegisterGauge(name, help, slices.Clone(names))
+	if m.labeledGauges == nil {
+		m.labeledGauges = make(map[string]labeledVec[*prometheus.GaugeVec])
+	}
+	m.labeledGauges[name] = labeledVec[*prometheus.GaugeVec]{vec: gauge, labels: names}
+	return gauge
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLabeledEventsAndGauges(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	defer metrics.Close(context.Background())
+
+	metrics.RecordEventWithLabels("order_placed", map[string]string{"region": "eu", "plan": "pro"})
+	metrics.RecordEventWithLabels("order_placed", map[string]string{"plan": "pro", "region": "eu"})
+	metrics.RecordEventWithLabels("order_placed", map[string]string{"country": "de"}) // other labels, shared vector
+	metrics.RecordEventWithLabels("signup", nil)
+
+	metrics.SetGaugeWithLabels("pool_connections", 4, map[string]string{"pool": "primary"})
+	metrics.SetGaugeWithLabels("pool_connections", 7, map[string]string{"pool": "primary"})
+	metrics.AddGauge("queue_depth", 5)
+	metrics.AddGauge("queue_depth", -2)
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`nexen_service_order_placed_total{plan="pro",region="eu",service="test-service"} 2`,
+		`nexen_service_application_events_total{event="order_placed",service="test-service"} 1`,
+		`nexen_service_application_events_total{event="signup",service="test-service"} 1`,
+		`nexen_service_pool_connections{pool="primary",service="test-service"} 7`,
+		`nexen_service_gauge{name="queue_depth",service="test-service"} 3`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
+
+func TestLabeledSeriesAreLimitedAndExpire(t *testing.T) {
+	metrics := New(
+		WithServiceName("test-service"),
+		WithMaxLabelCardinality(1),
+		WithMetricTTL(time.Minute),
+		WithLabelSanitizer(12, SafeLabelRune, '_'),
+	)
+	defer metrics.Close(context.Background())
+
+	metrics.RecordEventWithLabels("order_placed", map[string]string{"region": "eu west"})
+	metrics.RecordEventWithLabels("order_placed", map[string]string{"region": "us"})
+	metrics.SetGaugeWithLabels("pool_size", 4, map[string]string{"pool": "primary pool 2"})
+
+	for want, got := range map[string]float64{
+		"eu_west": testutil.ToFloat64(metrics.labeledEvents["order_placed"].vec.WithLabelValues("eu_west", "test-service")),
+		"other":   testutil.ToFloat64(metrics.labeledEvents["order_placed"].vec.WithLabelValues("other", "test-service")),
+		"primary": testutil.ToFloat64(metrics.labeledGauges["pool_size"].vec.WithLabelValues("primary_pool", "test-service")),
+	} {
+		if got == 0 {
+			t.Errorf("Expected a series for %s", want)
+		}
+	}
+
+	metrics.expireSeries(time.Now().Add(time.Minute))
+	if n := testutil.CollectAndCount(metrics.labeledEvents["order_placed"].vec) + testutil.CollectAndCount(metrics.labeledGauges["pool_size"].vec); n != 0 {
+		t.Fatalf("Expected expired labeled series to be deleted, got %d", n)
+	}
+	metrics.RecordEventWithLabels("order_placed", map[string]string{"region": "us"})
+	if got := testutil.ToFloat64(metrics.labeledEvents["order_placed"].vec.WithLabelValues("us", "test-service")); got != 1 {
+		t.Fatalf("Expected an expired combination to free its cardinality slot, got %v", got)
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// WithLatencyProbe makes Instrument remember the duration of the most recent
+// request for each method and path, for LastLatency to report. It is a
+// debugging aid only: a single last value says nothing about the latency
+// distribution, so dashboards and alerts should keep using the
+// nexen_service_http_request_duration_seconds histogram.
+func WithLatencyProbe() Option {
+	return func(m *Metrics) {
+		m.latencyProbe = &latencyProbe{}
+	}
+}
+
+// latencyProbe tracks the last observed duration per method and path.
+type latencyProbe struct {
+	mu   sync.RWMutex
+	last map[requestRoute]time.Duration
+}
+
+// requestRoute identifies a method and path label pair.
+type requestRoute struct {
+	method, path string
+}
+
+// observe records d as the latest duration for method and path.
+func (p *latencyProbe) observe(method, path string, d time.Duration) {
+	p.mu.Lock()
+	if p.last == nil {
+		p.last = make(map[requestRoute]time.Duration)
+	}
+	p.last[requestRoute{method, path}] = d
+	p.mu.Unlock()
+}
+
+// forget deletes the duration recorded for method and path.
+func (p *latencyProbe) forget(method, path string) {
+	p.mu.Lock()
+	delete(p.last, requestRoute{method, path})
+	p.mu.Unlock()
+}
+
+// LastLatency returns the duration of the most recent instrumented request with
+// the given method and path label, which is the path after truncation by
+// WithPathDepthLimit. It reports false if no such request was seen or
+// WithLatencyProbe is not set. With WithAsyncRecording, the value is updated
+// once the queued observation has been applied.
+func (m *Metrics) LastLatency(method, path string) (time.Duration, bool) {
+	if m.latencyProbe == nil {
+		return 0, false
+	}
+	m.latencyProbe.mu.RLock()
+	defer m.latencyProbe.mu.RUnlock()
+	d, ok := m.latencyProbe.last[requestRoute{method, path}]
+	return d, ok
+}
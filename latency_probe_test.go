@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLastLatency(t *testing.T) {
+	metrics := New(WithLatencyProbe())
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}))
+
+	if _, ok := metrics.LastLatency("GET", "/slow"); ok {
+		t.Fatal("Expected no latency before any request")
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fast", nil))
+
+	if d, ok := metrics.LastLatency("GET", "/slow"); !ok || d < 5*time.Millisecond {
+		t.Fatalf("Expected last latency of at least 5ms for /slow, got %v (%v)", d, ok)
+	}
+	if _, ok := metrics.LastLatency("POST", "/slow"); ok {
+		t.Fatal("Expected no latency for an unseen method")
+	}
+}
+
+func TestLastLatencyDisabled(t *testing.T) {
+	metrics := New()
+	metrics.Instrument(http.NotFoundHandler()).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if _, ok := metrics.LastLatency("GET", "/"); ok {
+		t.Fatal("Expected LastLatency to report false without WithLatencyProbe")
+	}
+}
+
+func TestLastLatencyExpires(t *testing.T) {
+	metrics := New(WithLatencyProbe(), WithMetricTTL(time.Minute))
+	defer metrics.Close(context.Background())
+	metrics.Instrument(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/old", nil))
+
+	metrics.expireSeries(time.Now().Add(time.Minute))
+	if _, ok := metrics.LastLatency("GET", "/old"); ok {
+		t.Fatal("Expected the latency of an expired path to be forgotten")
+	}
+}
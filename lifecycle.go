@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// mustRegister registers collectors and remembers them so Close can unregister
+// them. It panics on registration errors, like prometheus.MustRegister.
+func (m *Metrics) mustRegister(cs ...prometheus.Collector) {
+	m.registerer.MustRegister(cs...)
+	m.track(cs...)
+}
+
+// register registers a collector and remembers it so Close can unregister it.
+func (m *Metrics) register(c prometheus.Collector) error {
+	if err := m.registerer.Register(c); err != nil {
+		m.registrationFailed(err)
+		return err
+	}
+	m.track(c)
+	return nil
+}
+
+// registerShared is like register, but leaves counting a collision with an
+// already registered collector to the caller, which may reuse that collector.
+func (m *Metrics) registerShared(c prometheus.Collector) error {
+	err := m.registerer.Register(c)
+	if err == nil {
+		m.track(c)
+		return nil
+	}
+	var are prometheus.AlreadyRegisteredError
+	if !errors.As(err, &are) {
+		m.registrationFailed(err)
+	}
+	return err
+}
+
+// track records collectors registered through this instance.
+func (m *Metrics) track(cs ...prometheus.Collector) {
+	m.registeredMu.Lock()
+	defer m.registeredMu.Unlock()
+	m.registered = append(m.registered, cs...)
+}
+
+// unregister unregisters c, registered as name by one of the Register methods,
+// and forgets it, so it is neither listed nor looked up by name any more.
+func (m *Metrics) unregister(name string, c prometheus.Collector) {
+	m.registerer.Unregister(c)
+
+	m.registeredMu.Lock()
+	defer m.registeredMu.Unlock()
+	for i, registered := range m.registered {
+		if registered == c {
+			m.registered = append(m.registered[:i], m.registered[i+1:]...)
+			break
+		}
+	}
+	if indexed, ok := m.named[name]; ok && indexed.collector == c {
+		delete(m.named, name)
+	}
+}
+
+// goBackground runs fn in a goroutine that Close waits for. fn must return
+// promptly once m.done is closed.
+func (m *Metrics) goBackground(fn func()) {
+	m.background.Add(1)
+	go func() {
+		defer m.background.Done()
+		fn()
+	}()
+}
+
+// onClose adds a hook run by Close. Hooks run in reverse order of addition.
+func (m *Metrics) onClose(hook func(context.Context) error) {
+	m.registeredMu.Lock()
+	defer m.registeredMu.Unlock()
+	m.closeHooks = append(m.closeHooks, hook)
+}
+
+// Close stops background goroutines started by this instance, runs the shutdown
+// hooks registered by other features and then unregisters every collector
+// registered through this instance. Waiting for background goroutines is bounded
+// by ctx. It is safe to call multiple times; subsequent calls return the result
+// of the first.
+func (m *Metrics) Close(ctx context.Context) error {
+	m.closeOnce.Do(func() {
+		m.registeredMu.Lock()
+		hooks := m.closeHooks
+		registered := m.registered
+		m.registered = nil
+		m.named = nil
+		m.registeredMu.Unlock()
+
+		var errs []error
+		m.doneMu.Lock()
+		close(m.done)
+		m.doneMu.Unlock()
+		stopped := make(chan struct{})
+		go func() {
+			m.background.Wait()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			errs = append(errs, ctx.Err())
+		}
+
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if err := hooks[i](ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		for _, c := range registered {
+			m.registerer.Unregister(c)
+		}
+		m.closeErr = errors.Join(errs...)
+	})
+	return m.closeErr
+}
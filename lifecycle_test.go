@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestClose(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	if _, err := metrics.RegisterCounter("jobs_total", "Jobs", nil); err != nil {
+		t.Fatalf("Failed to register counter: %v", err)
+	}
+	metrics.RecordEvent("started")
+
+	var hookCalls int
+	metrics.onClose(func(context.Context) error {
+		hookCalls++
+		return errors.New("flush failed")
+	})
+
+	err := metrics.Close(context.Background())
+	if err == nil || err.Error() != "flush failed" {
+		t.Fatalf("Expected hook error to be returned, got %v", err)
+	}
+
+	families, err := metrics.Registry().Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %v", err)
+	}
+	if len(families) != 0 {
+		t.Fatalf("Expected all collectors to be unregistered, got %d families", len(families))
+	}
+
+	if err := metrics.Close(context.Background()); err == nil {
+		t.Fatal("Expected repeated Close to return the first result")
+	}
+	if hookCalls != 1 {
+		t.Fatalf("Expected hooks to run once, ran %d times", hookCalls)
+	}
+
+	// The same registry can be reused after Close
+	New(WithRegistry(metrics.Registry()))
+}
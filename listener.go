@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// unixAddressPrefix marks listen addresses that are Unix domain socket
+	// paths, as in unix:///run/app/metrics.sock.
+	unixAddressPrefix = "unix://"
+	// systemdAddressPrefix marks listen addresses naming a socket passed by
+	// systemd socket activation, as in systemd: or systemd:metrics.
+	systemdAddressPrefix = "systemd:"
+	// listenFDsStart is the first file descriptor passed by socket activation.
+	listenFDsStart = 3
+)
+
+// WithListener makes Serve serve on ln instead of listening on the listen
+// address, for listeners created by the caller, such as in-memory listeners in
+// tests or sockets inherited from a supervisor. Serve closes ln when it
+// returns.
+func WithListener(ln net.Listener) Option {
+	return func(m *Metrics) {
+		m.serveListener = ln
+	}
+}
+
+// listen returns the listener Serve serves on: the one set with WithListener,
+// or one for addr, which is either a TCP address such as ":8080", a Unix
+// domain socket such as "unix:///run/app/metrics.sock", or a socket passed by
+// systemd socket activation, "systemd:" for the first one or "systemd:name"
+// for the one named name with FileDescriptorName=.
+func (m *Metrics) listen(addr string) (net.Listener, error) {
+	if m.serveListener != nil {
+		return m.serveListener, nil
+	}
+
+	var ln net.Listener
+	var err error
+	switch {
+	case strings.HasPrefix(addr, unixAddressPrefix):
+		ln, err = listenUnix(strings.TrimPrefix(addr, unixAddressPrefix))
+	case strings.HasPrefix(addr, systemdAddressPrefix):
+		ln, err = activatedListener(strings.TrimPrefix(addr, systemdAddressPrefix), listenFDsStart)
+	default:
+		ln, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return ln, nil
+}
+
+// listenUnix listens on the Unix domain socket at path, replacing the socket
+// left behind by a previous process that did not shut down cleanly. The socket
+// is removed when the listener is closed.
+func listenUnix(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("missing socket path")
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// activatedListener returns the listener for the socket named name, or the
+// first socket if name is empty, among those passed by systemd socket
+// activation through the LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES environment
+// variables, starting at file descriptor first.
+func activatedListener(name string, first int) (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, errors.New("no sockets passed by socket activation")
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, errors.New("no sockets passed by socket activation")
+	}
+
+	index := 0
+	if name != "" {
+		index = -1
+		for i, fdName := range strings.Split(os.Getenv("LISTEN_FDNAMES"), ":") {
+			if fdName == name && i < n {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("no socket named %q passed by socket activation", name)
+		}
+	}
+
+	f := os.NewFile(uintptr(first+index), name)
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use socket passed by socket activation: %w", err)
+	}
+	return ln, nil
+}
+
+// validListenAddress reports whether addr is a valid listen address for
+// Serve.
+func validListenAddress(addr string) error {
+	switch {
+	case strings.HasPrefix(addr, unixAddressPrefix):
+		if strings.TrimPrefix(addr, unixAddressPrefix) == "" {
+			return errors.New("missing socket path")
+		}
+		return nil
+	case strings.HasPrefix(addr, systemdAddressPrefix):
+		return nil
+	}
+	_, _, err := net.SplitHostPort(addr)
+	return err
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrapeWith serves metrics in the background and scrapes /metrics with
+// client, retrying until the server is up.
+func scrapeWith(t *testing.T, metrics *Metrics, client *http.Client, url string) string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- metrics.Serve(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-errc; err != nil {
+			t.Errorf("Serve returned %v", err)
+		}
+	}()
+
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get(url); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Failed to scrape metrics server: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestServeUnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "metrics")
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.sock")
+
+	// Leave a stale socket behind, as a crashed process would
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to create stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	metrics := New(WithServiceName("test-service"), WithListenAddress("unix://"+path))
+	metrics.RecordEvent("served")
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+
+	body := scrapeWith(t, metrics, client, "http://unix/metrics")
+	if !strings.Contains(body, `nexen_service_application_events_total{event="served",service="test-service"} 1`) {
+		t.Fatal("Expected scrape over the Unix socket to expose recorded metrics")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected the socket to be removed on shutdown, got %v", err)
+	}
+}
+
+func TestServeWithListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	metrics := New(WithServiceName("test-service"), WithListener(ln))
+	metrics.RecordEvent("served")
+
+	body := scrapeWith(t, metrics, http.DefaultClient, "http://"+ln.Addr().String()+"/metrics")
+	if !strings.Contains(body, `event="served"`) {
+		t.Fatal("Expected scrape on the given listener to expose recorded metrics")
+	}
+}
+
+func TestServeWithListenerCertificateError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	dir := t.TempDir()
+	metrics := New(WithListener(ln), WithTLS(filepath.Join(dir, "missing.pem"), filepath.Join(dir, "missing-key.pem")))
+	if err := metrics.Serve(context.Background()); err == nil {
+		t.Fatal("Expected an error for a missing certificate")
+	}
+
+	// The given listener was closed, freeing its address
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Expected the given listener to be closed, got %v", err)
+	}
+	ln.Close()
+}
+
+func TestValidListenAddress(t *testing.T) {
+	for addr, valid := range map[string]bool{
+		":9090":                    true,
+		"unix:///run/metrics.sock": true,
+		"systemd:":                 true,
+		"systemd:metrics":          true,
+		"unix://":                  false,
+		"9090":                     false,
+	} {
+		if err := validListenAddress(addr); (err == nil) != valid {
+			t.Errorf("validListenAddress(%q) = %v, want valid %v", addr, err, valid)
+		}
+	}
+}
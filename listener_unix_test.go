@@ -0,0 +1,50 @@
+//go:build unix
+
+package metrics
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestActivatedListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("Failed to get listener file: %v", err)
+	}
+	defer f.Close()
+	// activatedListener takes ownership of the descriptor, so pass a duplicate,
+	// pretending it is the second of two passed sockets
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatalf("Failed to duplicate descriptor: %v", err)
+	}
+	first := fd - 1
+
+	if _, err := activatedListener("", first); err == nil {
+		t.Fatal("Expected an error without socket activation")
+	}
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+	t.Setenv("LISTEN_FDNAMES", "admin:metrics")
+	if _, err := activatedListener("missing", first); err == nil {
+		t.Fatal("Expected an error for an unknown socket name")
+	}
+	activated, err := activatedListener("metrics", first)
+	if err != nil {
+		t.Fatalf("Failed to use activated socket: %v", err)
+	}
+	defer activated.Close()
+	if activated.Addr().String() != ln.Addr().String() {
+		t.Fatalf("Expected the activated listener on %s, got %s", ln.Addr(), activated.Addr())
+	}
+}
@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/nexen-io/nexen-metrics/internal"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithLLMMetrics enables the LLM pipeline metrics. They are registered on first
+// use, so services that enable the option but never record LLM activity do not
+// expose empty metric families.
+func WithLLMMetrics() Option {
+	return func(m *Metrics) {
+		m.llmEnabled = true
+	}
+}
+
+// ObserveStageLatency records the latency of a single LLM pipeline stage, such as
+// embedding, retrieval or generation, into nexen_service_llm_stage_latency_seconds.
+// It is a no-op unless WithLLMMetrics is set.
+func (m *Metrics) ObserveStageLatency(stage, model string, seconds float64) {
+	if !m.llmEnabled {
+		return
+	}
+	m.llmStageHistogram().WithLabelValues(stage, model, m.serviceName).Observe(seconds)
+}
+
+// llmStageHistogram returns the stage latency histogram, registering it on first use.
+func (m *Metrics) llmStageHistogram() *prometheus.HistogramVec {
+	m.lazyMu.Lock()
+	defer m.lazyMu.Unlock()
+
+	if m.llmStageLatency == nil {
+		m.llmStageLatency = prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "llm_stage_latency_seconds",
+				Help:      "Histogram of LLM pipeline stage latencies",
+				Buckets:   internal.DefaultLLMLatencyBuckets(),
+			},
+			[]string{"stage", "model", "service"},
+		)
+		m.mustRegister(m.llmStageLatency)
+	}
+	return m.llmStageLatency
+}
+
+// llmInferenceMetrics holds the LLM inference metrics, labeled by model.
+type llmInferenceMetrics struct {
+	promptTokens     *prometheus.CounterVec
+	completionTokens *prometheus.CounterVec
+	latency          *prometheus.HistogramVec
+	firstToken       *prometheus.HistogramVec
+	errors           *prometheus.CounterVec
+	interToken       *prometheus.HistogramVec
+	tokensPerSecond  *prometheus.GaugeVec
+	streamAborts     *prometheus.CounterVec
+}
+
+// RecordTokens adds the prompt and completion token counts of an inference call
+// to nexen_service_llm_prompt_tokens_total and
+// nexen_service_llm_completion_tokens_total. It is a no-op unless
+// WithLLMMetrics is set.
+func (m *Metrics) RecordTokens(model string, prompt, completion int) {
+	if !m.llmEnabled {
+		return
+	}
+	inference := m.llmInferenceMetrics()
+	inference.promptTokens.WithLabelValues(model, m.serviceName).Add(float64(prompt))
+	inference.completionTokens.WithLabelValues(model, m.serviceName).Add(float64(completion))
+}
+
+// ObserveTimeToFirstToken records the time until the first token of a streamed
+// response arrived into nexen_service_llm_time_to_first_token_seconds. It is a
+// no-op unless WithLLMMetrics is set.
+func (m *Metrics) ObserveTimeToFirstToken(model string, d time.Duration) {
+	if !m.llmEnabled {
+		return
+	}
+	m.llmInferenceMetrics().firstToken.WithLabelValues(model, m.serviceName).Observe(d.Seconds())
+}
+
+// ObserveInference calls fn and records its duration into
+// nexen_service_llm_inference_latency_seconds. If fn returns an error,
+// nexen_service_llm_errors_total is incremented as well. The error is returned
+// unchanged. Without WithLLMMetrics, fn is called but nothing is recorded.
+//
+//	err := m.ObserveInference("gpt-4", func() error {
+//	    resp, err = client.Complete(ctx, prompt)
+//	    return err
+//	})
+func (m *Metrics) ObserveInference(model string, fn func() error) error {
+	if !m.llmEnabled {
+		return fn()
+	}
+
+	start := m.now()
+	err := fn()
+	inference := m.llmInferenceMetrics()
+	inference.latency.WithLabelValues(model, m.serviceName).Observe(m.since(start).Seconds())
+	if err != nil {
+		inference.errors.WithLabelValues(model, m.serviceName).Inc()
+	}
+	return err
+}
+
+// llmInferenceMetrics returns the inference metrics, registering them on first use.
+func (m *Metrics) llmInferenceMetrics() *llmInferenceMetrics {
+	m.lazyMu.Lock()
+	defer m.lazyMu.Unlock()
+
+	if m.llmInference != nil {
+		return m.llmInference
+	}
+
+	counter := func(name, help string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      name,
+				Help:      help,
+			},
+			[]string{"model", "service"},
+		)
+	}
+	histogram := func(name, help string, buckets []float64) *prometheus.HistogramVec {
+		return prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      name,
+				Help:      help,
+				Buckets:   buckets,
+			},
+			[]string{"model", "service"},
+		)
+	}
+
+	inference := &llmInferenceMetrics{
+		promptTokens:     counter("llm_prompt_tokens_total", "Total number of LLM prompt tokens"),
+		completionTokens: counter("llm_completion_tokens_total", "Total number of LLM completion tokens"),
+		latency:          histogram("llm_inference_latency_seconds", "Histogram of LLM inference call latencies", internal.DefaultLLMLatencyBuckets()),
+		firstToken:       histogram("llm_time_to_first_token_seconds", "Histogram of time until the first token of a streamed LLM response", internal.DefaultLLMLatencyBuckets()),
+		errors:           counter("llm_errors_total", "Total number of failed LLM inference calls"),
+		interToken:       histogram("llm_inter_token_latency_seconds", "Histogram of latencies between consecutive tokens of streamed LLM responses", internal.DefaultTokenLatencyBuckets()),
+		tokensPerSecond: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "llm_tokens_per_second",
+				Help:      "Token rate of the most recently finished streamed LLM response",
+			},
+			[]string{"model", "service"},
+		),
+		streamAborts: counter("llm_stream_aborts_total", "Total number of streamed LLM responses finished with an error"),
+	}
+	m.mustRegister(
+		inference.promptTokens, inference.completionTokens, inference.latency, inference.firstToken,
+		inference.errors, inference.interToken, inference.tokensPerSecond, inference.streamAborts,
+	)
+	m.llmInference = inference
+	return inference
+}
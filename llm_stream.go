@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"time"
+)
+
+// LLMMetrics groups the LLM instrumentation of a Metrics instance. Obtain it
+// with Metrics.LLM.
+type LLMMetrics struct {
+	m *Metrics
+}
+
+// LLM returns the LLM instrumentation of m. Like the other LLM methods, it
+// records nothing unless WithLLMMetrics is set.
+func (m *Metrics) LLM() *LLMMetrics {
+	return &LLMMetrics{m: m}
+}
+
+// StartStream starts timing a streamed response from model. Call ObserveToken
+// for every token received and Finish once the stream ends.
+func (l *LLMMetrics) StartStream(model string) *StreamObserver {
+	s := &StreamObserver{model: model, service: l.m.serviceName, now: l.m.now, start: l.m.now()}
+	if l.m.llmEnabled {
+		s.metrics = l.m.llmInferenceMetrics()
+	}
+	return s
+}
+
+// StreamObserver records the token timing of a single streamed LLM response:
+// time to first token, the latency between tokens, the token rate and whether
+// the stream was aborted. It is not safe for concurrent use.
+type StreamObserver struct {
+	metrics  *llmInferenceMetrics
+	model    string
+	service  string
+	now      func() time.Time
+	start    time.Time
+	last     time.Time
+	tokens   int
+	finished bool
+}
+
+// ObserveToken records the arrival of a token. The first token is recorded into
+// nexen_service_llm_time_to_first_token_seconds, later ones into
+// nexen_service_llm_inter_token_latency_seconds.
+func (s *StreamObserver) ObserveToken() {
+	if s.finished {
+		return
+	}
+	now := s.now()
+	if s.metrics != nil {
+		if s.tokens == 0 {
+			s.metrics.firstToken.WithLabelValues(s.model, s.service).Observe(now.Sub(s.start).Seconds())
+		} else {
+			s.metrics.interToken.WithLabelValues(s.model, s.service).Observe(now.Sub(s.last).Seconds())
+		}
+	}
+	s.last = now
+	s.tokens++
+}
+
+// Finish ends the stream. If err is non-nil, the stream counts as aborted in
+// nexen_service_llm_stream_aborts_total. Otherwise, the token rate since the
+// start of the stream is set in nexen_service_llm_tokens_per_second. Calls after
+// the first have no effect.
+func (s *StreamObserver) Finish(err error) {
+	if s.finished {
+		return
+	}
+	s.finished = true
+	if s.metrics == nil {
+		return
+	}
+
+	if err != nil {
+		s.metrics.streamAborts.WithLabelValues(s.model, s.service).Inc()
+		return
+	}
+	if elapsed := s.now().Sub(s.start).Seconds(); elapsed > 0 {
+		s.metrics.tokensPerSecond.WithLabelValues(s.model, s.service).Set(float64(s.tokens) / elapsed)
+	}
+}
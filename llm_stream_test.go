@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStreamObserver(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithLLMMetrics())
+
+	stream := metrics.LLM().StartStream("gpt-4")
+	for i := 0; i < 3; i++ {
+		time.Sleep(2 * time.Millisecond)
+		stream.ObserveToken()
+	}
+	stream.Finish(nil)
+	stream.ObserveToken()
+
+	inference := metrics.llmInference
+	if n := testutil.CollectAndCount(inference.firstToken); n != 1 {
+		t.Errorf("Expected time to first token to be recorded, got %d series", n)
+	}
+	if got := testutil.ToFloat64(inference.tokensPerSecond.WithLabelValues("gpt-4", "test-service")); got <= 0 || got > 1000 {
+		t.Errorf("Expected a token rate below 1000/s, got %v", got)
+	}
+
+	aborted := metrics.LLM().StartStream("gpt-4")
+	aborted.ObserveToken()
+	aborted.Finish(errors.New("client disconnected"))
+	aborted.Finish(nil)
+	if got := testutil.ToFloat64(inference.streamAborts.WithLabelValues("gpt-4", "test-service")); got != 1 {
+		t.Errorf("Expected 1 aborted stream, got %v", got)
+	}
+
+	// Two intervals from the first stream, none from tokens after Finish
+	if got := histogramCount(t, metrics, "nexen_service_llm_inter_token_latency_seconds"); got != 2 {
+		t.Errorf("Expected 2 inter-token observations, got %d", got)
+	}
+}
+
+func TestStreamObserverDisabled(t *testing.T) {
+	metrics := New()
+	stream := metrics.LLM().StartStream("gpt-4")
+	stream.ObserveToken()
+	stream.Finish(errors.New("aborted"))
+
+	if metrics.llmInference != nil {
+		t.Fatal("Expected no LLM metrics without WithLLMMetrics")
+	}
+}
+
+// histogramCount returns the sample count of the single series of the named histogram.
+func histogramCount(t *testing.T, m *Metrics, name string) uint64 {
+	t.Helper()
+	families, err := m.Registry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) == 1 {
+			return family.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	t.Fatalf("Expected a single %s series", name)
+	return 0
+}
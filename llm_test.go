@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveStageLatency(t *testing.T) {
+	scrape := func(m *Metrics) string {
+		w := httptest.NewRecorder()
+		m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		body, _ := io.ReadAll(w.Result().Body)
+		return string(body)
+	}
+
+	disabled := New()
+	disabled.ObserveStageLatency("generation", "gpt-4", 1.5)
+	if strings.Contains(scrape(disabled), "llm_stage_latency_seconds") {
+		t.Fatal("Expected stage latency to be disabled without WithLLMMetrics")
+	}
+
+	metrics := New(WithServiceName("test-service"), WithLLMMetrics())
+	if strings.Contains(scrape(metrics), "llm_stage_latency_seconds") {
+		t.Fatal("Expected stage latency histogram to be registered lazily")
+	}
+
+	metrics.ObserveStageLatency("retrieval", "gpt-4", 0.3)
+	metrics.ObserveStageLatency("generation", "gpt-4", 4)
+
+	body := scrape(metrics)
+	for _, want := range []string{
+		`nexen_service_llm_stage_latency_seconds_count{model="gpt-4",service="test-service",stage="retrieval"} 1`,
+		`nexen_service_llm_stage_latency_seconds_bucket{model="gpt-4",service="test-service",stage="generation",le="5"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
+
+func TestLLMInferenceMetrics(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithLLMMetrics())
+
+	metrics.RecordTokens("gpt-4", 120, 30)
+	metrics.RecordTokens("gpt-4", 80, 20)
+	metrics.ObserveTimeToFirstToken("gpt-4", 300*time.Millisecond)
+	if err := metrics.ObserveInference("gpt-4", func() error { return nil }); err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	failure := errors.New("rate limited")
+	if err := metrics.ObserveInference("gpt-4", func() error { return failure }); err != failure {
+		t.Fatalf("Expected fn error to be returned, got %v", err)
+	}
+
+	inference := metrics.llmInference
+	if got := testutil.ToFloat64(inference.promptTokens.WithLabelValues("gpt-4", "test-service")); got != 200 {
+		t.Errorf("Expected 200 prompt tokens, got %v", got)
+	}
+	if got := testutil.ToFloat64(inference.completionTokens.WithLabelValues("gpt-4", "test-service")); got != 50 {
+		t.Errorf("Expected 50 completion tokens, got %v", got)
+	}
+	if got := testutil.ToFloat64(inference.errors.WithLabelValues("gpt-4", "test-service")); got != 1 {
+		t.Errorf("Expected 1 error, got %v", got)
+	}
+	if n := testutil.CollectAndCount(inference.latency); n != 1 {
+		t.Errorf("Expected 1 latency series, got %d", n)
+	}
+	if n := testutil.CollectAndCount(inference.firstToken); n != 1 {
+		t.Errorf("Expected 1 time to first token series, got %d", n)
+	}
+}
+
+func TestLLMInferenceMetricsDisabled(t *testing.T) {
+	metrics := New()
+	called := false
+	metrics.ObserveInference("gpt-4", func() error { called = true; return nil })
+	metrics.RecordTokens("gpt-4", 1, 1)
+
+	if !called {
+		t.Fatal("Expected fn to be called without WithLLMMetrics")
+	}
+	if metrics.llmInference != nil {
+		t.Fatal("Expected inference metrics not to be registered without WithLLMMetrics")
+	}
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"context"
+	"os"
+	runtimemetrics "runtime/metrics"
+	"time"
+
+	"github.com/nexen-io/nexen-metrics/internal"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+// Values of the kind label of the memory metrics.
+const (
+	memoryRSS  = "rss"
+	memoryHeap = "heap"
+)
+
+// heapObjectsMetric is the runtime metric sampled as heap usage: the memory
+// occupied by live and not yet swept heap objects, as HeapAlloc.
+const heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+
+// memoryMetrics are the metrics of StartMemoryMetrics, registered on its first
+// call.
+type memoryMetrics struct {
+	usage   *prometheus.GaugeVec
+	samples *prometheus.HistogramVec
+	// sampling is set while a sampler runs, guarded by lazyMu
+	sampling bool
+}
+
+// memoryMetrics returns the memory metrics, registering them on first use.
+func (m *Metrics) memoryMetrics() *memoryMetrics {
+	m.lazyMu.Lock()
+	defer m.lazyMu.Unlock()
+
+	if m.memory != nil {
+		return m.memory
+	}
+
+	memory := &memoryMetrics{
+		usage: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "memory_usage_bytes",
+				Help:      "Current memory usage of the process by kind",
+			},
+			[]string{"kind", "service"},
+		),
+		samples: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "memory_usage_megabytes",
+				Help:      "Distribution of periodic samples of the memory usage of the process by kind",
+				Buckets:   internal.DefaultMemoryBuckets(),
+			},
+			[]string{"kind", "service"},
+		),
+	}
+	m.mustRegister(memory.usage, memory.samples)
+	m.memory = memory
+	return memory
+}
+
+// StartMemoryMetrics samples the resident set size and the heap usage of the
+// process every interval, until ctx is cancelled or the Metrics instance is
+// closed. Each sample sets the current value of
+// nexen_service_memory_usage_bytes{kind} and is observed by the
+// nexen_service_memory_usage_megabytes{kind} histogram, so the distribution of
+// memory usage over time can be queried, such as the share of time a process
+// spent above 1GB, which instantaneous gauges sampled at scrape time miss. The
+// kind label is "rss" or "heap"; the resident set size is only available on
+// Linux. The first sample is taken immediately. A non-positive interval
+// defaults to 15s. Calls while a sampler is running have no effect, so samples
+// are not observed twice.
+func (m *Metrics) StartMemoryMetrics(ctx context.Context, interval time.Duration) {
+	interval = positiveInterval(interval, defaultInterval)
+	memory := m.memoryMetrics()
+	m.lazyMu.Lock()
+	running := memory.sampling
+	memory.sampling = true
+	m.lazyMu.Unlock()
+	if running {
+		return
+	}
+	service := m.serviceName
+	proc, err := procfs.NewProc(os.Getpid())
+	hasRSS := err == nil
+	heap := []runtimemetrics.Sample{{Name: heapObjectsMetric}}
+
+	observe := func(kind string, bytes float64) {
+		memory.usage.WithLabelValues(kind, service).Set(bytes)
+		memory.samples.WithLabelValues(kind, service).Observe(bytes / (1 << 20))
+	}
+
+	m.goBackground(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		defer func() {
+			m.lazyMu.Lock()
+			memory.sampling = false
+			m.lazyMu.Unlock()
+		}()
+
+		for {
+			if hasRSS {
+				if stat, err := proc.Stat(); err == nil {
+					observe(memoryRSS, float64(stat.ResidentMemory()))
+				}
+			}
+			runtimemetrics.Read(heap)
+			if heap[0].Value.Kind() == runtimemetrics.KindUint64 {
+				observe(memoryHeap, float64(heap[0].Value.Uint64()))
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			case <-m.done:
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStartMemoryMetrics(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	defer metrics.Close(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	metrics.StartMemoryMetrics(ctx, 10*time.Millisecond)
+
+	kinds := []string{"heap"}
+	if runtime.GOOS == "linux" {
+		kinds = append(kinds, "rss")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for _, kind := range kinds {
+		for memorySamples(t, metrics, kind) == 0 ||
+			testutil.ToFloat64(metrics.memory.usage.WithLabelValues(kind, "test-service")) == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for a %s sample", kind)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+// memorySamples returns the number of samples of kind observed by the memory
+// usage histogram.
+func memorySamples(t *testing.T, metrics *Metrics, kind string) uint64 {
+	t.Helper()
+	families, err := metrics.gatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != "nexen_service_memory_usage_megabytes" {
+			continue
+		}
+		for _, metric := range mf.GetMetric() {
+			for _, l := range metric.GetLabel() {
+				if l.GetName() == "kind" && l.GetValue() == kind {
+					return metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestStartMemoryMetricsTwice(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	defer metrics.Close(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	metrics.StartMemoryMetrics(ctx, time.Hour)
+	metrics.StartMemoryMetrics(ctx, time.Hour)
+	waitForMemorySamples(t, metrics, 1)
+	time.Sleep(10 * time.Millisecond)
+	if n := memorySamples(t, metrics, "heap"); n != 1 {
+		t.Fatalf("Expected a single sampler, got %d samples", n)
+	}
+
+	// Once stopped, the sampler can be started again
+	cancel()
+	metrics.background.Wait()
+	metrics.StartMemoryMetrics(context.Background(), time.Hour)
+	waitForMemorySamples(t, metrics, 2)
+}
+
+// waitForMemorySamples waits for n heap samples to be observed.
+func waitForMemorySamples(t *testing.T, metrics *Metrics, n uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for memorySamples(t, metrics, "heap") < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d heap samples", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -4,15 +4,23 @@
 package metrics
 
 import (
+	"bufio"
+	"context"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/nexen-io/nexen-metrics/health"
 	"github.com/nexen-io/nexen-metrics/internal"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Flags for the metrics server
@@ -44,24 +52,291 @@ func WithServiceName(serviceName string) Option {
 	}
 }
 
+// WithEnvironment adds an "environment" constant label to every metric. When not
+// set, the value is taken from the NEXEN_ENV or ENVIRONMENT environment variables,
+// and no label is added if neither is present.
+func WithEnvironment(environment string) Option {
+	return func(m *Metrics) {
+		m.environment = environment
+	}
+}
+
+// WithConstLabels adds constant labels, such as version or region, to every
+// metric registered through the instance. An environment set with
+// WithEnvironment takes precedence over an "environment" key in labels. Label
+// names must not collide with the labels of any metric.
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(m *Metrics) {
+		if m.constLabels == nil {
+			m.constLabels = prometheus.Labels{}
+		}
+		for name, value := range labels {
+			m.constLabels[name] = value
+		}
+	}
+}
+
+// WithApdex enables Apdex tracking for Instrument. Each request is classified as
+// satisfied (<= target), tolerating (<= 4*target) or frustrated (> 4*target) and
+// counted in nexen_service_http_apdex_total, so the score can be computed in PromQL
+// as (satisfied + tolerating/2) / total.
+func WithApdex(target time.Duration) Option {
+	return func(m *Metrics) {
+		m.apdexTarget = target
+	}
+}
+
+// WithResponseWriterWrapper replaces the internal ResponseWriter wrapper used by
+// Instrument. This allows reusing an existing capturing wrapper, such as an
+// httpsnoop adapter, instead of wrapping the writer a second time.
+func WithResponseWriterWrapper(wrap func(http.ResponseWriter) CapturingWriter) Option {
+	return func(m *Metrics) {
+		m.wrapWriter = wrap
+	}
+}
+
+// WithPathDepthLimit limits the path label recorded by Instrument to the first n
+// segments, replacing the remainder with "/…". For example, with n=2 the path
+// /api/v1/users/123 is recorded as /api/v1/…. A limit of zero disables truncation.
+func WithPathDepthLimit(n int) Option {
+	return func(m *Metrics) {
+		m.pathDepthLimit = n
+	}
+}
+
+// StatusCodeGranularity controls how status codes are rendered in the code label.
+type StatusCodeGranularity int
+
+const (
+	// StatusCodeText records the status text, e.g. "Not Found". This is the
+	// default, unless WithErrorClassifier is set.
+	StatusCodeText StatusCodeGranularity = iota
+	// StatusCodeExact records the numeric status code, e.g. "404".
+	StatusCodeExact
+	// StatusCodeClass records only the status class, e.g. "4xx".
+	StatusCodeClass
+)
+
+// WithStatusCodeGranularity sets how the code label of http_errors_total is
+// rendered, trading detail for cardinality.
+func WithStatusCodeGranularity(granularity StatusCodeGranularity) Option {
+	return func(m *Metrics) {
+		m.codeGranularity = granularity
+		m.codeGranularitySet = true
+	}
+}
+
+// WithLatencyForSuccessOnly restricts the HTTP duration histogram to responses
+// with a status below 400, so fast rejections do not skew latency downwards.
+// Request and error counters still include every response. Note that this
+// changes the meaning of http_request_duration_seconds: its _count no longer
+// matches http_requests_total.
+func WithLatencyForSuccessOnly() Option {
+	return func(m *Metrics) {
+		m.successLatency = true
+	}
+}
+
 // WithRegistry allows providing a custom prometheus registry.
 func WithRegistry(registry *prometheus.Registry) Option {
 	return func(m *Metrics) {
 		m.registry = registry
+		m.baseRegisterer, m.baseGatherer = registry, registry
+	}
+}
+
+// WithRegisterer registers all metrics through registerer instead of a
+// registry, e.g. the result of prometheus.WrapRegistererWith. Handler, Serve
+// and pushes gather from the gatherer set with WithGatherer, from registerer
+// itself if it is also a Gatherer, or else from prometheus.DefaultGatherer.
+func WithRegisterer(registerer prometheus.Registerer) Option {
+	return func(m *Metrics) {
+		m.registry, _ = registerer.(*prometheus.Registry)
+		m.baseRegisterer, m.baseGatherer = registerer, nil
+	}
+}
+
+// WithGatherer sets the gatherer Handler, Serve and pushes read metrics
+// from, typically the registry behind the registerer set with WithRegisterer.
+func WithGatherer(gatherer prometheus.Gatherer) Option {
+	return func(m *Metrics) {
+		m.baseGatherer = gatherer
+	}
+}
+
+// WithoutProcessCollector skips registering the process collector, for
+// registries that already have one.
+func WithoutProcessCollector() Option {
+	return func(m *Metrics) {
+		m.noProcess = true
+	}
+}
+
+// WithoutGoCollector skips registering the Go runtime collector, for
+// registries that already have one. WithGoRuntimeMetrics has no effect then.
+func WithoutGoCollector() Option {
+	return func(m *Metrics) {
+		m.noGoCollector = true
+	}
+}
+
+// WithoutDefaultHTTPMetrics skips registering the http_* metrics, for
+// services that record HTTP metrics of their own. Instrument and
+// InstrumentFunc then pass requests through without recording them.
+func WithoutDefaultHTTPMetrics() Option {
+	return func(m *Metrics) {
+		m.noHTTPMetrics = true
 	}
 }
 
 // Metrics holds common instrumenters and the Prometheus registry.
 type Metrics struct {
-	registry         *prometheus.Registry
-	httpRequests     *prometheus.CounterVec
-	httpDuration     *prometheus.HistogramVec
-	httpErrors       *prometheus.CounterVec
-	applicationEvent *prometheus.CounterVec
-	serviceGauge     *prometheus.GaugeVec
-	scrapeHandler    http.Handler
-	histogramBuckets []float64
-	serviceName      string
+	registry             *prometheus.Registry
+	registerer           prometheus.Registerer
+	baseRegisterer       prometheus.Registerer
+	baseGatherer         prometheus.Gatherer
+	constLabels          prometheus.Labels
+	httpRequests         *prometheus.CounterVec
+	httpDuration         *prometheus.HistogramVec
+	httpErrors           *prometheus.CounterVec
+	httpApdex            *prometheus.CounterVec
+	httpPanics           *prometheus.CounterVec
+	httpMiddleware       *prometheus.HistogramVec
+	httpFirstByte        *prometheus.HistogramVec
+	httpWrite            *prometheus.HistogramVec
+	httpSkipped          *prometheus.CounterVec
+	httpInFlight         *prometheus.GaugeVec
+	httpRequestSize      *prometheus.HistogramVec
+	httpResponseSize     *prometheus.HistogramVec
+	applicationEvent     *prometheus.CounterVec
+	applicationError     *prometheus.CounterVec
+	serviceGauge         *prometheus.GaugeVec
+	batchSize            *prometheus.HistogramVec
+	gatherer             prometheus.Gatherer
+	scrapeHandler        http.Handler
+	histogramBuckets     []float64
+	batchSizeBuckets     []float64
+	serviceName          string
+	serveAddr            string
+	serveListener        net.Listener
+	multiProcessDir      string
+	textfile             *textfileConfig
+	multiProcessInterval time.Duration
+	multiProcessGauges   GaugeMergeMode
+	servePath            string
+	serverAuth           serverAuth
+	tlsCertFile          string
+	tlsKeyFile           string
+	environment          string
+	apdexTarget          time.Duration
+	pathDepthLimit       int
+	pathNormalizer       func(*http.Request) string
+	renames              map[string]string
+	codeGranularity      StatusCodeGranularity
+	codeGranularitySet   bool
+	clientClassifier     func(*http.Request) string
+	errorClassifier      func(int, *http.Request) string
+	extraLabels          []string
+	contentTypeLabel     bool
+	successLatency       bool
+	panicCapture         bool
+	panicRecover         bool
+	noInFlight           bool
+	noProcess            bool
+	noGoCollector        bool
+	noHTTPMetrics        bool
+	noRequestSize        bool
+	noResponseSize       bool
+	serverTiming         bool
+	responsePhases       bool
+	codeClassLabel       bool
+	requestFilters       []func(*http.Request) bool
+	sampleRate           float64
+	sampleSet            bool
+	sampleThreshold      float64
+	sampler              *durationSampler
+	asyncBuffer          int
+	asyncHTTP            *asyncRecorder
+	dropped              *prometheus.CounterVec
+	eventBuffer          int
+	eventPolicy          BackpressurePolicy
+	asyncEvents          chan string
+	eventsDropped        prometheus.Counter
+	shardedHTTP          bool
+	shardedRequests      *shardedVec[*shardedCounter]
+	shardedDuration      *shardedVec[*shardedHistogram]
+	httpChildren         httpChildren
+	latencyProbe         *latencyProbe
+	cardinalityLimit     int
+	cardinality          *cardinalityLimiter
+	metricTTL            time.Duration
+	ttlExempt            map[string]bool
+	seriesSeen           *seriesExpiry
+	typedGauges          bool
+	typedEvents          bool
+	metricHelp           map[string]string
+	pushGateway          *pushGatewayConfig
+	pushGrouping         map[string]string
+	graphite             *graphiteConfig
+	graphiteTags         bool
+	now                  func() time.Time
+	exemplars            bool
+	openMetrics          bool
+	createdSamples       bool
+	noCompression        bool
+	scrapeTimeout        time.Duration
+	maxScrapes           int
+	exemplarLabels       ExemplarExtractor
+	nativeFactor         float64
+	errorTypeNames       map[reflect.Type]string
+	wrapWriter           func(http.ResponseWriter) CapturingWriter
+	client               *clientMetrics
+	clientPhases         bool
+	clientPhase          *clientPhaseMetrics
+	llmEnabled           bool
+	goRuntimeRules       []collectors.GoRuntimeMetricsRule
+	selfEnabled          bool
+	sanitizer            *labelSanitizer
+	self                 *selfMetrics
+
+	timestampedGauges *timestampedGaugeCollector
+
+	// registeredMu guards the collectors, their names and hooks released by Close
+	registeredMu sync.Mutex
+	registered   []prometheus.Collector
+	closeHooks   []func(context.Context) error
+	named        map[string]indexedMetric
+	closeOnce    sync.Once
+	closeErr     error
+	done         chan struct{}
+	background   sync.WaitGroup
+	// doneMu is held for reading by sends to background goroutines, so that
+	// done is only closed once they are queued and will be drained
+	doneMu sync.RWMutex
+
+	// deprecationsMu guards the HELP notes added by DeprecateMetric
+	deprecationsMu sync.RWMutex
+	deprecations   map[string]string
+
+	// deltaMu guards the baseline of Delta
+	deltaMu   sync.Mutex
+	deltaBase map[string]MetricSnapshot
+
+	// lazyMu guards metrics registered on first use
+	lazyMu          sync.Mutex
+	durations       map[string]labeledVec[*prometheus.HistogramVec]
+	labeledEvents   map[string]labeledVec[*prometheus.CounterVec]
+	labeledGauges   map[string]labeledVec[*prometheus.GaugeVec]
+	timerErrors     map[string]*prometheus.CounterVec
+	gauges          map[string]*prometheus.GaugeVec
+	events          map[string]*prometheus.CounterVec
+	llmStageLatency *prometheus.HistogramVec
+	llmInference    *llmInferenceMetrics
+	health          *health.Checks
+	connections     *connectionMetrics
+	tasks           *taskMetrics
+	jobs            *jobMetrics
+	memory          *memoryMetrics
 }
 
 // New constructs a Metrics instance, registers standard collectors, and returns it.
@@ -69,85 +344,296 @@ func New(opts ...Option) *Metrics {
 	m := &Metrics{
 		registry:         prometheus.NewRegistry(),
 		histogramBuckets: internal.DefaultHTTPBuckets(),
+		batchSizeBuckets: internal.DefaultBatchSizeBuckets(),
 		serviceName:      "default",
+		wrapWriter:       newResponseWriter,
+		exemplarLabels:   TraceparentExemplar,
+		done:             make(chan struct{}),
+		now:              time.Now,
 	}
 
 	// Apply options
 	for _, opt := range opts {
 		opt(m)
 	}
+	if m.errorClassifier != nil && !m.codeGranularitySet {
+		m.codeGranularity = StatusCodeExact
+	}
+	if m.baseRegisterer == nil {
+		m.baseRegisterer = m.registry
+	}
+	if m.baseGatherer == nil {
+		m.baseGatherer = prometheus.DefaultGatherer
+		if g, ok := m.baseRegisterer.(prometheus.Gatherer); ok {
+			m.baseGatherer = g
+		}
+	}
+
+	// All collectors are registered through registerer so that constant labels
+	// such as the environment apply uniformly
+	m.environment = m.resolveEnvironment()
+	m.registerer = m.baseRegisterer
+	if constLabels := m.resolveConstLabels(); len(constLabels) > 0 {
+		m.registerer = prometheus.WrapRegistererWith(constLabels, m.baseRegisterer)
+	}
+
+	// Metrics about the instrumentation itself
+	m.registerSelfMetrics()
+
+	// Sanitization of caller-supplied label values
+	m.registerLabelSanitizer()
 
-	// Standard process and Go runtime metrics
-	m.registry.MustRegister(
-		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
-		collectors.NewGoCollector(),
+	// Standard process and Go runtime metrics, unless disabled
+	if !m.noProcess {
+		m.mustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	}
+	if !m.noGoCollector {
+		m.mustRegister(m.newGoCollector())
+	}
+
+	// Standard HTTP metrics recorded by Instrument, unless disabled
+	if !m.noHTTPMetrics {
+		m.registerHTTPMetrics()
+	}
+
+	// Generic application event counter for custom events
+	m.applicationEvent = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "application_events_total",
+			Help:      "Count of application-specific events",
+		},
+		[]string{"event", "service"},
 	)
+	m.mustRegister(m.applicationEvent)
 
-	// HTTP request count, partitioned by method, path and service
-	m.httpRequests = prometheus.NewCounterVec(
+	// Application error counter, partitioned by error type
+	m.applicationError = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
 			Subsystem: subsystem,
-			Name:      "http_requests_total",
-			Help:      "Total number of HTTP requests received",
+			Name:      "errors_total",
+			Help:      "Count of application errors by type",
 		},
-		[]string{"method", "path", "service"},
+		[]string{"type", "service"},
 	)
-	m.registry.MustRegister(m.httpRequests)
+	m.mustRegister(m.applicationError)
 
-	// HTTP request duration histogram
-	m.httpDuration = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
+	// Service-specific gauge for arbitrary numeric values
+	m.serviceGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: subsystem,
-			Name:      "http_request_duration_seconds",
-			Help:      "Histogram of HTTP request durations",
-			Buckets:   m.histogramBuckets,
+			Name:      "gauge",
+			Help:      "Service-specific gauge for arbitrary values",
 		},
-		[]string{"method", "path", "service"},
+		[]string{"name", "service"},
 	)
-	m.registry.MustRegister(m.httpDuration)
+	m.mustRegister(m.serviceGauge)
 
-	// HTTP error count, partitioned by method, path, status code and service
-	m.httpErrors = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
+	// Batch size histogram for queue consumers
+	m.batchSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
 			Namespace: namespace,
 			Subsystem: subsystem,
-			Name:      "http_errors_total",
-			Help:      "Total number of HTTP responses with error status codes",
+			Name:      "batch_size",
+			Help:      "Histogram of batch sizes pulled from queues",
+			Buckets:   m.batchSizeBuckets,
 		},
-		[]string{"method", "path", "code", "service"},
+		[]string{"queue", "service"},
 	)
-	m.registry.MustRegister(m.httpErrors)
+	m.mustRegister(m.batchSize)
 
-	// Generic application event counter for custom events
-	m.applicationEvent = prometheus.NewCounterVec(
+	// Service-specific gauges carrying explicit sample timestamps
+	m.timestampedGauges = newTimestampedGaugeCollector(m.serviceName)
+	m.mustRegister(m.timestampedGauges)
+
+	// Background recording of HTTP observations
+	m.startAsyncRecording()
+	m.startAsyncEvents()
+
+	// Outbound HTTP client metrics
+	m.registerClientMetrics()
+
+	// Limits on the number of distinct label values
+	m.registerCardinalityLimit()
+
+	// Expiry of label sets that are no longer recorded
+	m.startMetricTTL()
+
+	// Prometheus HTTP handler for /metrics
+	m.gatherer = m.buildGatherer()
+	m.scrapeHandler = m.newScrapeHandler()
+
+	// Periodic pushes to a Pushgateway
+	m.startPushing()
+
+	// Periodic pushes to Graphite
+	m.startGraphite()
+
+	// Periodic writes for the node_exporter textfile collector
+	m.startTextfile()
+
+	return m
+}
+
+// registerHTTPMetrics registers the metrics recorded by Instrument.
+func (m *Metrics) registerHTTPMetrics() {
+	// HTTP request count, partitioned by method, path, service and optionally
+	// client class and status code class
+	requestLabels := []string{"method", "path", "service"}
+	if m.clientClassifier != nil {
+		requestLabels = append(requestLabels, "client_class")
+	}
+	if m.codeClassLabel {
+		requestLabels = append(requestLabels, "code_class")
+	}
+	requestLabels = append(requestLabels, m.extraLabels...)
+	requestOpts := prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "http_requests_total",
+		Help:      "Total number of HTTP requests received",
+	}
+	if m.shardedHTTP {
+		m.shardedRequests = newShardedCounterVec(requestOpts, requestLabels)
+		m.mustRegister(m.shardedRequests)
+	} else {
+		m.httpRequests = prometheus.NewCounterVec(requestOpts, requestLabels)
+		m.mustRegister(m.httpRequests)
+	}
+
+	// HTTP request duration histogram, optionally partitioned by response content type
+	durationLabels := []string{"method", "path", "service"}
+	if m.contentTypeLabel {
+		durationLabels = append(durationLabels, "content_type")
+	}
+	durationLabels = append(durationLabels, m.extraLabels...)
+	durationOpts := withNativeBuckets(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "http_request_duration_seconds",
+		Help:      "Histogram of HTTP request durations",
+		Buckets:   m.histogramBuckets,
+	}, m.nativeFactor)
+	if m.shardedHTTP && !m.exemplars && m.nativeFactor == 0 {
+		m.shardedDuration = newShardedHistogramVec(durationOpts, durationLabels)
+		m.mustRegister(m.shardedDuration)
+	} else {
+		m.httpDuration = prometheus.NewHistogramVec(durationOpts, durationLabels)
+		m.mustRegister(m.httpDuration)
+	}
+
+	// HTTP error count, partitioned by method, path, status code, service and
+	// optionally error class
+	errorLabels := []string{"method", "path", "code", "service"}
+	if m.errorClassifier != nil {
+		errorLabels = append(errorLabels, "class")
+	}
+	m.httpErrors = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
 			Subsystem: subsystem,
-			Name:      "application_events_total",
-			Help:      "Count of application-specific events",
+			Name:      "http_errors_total",
+			Help:      "Total number of HTTP responses with error status codes",
 		},
-		[]string{"event", "service"},
+		append(errorLabels, m.extraLabels...),
 	)
-	m.registry.MustRegister(m.applicationEvent)
+	m.mustRegister(m.httpErrors)
 
-	// Service-specific gauge for arbitrary numeric values
-	m.serviceGauge = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
+	// Time spent in middleware before the business handler, see MarkHandlerStart
+	m.httpMiddleware = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
 			Namespace: namespace,
 			Subsystem: subsystem,
-			Name:      "gauge",
-			Help:      "Service-specific gauge for arbitrary values",
+			Name:      "http_middleware_seconds",
+			Help:      "Histogram of time spent in middleware before the handler starts",
+			Buckets:   m.histogramBuckets,
 		},
-		[]string{"name", "service"},
+		[]string{"method", "path", "service"},
 	)
-	m.registry.MustRegister(m.serviceGauge)
+	m.mustRegister(m.httpMiddleware)
 
-	// Prometheus HTTP handler for /metrics
-	m.scrapeHandler = promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	// In-flight requests and request/response sizes, unless disabled
+	m.registerHTTPSizeMetrics()
 
-	return m
+	// Optional Apdex counter, partitioned by satisfaction bucket and service
+	if m.apdexTarget > 0 {
+		m.httpApdex = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "http_apdex_total",
+				Help:      "Total number of HTTP requests by Apdex satisfaction bucket",
+			},
+			[]string{"bucket", "service"},
+		)
+		m.mustRegister(m.httpApdex)
+	}
+
+	// Optional sampling of duration observations
+	m.registerDurationSampling()
+
+	// Optional counter of requests skipped by filters
+	m.registerRequestFilterMetrics()
+
+	// Optional time to first byte and body write histograms
+	m.registerResponsePhaseMetrics()
+
+	// Optional panic counter
+	m.registerPanicMetrics()
+}
+
+// HistogramBuckets returns the effective buckets used for HTTP duration metrics,
+// either the defaults or those set with WithHistogramBuckets.
+func (m *Metrics) HistogramBuckets() []float64 {
+	return append([]float64(nil), m.histogramBuckets...)
+}
+
+// HTTPDurationCollector returns the http_request_duration_seconds histogram
+// recorded by Instrument, for packages deriving metrics from it such as slo. It
+// returns nil with WithoutDefaultHTTPMetrics.
+func (m *Metrics) HTTPDurationCollector() prometheus.Collector {
+	if m.shardedDuration != nil {
+		return m.shardedDuration
+	}
+	if m.httpDuration == nil {
+		return nil
+	}
+	return m.httpDuration
+}
+
+// ServiceName returns the value of the service label, as set with WithServiceName.
+func (m *Metrics) ServiceName() string {
+	return m.serviceName
+}
+
+// resolveEnvironment returns the configured environment, falling back to the
+// NEXEN_ENV and ENVIRONMENT environment variables.
+func (m *Metrics) resolveEnvironment() string {
+	if m.environment != "" {
+		return m.environment
+	}
+	for _, key := range []string{"NEXEN_ENV", "ENVIRONMENT"} {
+		if env := os.Getenv(key); env != "" {
+			return env
+		}
+	}
+	return ""
+}
+
+// resolveConstLabels returns the constant labels of every metric: those set
+// with WithConstLabels and the environment.
+func (m *Metrics) resolveConstLabels() prometheus.Labels {
+	labels := prometheus.Labels{}
+	for name, value := range m.constLabels {
+		labels[name] = value
+	}
+	if m.environment != "" {
+		labels["environment"] = m.environment
+	}
+	return labels
 }
 
 // Handler returns the HTTP handler to expose the /metrics endpoint.
@@ -155,62 +641,308 @@ func (m *Metrics) Handler() http.Handler {
 	return m.scrapeHandler
 }
 
-// Registry returns the underlying Prometheus registry.
+// Registry returns the underlying Prometheus registry, or nil if metrics are
+// registered through a registerer set with WithRegisterer that is not one.
 func (m *Metrics) Registry() *prometheus.Registry {
 	return m.registry
 }
 
+// Gatherer returns the gatherer of the metrics exposed by Handler, with the
+// renames and deprecation notes applied, for exporters pushing them elsewhere.
+func (m *Metrics) Gatherer() prometheus.Gatherer {
+	return m.gatherer
+}
+
+// Collectors returns the collectors registered through m, including those
+// added with Register and the Register* helpers.
+func (m *Metrics) Collectors() []prometheus.Collector {
+	m.registeredMu.Lock()
+	defer m.registeredMu.Unlock()
+	return append([]prometheus.Collector(nil), m.registered...)
+}
+
 // Instrument wraps an HTTP handler to collect request count, duration, and errors.
 // It should be used as middleware at the outermost layer.
 func (m *Metrics) Instrument(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Path
-		method := r.Method
+		m.serveInstrumented(w, r, next, m.serviceName)
+	})
+}
+
+// InstrumentFunc is like Instrument but wraps an http.HandlerFunc, so it can be
+// passed directly to mux.HandleFunc.
+func (m *Metrics) InstrumentFunc(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m.serveInstrumented(w, r, next, m.serviceName)
+	}
+}
+
+// serveInstrumented serves a single request through next while recording the
+// standard HTTP metrics with the given service label. It is shared by
+// Instrument, InstrumentFunc and their ServiceScope counterparts.
+func (m *Metrics) serveInstrumented(w http.ResponseWriter, r *http.Request, next http.Handler, service string) {
+	var overheadStart time.Time
+	if m.self != nil {
+		overheadStart = m.now()
+	}
+	o := m.startRequest(r, service)
+	r = o.req
+	if m.noHTTPMetrics || o.skipped {
+		next.ServeHTTP(w, r)
+		return
+	}
+	var overhead time.Duration
+	if m.self != nil {
+		overhead = m.since(overheadStart)
+	}
+	if o.inFlight != nil {
+		defer o.inFlight.Dec()
+	}
 
-		// Increment request count
-		m.httpRequests.WithLabelValues(method, path, m.serviceName).Inc()
+	// Add the Server-Timing header before the response starts
+	var timing *serverTimingWriter
+	if m.serverTiming {
+		timing = &serverTimingWriter{ResponseWriter: w, now: m.now, start: o.start}
+		w = timing
+	}
 
-		// Create timer to observe duration
-		start := time.Now()
+	// Record when the response starts
+	var phases *phaseWriter
+	if m.responsePhases {
+		phases = &phaseWriter{ResponseWriter: w, now: m.now}
+		w = phases
+	}
 
-		// Capture status code via ResponseWriter wrapper
-		rw := &responseWriter{ResponseWriter: w}
+	// Capture status code via ResponseWriter wrapper
+	rw := m.wrapWriter(w)
+	completed := false
+	defer func() {
+		// A panic that is not recovered continues once the request is recorded
+		// as a 500, as the adapters record it with Response.Panicked
+		if !completed {
+			o.finish(m.pathLabel(r), http.StatusInternalServerError, rw.BytesWritten(), responseContentType(rw))
+		}
+	}()
+	if m.httpPanics != nil {
+		m.serveCapturingPanic(rw, r, next, service)
+	} else {
 		next.ServeHTTP(rw, r)
+	}
+	completed = true
+	if timing != nil {
+		timing.setHeader()
+	}
+
+	if phases != nil {
+		phases.started()
+		o.obs.phases = true
+		o.obs.firstByte = phases.firstByte.Sub(o.start)
+	}
+
+	if m.self != nil {
+		overheadStart = m.now()
+	}
+	o.finish(m.pathLabel(r), rw.StatusCode(), rw.BytesWritten(), responseContentType(rw))
+	if m.self != nil {
+		m.self.instrumentOverhead.Observe((overhead + m.since(overheadStart)).Seconds())
+	}
+}
+
+// httpObservation holds everything Instrument records about a single request,
+// so recording can happen inline or on a background goroutine.
+type httpObservation struct {
+	service     string
+	method      string
+	path        string
+	clientClass string
+	contentType string
+	errorClass  string
+	status      int
+	reqSize     int64
+	respSize    int64
+	elapsed     time.Duration
+	marked      bool
+	middleware  time.Duration
+	phases      bool
+	firstByte   time.Duration
+	exemplar    prometheus.Labels
+	extra       []string
+}
+
+// observeHTTP updates the HTTP metrics for a completed request.
+func (m *Metrics) observeHTTP(obs httpObservation) {
+	m.touchSeries(seriesKey{group: seriesHTTP, service: obs.service, a: obs.method, b: obs.path})
+
+	// Increment request count
+	m.requestCounter(obs).Inc()
+
+	// Record duration, unless restricted to successful responses or not sampled
+	if (!m.successLatency || obs.status < 400) && (m.sampler == nil || m.sampler.sample()) {
+		observeWithExemplar(m.durationObserver(obs), obs.elapsed.Seconds(), obs.exemplar)
+	}
 
-		// Record duration
-		duration := time.Since(start).Seconds()
-		m.httpDuration.WithLabelValues(method, path, m.serviceName).Observe(duration)
+	// Record middleware overhead if the handler start was marked
+	if obs.marked {
+		m.httpMiddleware.WithLabelValues(obs.method, obs.path, obs.service).Observe(obs.middleware.Seconds())
+	}
+
+	// Split the duration at the first response byte if enabled
+	if obs.phases {
+		m.httpFirstByte.WithLabelValues(obs.method, obs.path, obs.service).Observe(obs.firstByte.Seconds())
+		m.httpWrite.WithLabelValues(obs.method, obs.path, obs.service).Observe((obs.elapsed - obs.firstByte).Seconds())
+	}
+
+	// Record request and response sizes; unknown request sizes are skipped
+	if m.httpRequestSize != nil && obs.reqSize >= 0 {
+		m.sizeObserver(&m.httpChildren.requestSize, m.httpRequestSize, obs).Observe(float64(obs.reqSize))
+	}
+	if m.httpResponseSize != nil {
+		m.sizeObserver(&m.httpChildren.responseSize, m.httpResponseSize, obs).Observe(float64(obs.respSize))
+	}
+
+	// Classify the request for Apdex if enabled
+	if m.httpApdex != nil {
+		m.httpApdex.WithLabelValues(apdexBucket(obs.elapsed, m.apdexTarget), obs.service).Inc()
+	}
 
-		// If status code >= 400, increment error counter
-		statusCode := rw.statusCode
-		if statusCode >= 400 {
-			m.httpErrors.WithLabelValues(method, path, http.StatusText(statusCode), m.serviceName).Inc()
+	// If status code >= 400, increment error counter
+	if obs.status >= 400 {
+		labels := []string{obs.method, obs.path, m.codeLabel(obs.status), obs.service}
+		if m.errorClassifier != nil {
+			labels = append(labels, obs.errorClass)
 		}
-	})
+		labels = append(labels, obs.extra...)
+		incWithExemplar(m.httpErrors.WithLabelValues(labels...), obs.exemplar)
+	}
+
+	// Remember the latest duration for LastLatency
+	if m.latencyProbe != nil {
+		m.latencyProbe.observe(obs.method, obs.path, obs.elapsed)
+	}
+}
+
+// pathLabel returns the value of the path label for a request.
+func (m *Metrics) pathLabel(r *http.Request) string {
+	if m.pathNormalizer != nil {
+		return m.routeLabel(m.pathNormalizer(r))
+	}
+	return m.limitDepth(r.URL.Path)
+}
+
+// routeLabel returns the value of the path label for a route template, or
+// "unmatched" if route is empty.
+func (m *Metrics) routeLabel(route string) string {
+	if route == "" {
+		route = unmatchedPath
+	}
+	return m.limitDepth(route)
+}
+
+// limitDepth truncates path to the limit set with WithPathDepthLimit.
+func (m *Metrics) limitDepth(path string) string {
+	if m.pathDepthLimit > 0 {
+		return truncatePath(path, m.pathDepthLimit)
+	}
+	return path
+}
+
+// truncatePath keeps the first depth segments of path and replaces the rest with "/…".
+func truncatePath(path string, depth int) string {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", depth+1)
+	if len(parts) <= depth || (len(parts) == depth+1 && parts[depth] == "") {
+		return path
+	}
+	return "/" + strings.Join(parts[:depth], "/") + "/…"
+}
+
+// codeLabel renders a status code according to the configured granularity.
+func (m *Metrics) codeLabel(code int) string {
+	switch m.codeGranularity {
+	case StatusCodeExact:
+		return strconv.Itoa(code)
+	case StatusCodeClass:
+		return statusClass(code)
+	default:
+		return http.StatusText(code)
+	}
+}
+
+// WithCodeClassLabel adds a code_class label with the class of the response
+// status, e.g. "2xx" or "5xx", to http_requests_total, so success ratios can
+// be computed from it alone:
+//
+//	sum(rate(nexen_service_http_requests_total{code_class!="5xx"}[5m]))
+//	  / sum(rate(nexen_service_http_requests_total[5m]))
+//
+// It is off by default because the extra label changes the series of the
+// metric, which breaks queries matching on its exact label set.
+func WithCodeClassLabel() Option {
+	return func(m *Metrics) {
+		m.codeClassLabel = true
+	}
+}
+
+// statusClass returns the class of a status code, e.g. "5xx".
+func statusClass(code int) string {
+	if code < 100 || code > 999 {
+		return "unknown"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// apdexBucket returns the Apdex satisfaction bucket for a request duration.
+func apdexBucket(elapsed, target time.Duration) string {
+	switch {
+	case elapsed <= target:
+		return "satisfied"
+	case elapsed <= 4*target:
+		return "tolerating"
+	default:
+		return "frustrated"
+	}
 }
 
 // RecordEvent increments a counter for application-specific events.
 func (m *Metrics) RecordEvent(event string) {
-	m.applicationEvent.WithLabelValues(event, m.serviceName).Inc()
+	m.eventCounter(event, m.serviceName).Inc()
 }
 
 // SetGauge sets the value of a named gauge.
 func (m *Metrics) SetGauge(name string, value float64) {
-	m.serviceGauge.WithLabelValues(name, m.serviceName).Set(value)
+	m.gauge(name, m.serviceName).Set(value)
 }
 
 // IncrementGauge increments a named gauge by 1.
 func (m *Metrics) IncrementGauge(name string) {
-	m.serviceGauge.WithLabelValues(name, m.serviceName).Inc()
+	m.gauge(name, m.serviceName).Inc()
 }
 
 // DecrementGauge decrements a named gauge by 1.
 func (m *Metrics) DecrementGauge(name string) {
-	m.serviceGauge.WithLabelValues(name, m.serviceName).Dec()
+	m.gauge(name, m.serviceName).Dec()
+}
+
+// Register registers a custom collector, such as one exporting the stats of a
+// connection pool. Like the metrics created by the other Register methods, its
+// metrics carry the environment label if configured and it is unregistered by
+// Close.
+func (m *Metrics) Register(c prometheus.Collector) error {
+	if err := m.register(c); err != nil {
+		return fmt.Errorf("failed to register collector: %w", err)
+	}
+	return nil
 }
 
 // RegisterCounter creates and registers a new counter with the given name and help text.
 func (m *Metrics) RegisterCounter(name, help string, labels []string) (*prometheus.CounterVec, error) {
+	return m.registerCounter(name, help, labels, m.register)
+}
+
+// registerCounter is RegisterCounter registering with register.
+func (m *Metrics) registerCounter(name, help string, labels []string, register func(prometheus.Collector) error) (*prometheus.CounterVec, error) {
+	if err := m.validateNames(name, labels); err != nil {
+		return nil, fmt.Errorf("failed to register counter %s: %w", name, err)
+	}
 	allLabels := append(labels, "service")
 	counter := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -222,40 +954,121 @@ func (m *Metrics) RegisterCounter(name, help string, labels []string) (*promethe
 		allLabels,
 	)
 
-	err := m.registry.Register(counter)
+	err := register(counter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to register counter %s: %w", name, err)
 	}
+	m.index(name, counter, "counter", help, allLabels)
 	return counter, nil
 }
 
 // RegisterHistogram creates and registers a new histogram with the given name, help text, and buckets.
 func (m *Metrics) RegisterHistogram(name, help string, buckets []float64, labels []string) (*prometheus.HistogramVec, error) {
+	return m.registerHistogram(name, help, buckets, labels, m.register)
+}
+
+// registerHistogram is RegisterHistogram registering with register.
+func (m *Metrics) registerHistogram(name, help string, buckets []float64, labels []string, register func(prometheus.Collector) error) (*prometheus.HistogramVec, error) {
+	if err := m.validateNames(name, labels); err != nil {
+		return nil, fmt.Errorf("failed to register histogram %s: %w", name, err)
+	}
 	if buckets == nil {
 		buckets = m.histogramBuckets
 	}
 
 	allLabels := append(labels, "service")
 	histogram := prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
+		withNativeBuckets(prometheus.HistogramOpts{
 			Namespace: namespace,
 			Subsystem: subsystem,
 			Name:      name,
 			Help:      help,
 			Buckets:   buckets,
-		},
+		}, m.nativeFactor),
+		allLabels,
+	)
+
+	err := register(histogram)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register histogram %s: %w", name, err)
+	}
+	m.index(name, histogram, "histogram", help, allLabels)
+	return histogram, nil
+}
+
+// RegisterNativeHistogram creates and registers a native histogram without any
+// classic buckets, minimizing the number of series for high-cardinality
+// histograms. bucketFactor controls the resolution: each bucket is at most
+// bucketFactor times wider than the previous one (1.1 is a common choice) and
+// must be greater than 1. Native histograms are only exposed in the protobuf
+// exposition format; text-format scrapes only see _sum and _count.
+func (m *Metrics) RegisterNativeHistogram(name, help string, bucketFactor float64, labels []string) (*prometheus.HistogramVec, error) {
+	if err := m.validateNames(name, labels); err != nil {
+		return nil, fmt.Errorf("failed to register histogram %s: %w", name, err)
+	}
+	if bucketFactor <= 1 {
+		return nil, fmt.Errorf("failed to register histogram %s: native bucket factor must be greater than 1, got %v", name, bucketFactor)
+	}
+
+	allLabels := append(labels, "service")
+	histogram := prometheus.NewHistogramVec(
+		withNativeBuckets(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      name,
+			Help:      help,
+		}, bucketFactor),
 		allLabels,
 	)
 
-	err := m.registry.Register(histogram)
+	err := m.register(histogram)
 	if err != nil {
 		return nil, fmt.Errorf("failed to register histogram %s: %w", name, err)
 	}
+	m.index(name, histogram, "histogram", help, allLabels)
 	return histogram, nil
 }
 
+// RegisterSummary creates and registers a new summary with the given name, help
+// text and quantile objectives, mapping each quantile to its allowed absolute
+// error, e.g. {0.5: 0.05, 0.95: 0.01, 0.99: 0.001}. Summaries compute quantiles
+// on the client over a sliding ten-minute window, so they need no bucket
+// tuning but cannot be aggregated across instances. A nil objectives map
+// exposes only _sum and _count.
+func (m *Metrics) RegisterSummary(name, help string, objectives map[float64]float64, labels []string) (*prometheus.SummaryVec, error) {
+	if err := m.validateNames(name, labels); err != nil {
+		return nil, fmt.Errorf("failed to register summary %s: %w", name, err)
+	}
+	allLabels := append(labels, "service")
+	summary := prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Namespace:  namespace,
+			Subsystem:  subsystem,
+			Name:       name,
+			Help:       help,
+			Objectives: objectives,
+		},
+		allLabels,
+	)
+
+	err := m.register(summary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register summary %s: %w", name, err)
+	}
+	m.index(name, summary, "summary", help, allLabels)
+	return summary, nil
+}
+
 // RegisterGauge creates and registers a new gauge with the given name and help text.
 func (m *Metrics) RegisterGauge(name, help string, labels []string) (*prometheus.GaugeVec, error) {
+	return m.registerGauge(name, help, labels, m.register)
+}
+
+// registerGauge is RegisterGauge registering with register.
+func (m *Metrics) registerGauge(name, help string, labels []string, register func(prometheus.Collector) error) (*prometheus.GaugeVec, error) {
+	if err := m.validateNames(name, labels); err != nil {
+		return nil, fmt.Errorf("failed to register gauge %s: %w", name, err)
+	}
 	allLabels := append(labels, "service")
 	gauge := prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -267,22 +1080,86 @@ func (m *Metrics) RegisterGauge(name, help string, labels []string) (*prometheus
 		allLabels,
 	)
 
-	err := m.registry.Register(gauge)
+	err := register(gauge)
 	if err != nil {
 		return nil, fmt.Errorf("failed to register gauge %s: %w", name, err)
 	}
+	m.index(name, gauge, "gauge", help, allLabels)
 	return gauge, nil
 }
 
+// RegisterGaugeFunc creates and registers a gauge whose value is computed by
+// fn at scrape time, such as a queue depth or cache size. fn may be called
+// concurrently and should return quickly.
+func (m *Metrics) RegisterGaugeFunc(name, help string, fn func() float64) (prometheus.GaugeFunc, error) {
+	if err := m.validateNames(name, nil); err != nil {
+		return nil, fmt.Errorf("failed to register gauge func %s: %w", name, err)
+	}
+	gauge := prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        name,
+			Help:        help,
+			ConstLabels: prometheus.Labels{"service": m.serviceName},
+		},
+		fn,
+	)
+
+	err := m.register(gauge)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register gauge func %s: %w", name, err)
+	}
+	m.index(name, gauge, "gauge", help, []string{"service"})
+	return gauge, nil
+}
+
+// CapturingWriter is an http.ResponseWriter that records the status code and
+// number of body bytes written through it.
+type CapturingWriter interface {
+	http.ResponseWriter
+	StatusCode() int
+	BytesWritten() int64
+}
+
 // responseWriter wraps http.ResponseWriter to capture status codes
 // without altering its behaviour.
 type responseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode   int
+	bytesWritten int64
+	// sniffedType is the Content-Type net/http detects from the first body
+	// bytes when the handler sets none.
+	sniffedType string
+}
+
+// newResponseWriter is the default CapturingWriter factory used by Instrument.
+func newResponseWriter(w http.ResponseWriter) CapturingWriter {
+	return &responseWriter{ResponseWriter: w}
+}
+
+// StatusCode returns the captured status code, or 0 if nothing was written.
+func (rw *responseWriter) StatusCode() int {
+	return rw.statusCode
+}
+
+// BytesWritten returns the number of body bytes written.
+func (rw *responseWriter) BytesWritten() int64 {
+	return rw.bytesWritten
 }
 
 // WriteHeader captures the status code and delegates to the real writer.
+// Like the standard library, only the first final status is honoured: later
+// calls are neither recorded nor forwarded. Informational 1xx headers are
+// forwarded without being captured.
 func (rw *responseWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		rw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if rw.statusCode != 0 {
+		return
+	}
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
@@ -293,5 +1170,34 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	if rw.statusCode == 0 {
 		rw.statusCode = http.StatusOK
 	}
-	return rw.ResponseWriter.Write(b)
+	if rw.bytesWritten == 0 && len(b) > 0 {
+		// Like net/http, which sends the sniffed type without adding it to the
+		// header map; a nil Content-Type value suppresses sniffing
+		if _, ok := rw.Header()["Content-Type"]; !ok {
+			rw.sniffedType = http.DetectContentType(b)
+		}
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytesWritten += int64(n)
+	return n, err
+}
+
+// Flush sends buffered data to the client, for streaming handlers.
+func (rw *responseWriter) Flush() {
+	_ = http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Hijack takes over the connection, for WebSocket upgrades. The response is
+// recorded as 101 Switching Protocols.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	c, brw, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err == nil && rw.statusCode == 0 {
+		rw.statusCode = http.StatusSwitchingProtocols
+	}
+	return c, brw, err
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 }
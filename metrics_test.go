@@ -1,11 +1,17 @@
 package metrics
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 func TestNewMetrics(t *testing.T) {
@@ -146,3 +152,576 @@ func TestCustomMetrics(t *testing.T) {
 		t.Fatal("Expected metrics to contain test_counter")
 	}
 }
+
+func TestApdexBucket(t *testing.T) {
+	target := 100 * time.Millisecond
+	cases := []struct {
+		elapsed time.Duration
+		want    string
+	}{
+		{50 * time.Millisecond, "satisfied"},
+		{100 * time.Millisecond, "satisfied"},
+		{250 * time.Millisecond, "tolerating"},
+		{400 * time.Millisecond, "tolerating"},
+		{401 * time.Millisecond, "frustrated"},
+	}
+	for _, c := range cases {
+		if got := apdexBucket(c.elapsed, target); got != c.want {
+			t.Errorf("apdexBucket(%v) = %q, want %q", c.elapsed, got, c.want)
+		}
+	}
+}
+
+func TestInstrumentApdex(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithApdex(time.Second))
+
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fast", nil))
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+
+	want := `nexen_service_http_apdex_total{bucket="satisfied",service="test-service"} 1`
+	if !strings.Contains(string(body), want) {
+		t.Fatalf("Expected metrics to contain %q", want)
+	}
+}
+
+// stubWriter is a minimal CapturingWriter used to verify custom wrappers.
+type stubWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *stubWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *stubWriter) StatusCode() int     { return w.status }
+func (w *stubWriter) BytesWritten() int64 { return 0 }
+
+func TestInstrumentResponseWriterWrapper(t *testing.T) {
+	var used *stubWriter
+	metrics := New(WithServiceName("test-service"), WithResponseWriterWrapper(func(w http.ResponseWriter) CapturingWriter {
+		used = &stubWriter{ResponseWriter: w}
+		return used
+	}))
+
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/tea", nil))
+
+	if used == nil {
+		t.Fatal("Expected custom wrapper to be used")
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+
+	if !strings.Contains(string(body), `code="I'm a teapot"`) {
+		t.Fatal("Expected error counter to use status from custom wrapper")
+	}
+}
+
+func TestResponseWriterBytesWritten(t *testing.T) {
+	rw := newResponseWriter(httptest.NewRecorder())
+	_, _ = rw.Write([]byte("hello"))
+	_, _ = rw.Write([]byte(" world"))
+
+	if rw.BytesWritten() != 11 {
+		t.Fatalf("Expected 11 bytes written, got %d", rw.BytesWritten())
+	}
+	if rw.StatusCode() != http.StatusOK {
+		t.Fatalf("Expected implicit status 200, got %d", rw.StatusCode())
+	}
+}
+
+func TestSetGaugeAt(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+
+	at := time.UnixMilli(1700000000000)
+	metrics.SetGaugeAt("queue_lag", 3, at)
+	metrics.SetGaugeAt("queue_lag", 7, at.Add(-time.Minute)) // older sample, ignored
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+
+	want := `nexen_service_timestamped_gauge{name="queue_lag",service="test-service"} 3 1700000000000`
+	if !strings.Contains(string(body), want) {
+		t.Fatalf("Expected metrics to contain %q, got:\n%s", want, body)
+	}
+}
+
+func TestInstrumentFunc(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/func", metrics.InstrumentFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/func", nil))
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	bodyStr := string(body)
+
+	if !strings.Contains(bodyStr, `nexen_service_http_requests_total{method="GET",path="/func",service="test-service"} 1`) {
+		t.Fatal("Expected InstrumentFunc to count the request")
+	}
+	if !strings.Contains(bodyStr, `code="Not Found"`) {
+		t.Fatal("Expected InstrumentFunc to record the error")
+	}
+}
+
+func TestEnvironmentLabel(t *testing.T) {
+	scrape := func(m *Metrics) string {
+		w := httptest.NewRecorder()
+		m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		body, _ := ioutil.ReadAll(w.Result().Body)
+		return string(body)
+	}
+
+	t.Setenv("NEXEN_ENV", "")
+	t.Setenv("ENVIRONMENT", "")
+	if strings.Contains(scrape(New()), `environment="`) {
+		t.Fatal("Expected no environment label by default")
+	}
+
+	t.Setenv("ENVIRONMENT", "staging")
+	if !strings.Contains(scrape(New()), `go_goroutines{environment="staging"}`) {
+		t.Fatal("Expected environment label from ENVIRONMENT")
+	}
+
+	t.Setenv("NEXEN_ENV", "canary")
+	if !strings.Contains(scrape(New()), `go_goroutines{environment="canary"}`) {
+		t.Fatal("Expected NEXEN_ENV to take precedence over ENVIRONMENT")
+	}
+
+	m := New(WithEnvironment("production"))
+	m.RecordEvent("deploy")
+	if !strings.Contains(scrape(m), `nexen_service_application_events_total{environment="production",event="deploy",service="default"} 1`) {
+		t.Fatal("Expected explicit environment to override environment variables")
+	}
+}
+
+func TestTruncatePath(t *testing.T) {
+	cases := []struct {
+		path  string
+		depth int
+		want  string
+	}{
+		{"/api/v1/users/123", 2, "/api/v1/…"},
+		{"/api/v1", 2, "/api/v1"},
+		{"/api/v1/", 2, "/api/v1/"},
+		{"/api", 2, "/api"},
+		{"/", 1, "/"},
+		{"/a/b/c", 1, "/a/…"},
+	}
+	for _, c := range cases {
+		if got := truncatePath(c.path, c.depth); got != c.want {
+			t.Errorf("truncatePath(%q, %d) = %q, want %q", c.path, c.depth, got, c.want)
+		}
+	}
+}
+
+func TestObserveDuration(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+
+	metrics.ObserveDuration("cache_refresh", 30*time.Millisecond)
+	metrics.ObserveDuration("cache_refresh", 70*time.Millisecond)
+	metrics.ObserveDuration("invalid-name", time.Second) // dropped
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+
+	want := `nexen_service_cache_refresh_duration_seconds_count{service="test-service"} 2`
+	if !strings.Contains(string(body), want) {
+		t.Fatalf("Expected metrics to contain %q", want)
+	}
+}
+
+func TestTimer(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+
+	if elapsed := metrics.Timer("import", "source", "csv").Stop(); elapsed <= 0 {
+		t.Errorf("Expected Stop to return the elapsed time, got %v", elapsed)
+	}
+	metrics.Timer("import", "format", "json").Stop() // other label names, dropped
+	metrics.Timer("import", "source").Stop()         // odd labels, dropped
+
+	failure := errors.New("upstream unavailable")
+	if err := metrics.Time("sync", func() error { return failure }); !errors.Is(err, failure) {
+		t.Errorf("Expected Time to return the error of fn, got %v", err)
+	}
+	if err := metrics.Time("sync", func() error { return nil }); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`nexen_service_import_duration_seconds_count{service="test-service",source="csv"} 1`,
+		`nexen_service_sync_duration_seconds_count{service="test-service"} 2`,
+		`nexen_service_sync_errors_total{service="test-service"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
+
+func TestResponseWriterDoubleWriteHeader(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(http.StatusInternalServerError) // superfluous, ignored
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/twice", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected client to receive 400, got %d", rec.Code)
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	bodyStr := string(body)
+
+	if !strings.Contains(bodyStr, `code="Bad Request"`) {
+		t.Fatal("Expected recorded status to match the first WriteHeader call")
+	}
+	if strings.Contains(bodyStr, `code="Internal Server Error"`) {
+		t.Fatal("Expected the second WriteHeader call to be ignored")
+	}
+}
+
+func TestResponseWriterWriteHeaderAfterWrite(t *testing.T) {
+	rw := newResponseWriter(httptest.NewRecorder())
+	_, _ = rw.Write([]byte("body"))
+	rw.WriteHeader(http.StatusInternalServerError)
+
+	if rw.StatusCode() != http.StatusOK {
+		t.Fatalf("Expected implicit status 200 to stick, got %d", rw.StatusCode())
+	}
+}
+
+func TestStatusCodeGranularity(t *testing.T) {
+	cases := []struct {
+		granularity StatusCodeGranularity
+		want        string
+	}{
+		{StatusCodeText, `code="Service Unavailable"`},
+		{StatusCodeExact, `code="503"`},
+		{StatusCodeClass, `code="5xx"`},
+	}
+	for _, c := range cases {
+		metrics := New(WithStatusCodeGranularity(c.granularity))
+		handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/down", nil))
+
+		w := httptest.NewRecorder()
+		metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		body, _ := ioutil.ReadAll(w.Result().Body)
+
+		if !strings.Contains(string(body), c.want) {
+			t.Errorf("granularity %d: expected metrics to contain %s", c.granularity, c.want)
+		}
+	}
+}
+
+func TestCodeClassLabel(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithCodeClassLabel(), WithClientClassifier(DefaultClientClassifier))
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/moved":
+			http.Redirect(w, r, "/", http.StatusFound)
+		}
+	}))
+	for _, path := range []string{"/down", "/moved", "/empty", "/empty"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`nexen_service_http_requests_total{client_class="external",code_class="5xx",method="GET",path="/down",service="test-service"} 1`,
+		`nexen_service_http_requests_total{client_class="external",code_class="3xx",method="GET",path="/moved",service="test-service"} 1`,
+		`nexen_service_http_requests_total{client_class="external",code_class="2xx",method="GET",path="/empty",service="test-service"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %s", want)
+		}
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	defaults := New().HistogramBuckets()
+	if len(defaults) == 0 || defaults[0] != 0.005 {
+		t.Fatalf("Expected default HTTP buckets, got %v", defaults)
+	}
+
+	custom := []float64{0.1, 1, 10}
+	metrics := New(WithHistogramBuckets(custom))
+	got := metrics.HistogramBuckets()
+	if len(got) != 3 || got[0] != 0.1 || got[2] != 10 {
+		t.Fatalf("Expected custom buckets, got %v", got)
+	}
+
+	got[0] = 42
+	if metrics.HistogramBuckets()[0] != 0.1 {
+		t.Fatal("Expected HistogramBuckets to return a copy")
+	}
+}
+
+func TestLatencyForSuccessOnly(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithLatencyForSuccessOnly())
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ok", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/bad", nil))
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	bodyStr := string(body)
+
+	if !strings.Contains(bodyStr, `nexen_service_http_request_duration_seconds_count{method="GET",path="/ok",service="test-service"} 1`) {
+		t.Fatal("Expected duration for successful request")
+	}
+	if strings.Contains(bodyStr, `nexen_service_http_request_duration_seconds_count{method="GET",path="/bad"`) {
+		t.Fatal("Expected no duration for failed request")
+	}
+	if !strings.Contains(bodyStr, `nexen_service_http_requests_total{method="GET",path="/bad",service="test-service"} 1`) {
+		t.Fatal("Expected failed request to still be counted")
+	}
+}
+
+func TestRegisterNativeHistogram(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+
+	if _, err := metrics.RegisterNativeHistogram("bad_factor_seconds", "Bad", 1, nil); err == nil {
+		t.Fatal("Expected an error for a bucket factor of 1")
+	}
+
+	histogram, err := metrics.RegisterNativeHistogram("token_latency_seconds", "Token latency", 1.1, []string{"model"})
+	if err != nil {
+		t.Fatalf("Failed to register native histogram: %v", err)
+	}
+	histogram.WithLabelValues("gpt-4", "test-service").Observe(0.25)
+
+	families, err := metrics.Registry().Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %v", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != "nexen_service_token_latency_seconds" {
+			continue
+		}
+		h := mf.GetMetric()[0].GetHistogram()
+		if len(h.GetBucket()) != 0 {
+			t.Fatalf("Expected no classic buckets, got %d", len(h.GetBucket()))
+		}
+		if len(h.GetPositiveSpan()) == 0 {
+			t.Fatal("Expected native histogram buckets")
+		}
+		return
+	}
+	t.Fatal("Expected native histogram to be gathered")
+}
+
+func TestObserveBatchSize(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	metrics.ObserveBatchSize("orders", 7)
+	metrics.ObserveBatchSize("orders", 300)
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	bodyStr := string(body)
+
+	for _, want := range []string{
+		`nexen_service_batch_size_bucket{queue="orders",service="test-service",le="10"} 1`,
+		`nexen_service_batch_size_bucket{queue="orders",service="test-service",le="500"} 2`,
+		`nexen_service_batch_size_sum{queue="orders",service="test-service"} 307`,
+	} {
+		if !strings.Contains(bodyStr, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+
+	custom := New(WithBatchSizeBuckets([]float64{8, 64}))
+	custom.ObserveBatchSize("orders", 7)
+	w = httptest.NewRecorder()
+	custom.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ = ioutil.ReadAll(w.Result().Body)
+	if !strings.Contains(string(body), `le="64"`) {
+		t.Fatal("Expected custom batch size buckets")
+	}
+}
+
+func TestRegisterSummary(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+
+	summary, err := metrics.RegisterSummary("query_seconds", "Query duration", map[float64]float64{0.5: 0.05, 0.99: 0.001}, []string{"table"})
+	if err != nil {
+		t.Fatalf("Failed to register summary: %v", err)
+	}
+	for i := 1; i <= 100; i++ {
+		summary.WithLabelValues("users", "test-service").Observe(float64(i))
+	}
+
+	if _, err := metrics.RegisterSummary("query_seconds", "Duplicate", nil, []string{"table"}); err == nil {
+		t.Fatal("Expected an error when registering a duplicate summary")
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	bodyStr := string(body)
+
+	for _, want := range []string{
+		`nexen_service_query_seconds{service="test-service",table="users",quantile="0.5"} 50`,
+		`nexen_service_query_seconds{service="test-service",table="users",quantile="0.99"} 99`,
+		`nexen_service_query_seconds_count{service="test-service",table="users"} 100`,
+	} {
+		if !strings.Contains(bodyStr, want) {
+			t.Errorf("Expected metrics output to contain %q", want)
+		}
+	}
+}
+
+func TestRegisterGaugeFunc(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	depth := 3
+	if _, err := metrics.RegisterGaugeFunc("queue_depth", "Jobs waiting in the queue", func() float64 {
+		return float64(depth)
+	}); err != nil {
+		t.Fatalf("Failed to register gauge func: %v", err)
+	}
+	if _, err := metrics.RegisterGaugeFunc("queue_depth", "Jobs waiting in the queue", func() float64 { return 0 }); err == nil {
+		t.Error("Expected an error when registering the same gauge func twice")
+	}
+
+	depth = 8
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	want := `nexen_service_queue_depth{service="test-service"} 8`
+	if !strings.Contains(w.Body.String(), want) {
+		t.Errorf("Expected value computed at scrape time %q", want)
+	}
+}
+
+func TestRegisterCollector(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "custom_collector_value", Help: "Custom"})
+
+	if err := metrics.Register(gauge); err != nil {
+		t.Fatalf("Failed to register collector: %v", err)
+	}
+	if err := metrics.Register(gauge); err == nil {
+		t.Fatal("Expected an error when registering a collector twice")
+	}
+	if err := metrics.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if metrics.Registry().Unregister(gauge) {
+		t.Fatal("Expected Close to unregister the collector")
+	}
+}
+
+func TestWithoutDefaultCollectors(t *testing.T) {
+	// A registry that already has the standard collectors
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}), collectors.NewGoCollector())
+
+	metrics := New(
+		WithRegistry(registry),
+		WithServiceName("test-service"),
+		WithoutProcessCollector(),
+		WithoutGoCollector(),
+		WithoutDefaultHTTPMetrics(),
+	)
+	defer metrics.Close(context.Background())
+
+	called := false
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/users", nil))
+	if !called || w.Code != http.StatusNotFound {
+		t.Fatalf("Expected request to reach the handler, got called=%v status=%d", called, w.Code)
+	}
+	metrics.RecordEvent("signup")
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	for _, f := range families {
+		if strings.HasPrefix(f.GetName(), "nexen_service_http_") {
+			t.Errorf("Expected no HTTP metrics, got %s", f.GetName())
+		}
+	}
+	if metrics.HTTPDurationCollector() != nil {
+		t.Error("Expected no HTTP duration collector")
+	}
+}
+
+func TestWithRegisterer(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics := New(
+		WithServiceName("test-service"),
+		WithRegisterer(prometheus.WrapRegistererWith(prometheus.Labels{"region": "eu-west"}, registry)),
+		WithGatherer(registry),
+	)
+	defer metrics.Close(context.Background())
+
+	if metrics.Registry() != nil {
+		t.Error("Expected no registry with a wrapping registerer")
+	}
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users", nil))
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	want := `nexen_service_http_requests_total{method="GET",path="/users",region="eu-west",service="test-service"} 1`
+	if !strings.Contains(w.Body.String(), want) {
+		t.Errorf("Expected scrape to contain %q, got:\n%s", want, w.Body.String())
+	}
+
+	// A registry passed as registerer is also the gatherer
+	other := prometheus.NewRegistry()
+	scoped := New(WithoutProcessCollector(), WithoutGoCollector(), WithRegisterer(other))
+	defer scoped.Close(context.Background())
+	scoped.RecordEvent("signup")
+	if scoped.Registry() != other {
+		t.Error("Expected registerer to be returned as the registry")
+	}
+	if families, err := scoped.gatherer.Gather(); err != nil || len(families) == 0 {
+		t.Errorf("Expected to gather from the registerer, got %d families: %v", len(families), err)
+	}
+}
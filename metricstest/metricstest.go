@@ -0,0 +1,188 @@
+// Package metricstest helps unit-test the instrumentation recorded with a
+// Metrics instance, without scraping it and matching the text format:
+//
+//	clock := metricstest.NewClock(time.Time{})
+//	m := metrics.New(metrics.WithServiceName("orders"), metrics.WithClock(clock.Now))
+//	handler := m.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//		clock.Advance(250 * time.Millisecond)
+//	}))
+//	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/orders", nil))
+//
+//	labels := map[string]string{"method": "GET", "path": "/orders"}
+//	metricstest.AssertCounterValue(t, m, "nexen_service_http_requests_total", labels, 1)
+//	metricstest.AssertHistogramSum(t, m, "nexen_service_http_request_duration_seconds", labels, 0.25)
+package metricstest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// AssertCounterValue fails t unless the counter name with labels has the value
+// want. labels need not include every label of the series, but must match
+// exactly one series; the service label can usually be left out.
+func AssertCounterValue(t testing.TB, m *metrics.Metrics, name string, labels map[string]string, want float64) {
+	t.Helper()
+	metric, err := find(m, name, labels, dto.MetricType_COUNTER)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got := metric.GetCounter().GetValue(); got != want {
+		t.Errorf("Expected %s to be %v, got %v", describe(name, labels), want, got)
+	}
+}
+
+// AssertGaugeValue is like AssertCounterValue for gauges.
+func AssertGaugeValue(t testing.TB, m *metrics.Metrics, name string, labels map[string]string, want float64) {
+	t.Helper()
+	metric, err := find(m, name, labels, dto.MetricType_GAUGE)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got := metric.GetGauge().GetValue(); got != want {
+		t.Errorf("Expected %s to be %v, got %v", describe(name, labels), want, got)
+	}
+}
+
+// AssertHistogramCount fails t unless the histogram name with labels has
+// recorded want observations.
+func AssertHistogramCount(t testing.TB, m *metrics.Metrics, name string, labels map[string]string, want uint64) {
+	t.Helper()
+	metric, err := find(m, name, labels, dto.MetricType_HISTOGRAM)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got := metric.GetHistogram().GetSampleCount(); got != want {
+		t.Errorf("Expected %s to have %d observations, got %d", describe(name, labels), want, got)
+	}
+}
+
+// AssertHistogramSum fails t unless the observations of the histogram name
+// with labels sum up to want. Durations are exact when recorded with a Clock.
+func AssertHistogramSum(t testing.TB, m *metrics.Metrics, name string, labels map[string]string, want float64) {
+	t.Helper()
+	metric, err := find(m, name, labels, dto.MetricType_HISTOGRAM)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got := metric.GetHistogram().GetSampleSum(); got != want {
+		t.Errorf("Expected the observations of %s to sum up to %v, got %v", describe(name, labels), want, got)
+	}
+}
+
+// CollectAndCompare fails t unless the metric families names, or all exposed
+// families if none are given, match expected in the Prometheus text format.
+// It wraps testutil.GatherAndCompare, whose error shows a diff.
+func CollectAndCompare(t testing.TB, m *metrics.Metrics, expected string, names ...string) {
+	t.Helper()
+	if err := testutil.GatherAndCompare(m.Gatherer(), strings.NewReader(expected), names...); err != nil {
+		t.Error(err)
+	}
+}
+
+// CollectAndCount returns the number of series of the metric families names,
+// or of all exposed families if none are given. Histogram and summary series
+// count once per label set.
+func CollectAndCount(t testing.TB, m *metrics.Metrics, names ...string) int {
+	t.Helper()
+	count, err := testutil.GatherAndCount(m.Gatherer(), names...)
+	if err != nil {
+		t.Error(err)
+	}
+	return count
+}
+
+// find returns the single series of the family name of type kind matching
+// labels.
+func find(m *metrics.Metrics, name string, labels map[string]string, kind dto.MetricType) (*dto.Metric, error) {
+	families, err := m.Gatherer().Gather()
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather metrics: %w", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+		if mf.GetType() != kind {
+			return nil, fmt.Errorf("%s is a %s, not a %s", name, strings.ToLower(mf.GetType().String()), strings.ToLower(kind.String()))
+		}
+
+		var found []*dto.Metric
+		for _, metric := range mf.GetMetric() {
+			if matches(metric, labels) {
+				found = append(found, metric)
+			}
+		}
+		switch len(found) {
+		case 0:
+			return nil, fmt.Errorf("no series matches %s", describe(name, labels))
+		case 1:
+			return found[0], nil
+		default:
+			return nil, fmt.Errorf("%d series match %s; add labels to select one", len(found), describe(name, labels))
+		}
+	}
+	return nil, fmt.Errorf("metric %s is not registered", name)
+}
+
+// matches reports whether metric has all labels.
+func matches(metric *dto.Metric, labels map[string]string) bool {
+	matched := 0
+	for _, l := range metric.GetLabel() {
+		if want, ok := labels[l.GetName()]; ok {
+			if l.GetValue() != want {
+				return false
+			}
+			matched++
+		}
+	}
+	return matched == len(labels)
+}
+
+// describe formats a series selector like PromQL, as in name{a="b"}.
+func describe(name string, labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, v))
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Clock is a fake clock for metrics.WithClock. It only moves when advanced.
+// It is safe for concurrent use.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a clock stopped at start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
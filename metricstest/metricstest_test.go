@@ -0,0 +1,73 @@
+package metricstest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+)
+
+// recorder captures the failures reported by the helpers.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Error(args ...any) {
+	r.errors = append(r.errors, fmt.Sprint(args...))
+}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertions(t *testing.T) {
+	clock := NewClock(time.Time{})
+	m := metrics.New(metrics.WithServiceName("orders"), metrics.WithClock(clock.Now))
+	handler := m.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clock.Advance(250 * time.Millisecond)
+	}))
+	for _, path := range []string{"/orders", "/orders", "/users"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	m.SetGauge("depth", 3)
+
+	orders := map[string]string{"method": "GET", "path": "/orders"}
+	AssertCounterValue(t, m, "nexen_service_http_requests_total", orders, 2)
+	AssertHistogramCount(t, m, "nexen_service_http_request_duration_seconds", orders, 2)
+	AssertHistogramSum(t, m, "nexen_service_http_request_duration_seconds", orders, 0.5)
+	AssertGaugeValue(t, m, "nexen_service_gauge", map[string]string{"name": "depth"}, 3)
+	if got := CollectAndCount(t, m, "nexen_service_http_requests_total"); got != 2 {
+		t.Errorf("Expected 2 request series, got %d", got)
+	}
+	CollectAndCompare(t, m, `
+# HELP nexen_service_gauge Service-specific gauge for arbitrary values
+# TYPE nexen_service_gauge gauge
+nexen_service_gauge{name="depth",service="orders"} 3
+`, "nexen_service_gauge")
+
+	for _, tc := range []struct {
+		assert func(tb testing.TB)
+		err    string
+	}{
+		{func(tb testing.TB) { AssertCounterValue(tb, m, "nexen_service_http_requests_total", orders, 3) }, "to be 3, got 2"},
+		{func(tb testing.TB) { AssertCounterValue(tb, m, "nexen_service_http_requests_total", nil, 1) }, "2 series match"},
+		{func(tb testing.TB) {
+			AssertCounterValue(tb, m, "nexen_service_http_requests_total", map[string]string{"path": "/none"}, 1)
+		}, "no series matches"},
+		{func(tb testing.TB) { AssertGaugeValue(tb, m, "nexen_service_http_requests_total", orders, 1) }, "is a counter, not a gauge"},
+		{func(tb testing.TB) { AssertCounterValue(tb, m, "nexen_service_missing_total", nil, 1) }, "is not registered"},
+	} {
+		r := &recorder{TB: t}
+		tc.assert(r)
+		if len(r.errors) != 1 || !strings.Contains(r.errors[0], tc.err) {
+			t.Errorf("Expected a failure containing %q, got %q", tc.err, r.errors)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+)
+
+// processFileSuffix is the suffix of the files holding the metrics of each
+// process in multi-process mode.
+const processFileSuffix = ".pb"
+
+// exitedFilePrefix starts the names of the files of exited processes whose PID
+// was reused, which are kept for their counters.
+const exitedFilePrefix = "exited-"
+
+// staleIntervals is the number of write intervals after which a process whose
+// file was not written is considered to have exited.
+const staleIntervals = 3
+
+// GaugeMergeMode selects how WithMultiProcess merges the gauges of several
+// processes. Only the gauges of live processes are merged in every mode.
+type GaugeMergeMode int
+
+const (
+	// GaugeLive keeps a series per live process, with a pid label.
+	GaugeLive GaugeMergeMode = iota
+	// GaugeMax keeps the largest value across live processes.
+	GaugeMax
+	// GaugeSum adds up the values of live processes, e.g. for connections or
+	// queue lengths per worker.
+	GaugeSum
+)
+
+// WithMultiProcess aggregates the metrics of several processes sharing dir,
+// such as pre-forked workers or replicas in one pod, so that a scrape of any
+// of them returns one series set. Every interval, and when closed, each process
+// writes its metrics to a file named after its PID in dir; gathering merges
+// the files of the other processes with the live metrics of the process:
+//
+//   - counters and histograms are summed, so requests served by all workers
+//     appear as one series
+//   - summaries are summed too, but lose their quantiles, which cannot be
+//     merged
+//   - gauges are kept per process, with a pid label, or merged as set with
+//     WithMultiProcessGauges
+//
+// A process whose file was not written for three intervals is considered to
+// have exited: its gauges are dropped, while its counts are kept. A process
+// reusing the PID of an exited one first renames the file of that process, so
+// the counts are not overwritten. Clear dir when the service, not a worker,
+// starts. All processes must be created with the same options.
+func WithMultiProcess(dir string, interval time.Duration) Option {
+	return func(m *Metrics) {
+		m.multiProcessDir = dir
+		m.multiProcessInterval = interval
+	}
+}
+
+// WithMultiProcessGauges sets how WithMultiProcess merges the gauges of live
+// processes. It defaults to GaugeLive.
+func WithMultiProcessGauges(mode GaugeMergeMode) Option {
+	return func(m *Metrics) {
+		m.multiProcessGauges = mode
+	}
+}
+
+// multiProcess writes the metrics of this process and merges those of others.
+type multiProcess struct {
+	dir  string
+	pid  string
+	file string
+	// local gathers the metrics of this process
+	local prometheus.Gatherer
+	// gauges is the merge mode of gauges
+	gauges GaugeMergeMode
+	// staleAfter is the age after which the file of a process is considered
+	// to be left by an exited process
+	staleAfter time.Duration
+	// dirErr is the error setting up dir, reported by write and Gather
+	dirErr error
+}
+
+// startMultiProcess sets up multi-process mode when WithMultiProcess is set:
+// it wraps local, the gatherer of this process, to merge the files of other
+// processes, and writes local to the file of this process every interval and
+// when the instance is closed. If dir cannot be created, or the file left
+// under the PID of this process cannot be kept, gathering returns the local
+// metrics along with the error.
+func (m *Metrics) startMultiProcess(local prometheus.Gatherer) prometheus.Gatherer {
+	if m.multiProcessDir == "" {
+		return local
+	}
+
+	interval := positiveInterval(m.multiProcessInterval, time.Second)
+	pid := strconv.Itoa(os.Getpid())
+	p := &multiProcess{
+		dir:        m.multiProcessDir,
+		pid:        pid,
+		file:       filepath.Join(m.multiProcessDir, pid+processFileSuffix),
+		local:      local,
+		gauges:     m.multiProcessGauges,
+		staleAfter: staleIntervals * interval,
+	}
+	if err := os.MkdirAll(p.dir, 0o755); err != nil {
+		p.dirErr = fmt.Errorf("failed to create multi-process directory: %w", err)
+	} else {
+		p.dirErr = p.keepExited()
+	}
+
+	m.goBackground(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_ = p.write()
+			case <-m.done:
+				return
+			}
+		}
+	})
+	m.onClose(func(context.Context) error {
+		return p.write()
+	})
+	return p
+}
+
+// keepExited renames a file left under the PID of this process by an exited
+// process, which write would otherwise replace, losing its counts.
+func (p *multiProcess) keepExited() error {
+	exited := filepath.Join(p.dir, exitedFilePrefix+p.pid+"-"+strconv.FormatInt(time.Now().UnixNano(), 10)+processFileSuffix)
+	if err := os.Rename(p.file, exited); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to keep metrics file of exited process: %w", err)
+	}
+	return nil
+}
+
+// write atomically replaces the file of this process with its current
+// metrics.
+func (p *multiProcess) write() error {
+	if p.dirErr != nil {
+		return p.dirErr
+	}
+	families, err := p.local.Gather()
+	if err != nil && len(families) == 0 {
+		return fmt.Errorf("failed to gather metrics: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(p.dir, "."+p.pid+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create metrics file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, mf := range families {
+		if _, err := protodelim.MarshalTo(w, mf); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write metrics file: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p.file); err != nil {
+		return fmt.Errorf("failed to replace metrics file: %w", err)
+	}
+	return nil
+}
+
+// Gather merges the live metrics of this process with the files of the other
+// processes. The gauges of exited processes are left out. Unreadable files are
+// skipped and reported in the error.
+func (p *multiProcess) Gather() ([]*dto.MetricFamily, error) {
+	families, err := p.local.Gather()
+	errs := []error{err}
+	merged := newFamilyMerger(p.gauges)
+	merged.add(families, p.pid, true)
+	if p.dirErr != nil {
+		return merged.families(), errors.Join(append(errs, p.dirErr)...)
+	}
+
+	paths, globErr := filepath.Glob(filepath.Join(p.dir, "*"+processFileSuffix))
+	errs = append(errs, globErr)
+	for _, path := range paths {
+		pid := strings.TrimSuffix(filepath.Base(path), processFileSuffix)
+		if pid == p.pid {
+			continue
+		}
+		live := !strings.HasPrefix(pid, exitedFilePrefix)
+		if live {
+			info, err := os.Stat(path)
+			if err != nil {
+				// Renamed by a process reusing the PID
+				continue
+			}
+			live = time.Since(info.ModTime()) < p.staleAfter
+		}
+		families, err := readProcessFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		merged.add(families, pid, live)
+	}
+	return merged.families(), errors.Join(errs...)
+}
+
+// readProcessFile reads the metric families written by another process.
+func readProcessFile(path string) ([]*dto.MetricFamily, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics file: %w", err)
+	}
+	defer f.Close()
+
+	var families []*dto.MetricFamily
+	r := bufio.NewReader(f)
+	for {
+		mf := &dto.MetricFamily{}
+		if err := protodelim.UnmarshalFrom(r, mf); err != nil {
+			if errors.Is(err, io.EOF) {
+				return families, nil
+			}
+			return nil, fmt.Errorf("failed to parse metrics file %s: %w", path, err)
+		}
+		families = append(families, mf)
+	}
+}
+
+// familyMerger merges the metric families of several processes.
+type familyMerger struct {
+	gauges  GaugeMergeMode
+	byName  map[string]*dto.MetricFamily
+	metrics map[string]map[string]*dto.Metric
+}
+
+// newFamilyMerger returns an empty merger merging gauges as set by mode.
+func newFamilyMerger(gauges GaugeMergeMode) *familyMerger {
+	return &familyMerger{
+		gauges:  gauges,
+		byName:  make(map[string]*dto.MetricFamily),
+		metrics: make(map[string]map[string]*dto.Metric),
+	}
+}
+
+// add merges the families of the process pid. The gauges of a process that is
+// not live are skipped, as are families whose type differs from the one seen
+// first.
+func (f *familyMerger) add(families []*dto.MetricFamily, pid string, live bool) {
+	for _, mf := range families {
+		isGauge := mf.GetType() == dto.MetricType_GAUGE || mf.GetType() == dto.MetricType_UNTYPED
+		if isGauge && !live {
+			continue
+		}
+		name := mf.GetName()
+		merged, ok := f.byName[name]
+		if !ok {
+			merged = &dto.MetricFamily{Name: mf.Name, Help: mf.Help, Type: mf.Type, Unit: mf.Unit}
+			f.byName[name] = merged
+			f.metrics[name] = make(map[string]*dto.Metric)
+		} else if merged.GetType() != mf.GetType() {
+			continue
+		}
+
+		series := f.metrics[name]
+		for _, metric := range mf.Metric {
+			metric = proto.Clone(metric).(*dto.Metric)
+			if metric.Summary != nil {
+				// Quantiles cannot be merged, so drop them even from series
+				// recorded by a single process for consistent output
+				metric.Summary.Quantile = nil
+			}
+			if isGauge && f.gauges == GaugeLive {
+				metric.Label = append(metric.Label, &dto.LabelPair{Name: proto.String("pid"), Value: proto.String(pid)})
+				sort.Slice(metric.Label, func(i, j int) bool {
+					return metric.Label[i].GetName() < metric.Label[j].GetName()
+				})
+			}
+			key := labelsKey(metric.Label)
+			if existing, ok := series[key]; ok {
+				mergeMetric(existing, metric, f.gauges)
+				continue
+			}
+			series[key] = metric
+			merged.Metric = append(merged.Metric, metric)
+		}
+	}
+}
+
+// families returns the merged families sorted by name, with their series
+// sorted by label set.
+func (f *familyMerger) families() []*dto.MetricFamily {
+	out := make([]*dto.MetricFamily, 0, len(f.byName))
+	for _, mf := range f.byName {
+		sort.Slice(mf.Metric, func(i, j int) bool {
+			return labelsKey(mf.Metric[i].Label) < labelsKey(mf.Metric[j].Label)
+		})
+		out = append(out, mf)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GetName() < out[j].GetName() })
+	return out
+}
+
+// labelsKey identifies a label set.
+func labelsKey(labels []*dto.LabelPair) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.GetName())
+		b.WriteByte(0)
+		b.WriteString(l.GetValue())
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// mergeMetric adds the samples of src to dst, series of the same family and
+// label set recorded by different processes. Gauges are merged as set by
+// gauges.
+func mergeMetric(dst, src *dto.Metric, gauges GaugeMergeMode) {
+	dst.TimestampMs = nil
+	switch {
+	case dst.Counter != nil && src.Counter != nil:
+		dst.Counter = &dto.Counter{Value: proto.Float64(dst.Counter.GetValue() + src.Counter.GetValue())}
+	case dst.Gauge != nil && src.Gauge != nil:
+		dst.Gauge = &dto.Gauge{Value: proto.Float64(mergeGauge(dst.Gauge.GetValue(), src.Gauge.GetValue(), gauges))}
+	case dst.Untyped != nil && src.Untyped != nil:
+		dst.Untyped = &dto.Untyped{Value: proto.Float64(mergeGauge(dst.Untyped.GetValue(), src.Untyped.GetValue(), gauges))}
+	case dst.Histogram != nil && src.Histogram != nil:
+		dst.Histogram = mergeHistogram(dst.Histogram, src.Histogram)
+	case dst.Summary != nil && src.Summary != nil:
+		dst.Summary = &dto.Summary{
+			SampleCount: proto.Uint64(dst.Summary.GetSampleCount() + src.Summary.GetSampleCount()),
+			SampleSum:   proto.Float64(dst.Summary.GetSampleSum() + src.Summary.GetSampleSum()),
+		}
+	}
+}
+
+// mergeGauge merges the gauge values of two processes.
+func mergeGauge(a, b float64, gauges GaugeMergeMode) float64 {
+	if gauges == GaugeMax {
+		return max(a, b)
+	}
+	return a + b
+}
+
+// mergeHistogram sums the classic buckets, count and sum of two histograms.
+// Buckets are matched by upper bound; native histogram data and exemplars are
+// dropped, as they cannot be summed this way.
+func mergeHistogram(a, b *dto.Histogram) *dto.Histogram {
+	counts := make(map[float64]uint64)
+	for _, h := range []*dto.Histogram{a, b} {
+		for _, bucket := range h.Bucket {
+			counts[bucket.GetUpperBound()] += bucket.GetCumulativeCount()
+		}
+	}
+	bounds := make([]float64, 0, len(counts))
+	for bound := range counts {
+		bounds = append(bounds, bound)
+	}
+	sort.Float64s(bounds)
+
+	merged := &dto.Histogram{
+		SampleCount: proto.Uint64(a.GetSampleCount() + b.GetSampleCount()),
+		SampleSum:   proto.Float64(a.GetSampleSum() + b.GetSampleSum()),
+	}
+	for _, bound := range bounds {
+		merged.Bucket = append(merged.Bucket, &dto.Bucket{
+			UpperBound:      proto.Float64(bound),
+			CumulativeCount: proto.Uint64(counts[bound]),
+		})
+	}
+	return merged
+}
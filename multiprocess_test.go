@@ -0,0 +1,259 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// gatheredFamily returns the family named name from families.
+func gatheredFamily(t *testing.T, families []*dto.MetricFamily, name string) *dto.MetricFamily {
+	t.Helper()
+	for _, mf := range families {
+		if mf.GetName() == name {
+			return mf
+		}
+	}
+	t.Fatalf("Expected family %s to be gathered", name)
+	return nil
+}
+
+func TestMultiProcess(t *testing.T) {
+	dir := t.TempDir()
+
+	// Another worker, writing its file as the background writer would
+	worker := New(WithServiceName("test-service"))
+	worker.RecordEvent("job_done")
+	worker.RecordEvent("job_done")
+	worker.SetGauge("queue_depth", 5)
+	worker.Instrument(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/jobs", nil))
+	other := &multiProcess{dir: dir, pid: "1", file: filepath.Join(dir, "1"+processFileSuffix), local: worker.Registry()}
+	if err := other.write(); err != nil {
+		t.Fatalf("Failed to write metrics file: %v", err)
+	}
+
+	metrics := New(WithServiceName("test-service"), WithMultiProcess(dir, time.Hour))
+	metrics.RecordEvent("job_done")
+	metrics.SetGauge("queue_depth", 3)
+	metrics.Instrument(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/jobs", nil))
+
+	families, err := metrics.Gatherer().Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %v", err)
+	}
+
+	events := gatheredFamily(t, families, "nexen_service_application_events_total")
+	if len(events.Metric) != 1 || events.Metric[0].GetCounter().GetValue() != 3 {
+		t.Fatalf("Expected one event series summed to 3, got %v", events.Metric)
+	}
+	duration := gatheredFamily(t, families, "nexen_service_http_request_duration_seconds")
+	if len(duration.Metric) != 1 || duration.Metric[0].GetHistogram().GetSampleCount() != 2 {
+		t.Fatalf("Expected one duration series with 2 observations, got %v", duration.Metric)
+	}
+	gauges := gatheredFamily(t, families, "nexen_service_gauge")
+	if len(gauges.Metric) != 2 {
+		t.Fatalf("Expected a gauge series per process, got %v", gauges.Metric)
+	}
+	for _, m := range gauges.Metric {
+		for _, l := range m.Label {
+			if l.GetName() == "pid" && l.GetValue() == "1" && m.GetGauge().GetValue() != 5 {
+				t.Fatalf("Expected the gauge of the other worker to be 5, got %v", m.GetGauge().GetValue())
+			}
+		}
+	}
+
+	// Close writes the file of this process
+	if err := metrics.Close(context.Background()); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, strconv.Itoa(os.Getpid())+processFileSuffix)); err != nil {
+		t.Fatalf("Expected the metrics file of this process to be written: %v", err)
+	}
+}
+
+func TestMultiProcessUnreadableFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "1"+processFileSuffix), []byte("not protobuf"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	metrics := New(WithServiceName("test-service"), WithMultiProcess(dir, time.Hour))
+	defer metrics.Close(context.Background())
+	metrics.RecordEvent("job_done")
+
+	families, err := metrics.Gatherer().Gather()
+	if err == nil {
+		t.Fatal("Expected an error for an unreadable metrics file")
+	}
+	gatheredFamily(t, families, "nexen_service_application_events_total")
+}
+
+func TestMergeHistogram(t *testing.T) {
+	h := func(count uint64, sum float64, buckets ...uint64) *dto.Histogram {
+		out := &dto.Histogram{SampleCount: &count, SampleSum: &sum}
+		for i, c := range buckets {
+			bound, c := float64(i+1), c
+			out.Bucket = append(out.Bucket, &dto.Bucket{UpperBound: &bound, CumulativeCount: &c})
+		}
+		return out
+	}
+
+	merged := mergeHistogram(h(2, 1.5, 1, 2), h(3, 4, 0, 3))
+	if merged.GetSampleCount() != 5 || merged.GetSampleSum() != 5.5 {
+		t.Fatalf("Expected count 5 and sum 5.5, got %d and %v", merged.GetSampleCount(), merged.GetSampleSum())
+	}
+	for i, want := range []uint64{1, 5} {
+		if got := merged.Bucket[i].GetCumulativeCount(); got != want {
+			t.Fatalf("Expected bucket %d to hold %d, got %d", i, want, got)
+		}
+	}
+}
+
+func TestMultiProcessDirectoryError(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	metrics := New(WithServiceName("test-service"), WithMultiProcess(filepath.Join(file, "dir"), time.Hour))
+	metrics.RecordEvent("job_done")
+
+	families, err := metrics.Gatherer().Gather()
+	if err == nil {
+		t.Fatal("Expected an error for a directory that cannot be created")
+	}
+	gatheredFamily(t, families, "nexen_service_application_events_total")
+	if err := metrics.Close(context.Background()); err == nil {
+		t.Fatal("Expected Close to report the failed write")
+	}
+}
+
+func TestFamilyMergerStripsQuantiles(t *testing.T) {
+	summary := &dto.MetricFamily{
+		Name: proto.String("latency"),
+		Type: dto.MetricType_SUMMARY.Enum(),
+		Metric: []*dto.Metric{{Summary: &dto.Summary{
+			SampleCount: proto.Uint64(2),
+			SampleSum:   proto.Float64(3),
+			Quantile:    []*dto.Quantile{{Quantile: proto.Float64(0.5), Value: proto.Float64(1)}},
+		}}},
+	}
+	merged := newFamilyMerger(GaugeLive)
+	merged.add([]*dto.MetricFamily{summary}, "1", true)
+
+	got := merged.families()[0].Metric[0].GetSummary()
+	if len(got.Quantile) != 0 || got.GetSampleCount() != 2 {
+		t.Fatalf("Expected the summary of a single process to lose its quantiles only, got %v", got)
+	}
+	if len(summary.Metric[0].GetSummary().Quantile) != 1 {
+		t.Fatal("Expected the gathered family to be left unchanged")
+	}
+}
+
+// writeProcessFile writes the metrics of worker to the file of process pid in
+// dir, as its background writer would.
+func writeProcessFile(t *testing.T, dir, pid string, worker *Metrics) string {
+	t.Helper()
+	p := &multiProcess{dir: dir, pid: pid, file: filepath.Join(dir, pid+processFileSuffix), local: worker.Registry()}
+	if err := p.write(); err != nil {
+		t.Fatalf("Failed to write metrics file: %v", err)
+	}
+	return p.file
+}
+
+func TestMultiProcessGaugeModes(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		mode   GaugeMergeMode
+		series int
+		value  float64
+	}{
+		{"live", GaugeLive, 2, 0},
+		{"max", GaugeMax, 1, 5},
+		{"sum", GaugeSum, 1, 8},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			worker := New(WithServiceName("test-service"))
+			worker.SetGauge("queue_depth", 5)
+			writeProcessFile(t, dir, "1", worker)
+
+			// The gauge of an exited worker is left out in every mode
+			exited := New(WithServiceName("test-service"))
+			exited.SetGauge("queue_depth", 100)
+			old := time.Now().Add(-staleIntervals * time.Hour)
+			if err := os.Chtimes(writeProcessFile(t, dir, "2", exited), old, old); err != nil {
+				t.Fatalf("Failed to age metrics file: %v", err)
+			}
+
+			metrics := New(WithServiceName("test-service"), WithMultiProcess(dir, time.Hour), WithMultiProcessGauges(tc.mode))
+			defer metrics.Close(context.Background())
+			metrics.SetGauge("queue_depth", 3)
+
+			families, err := metrics.Gatherer().Gather()
+			if err != nil {
+				t.Fatalf("Failed to gather: %v", err)
+			}
+			gauges := gatheredFamily(t, families, "nexen_service_gauge")
+			if len(gauges.Metric) != tc.series {
+				t.Fatalf("Expected %d gauge series, got %v", tc.series, gauges.Metric)
+			}
+			for _, m := range gauges.Metric {
+				if m.GetGauge().GetValue() == 100 {
+					t.Fatal("Expected the gauge of the exited worker to be dropped")
+				}
+				if tc.mode != GaugeLive && m.GetGauge().GetValue() != tc.value {
+					t.Fatalf("Expected the merged gauge to be %v, got %v", tc.value, m.GetGauge().GetValue())
+				}
+			}
+		})
+	}
+}
+
+func TestMultiProcessExitedCountsKept(t *testing.T) {
+	dir := t.TempDir()
+
+	// Exited worker whose counts stay in the merged counters
+	exited := New(WithServiceName("test-service"))
+	exited.RecordEvent("job_done")
+	old := time.Now().Add(-staleIntervals * time.Hour)
+	if err := os.Chtimes(writeProcessFile(t, dir, "1", exited), old, old); err != nil {
+		t.Fatalf("Failed to age metrics file: %v", err)
+	}
+
+	// An exited process whose PID this process reuses
+	previous := New(WithServiceName("test-service"))
+	previous.RecordEvent("job_done")
+	previous.RecordEvent("job_done")
+	writeProcessFile(t, dir, strconv.Itoa(os.Getpid()), previous)
+
+	metrics := New(WithServiceName("test-service"), WithMultiProcess(dir, time.Hour))
+	metrics.RecordEvent("job_done")
+	assertEvents := func(name string, gatherer prometheus.Gatherer) {
+		t.Helper()
+		families, err := gatherer.Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather from %s: %v", name, err)
+		}
+		events := gatheredFamily(t, families, "nexen_service_application_events_total")
+		if len(events.Metric) != 1 || events.Metric[0].GetCounter().GetValue() != 4 {
+			t.Fatalf("Expected %s to sum the events to 4, got %v", name, events.Metric)
+		}
+	}
+	assertEvents("this process", metrics.Gatherer())
+
+	// Close writes the file of this process without replacing the counts of
+	// the process that had its PID
+	if err := metrics.Close(context.Background()); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	other := &multiProcess{dir: dir, pid: "3", local: New(WithServiceName("test-service")).Registry(), staleAfter: time.Hour}
+	assertEvents("another process", other)
+}
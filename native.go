@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Limits applied to every native histogram, keeping memory bounded for
+// histograms with a wide range of observations.
+const (
+	nativeHistogramMaxBuckets    = 160
+	nativeHistogramMinResetDelay = time.Hour
+)
+
+// WithNativeHistograms makes the HTTP duration histogram and histograms created
+// with RegisterHistogram native histograms with the given bucket factor, in
+// addition to their classic buckets. Scrapers negotiating the protobuf format
+// receive both; text-format scrapes are unchanged. Factors of 1 or less leave
+// native histograms disabled.
+func WithNativeHistograms(factor float64) Option {
+	return func(m *Metrics) {
+		m.nativeFactor = factor
+	}
+}
+
+// withNativeBuckets adds native histogram buckets with the given factor to opts.
+func withNativeBuckets(opts prometheus.HistogramOpts, factor float64) prometheus.HistogramOpts {
+	if factor <= 1 {
+		return opts
+	}
+	opts.NativeHistogramBucketFactor = factor
+	opts.NativeHistogramMaxBucketNumber = nativeHistogramMaxBuckets
+	opts.NativeHistogramMinResetDuration = nativeHistogramMinResetDelay
+	return opts
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestWithNativeHistograms(t *testing.T) {
+	find := func(t *testing.T, m *Metrics, name string) *dto.Histogram {
+		t.Helper()
+		families, err := m.Registry().Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather: %v", err)
+		}
+		for _, mf := range families {
+			if mf.GetName() == name {
+				return mf.GetMetric()[0].GetHistogram()
+			}
+		}
+		t.Fatalf("Expected %s to be gathered", name)
+		return nil
+	}
+
+	metrics := New(WithNativeHistograms(1.1))
+	metrics.Instrument(http.NotFoundHandler()).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	custom, err := metrics.RegisterHistogram("job_seconds", "Job duration", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to register histogram: %v", err)
+	}
+	custom.WithLabelValues("default").Observe(0.3)
+
+	for _, name := range []string{"nexen_service_http_request_duration_seconds", "nexen_service_job_seconds"} {
+		h := find(t, metrics, name)
+		if len(h.GetPositiveSpan()) == 0 {
+			t.Errorf("Expected native buckets for %s", name)
+		}
+		if len(h.GetBucket()) == 0 {
+			t.Errorf("Expected classic buckets to be kept for %s", name)
+		}
+	}
+
+	classic := New()
+	classic.Instrument(http.NotFoundHandler()).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if h := find(t, classic, "nexen_service_http_request_duration_seconds"); h.Schema != nil {
+		t.Fatal("Expected no native histogram without WithNativeHistograms")
+	}
+}
@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RequestObserver records a single request in the standard HTTP metrics, for
+// middleware of frameworks whose handlers do not write through the
+// http.ResponseWriter that Instrument wraps, or that are not built on net/http
+// at all. Create it with StartRequest when the request arrives, pass Request
+// down the handler chain and call Finish once, deferred so that a panicking
+// handler is recorded too:
+//
+//	o := m.StartRequest(c.Request)
+//	c.Request = o.Request()
+//	completed := false
+//	defer func() {
+//		o.Finish(metrics.Response{Route: c.FullPath(), Status: c.Writer.Status(), Panicked: !completed})
+//	}()
+//	c.Next()
+//	completed = true
+//
+// The adapters packages provide such middleware for common frameworks.
+type RequestObserver struct {
+	m            *Metrics
+	req          *http.Request
+	obs          httpObservation
+	start        time.Time
+	handlerStart *time.Time
+	extra        *requestLabels
+	inFlight     prometheus.Gauge
+	skipped      bool
+}
+
+// Response describes a completed response for RequestObserver.Finish.
+type Response struct {
+	// Route is the route template the request matched, such as /users/{id},
+	// recorded as the path label. An empty route is recorded as "unmatched".
+	Route string
+	// Status is the status code sent.
+	Status int
+	// Size is the number of body bytes written.
+	Size int64
+	// ContentType is the Content-Type of the response, recorded with
+	// WithContentTypeLabel.
+	ContentType string
+	// Panicked reports that the handlers panicked. The request is then
+	// recorded with status 500, whatever Status holds, and counted in
+	// nexen_service_http_panics_total with WithPanicCapture. Middleware sets
+	// it from a deferred call that does not recover, leaving recovery to the
+	// framework.
+	Panicked bool
+}
+
+// StartRequest starts recording r, counting it as in flight until Finish.
+func (m *Metrics) StartRequest(r *http.Request) *RequestObserver {
+	return m.startRequest(r, m.serviceName)
+}
+
+// StartRequest is like Metrics.StartRequest, recording with the scope's
+// service label.
+func (s *ServiceScope) StartRequest(r *http.Request) *RequestObserver {
+	return s.m.startRequest(r, s.service)
+}
+
+// startRequest starts recording r with the given service label.
+func (m *Metrics) startRequest(r *http.Request, service string) *RequestObserver {
+	o := &RequestObserver{m: m}
+
+	// Let FromContext find the instance downstream
+	ctx := withScope(r.Context(), &ServiceScope{m: m, service: service})
+	if m.noHTTPMetrics {
+		o.req = r.WithContext(ctx)
+		return o
+	}
+	if m.skipRequest(r, service) {
+		o.skipped = true
+		o.req = r.WithContext(ctx)
+		return o
+	}
+
+	o.obs = httpObservation{
+		service: service,
+		method:  r.Method,
+		reqSize: r.ContentLength,
+	}
+	if m.clientClassifier != nil {
+		o.obs.clientClass = m.clientClass(r)
+	}
+	if m.httpInFlight != nil {
+		o.inFlight = m.httpInFlight.WithLabelValues(service)
+		o.inFlight.Inc()
+	}
+
+	// Create timer to observe duration
+	o.start = m.now()
+
+	// Let MarkHandlerStart report when the business handler begins
+	ctx, o.handlerStart = withHandlerStartMark(ctx)
+	if len(m.extraLabels) > 0 {
+		ctx, o.extra = m.withRequestLabels(ctx)
+	}
+	o.req = r.WithContext(ctx)
+	return o
+}
+
+// Request returns the request to serve, whose context carries the state read
+// by SetLabel, MarkHandlerStart and FromContext.
+func (o *RequestObserver) Request() *http.Request {
+	return o.req
+}
+
+// Finish records the request with the given response.
+func (o *RequestObserver) Finish(resp Response) {
+	if o.m.noHTTPMetrics || o.skipped {
+		return
+	}
+	if o.inFlight != nil {
+		o.inFlight.Dec()
+	}
+	path := o.m.routeLabel(resp.Route)
+	status := resp.Status
+	if resp.Panicked {
+		status = http.StatusInternalServerError
+		if o.m.httpPanics != nil {
+			o.m.httpPanics.WithLabelValues(o.m.limitPath(o.obs.method, o.obs.service, path), o.obs.service).Inc()
+		}
+	}
+	o.finish(path, status, resp.Size, resp.ContentType)
+}
+
+// finish records the request with its path label and response.
+func (o *RequestObserver) finish(path string, status int, respSize int64, contentType string) {
+	m, obs := o.m, o.obs
+	obs.elapsed = m.since(o.start)
+	obs.path = m.limitPath(obs.method, obs.service, path)
+	obs.status = status
+	if m.errorClassifier != nil && obs.status >= 400 {
+		obs.errorClass = m.errorClassifier(obs.status, o.req)
+	}
+	obs.respSize = respSize
+	if o.extra != nil {
+		obs.extra = o.extra.snapshot()
+	}
+	if m.exemplars {
+		obs.exemplar = m.exemplar(o.req)
+	}
+	if m.contentTypeLabel {
+		obs.contentType = normalizeContentType(contentType)
+	}
+	if !o.handlerStart.IsZero() {
+		obs.marked = true
+		obs.middleware = o.handlerStart.Sub(o.start)
+	}
+
+	if m.asyncHTTP != nil {
+		m.enqueueHTTP(obs)
+		return
+	}
+	m.observeHTTP(obs)
+}
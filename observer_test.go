@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRequestObserver(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithPathDepthLimit(2))
+
+	o := metrics.StartRequest(httptest.NewRequest("GET", "/api/v1/users/1", nil))
+	if FromContext(o.Request().Context()) != metrics {
+		t.Error("Expected the Metrics in the request context")
+	}
+	inFlight := metrics.httpInFlight.WithLabelValues("test-service")
+	if got := testutil.ToFloat64(inFlight); got != 1 {
+		t.Errorf("Expected 1 request in flight, got %v", got)
+	}
+	o.Finish(Response{Route: "/api/v1/users/:id", Status: 200, Size: 4})
+	metrics.StartRequest(httptest.NewRequest("GET", "/wp-admin", nil)).Finish(Response{Status: 404})
+
+	if got := testutil.ToFloat64(inFlight); got != 0 {
+		t.Errorf("Expected no requests in flight, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.httpRequests.WithLabelValues("GET", "/api/v1/…", "test-service")); got != 1 {
+		t.Errorf("Expected the route to be truncated, got %v requests", got)
+	}
+	if got := testutil.ToFloat64(metrics.httpErrors.WithLabelValues("GET", "unmatched", "Not Found", "test-service")); got != 1 {
+		t.Errorf("Expected an empty route to be recorded as unmatched, got %v errors", got)
+	}
+}
+
+func TestRequestObserverPanicked(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithPanicCapture(false))
+
+	metrics.StartRequest(httptest.NewRequest("GET", "/boom", nil)).Finish(Response{Route: "/boom", Status: 200, Panicked: true})
+
+	if got := testutil.ToFloat64(metrics.httpPanics.WithLabelValues("/boom", "test-service")); got != 1 {
+		t.Errorf("Expected 1 panic, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.httpErrors.WithLabelValues("GET", "/boom", "Internal Server Error", "test-service")); got != 1 {
+		t.Errorf("Expected the panic to be recorded as a 500, got %v errors", got)
+	}
+}
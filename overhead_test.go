@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarkHandlerStart(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+
+	slowMiddleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(5 * time.Millisecond)
+			next.ServeHTTP(w, r)
+		})
+	}
+	business := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	metrics.Instrument(slowMiddleware(MarkHandlerStart(business))).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/marked", nil))
+	metrics.Instrument(slowMiddleware(business)).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/unmarked", nil))
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Result().Body)
+	bodyStr := string(body)
+
+	if !strings.Contains(bodyStr, `nexen_service_http_middleware_seconds_count{method="GET",path="/marked",service="test-service"} 1`) {
+		t.Fatal("Expected middleware overhead for marked handler")
+	}
+	if !strings.Contains(bodyStr, `nexen_service_http_middleware_seconds_bucket{method="GET",path="/marked",service="test-service",le="0.005"} 0`) {
+		t.Fatal("Expected middleware overhead to include the middleware delay")
+	}
+	if strings.Contains(bodyStr, `nexen_service_http_middleware_seconds_count{method="GET",path="/unmarked"`) {
+		t.Fatal("Expected no middleware overhead without a mark")
+	}
+}
+
+func TestMarkHandlerStartWithoutInstrument(t *testing.T) {
+	called := false
+	MarkHandlerStart(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if !called {
+		t.Fatal("Expected MarkHandlerStart to call the next handler")
+	}
+}
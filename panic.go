@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithPanicCapture makes Instrument count handler panics in
+// nexen_service_http_panics_total, labeled by path. With recover set, the panic
+// is logged with its stack and recovered, and the request is answered with
+// 500 Internal Server Error unless the response has already started. Otherwise
+// the request is recorded with status 500 and the panic continues with its
+// original stack to the recovery of net/http or an outer middleware. Panics with http.ErrAbortHandler, which abort a response
+// on purpose, are never recovered; they are left out of the count only with
+// recover set, since telling them apart requires recovering.
+func WithPanicCapture(recover bool) Option {
+	return func(m *Metrics) {
+		m.panicCapture = true
+		m.panicRecover = recover
+	}
+}
+
+// registerPanicMetrics registers the panic counter if enabled.
+func (m *Metrics) registerPanicMetrics() {
+	if !m.panicCapture {
+		return
+	}
+	m.httpPanics = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "http_panics_total",
+			Help:      "Total number of HTTP handler panics",
+		},
+		[]string{"path", "service"},
+	)
+	m.mustRegister(m.httpPanics)
+}
+
+// serveCapturingPanic serves r with next, counting a panic and recovering it
+// if configured. Without recovery the panic is counted in a defer that does not
+// recover, so it continues with its original stack.
+func (m *Metrics) serveCapturingPanic(w CapturingWriter, r *http.Request, next http.Handler, service string) {
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		if !m.panicRecover {
+			m.httpPanics.WithLabelValues(m.limitPath(r.Method, service, m.pathLabel(r)), service).Inc()
+			return
+		}
+		p := recover()
+		if p == nil {
+			return
+		}
+		if p == http.ErrAbortHandler {
+			panic(p)
+		}
+		m.httpPanics.WithLabelValues(m.limitPath(r.Method, service, m.pathLabel(r)), service).Inc()
+
+		log.Printf("metrics: panic serving %s %s: %v\n%s", r.Method, r.URL.Path, p, debug.Stack())
+		if w.StatusCode() == 0 {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	}()
+	next.ServeHTTP(w, r)
+	completed = true
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPanicCapture(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/abort" {
+			panic(http.ErrAbortHandler)
+		}
+		panic("boom")
+	})
+	serve := func(h http.Handler, path string) (w *httptest.ResponseRecorder, recovered any) {
+		w = httptest.NewRecorder()
+		defer func() { recovered = recover() }()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w, nil
+	}
+
+	metrics := New(WithServiceName("test-service"), WithPanicCapture(true))
+	w, recovered := serve(metrics.Instrument(panicking), "/orders")
+	if recovered != nil || w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected the panic to be recovered as 500, got %d and %v", w.Code, recovered)
+	}
+	if _, recovered := serve(metrics.Instrument(panicking), "/abort"); recovered != http.ErrAbortHandler {
+		t.Errorf("Expected http.ErrAbortHandler to be re-panicked, got %v", recovered)
+	}
+	if got := testutil.ToFloat64(metrics.httpPanics.WithLabelValues("/orders", "test-service")); got != 1 {
+		t.Errorf("Expected 1 panic, got %v", got)
+	}
+	if got := testutil.CollectAndCount(metrics.httpPanics); got != 1 {
+		t.Errorf("Expected aborts not to be counted, got %d series", got)
+	}
+	if got := testutil.ToFloat64(metrics.httpErrors.WithLabelValues("GET", "/orders", "Internal Server Error", "test-service")); got != 1 {
+		t.Errorf("Expected the recovered panic to be recorded as an error, got %v", got)
+	}
+
+	metrics = New(WithServiceName("test-service"), WithPanicCapture(false))
+	if _, recovered := serve(metrics.Instrument(panicking), "/orders"); recovered != "boom" {
+		t.Errorf("Expected the panic to continue, got %v", recovered)
+	}
+	if got := testutil.ToFloat64(metrics.httpPanics.WithLabelValues("/orders", "test-service")); got != 1 {
+		t.Errorf("Expected 1 panic, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.httpRequests.WithLabelValues("GET", "/orders", "test-service")); got != 1 {
+		t.Errorf("Expected the panicking request to be counted, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.httpErrors.WithLabelValues("GET", "/orders", "Internal Server Error", "test-service")); got != 1 {
+		t.Errorf("Expected the panic to be recorded as an error, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.httpInFlight.WithLabelValues("test-service")); got != 0 {
+		t.Errorf("Expected no requests in flight, got %v", got)
+	}
+}
+
+// panicInHandler panics so that the stack seen by an outer recovery can be
+// checked for this frame.
+func panicInHandler(http.ResponseWriter, *http.Request) {
+	panic("boom")
+}
+
+func TestPanicCaptureKeepsStack(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithPanicCapture(false))
+
+	var stack string
+	func() {
+		defer func() {
+			if recover() != nil {
+				stack = string(debug.Stack())
+			}
+		}()
+		metrics.Instrument(http.HandlerFunc(panicInHandler)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/orders", nil))
+	}()
+	if !strings.Contains(stack, "panicInHandler") {
+		t.Errorf("Expected the panic to keep the stack of the handler, got\n%s", stack)
+	}
+	if got := testutil.ToFloat64(metrics.httpPanics.WithLabelValues("/orders", "test-service")); got != 1 {
+		t.Errorf("Expected 1 panic, got %v", got)
+	}
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// unmatchedPath is the path label of requests for which the path normalizer
+// finds no route, so unrouted requests such as scans of random URLs share a
+// single series.
+const unmatchedPath = "unmatched"
+
+// WithPathNormalizer sets the function deriving the path label recorded by
+// Instrument from a request, typically the route template (/users/{id}) rather
+// than the literal path (/users/123). The normalizer runs after the wrapped
+// handler returns, so routers that resolve the route while serving the request
+// are supported. An empty result is recorded as "unmatched". WithPathDepthLimit
+// applies to the normalized path.
+//
+// ServeMuxPattern, ChiRoutePattern and GorillaMuxTemplate provide normalizers
+// for common routers.
+func WithPathNormalizer(normalize func(*http.Request) string) Option {
+	return func(m *Metrics) {
+		m.pathNormalizer = normalize
+	}
+}
+
+// ServeMuxPattern returns a path normalizer reporting the path part of the
+// pattern mux routes a request to, such as /users/{id} for the pattern
+// "GET /users/{id}".
+func ServeMuxPattern(mux *http.ServeMux) func(*http.Request) string {
+	return func(r *http.Request) string {
+		_, pattern := mux.Handler(r)
+		if i := strings.IndexByte(pattern, '/'); i >= 0 {
+			return pattern[i:]
+		}
+		return ""
+	}
+}
+
+// ChiRoutePattern returns a path normalizer reporting the chi route pattern of
+// a request. Pass chi.RouteContext and add Instrument to the router with Use, so
+// it runs inside the router's routing context:
+//
+//	r := chi.NewRouter()
+//	m := metrics.New(metrics.WithPathNormalizer(metrics.ChiRoutePattern(chi.RouteContext)))
+//	r.Use(m.Instrument)
+func ChiRoutePattern[T any, C interface {
+	*T
+	RoutePattern() string
+}](routeContext func(context.Context) C) func(*http.Request) string {
+	return func(r *http.Request) string {
+		rctx := routeContext(r.Context())
+		if rctx == nil {
+			return ""
+		}
+		return rctx.RoutePattern()
+	}
+}
+
+// GorillaMuxTemplate returns a path normalizer reporting the path template of
+// the gorilla/mux route matching a request. Pass mux.CurrentRoute and add
+// Instrument to the router with Use:
+//
+//	r := mux.NewRouter()
+//	m := metrics.New(metrics.WithPathNormalizer(metrics.GorillaMuxTemplate(mux.CurrentRoute)))
+//	r.Use(m.Instrument)
+func GorillaMuxTemplate[T any, R interface {
+	*T
+	GetPathTemplate() (string, error)
+}](currentRoute func(*http.Request) R) func(*http.Request) string {
+	return func(r *http.Request) string {
+		route := currentRoute(r)
+		if route == nil {
+			return ""
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return ""
+		}
+		return template
+	}
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestServeMuxPattern(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	metrics := New(WithServiceName("test-service"), WithPathNormalizer(ServeMuxPattern(mux)))
+	handler := metrics.Instrument(mux)
+
+	for _, target := range []string{"/users/1", "/users/2", "/nope/123"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Result().Body)
+	bodyStr := string(body)
+
+	if !strings.Contains(bodyStr, `nexen_service_http_requests_total{method="GET",path="/users/{id}",service="test-service"} 2`) {
+		t.Fatal("Expected requests to be labeled with the route pattern")
+	}
+	if !strings.Contains(bodyStr, `nexen_service_http_requests_total{method="GET",path="unmatched",service="test-service"} 1`) {
+		t.Fatal("Expected unrouted requests to be labeled as unmatched")
+	}
+	if strings.Contains(bodyStr, `path="/users/1"`) {
+		t.Fatal("Expected no literal path labels")
+	}
+}
+
+type fakeRouteContext struct{ pattern string }
+
+func (c *fakeRouteContext) RoutePattern() string { return c.pattern }
+
+type fakeRouteContextKey struct{}
+
+func fakeRouteContextFrom(ctx context.Context) *fakeRouteContext {
+	rctx, _ := ctx.Value(fakeRouteContextKey{}).(*fakeRouteContext)
+	return rctx
+}
+
+func TestChiRoutePattern(t *testing.T) {
+	normalize := ChiRoutePattern(fakeRouteContextFrom)
+
+	r := httptest.NewRequest("GET", "/users/1", nil)
+	if got := normalize(r); got != "" {
+		t.Fatalf("Expected empty pattern without a route context, got %q", got)
+	}
+
+	// The router completes the pattern while serving, after Instrument has started
+	rctx := &fakeRouteContext{}
+	r = r.WithContext(context.WithValue(r.Context(), fakeRouteContextKey{}, rctx))
+	metrics := New(WithPathNormalizer(normalize))
+	metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rctx.pattern = "/users/{id}"
+	})).ServeHTTP(httptest.NewRecorder(), r)
+
+	if got := testutil.ToFloat64(metrics.httpRequests.WithLabelValues("GET", "/users/{id}", "default")); got != 1 {
+		t.Fatalf("Expected 1 request recorded under the route pattern, got %v", got)
+	}
+}
+
+type fakeRoute struct {
+	template string
+	err      error
+}
+
+func (r *fakeRoute) GetPathTemplate() (string, error) { return r.template, r.err }
+
+func TestGorillaMuxTemplate(t *testing.T) {
+	var route *fakeRoute
+	normalize := GorillaMuxTemplate(func(*http.Request) *fakeRoute { return route })
+	r := httptest.NewRequest("GET", "/users/1", nil)
+
+	if got := normalize(r); got != "" {
+		t.Fatalf("Expected empty template without a route, got %q", got)
+	}
+	route = &fakeRoute{template: "/users/{id}"}
+	if got := normalize(r); got != "/users/{id}" {
+		t.Fatalf("Expected /users/{id}, got %q", got)
+	}
+	route = &fakeRoute{err: errors.New("no template")}
+	if got := normalize(r); got != "" {
+		t.Fatalf("Expected empty template on error, got %q", got)
+	}
+}
@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// pushGatewayConfig holds the Pushgateway configured with WithPushGateway.
+type pushGatewayConfig struct {
+	url      string
+	job      string
+	interval time.Duration
+}
+
+// WithPushGateway pushes all metrics to the Prometheus Pushgateway at
+// gatewayURL under jobName every interval, replacing the metrics previously
+// pushed to the same group, and once more when the instance is closed. It is
+// intended for batch jobs and cron jobs that cannot be scraped. Failed periodic
+// pushes are retried on the next interval and counted in
+// nexen_service_push_failures_total; the error of the final push is returned by
+// Close. A non-positive interval defaults to 15s.
+func WithPushGateway(gatewayURL, jobName string, interval time.Duration) Option {
+	return func(m *Metrics) {
+		m.pushGateway = &pushGatewayConfig{url: gatewayURL, job: jobName, interval: positiveInterval(interval, defaultInterval)}
+	}
+}
+
+// WithPushGrouping adds a grouping label to the pushes made by WithPushGateway,
+// Push, PushAdd and DeletePush, such as the instance name. It may be given
+// multiple times.
+func WithPushGrouping(name, value string) Option {
+	return func(m *Metrics) {
+		if m.pushGrouping == nil {
+			m.pushGrouping = make(map[string]string)
+		}
+		m.pushGrouping[name] = value
+	}
+}
+
+// Push pushes all metrics to the Pushgateway at gatewayURL under jobName,
+// replacing every metric previously pushed to the same group.
+func (m *Metrics) Push(ctx context.Context, gatewayURL, jobName string) error {
+	if err := m.pusher(gatewayURL, jobName).PushContext(ctx); err != nil {
+		return fmt.Errorf("failed to push metrics to %s: %w", gatewayURL, err)
+	}
+	return nil
+}
+
+// PushAdd pushes all metrics to the Pushgateway at gatewayURL under jobName,
+// replacing only the previously pushed metrics with the same names.
+func (m *Metrics) PushAdd(ctx context.Context, gatewayURL, jobName string) error {
+	if err := m.pusher(gatewayURL, jobName).AddContext(ctx); err != nil {
+		return fmt.Errorf("failed to push metrics to %s: %w", gatewayURL, err)
+	}
+	return nil
+}
+
+// DeletePush deletes all metrics pushed to the Pushgateway at gatewayURL under
+// jobName and the configured grouping labels.
+func (m *Metrics) DeletePush(ctx context.Context, gatewayURL, jobName string) error {
+	pusher := m.pusher(gatewayURL, jobName).Client(contextDoer{ctx: ctx})
+	if err := pusher.Delete(); err != nil {
+		return fmt.Errorf("failed to delete pushed metrics from %s: %w", gatewayURL, err)
+	}
+	return nil
+}
+
+// pusher returns a Pusher for the exposed metrics with the configured grouping.
+func (m *Metrics) pusher(gatewayURL, jobName string) *push.Pusher {
+	pusher := push.New(gatewayURL, jobName).Gatherer(m.gatherer)
+	for name, value := range m.pushGrouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	return pusher
+}
+
+// startPushing starts the periodic pushes configured with WithPushGateway and
+// adds a final push on Close.
+func (m *Metrics) startPushing() {
+	cfg := m.pushGateway
+	if cfg == nil {
+		return
+	}
+
+	failures := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "push_failures_total",
+			Help:      "Total number of failed periodic pushes to the Pushgateway",
+		},
+		[]string{"service"},
+	)
+	m.mustRegister(failures)
+	failed := failures.WithLabelValues(m.serviceName)
+
+	m.goBackground(func() {
+		ticker := time.NewTicker(cfg.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), cfg.interval)
+				if err := m.Push(ctx, cfg.url, cfg.job); err != nil {
+					failed.Inc()
+				}
+				cancel()
+			case <-m.done:
+				return
+			}
+		}
+	})
+
+	m.onClose(func(ctx context.Context) error {
+		return m.Push(ctx, cfg.url, cfg.job)
+	})
+}
+
+// contextDoer sends requests with a fixed context, for Pusher methods that do
+// not take one.
+type contextDoer struct {
+	ctx context.Context
+}
+
+// Do sends r with the context of d.
+func (d contextDoer) Do(r *http.Request) (*http.Response, error) {
+	return http.DefaultClient.Do(r.WithContext(d.ctx))
+}
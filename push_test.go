@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGateway records the requests received by a Pushgateway stand-in.
+type fakeGateway struct {
+	mu       sync.Mutex
+	requests []string
+	bodies   []string
+}
+
+func (g *fakeGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.requests = append(g.requests, r.Method+" "+r.URL.Path)
+	g.bodies = append(g.bodies, string(body))
+	if r.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func (g *fakeGateway) received() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.requests...)
+}
+
+func TestPush(t *testing.T) {
+	gateway := &fakeGateway{}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	metrics := New(WithServiceName("test-service"), WithPushGrouping("instance", "worker-1"))
+	metrics.RecordEvent("batch_done")
+	ctx := context.Background()
+
+	if err := metrics.Push(ctx, server.URL, "nightly"); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if err := metrics.PushAdd(ctx, server.URL, "nightly"); err != nil {
+		t.Fatalf("PushAdd failed: %v", err)
+	}
+	if err := metrics.DeletePush(ctx, server.URL, "nightly"); err != nil {
+		t.Fatalf("DeletePush failed: %v", err)
+	}
+
+	want := []string{
+		"PUT /metrics/job/nightly/instance/worker-1",
+		"POST /metrics/job/nightly/instance/worker-1",
+		"DELETE /metrics/job/nightly/instance/worker-1",
+	}
+	if got := gateway.received(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Expected requests %q, got %q", want, got)
+	}
+	if !strings.Contains(gateway.bodies[0], "nexen_service_application_events_total") {
+		t.Fatal("Expected pushed body to contain recorded metrics")
+	}
+}
+
+func TestPushError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := New().Push(context.Background(), server.URL, "nightly"); err == nil {
+		t.Fatal("Expected an error when the gateway rejects the push")
+	}
+}
+
+func TestWithPushGateway(t *testing.T) {
+	gateway := &fakeGateway{}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	metrics := New(WithPushGateway(server.URL, "nightly", 10*time.Millisecond))
+	time.Sleep(35 * time.Millisecond)
+	periodic := len(gateway.received())
+	if periodic == 0 {
+		t.Fatal("Expected periodic pushes")
+	}
+
+	if err := metrics.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	got := gateway.received()
+	if len(got) != periodic+1 && len(got) != periodic+2 {
+		t.Fatalf("Expected a final push on Close, got %d requests after %d periodic pushes", len(got), periodic)
+	}
+	if got[len(got)-1] != "PUT /metrics/job/nightly" {
+		t.Fatalf("Expected final push to replace the job group, got %q", got[len(got)-1])
+	}
+}
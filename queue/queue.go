@@ -0,0 +1,158 @@
+// Package queue instruments work queues and worker pools: enqueue and dequeue
+// counts, depth, the time items wait in the queue and the time spent
+// processing them, labeled by queue name.
+package queue
+
+import (
+	"context"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// durationBuckets cover waits and jobs from a millisecond to ten minutes.
+var durationBuckets = []float64{0.001, 0.005, 0.025, 0.1, 0.5, 1, 5, 15, 60, 300, 600}
+
+// Queue records the metrics of one named queue. It is safe for concurrent use.
+type Queue struct {
+	enqueued   prometheus.Counter
+	dequeued   prometheus.Counter
+	depth      prometheus.Gauge
+	wait       prometheus.Observer
+	processing prometheus.Observer
+}
+
+// New returns the recorder of the queue name, exporting:
+//
+//   - nexen_service_queue_enqueued_total{queue}
+//   - nexen_service_queue_dequeued_total{queue}
+//   - nexen_service_queue_depth{queue}
+//   - nexen_service_queue_wait_seconds{queue}: time from enqueue to dequeue
+//   - nexen_service_queue_processing_seconds{queue}: time spent in Process
+//
+// Queues created from the same Metrics share the metrics.
+func New(m *metrics.Metrics, name string) (*Queue, error) {
+	enqueued, err := m.GetOrRegisterCounter("queue_enqueued_total", "Total number of items added to the queue", []string{"queue"})
+	if err != nil {
+		return nil, err
+	}
+	dequeued, err := m.GetOrRegisterCounter("queue_dequeued_total", "Total number of items taken from the queue", []string{"queue"})
+	if err != nil {
+		return nil, err
+	}
+	depth, err := m.GetOrRegisterGauge("queue_depth", "Number of items waiting in the queue", []string{"queue"})
+	if err != nil {
+		return nil, err
+	}
+	wait, err := m.GetOrRegisterHistogram("queue_wait_seconds", "Histogram of the time items wait in the queue", durationBuckets, []string{"queue"})
+	if err != nil {
+		return nil, err
+	}
+	processing, err := m.GetOrRegisterHistogram("queue_processing_seconds", "Histogram of the time spent processing queue items", durationBuckets, []string{"queue"})
+	if err != nil {
+		return nil, err
+	}
+
+	service := m.ServiceName()
+	return &Queue{
+		enqueued:   enqueued.WithLabelValues(name, service),
+		dequeued:   dequeued.WithLabelValues(name, service),
+		depth:      depth.WithLabelValues(name, service),
+		wait:       wait.WithLabelValues(name, service),
+		processing: processing.WithLabelValues(name, service),
+	}, nil
+}
+
+// Enqueued records an item added to the queue and returns the time to pass to
+// Dequeued when it is taken out.
+func (q *Queue) Enqueued() time.Time {
+	q.enqueued.Inc()
+	q.depth.Inc()
+	return time.Now()
+}
+
+// Dequeued records an item taken from the queue that was added at
+// enqueuedAt. The wait is not recorded if enqueuedAt is zero.
+func (q *Queue) Dequeued(enqueuedAt time.Time) {
+	q.dequeued.Inc()
+	q.depth.Dec()
+	if !enqueuedAt.IsZero() {
+		q.wait.Observe(time.Since(enqueuedAt).Seconds())
+	}
+}
+
+// SetDepth sets the depth of queues whose length is known from elsewhere, such
+// as a broker, instead of counting Enqueued and Dequeued calls.
+func (q *Queue) SetDepth(n int) {
+	q.depth.Set(float64(n))
+}
+
+// Process runs fn, records how long it took and returns its error.
+func (q *Queue) Process(fn func() error) error {
+	start := time.Now()
+	err := fn()
+	q.processing.Observe(time.Since(start).Seconds())
+	return err
+}
+
+// InstrumentedQueue is a bounded in-memory FIFO queue recording its metrics
+// with a Queue.
+type InstrumentedQueue[T any] struct {
+	q     *Queue
+	items chan entry[T]
+}
+
+type entry[T any] struct {
+	item       T
+	enqueuedAt time.Time
+}
+
+// NewInstrumentedQueue returns a queue holding up to capacity items:
+//
+//	jobs := queue.NewInstrumentedQueue[Job](q, 100)
+//	go func() {
+//		for {
+//			job, err := jobs.Pop(ctx)
+//			if err != nil {
+//				return
+//			}
+//			_ = q.Process(func() error { return job.Run(ctx) })
+//		}
+//	}()
+func NewInstrumentedQueue[T any](q *Queue, capacity int) *InstrumentedQueue[T] {
+	return &InstrumentedQueue[T]{q: q, items: make(chan entry[T], capacity)}
+}
+
+// Push adds item to the queue, blocking while it is full. It returns the
+// error of ctx if ctx is done first.
+func (iq *InstrumentedQueue[T]) Push(ctx context.Context, item T) error {
+	// Count the item before a consumer can take it, so depth never goes negative
+	iq.q.depth.Inc()
+	select {
+	case iq.items <- entry[T]{item: item, enqueuedAt: time.Now()}:
+		iq.q.enqueued.Inc()
+		return nil
+	case <-ctx.Done():
+		iq.q.depth.Dec()
+		return ctx.Err()
+	}
+}
+
+// Pop takes the oldest item from the queue, blocking while it is empty. It
+// returns the error of ctx if ctx is done first.
+func (iq *InstrumentedQueue[T]) Pop(ctx context.Context) (T, error) {
+	select {
+	case e := <-iq.items:
+		iq.q.Dequeued(e.enqueuedAt)
+		return e.item, nil
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Len returns the number of items in the queue.
+func (iq *InstrumentedQueue[T]) Len() int {
+	return len(iq.items)
+}
@@ -0,0 +1,110 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestQueue(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("worker"))
+	emails, err := New(m, "emails")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := New(m, "reports"); err != nil {
+		t.Fatalf("Expected a second queue to share the metrics: %v", err)
+	}
+
+	first := emails.Enqueued()
+	emails.Enqueued()
+	emails.Dequeued(first)
+	failure := errors.New("smtp unavailable")
+	if err := emails.Process(func() error { return failure }); !errors.Is(err, failure) {
+		t.Errorf("Expected Process to return the error of fn, got %v", err)
+	}
+
+	expected := `
+# HELP nexen_service_queue_depth Number of items waiting in the queue
+# TYPE nexen_service_queue_depth gauge
+nexen_service_queue_depth{queue="emails",service="worker"} 1
+nexen_service_queue_depth{queue="reports",service="worker"} 0
+# HELP nexen_service_queue_enqueued_total Total number of items added to the queue
+# TYPE nexen_service_queue_enqueued_total counter
+nexen_service_queue_enqueued_total{queue="emails",service="worker"} 2
+nexen_service_queue_enqueued_total{queue="reports",service="worker"} 0
+`
+	if err := testutil.GatherAndCompare(m.Registry(), strings.NewReader(expected),
+		"nexen_service_queue_depth", "nexen_service_queue_enqueued_total"); err != nil {
+		t.Error(err)
+	}
+	if got := sampleCount(t, m, "nexen_service_queue_wait_seconds", "emails"); got != 1 {
+		t.Errorf("Expected 1 wait observation, got %d", got)
+	}
+	if got := sampleCount(t, m, "nexen_service_queue_processing_seconds", "emails"); got != 1 {
+		t.Errorf("Expected 1 processing observation, got %d", got)
+	}
+}
+
+func TestInstrumentedQueue(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("worker"))
+	q, err := New(m, "jobs")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	jobs := NewInstrumentedQueue[string](q, 1)
+	ctx := context.Background()
+
+	if err := jobs.Push(ctx, "a"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	full, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := jobs.Push(full, "b"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Push on a full queue to wait for ctx, got %v", err)
+	}
+	if jobs.Len() != 1 {
+		t.Errorf("Expected 1 queued item, got %d", jobs.Len())
+	}
+	if item, err := jobs.Pop(ctx); err != nil || item != "a" {
+		t.Errorf("Expected to pop a, got %q, %v", item, err)
+	}
+
+	if got := testutil.ToFloat64(q.depth); got != 0 {
+		t.Errorf("Expected empty queue depth 0, got %v", got)
+	}
+	if got := testutil.ToFloat64(q.enqueued); got != 1 {
+		t.Errorf("Expected 1 enqueued item, got %v", got)
+	}
+	if got := sampleCount(t, m, "nexen_service_queue_wait_seconds", "jobs"); got != 1 {
+		t.Errorf("Expected 1 wait observation, got %d", got)
+	}
+}
+
+// sampleCount returns the number of observations of the histogram name for
+// queue.
+func sampleCount(t *testing.T, m *metrics.Metrics, name, queue string) uint64 {
+	t.Helper()
+	families, err := m.Registry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, metric := range f.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "queue" && label.GetValue() == queue {
+					return metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nexen-io/nexen-metrics/internal"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Recorder is the recording API of Metrics, for libraries that accept an
+// optional recorder instead of depending on the concrete type. Pass Noop() when
+// nothing should be recorded.
+type Recorder interface {
+	Instrument(next http.Handler) http.Handler
+	InstrumentFunc(next http.HandlerFunc) http.HandlerFunc
+	RecordEvent(event string)
+	SetGauge(name string, value float64)
+	IncrementGauge(name string)
+	DecrementGauge(name string)
+	AddGauge(name string, delta float64)
+	ObserveDuration(name string, d time.Duration)
+	Time(name string, fn func() error) error
+	Register(c prometheus.Collector) error
+	RegisterCounter(name, help string, labels []string) (*prometheus.CounterVec, error)
+	RegisterHistogram(name, help string, buckets []float64, labels []string) (*prometheus.HistogramVec, error)
+	RegisterSummary(name, help string, objectives map[float64]float64, labels []string) (*prometheus.SummaryVec, error)
+	RegisterGauge(name, help string, labels []string) (*prometheus.GaugeVec, error)
+}
+
+var _ Recorder = (*Metrics)(nil)
+
+// Noop returns a Recorder that records nothing, for tests and command-line
+// tools. Instrument returns the handler unchanged, and the Register* methods
+// return working collectors that are not registered anywhere, with the service
+// label appended like those of Metrics. They default histogram buckets and
+// reject invalid metrics, such as a duplicate service label, like Metrics does
+// without WithLabelSanitizer, returning the same errors.
+func Noop() Recorder {
+	return noopRecorder{}
+}
+
+// noopRecorder is the Recorder returned by Noop.
+type noopRecorder struct{}
+
+// Instrument returns next unchanged.
+func (noopRecorder) Instrument(next http.Handler) http.Handler {
+	return next
+}
+
+// InstrumentFunc returns next unchanged.
+func (noopRecorder) InstrumentFunc(next http.HandlerFunc) http.HandlerFunc {
+	return next
+}
+
+// RecordEvent does nothing.
+func (noopRecorder) RecordEvent(string) {}
+
+// SetGauge does nothing.
+func (noopRecorder) SetGauge(string, float64) {}
+
+// IncrementGauge does nothing.
+func (noopRecorder) IncrementGauge(string) {}
+
+// DecrementGauge does nothing.
+func (noopRecorder) DecrementGauge(string) {}
+
+// AddGauge does nothing.
+func (noopRecorder) AddGauge(string, float64) {}
+
+// ObserveDuration does nothing.
+func (noopRecorder) ObserveDuration(string, time.Duration) {}
+
+// Time runs fn and returns its error without timing it.
+func (noopRecorder) Time(_ string, fn func() error) error {
+	return fn()
+}
+
+// Register checks c without registering it.
+func (noopRecorder) Register(c prometheus.Collector) error {
+	return prometheus.NewRegistry().Register(c)
+}
+
+// RegisterCounter returns an unregistered counter vector.
+func (noopRecorder) RegisterCounter(name, help string, labels []string) (*prometheus.CounterVec, error) {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      name,
+		Help:      help,
+	}, append(labels, "service"))
+	if err := prometheus.NewRegistry().Register(counter); err != nil {
+		return nil, fmt.Errorf("failed to register counter %s: %w", name, err)
+	}
+	return counter, nil
+}
+
+// RegisterHistogram returns an unregistered histogram vector, with the
+// default buckets of Metrics if buckets is nil.
+func (noopRecorder) RegisterHistogram(name, help string, buckets []float64, labels []string) (*prometheus.HistogramVec, error) {
+	if buckets == nil {
+		buckets = internal.DefaultHTTPBuckets()
+	}
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      name,
+		Help:      help,
+		Buckets:   buckets,
+	}, append(labels, "service"))
+	if err := prometheus.NewRegistry().Register(histogram); err != nil {
+		return nil, fmt.Errorf("failed to register histogram %s: %w", name, err)
+	}
+	return histogram, nil
+}
+
+// RegisterSummary returns an unregistered summary vector.
+func (noopRecorder) RegisterSummary(name, help string, objectives map[float64]float64, labels []string) (*prometheus.SummaryVec, error) {
+	summary := prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace:  namespace,
+		Subsystem:  subsystem,
+		Name:       name,
+		Help:       help,
+		Objectives: objectives,
+	}, append(labels, "service"))
+	if err := prometheus.NewRegistry().Register(summary); err != nil {
+		return nil, fmt.Errorf("failed to register summary %s: %w", name, err)
+	}
+	return summary, nil
+}
+
+// RegisterGauge returns an unregistered gauge vector.
+func (noopRecorder) RegisterGauge(name, help string, labels []string) (*prometheus.GaugeVec, error) {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      name,
+		Help:      help,
+	}, append(labels, "service"))
+	if err := prometheus.NewRegistry().Register(gauge); err != nil {
+		return nil, fmt.Errorf("failed to register gauge %s: %w", name, err)
+	}
+	return gauge, nil
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newOrderHandler is a library constructor accepting an optional recorder.
+func newOrderHandler(rec Recorder) (http.Handler, error) {
+	placed, err := rec.RegisterCounter("orders_placed_total", "Orders placed", []string{"channel"})
+	if err != nil {
+		return nil, err
+	}
+	return rec.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		placed.WithLabelValues("web", "orders").Inc()
+		rec.RecordEvent("order_placed")
+	})), nil
+}
+
+func TestNoop(t *testing.T) {
+	handler, err := newOrderHandler(Noop())
+	if err != nil {
+		t.Fatalf("Expected the noop recorder to register, got %v", err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/orders", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the handler to be served, got %d", w.Code)
+	}
+
+	rec := Noop()
+	rec.SetGauge("depth", 1)
+	if _, err := rec.RegisterHistogram("latency_seconds", "Latency", nil, nil); err != nil {
+		t.Errorf("Expected default buckets to be accepted, got %v", err)
+	}
+	failure := errors.New("failed")
+	if err := rec.Time("job", func() error { return failure }); !errors.Is(err, failure) {
+		t.Errorf("Expected Time to run fn, got %v", err)
+	}
+}
+
+func TestMetricsRecorder(t *testing.T) {
+	metrics := New(WithServiceName("orders"))
+	handler, err := newOrderHandler(metrics)
+	if err != nil {
+		t.Fatalf("newOrderHandler: %v", err)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/orders", nil))
+	if got, err := testutil.GatherAndCount(metrics.gatherer, "nexen_service_orders_placed_total"); err != nil || got != 1 {
+		t.Errorf("Expected the counter to be exposed, got %d series (%v)", got, err)
+	}
+}
+
+func TestNoopMatchesMetricsRegistration(t *testing.T) {
+	noop, metrics := Noop(), New(WithServiceName("orders"))
+
+	_, noopErr := noop.RegisterHistogram("latency_seconds", "Latency", nil, []string{"service"})
+	_, metricsErr := metrics.RegisterHistogram("latency_seconds", "Latency", nil, []string{"service"})
+	if noopErr == nil || metricsErr == nil || noopErr.Error() != metricsErr.Error() {
+		t.Fatalf("Expected both recorders to reject a duplicate service label alike, got %v and %v", noopErr, metricsErr)
+	}
+	if _, err := noop.RegisterCounter("orders_total", "Orders", []string{"__reserved"}); err == nil {
+		t.Error("Expected the noop recorder to reject a reserved label")
+	}
+
+	// Nil buckets default to the buckets of Metrics
+	noopHist, err := noop.RegisterHistogram("latency_seconds", "Latency", nil, nil)
+	if err != nil {
+		t.Fatalf("Expected default buckets to be accepted, got %v", err)
+	}
+	metricsHist, err := metrics.RegisterHistogram("latency_seconds", "Latency", nil, nil)
+	if err != nil {
+		t.Fatalf("RegisterHistogram: %v", err)
+	}
+	buckets := func(vec *prometheus.HistogramVec) int {
+		var out dto.Metric
+		if err := vec.WithLabelValues("orders").(prometheus.Metric).Write(&out); err != nil {
+			t.Fatalf("Failed to write histogram: %v", err)
+		}
+		return len(out.GetHistogram().GetBucket())
+	}
+	if got, want := buckets(noopHist), buckets(metricsHist); got != want {
+		t.Errorf("Expected %d default buckets, got %d", want, got)
+	}
+}
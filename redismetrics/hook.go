@@ -0,0 +1,115 @@
+// Package redismetrics instruments go-redis clients: the hook returned by
+// NewHook records command latencies, errors and pipeline sizes using the same
+// nexen_service namespace and service label as the HTTP metrics.
+package redismetrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/nexen-io/nexen-metrics/internal"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+// Command label values of operations that are not single commands.
+const (
+	commandDial     = "dial"
+	commandPipeline = "pipeline"
+)
+
+// Hook is a redis.Hook recording the commands processed by a client.
+type Hook struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	pipeline *prometheus.HistogramVec
+	service  string
+}
+
+var _ redis.Hook = (*Hook)(nil)
+
+// NewHook returns a hook recording command latencies in
+// nexen_service_redis_command_duration_seconds and failed commands in
+// nexen_service_redis_errors_total, both labeled by command name, and the
+// number of commands per pipeline in nexen_service_redis_pipeline_size.
+// Pipelines are timed as a whole with the command label "pipeline", failed
+// connection attempts are counted with the command label "dial". redis.Nil
+// replies are not errors. Add the hook to a client with AddHook:
+//
+//	hook, err := redismetrics.NewHook(m)
+//	if err != nil {
+//		return err
+//	}
+//	rdb.AddHook(hook)
+//
+// Several clients may share the metrics by calling NewHook once per client.
+func NewHook(m *metrics.Metrics) (*Hook, error) {
+	duration, err := m.GetOrRegisterHistogram("redis_command_duration_seconds",
+		"Histogram of Redis command latencies", nil, []string{"command"})
+	if err != nil {
+		return nil, err
+	}
+	errs, err := m.GetOrRegisterCounter("redis_errors_total",
+		"Total number of failed Redis commands", []string{"command"})
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err := m.GetOrRegisterHistogram("redis_pipeline_size",
+		"Histogram of the number of commands per Redis pipeline",
+		internal.DefaultBatchSizeBuckets(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Hook{duration: duration, errors: errs, pipeline: pipeline, service: m.ServiceName()}, nil
+}
+
+// DialHook counts failed connection attempts.
+func (h *Hook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			h.errors.WithLabelValues(commandDial, h.service).Inc()
+		}
+		return conn, err
+	}
+}
+
+// ProcessHook records the latency and errors of single commands.
+func (h *Hook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.duration.WithLabelValues(cmd.Name(), h.service).Observe(time.Since(start).Seconds())
+		if isError(err) {
+			h.errors.WithLabelValues(cmd.Name(), h.service).Inc()
+		}
+		return err
+	}
+}
+
+// ProcessPipelineHook records the latency and size of pipelines, and counts
+// the failed commands in them.
+func (h *Hook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		h.duration.WithLabelValues(commandPipeline, h.service).Observe(time.Since(start).Seconds())
+		h.pipeline.WithLabelValues(h.service).Observe(float64(len(cmds)))
+		for _, cmd := range cmds {
+			if isError(cmd.Err()) {
+				h.errors.WithLabelValues(cmd.Name(), h.service).Inc()
+			}
+		}
+		return err
+	}
+}
+
+// isError reports whether err is a failure. redis.Nil only signals a missing
+// key.
+func isError(err error) bool {
+	return err != nil && !errors.Is(err, redis.Nil)
+}
@@ -0,0 +1,83 @@
+package redismetrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestHook(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("test"))
+	hook, err := NewHook(m)
+	if err != nil {
+		t.Fatalf("NewHook: %v", err)
+	}
+	ctx := context.Background()
+
+	process := hook.ProcessHook(func(_ context.Context, cmd redis.Cmder) error {
+		if cmd.Name() == "incr" {
+			cmd.SetErr(errors.New("WRONGTYPE"))
+		} else {
+			cmd.SetErr(redis.Nil)
+		}
+		return cmd.Err()
+	})
+	_ = process(ctx, redis.NewStringCmd(ctx, "get", "missing"))
+	_ = process(ctx, redis.NewIntCmd(ctx, "incr", "key"))
+
+	pipeline := hook.ProcessPipelineHook(func(_ context.Context, cmds []redis.Cmder) error {
+		cmds[1].SetErr(errors.New("ERR"))
+		return cmds[1].Err()
+	})
+	_ = pipeline(ctx, []redis.Cmder{
+		redis.NewStatusCmd(ctx, "set", "k", "v"),
+		redis.NewIntCmd(ctx, "incr", "k"),
+		redis.NewStringCmd(ctx, "get", "k"),
+	})
+
+	dial := hook.DialHook(func(context.Context, string, string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	})
+	_, _ = dial(ctx, "tcp", "localhost:6379")
+
+	if got := testutil.CollectAndCount(hook.duration); got != 3 {
+		t.Errorf("duration series = %d, want 3 (get, incr, pipeline)", got)
+	}
+	if got := testutil.CollectAndCount(hook.pipeline); got != 1 {
+		t.Errorf("pipeline size series = %d, want 1", got)
+	}
+
+	expected := `
+# HELP nexen_service_redis_errors_total Total number of failed Redis commands
+# TYPE nexen_service_redis_errors_total counter
+nexen_service_redis_errors_total{command="dial",service="test"} 1
+nexen_service_redis_errors_total{command="incr",service="test"} 2
+`
+	if err := testutil.GatherAndCompare(m.Registry(), strings.NewReader(expected), "nexen_service_redis_errors_total"); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.ToFloat64(hook.errors.WithLabelValues("get", "test")); got != 0 {
+		t.Errorf("redis.Nil counted as error: %v", got)
+	}
+}
+
+func TestNewHookShared(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("test"))
+	first, err := NewHook(m)
+	if err != nil {
+		t.Fatalf("NewHook: %v", err)
+	}
+	second, err := NewHook(m)
+	if err != nil {
+		t.Fatalf("second NewHook: %v", err)
+	}
+	if first.duration != second.duration || first.errors != second.errors || first.pipeline != second.pipeline {
+		t.Error("second hook does not share the registered metrics")
+	}
+}
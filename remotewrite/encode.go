@@ -0,0 +1,187 @@
+package remotewrite
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// label is a label of a time series.
+type label struct {
+	name, value string
+}
+
+// series is a time series with a single sample, as in a prompb.TimeSeries.
+type series struct {
+	labels    []label
+	value     float64
+	timestamp int64
+}
+
+// metadata describes a metric family, as in a prompb.MetricMetadata.
+type metadata struct {
+	kind int
+	name string
+	help string
+}
+
+// Metric types of prompb.MetricMetadata.
+const (
+	typeUnknown   = 0
+	typeCounter   = 1
+	typeGauge     = 2
+	typeHistogram = 3
+	typeSummary   = 5
+)
+
+// convert flattens gathered families into series stamped with now, in
+// milliseconds, unless a metric carries its own timestamp. Histograms and
+// summaries become their _bucket or quantile, _sum and _count series.
+func convert(families []*dto.MetricFamily, external []label, now int64) ([]series, []metadata) {
+	var out []series
+	var meta []metadata
+	for _, mf := range families {
+		name := mf.GetName()
+		kind := typeUnknown
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			kind = typeCounter
+		case dto.MetricType_GAUGE:
+			kind = typeGauge
+		case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+			kind = typeHistogram
+		case dto.MetricType_SUMMARY:
+			kind = typeSummary
+		}
+		meta = append(meta, metadata{kind: kind, name: name, help: mf.GetHelp()})
+
+		for _, m := range mf.GetMetric() {
+			ts := now
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+			add := func(name string, value float64, extra ...label) {
+				labels := make([]label, 0, len(m.GetLabel())+len(external)+len(extra)+1)
+				labels = append(labels, label{"__name__", name})
+				for _, l := range m.GetLabel() {
+					labels = append(labels, label{l.GetName(), l.GetValue()})
+				}
+				labels = append(labels, extra...)
+				out = append(out, series{labels: withExternal(labels, external), value: value, timestamp: ts})
+			}
+
+			switch {
+			case m.Counter != nil:
+				add(name, m.Counter.GetValue())
+			case m.Gauge != nil:
+				add(name, m.Gauge.GetValue())
+			case m.Untyped != nil:
+				add(name, m.Untyped.GetValue())
+			case m.Histogram != nil:
+				h := m.Histogram
+				for _, b := range h.GetBucket() {
+					if !math.IsInf(b.GetUpperBound(), +1) {
+						add(name+"_bucket", float64(b.GetCumulativeCount()), label{"le", formatFloat(b.GetUpperBound())})
+					}
+				}
+				add(name+"_bucket", float64(h.GetSampleCount()), label{"le", "+Inf"})
+				add(name+"_sum", h.GetSampleSum())
+				add(name+"_count", float64(h.GetSampleCount()))
+			case m.Summary != nil:
+				s := m.Summary
+				for _, q := range s.GetQuantile() {
+					add(name, q.GetValue(), label{"quantile", formatFloat(q.GetQuantile())})
+				}
+				add(name+"_sum", s.GetSampleSum())
+				add(name+"_count", float64(s.GetSampleCount()))
+			}
+		}
+	}
+	return out, meta
+}
+
+// withExternal adds the external labels missing from labels and sorts them by
+// name, as remote write requires.
+func withExternal(labels, external []label) []label {
+	for _, e := range external {
+		found := false
+		for _, l := range labels {
+			if l.name == e.name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			labels = append(labels, e)
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].name < labels[j].name
+	})
+	return labels
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// marshal encodes a prompb.WriteRequest:
+//
+//	message WriteRequest {
+//	  repeated TimeSeries timeseries = 1;
+//	  repeated MetricMetadata metadata = 3;
+//	}
+//	message TimeSeries {
+//	  repeated Label labels = 1;
+//	  repeated Sample samples = 2;
+//	}
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+//	message MetricMetadata {
+//	  MetricType type = 1;
+//	  string metric_family_name = 2;
+//	  string help = 4;
+//	}
+func marshal(batch []series, meta []metadata) []byte {
+	var buf, ts, msg []byte
+	for _, s := range batch {
+		ts = ts[:0]
+		for _, l := range s.labels {
+			msg = msg[:0]
+			msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+			msg = protowire.AppendString(msg, l.name)
+			msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+			msg = protowire.AppendString(msg, l.value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, msg)
+		}
+		msg = msg[:0]
+		msg = protowire.AppendTag(msg, 1, protowire.Fixed64Type)
+		msg = protowire.AppendFixed64(msg, math.Float64bits(s.value))
+		msg = protowire.AppendTag(msg, 2, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, uint64(s.timestamp))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, msg)
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, ts)
+	}
+	for _, md := range meta {
+		msg = msg[:0]
+		msg = protowire.AppendTag(msg, 1, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, uint64(md.kind))
+		msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+		msg = protowire.AppendString(msg, md.name)
+		msg = protowire.AppendTag(msg, 4, protowire.BytesType)
+		msg = protowire.AppendString(msg, md.help)
+		buf = protowire.AppendTag(buf, 3, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, msg)
+	}
+	return buf
+}
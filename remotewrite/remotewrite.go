@@ -0,0 +1,366 @@
+// Package remotewrite pushes the metrics of a Metrics instance to a Prometheus
+// remote-write endpoint, such as Prometheus started with
+// --web.enable-remote-write-receiver, Mimir, Thanos Receive or VictoriaMetrics,
+// for environments without a scraper.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Defaults of the options of New.
+const (
+	DefaultInterval   = 15 * time.Second
+	DefaultTimeout    = 10 * time.Second
+	DefaultMaxRetries = 3
+	DefaultMaxPending = 10
+)
+
+// Option configures an Exporter.
+type Option func(*Exporter)
+
+// WithInterval sets how often metrics are gathered and pushed.
+func WithInterval(interval time.Duration) Option {
+	return func(e *Exporter) {
+		e.interval = interval
+	}
+}
+
+// WithTimeout sets the timeout of each request, and the time Run waits for
+// pending batches once its context is cancelled.
+func WithTimeout(timeout time.Duration) Option {
+	return func(e *Exporter) {
+		e.timeout = timeout
+	}
+}
+
+// WithMaxRetries sets how often a request failing with a network error, a
+// 5xx status or 429 Too Many Requests is retried, with exponential backoff.
+// Requests failing with other statuses are not retried.
+func WithMaxRetries(n int) Option {
+	return func(e *Exporter) {
+		e.maxRetries = n
+	}
+}
+
+// WithMaxPending sets how many gathered batches may wait while the endpoint
+// is slow or unavailable. Once exceeded, the oldest batch is dropped.
+func WithMaxPending(n int) Option {
+	return func(e *Exporter) {
+		e.maxPending = n
+	}
+}
+
+// WithBasicAuth authenticates requests with HTTP basic auth.
+func WithBasicAuth(user, password string) Option {
+	return func(e *Exporter) {
+		e.headers.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+password)))
+	}
+}
+
+// WithBearerToken authenticates requests with a bearer token.
+func WithBearerToken(token string) Option {
+	return func(e *Exporter) {
+		e.headers.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// WithHeader adds a header to every request, such as X-Scope-OrgID for
+// multi-tenant Mimir.
+func WithHeader(name, value string) Option {
+	return func(e *Exporter) {
+		e.headers.Add(name, value)
+	}
+}
+
+// WithHTTPClient sets the client requests are sent with, e.g. for TLS client
+// certificates. It defaults to http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(e *Exporter) {
+		e.client = client
+	}
+}
+
+// WithExternalLabels adds labels to every series, such as the job and
+// instance labels a scraper would add. Labels of a series take precedence.
+func WithExternalLabels(labels map[string]string) Option {
+	return func(e *Exporter) {
+		for name, value := range labels {
+			e.external = append(e.external, label{name, value})
+		}
+		sort.Slice(e.external, func(i, j int) bool {
+			return e.external[i].name < e.external[j].name
+		})
+	}
+}
+
+// Exporter pushes the metrics exposed by the Handler of a Metrics instance to
+// a remote-write endpoint.
+type Exporter struct {
+	url        string
+	gatherer   prometheus.Gatherer
+	client     *http.Client
+	headers    http.Header
+	external   []label
+	interval   time.Duration
+	timeout    time.Duration
+	maxRetries int
+	maxPending int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	sent        prometheus.Counter
+	failed      prometheus.Counter
+	dropped     prometheus.Counter
+	retries     prometheus.Counter
+	pending     prometheus.Gauge
+	duration    prometheus.Observer
+	lastSuccess prometheus.Gauge
+}
+
+// batch holds the series gathered at one point in time.
+type batch struct {
+	series []series
+	meta   []metadata
+}
+
+// New returns an exporter pushing to the remote-write endpoint at rawURL.
+// It exports metrics about itself, labeled by the host of the endpoint:
+//
+//   - nexen_service_remote_write_samples_total{remote}: samples sent
+//   - nexen_service_remote_write_failed_samples_total{remote}: samples not
+//     sent after all retries
+//   - nexen_service_remote_write_dropped_samples_total{remote}: samples
+//     dropped because too many batches were pending
+//   - nexen_service_remote_write_retries_total{remote}: retried requests
+//   - nexen_service_remote_write_pending_samples{remote}: samples waiting to
+//     be sent
+//   - nexen_service_remote_write_request_duration_seconds{remote}: request
+//     latencies
+//   - nexen_service_remote_write_last_success_timestamp_seconds{remote}: the
+//     time of the last successful request
+//
+// Call Run to start pushing.
+func New(m *metrics.Metrics, rawURL string, opts ...Option) (*Exporter, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid remote write URL %q", rawURL)
+	}
+	e := &Exporter{
+		url:        rawURL,
+		gatherer:   m.Gatherer(),
+		client:     http.DefaultClient,
+		headers:    http.Header{},
+		interval:   DefaultInterval,
+		timeout:    DefaultTimeout,
+		maxRetries: DefaultMaxRetries,
+		maxPending: DefaultMaxPending,
+		minBackoff: 500 * time.Millisecond,
+		maxBackoff: 30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	labels := []string{"remote"}
+	counter := func(name, help string) (prometheus.Counter, error) {
+		vec, err := m.GetOrRegisterCounter(name, help, labels)
+		if err != nil {
+			return nil, err
+		}
+		return vec.WithLabelValues(u.Host, m.ServiceName()), nil
+	}
+	gauge := func(name, help string) (prometheus.Gauge, error) {
+		vec, err := m.GetOrRegisterGauge(name, help, labels)
+		if err != nil {
+			return nil, err
+		}
+		return vec.WithLabelValues(u.Host, m.ServiceName()), nil
+	}
+
+	var errs []error
+	register := func(err error) {
+		errs = append(errs, err)
+	}
+	e.sent, err = counter("remote_write_samples_total", "Total number of samples sent to the remote-write endpoint")
+	register(err)
+	e.failed, err = counter("remote_write_failed_samples_total", "Total number of samples not sent to the remote-write endpoint after all retries")
+	register(err)
+	e.dropped, err = counter("remote_write_dropped_samples_total", "Total number of samples dropped because too many batches were pending")
+	register(err)
+	e.retries, err = counter("remote_write_retries_total", "Total number of retried remote-write requests")
+	register(err)
+	e.pending, err = gauge("remote_write_pending_samples", "Number of samples waiting to be sent to the remote-write endpoint")
+	register(err)
+	e.lastSuccess, err = gauge("remote_write_last_success_timestamp_seconds", "Time of the last successful remote-write request")
+	register(err)
+	duration, err := m.GetOrRegisterHistogram("remote_write_request_duration_seconds", "Histogram of remote-write request latencies", nil, labels)
+	register(err)
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	e.duration = duration.WithLabelValues(u.Host, m.ServiceName())
+	return e, nil
+}
+
+// Run pushes the metrics every interval until ctx is cancelled, then pushes
+// them once more. Requests are sent in the background, so a slow endpoint does
+// not delay gathering. Run returns once the pending batches are sent, or after
+// the timeout, with the error of the final push.
+func (e *Exporter) Run(ctx context.Context) error {
+	queue := make(chan batch, e.maxPending)
+	sendCtx, cancelSend := context.WithCancel(context.Background())
+	defer cancelSend()
+
+	var final error
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for b := range queue {
+			e.pending.Sub(float64(len(b.series)))
+			final = e.send(sendCtx, b)
+		}
+	}()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.enqueue(queue, e.collect())
+		case <-ctx.Done():
+			e.enqueue(queue, e.collect())
+			close(queue)
+			timer := time.AfterFunc(e.timeout, cancelSend)
+			<-drained
+			timer.Stop()
+			return final
+		}
+	}
+}
+
+// Push gathers and pushes the metrics once, retrying within ctx. It can be
+// used whether or not Run is running, for example by batch jobs.
+func (e *Exporter) Push(ctx context.Context) error {
+	return e.send(ctx, e.collect())
+}
+
+// collect gathers the current metrics. Families gathered despite an error are
+// still pushed.
+func (e *Exporter) collect() batch {
+	families, _ := e.gatherer.Gather()
+	s, meta := convert(families, e.external, time.Now().UnixMilli())
+	return batch{series: s, meta: meta}
+}
+
+// enqueue adds b to queue, dropping the oldest batches while it is full.
+func (e *Exporter) enqueue(queue chan batch, b batch) {
+	e.pending.Add(float64(len(b.series)))
+	for {
+		select {
+		case queue <- b:
+			return
+		default:
+		}
+		select {
+		case old := <-queue:
+			e.pending.Sub(float64(len(old.series)))
+			e.dropped.Add(float64(len(old.series)))
+		default:
+		}
+	}
+}
+
+// send pushes b, retrying failures that may be transient.
+func (e *Exporter) send(ctx context.Context, b batch) error {
+	body := snappy.Encode(nil, marshal(b.series, b.meta))
+	samples := float64(len(b.series))
+	backoff := e.minBackoff
+	for attempt := 0; ; attempt++ {
+		err := e.post(ctx, body)
+		if err == nil {
+			e.sent.Add(samples)
+			e.lastSuccess.SetToCurrentTime()
+			return nil
+		}
+		var retryable *retryableError
+		if !errors.As(err, &retryable) || attempt >= e.maxRetries {
+			e.failed.Add(samples)
+			return err
+		}
+
+		e.retries.Inc()
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			e.failed.Add(samples)
+			return err
+		}
+		backoff = min(2*backoff, e.maxBackoff)
+	}
+}
+
+// post sends a single remote-write request.
+func (e *Exporter) post(ctx context.Context, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create remote write request: %w", err)
+	}
+	for name, values := range e.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("User-Agent", "nexen-metrics")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	start := time.Now()
+	resp, err := e.client.Do(req)
+	e.duration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		return &retryableError{fmt.Errorf("failed to send remote write request: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	err = fmt.Errorf("remote write to %s failed with status %s: %s", e.url, resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return &retryableError{err}
+	}
+	return err
+}
+
+// retryableError marks errors of requests worth retrying.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
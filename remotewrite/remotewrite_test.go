@@ -0,0 +1,235 @@
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decode returns the series of a snappy-compressed WriteRequest, formatted as
+// `name{label="value",...} value`.
+func decode(t *testing.T, body []byte) []string {
+	t.Helper()
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("Failed to decompress request: %v", err)
+	}
+	fields := func(b []byte, fn func(num protowire.Number, v []byte, n uint64)) {
+		for len(b) > 0 {
+			num, typ, l := protowire.ConsumeTag(b)
+			b = b[l:]
+			switch typ {
+			case protowire.BytesType:
+				v, l := protowire.ConsumeBytes(b)
+				fn(num, v, 0)
+				b = b[l:]
+			case protowire.Fixed64Type:
+				v, l := protowire.ConsumeFixed64(b)
+				fn(num, nil, v)
+				b = b[l:]
+			case protowire.VarintType:
+				v, l := protowire.ConsumeVarint(b)
+				fn(num, nil, v)
+				b = b[l:]
+			default:
+				t.Fatalf("Unexpected wire type %v", typ)
+			}
+		}
+	}
+
+	var out []string
+	fields(data, func(num protowire.Number, ts []byte, _ uint64) {
+		if num != 1 {
+			return
+		}
+		var name string
+		var labels []string
+		var value float64
+		fields(ts, func(num protowire.Number, msg []byte, _ uint64) {
+			var k, v string
+			fields(msg, func(field protowire.Number, b []byte, n uint64) {
+				switch {
+				case num == 1 && field == 1:
+					k = string(b)
+				case num == 1 && field == 2:
+					v = string(b)
+				case num == 2 && field == 1:
+					value = math.Float64frombits(n)
+				}
+			})
+			switch {
+			case num == 1 && k == "__name__":
+				name = v
+			case num == 1:
+				labels = append(labels, k+`="`+v+`"`)
+			}
+		})
+		out = append(out, name+"{"+strings.Join(labels, ",")+"} "+formatFloat(value))
+	})
+	return out
+}
+
+func TestPush(t *testing.T) {
+	var series []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Encoding"); got != "snappy" {
+			t.Errorf("Expected snappy encoding, got %q", got)
+		}
+		if got := r.Header.Get("X-Prometheus-Remote-Write-Version"); got != "0.1.0" {
+			t.Errorf("Expected remote write version 0.1.0, got %q", got)
+		}
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			t.Errorf("Expected basic auth, got %q %q", user, password)
+		}
+		if got := r.Header.Get("X-Scope-OrgID"); got != "tenant" {
+			t.Errorf("Expected the tenant header, got %q", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		series = decode(t, body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	m := metrics.New(metrics.WithServiceName("batch"))
+	jobs, err := m.RegisterCounter("jobs_total", "Jobs", []string{"kind"})
+	if err != nil {
+		t.Fatalf("RegisterCounter: %v", err)
+	}
+	jobs.WithLabelValues("import", "batch").Add(3)
+	latency, err := m.RegisterHistogram("job_seconds", "Job latency", []float64{1}, nil)
+	if err != nil {
+		t.Fatalf("RegisterHistogram: %v", err)
+	}
+	latency.WithLabelValues("batch").Observe(0.5)
+
+	e, err := New(m, server.URL,
+		WithBasicAuth("user", "secret"),
+		WithHeader("X-Scope-OrgID", "tenant"),
+		WithExternalLabels(map[string]string{"job": "importer"}),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := e.Push(context.Background()); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+
+	for _, expected := range []string{
+		`nexen_service_jobs_total{job="importer",kind="import",service="batch"} 3`,
+		`nexen_service_job_seconds_bucket{job="importer",le="1",service="batch"} 1`,
+		`nexen_service_job_seconds_bucket{job="importer",le="+Inf",service="batch"} 1`,
+		`nexen_service_job_seconds_sum{job="importer",service="batch"} 0.5`,
+		`nexen_service_job_seconds_count{job="importer",service="batch"} 1`,
+	} {
+		found := false
+		for _, s := range series {
+			found = found || s == expected
+		}
+		if !found {
+			t.Errorf("Expected series %s in %v", expected, series)
+		}
+	}
+	if got := testutil.ToFloat64(e.sent); got != float64(len(series)) {
+		t.Errorf("Expected %d samples sent, got %v", len(series), got)
+	}
+}
+
+func TestPushRetries(t *testing.T) {
+	var requests atomic.Int32
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	m := metrics.New(metrics.WithServiceName("batch"))
+	e, err := New(m, server.URL, WithBearerToken("token"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	e.minBackoff = time.Millisecond
+
+	if err := e.Push(context.Background()); err != nil {
+		t.Fatalf("Expected the push to succeed after retries: %v", err)
+	}
+	if got := testutil.ToFloat64(e.retries); got != 2 {
+		t.Errorf("Expected 2 retries, got %v", got)
+	}
+
+	requests.Store(0)
+	status = http.StatusBadRequest
+	if err := e.Push(context.Background()); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Expected the push to fail with 400, got %v", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("Expected client errors not to be retried, got %d requests", got)
+	}
+	if got := testutil.ToFloat64(e.failed); got == 0 {
+		t.Error("Expected the samples to be counted as failed")
+	}
+}
+
+func TestRunPushesOnShutdown(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	m := metrics.New(metrics.WithServiceName("batch"))
+	e, err := New(m, server.URL, WithInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := e.Run(ctx); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("Expected a final push, got %d requests", got)
+	}
+	if got := testutil.ToFloat64(e.pending); got != 0 {
+		t.Errorf("Expected no pending samples, got %v", got)
+	}
+}
+
+func TestEnqueueDropsOldest(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("batch"))
+	e, err := New(m, "http://localhost:9090/api/v1/write")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := New(m, "not a url"); err == nil {
+		t.Error("Expected an invalid URL to be rejected")
+	}
+
+	queue := make(chan batch, 1)
+	e.enqueue(queue, batch{series: make([]series, 2)})
+	e.enqueue(queue, batch{series: make([]series, 3)})
+	if got := testutil.ToFloat64(e.dropped); got != 2 {
+		t.Errorf("Expected the 2 samples of the oldest batch dropped, got %v", got)
+	}
+	if got := testutil.ToFloat64(e.pending); got != 3 {
+		t.Errorf("Expected 3 pending samples, got %v", got)
+	}
+	if got := len((<-queue).series); got != 3 {
+		t.Errorf("Expected the newest batch to be kept, got %d series", got)
+	}
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithIgnorePaths makes Instrument and StartRequest skip recording requests
+// whose URL path matches one of patterns, in the syntax of path.Match, such as
+// "/healthz" or "/debug/*". Use it for health checks, the metrics endpoint
+// itself and other requests that would only skew the HTTP metrics. Skipped
+// requests are counted in nexen_service_http_requests_skipped_total. It panics
+// on malformed patterns.
+func WithIgnorePaths(patterns ...string) Option {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			panic(fmt.Sprintf("metrics: invalid ignore path pattern %q: %v", pattern, err))
+		}
+	}
+	return WithRequestFilter(func(r *http.Request) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, r.URL.Path); ok {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithRequestFilter makes Instrument and StartRequest skip recording requests
+// for which skip returns true, for rules beyond paths such as probes
+// identified by their User-Agent. It may be given multiple times; a request is
+// skipped if any filter matches. Skipped requests are still served and
+// FromContext still works in their handlers, but they are neither counted nor
+// timed, only counted in nexen_service_http_requests_skipped_total.
+func WithRequestFilter(skip func(r *http.Request) bool) Option {
+	return func(m *Metrics) {
+		m.requestFilters = append(m.requestFilters, skip)
+	}
+}
+
+// registerRequestFilterMetrics registers the skipped request counter if
+// filters are configured.
+func (m *Metrics) registerRequestFilterMetrics() {
+	if len(m.requestFilters) == 0 {
+		return
+	}
+	m.httpSkipped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "http_requests_skipped_total",
+			Help:      "Total number of HTTP requests not recorded because of request filters",
+		},
+		[]string{"service"},
+	)
+	m.mustRegister(m.httpSkipped)
+}
+
+// skipRequest reports whether r matches a request filter, counting it if so.
+func (m *Metrics) skipRequest(r *http.Request, service string) bool {
+	for _, skip := range m.requestFilters {
+		if skip(r) {
+			m.httpSkipped.WithLabelValues(service).Inc()
+			return true
+		}
+	}
+	return false
+}
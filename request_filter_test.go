@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestIgnorePaths(t *testing.T) {
+	metrics := New(WithServiceName("test-service"),
+		WithIgnorePaths("/healthz", "/debug/*"),
+		WithRequestFilter(func(r *http.Request) bool {
+			return strings.HasPrefix(r.UserAgent(), "kube-probe/")
+		}),
+	)
+	var fromContext *Metrics
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fromContext = FromContext(r.Context())
+	}))
+
+	probe := httptest.NewRequest("GET", "/ready", nil)
+	probe.Header.Set("User-Agent", "kube-probe/1.30")
+	for _, r := range []*http.Request{
+		httptest.NewRequest("GET", "/healthz", nil),
+		httptest.NewRequest("GET", "/debug/vars", nil),
+		probe,
+		httptest.NewRequest("GET", "/debug/pprof/heap", nil),
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if fromContext != metrics {
+		t.Error("Expected FromContext to work for skipped requests")
+	}
+
+	// The observer used by the framework adapters skips the same requests
+	o := metrics.StartRequest(httptest.NewRequest("GET", "/healthz", nil))
+	o.Finish(Response{Route: "/healthz", Status: http.StatusOK})
+
+	if got := testutil.ToFloat64(metrics.httpSkipped.WithLabelValues("test-service")); got != 4 {
+		t.Errorf("Expected 4 skipped requests, got %v", got)
+	}
+	if got := testutil.CollectAndCount(metrics.httpRequests); got != 1 {
+		t.Errorf("Expected only /debug/pprof/heap to be recorded, got %d series", got)
+	}
+	if got := testutil.ToFloat64(metrics.httpRequests.WithLabelValues("GET", "/debug/pprof/heap", "test-service")); got != 1 {
+		t.Errorf("Expected paths beyond the pattern depth to be recorded, got %v", got)
+	}
+}
+
+func TestIgnorePathsInvalidPattern(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a malformed pattern to panic")
+		}
+	}()
+	WithIgnorePaths("/debug/[")
+}
@@ -0,0 +1,63 @@
+// Package resilience records the behavior of circuit breakers
+// (github.com/sony/gobreaker) and retrying HTTP clients
+// (github.com/hashicorp/go-retryablehttp) next to the RED metrics of a
+// service.
+package resilience
+
+import (
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sony/gobreaker"
+)
+
+// Breakers records the state of gobreaker circuit breakers.
+type Breakers struct {
+	changes *prometheus.CounterVec
+	open    *prometheus.GaugeVec
+	service string
+}
+
+// NewBreakers returns a recorder exporting
+// nexen_service_circuit_breaker_state_changes_total{breaker, from, to} and
+// nexen_service_circuit_breaker_open{breaker}, which is 1 while a breaker is
+// open and 0 otherwise.
+func NewBreakers(m *metrics.Metrics) (*Breakers, error) {
+	changes, err := m.GetOrRegisterCounter("circuit_breaker_state_changes_total",
+		"Total number of circuit breaker state changes", []string{"breaker", "from", "to"})
+	if err != nil {
+		return nil, err
+	}
+	open, err := m.GetOrRegisterGauge("circuit_breaker_open",
+		"Whether the circuit breaker is open (1) or not (0)", []string{"breaker"})
+	if err != nil {
+		return nil, err
+	}
+	return &Breakers{changes: changes, open: open, service: m.ServiceName()}, nil
+}
+
+// Settings returns st with an OnStateChange callback recording the state of
+// the breaker named st.Name, calling the callback already set in st, if any:
+//
+//	cb := gobreaker.NewCircuitBreaker(breakers.Settings(gobreaker.Settings{Name: "payments"}))
+func (b *Breakers) Settings(st gobreaker.Settings) gobreaker.Settings {
+	b.open.WithLabelValues(st.Name, b.service).Set(0)
+	next := st.OnStateChange
+	st.OnStateChange = func(name string, from, to gobreaker.State) {
+		b.OnStateChange(name, from, to)
+		if next != nil {
+			next(name, from, to)
+		}
+	}
+	return st
+}
+
+// OnStateChange records a state change of the breaker name. It has the
+// signature of gobreaker.Settings.OnStateChange.
+func (b *Breakers) OnStateChange(name string, from, to gobreaker.State) {
+	b.changes.WithLabelValues(name, from.String(), to.String(), b.service).Inc()
+	open := 0.0
+	if to == gobreaker.StateOpen {
+		open = 1
+	}
+	b.open.WithLabelValues(name, b.service).Set(open)
+}
@@ -0,0 +1,50 @@
+package resilience
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sony/gobreaker"
+)
+
+func TestBreakers(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("test"))
+	breakers, err := NewBreakers(m)
+	if err != nil {
+		t.Fatalf("NewBreakers: %v", err)
+	}
+
+	var chained []string
+	cb := gobreaker.NewCircuitBreaker(breakers.Settings(gobreaker.Settings{
+		Name:        "payments",
+		ReadyToTrip: func(c gobreaker.Counts) bool { return c.ConsecutiveFailures >= 1 },
+		OnStateChange: func(name string, from, to gobreaker.State) {
+			chained = append(chained, to.String())
+		},
+	}))
+	_, _ = cb.Execute(func() (interface{}, error) { return nil, errors.New("declined") })
+
+	if len(chained) != 1 || chained[0] != "open" {
+		t.Errorf("Expected the existing callback to see the change to open, got %v", chained)
+	}
+	expected := `
+# HELP nexen_service_circuit_breaker_open Whether the circuit breaker is open (1) or not (0)
+# TYPE nexen_service_circuit_breaker_open gauge
+nexen_service_circuit_breaker_open{breaker="payments",service="test"} 1
+# HELP nexen_service_circuit_breaker_state_changes_total Total number of circuit breaker state changes
+# TYPE nexen_service_circuit_breaker_state_changes_total counter
+nexen_service_circuit_breaker_state_changes_total{breaker="payments",from="closed",service="test",to="open"} 1
+`
+	if err := testutil.GatherAndCompare(m.Registry(), strings.NewReader(expected),
+		"nexen_service_circuit_breaker_open", "nexen_service_circuit_breaker_state_changes_total"); err != nil {
+		t.Error(err)
+	}
+
+	breakers.OnStateChange("payments", gobreaker.StateOpen, gobreaker.StateHalfOpen)
+	if got := testutil.ToFloat64(breakers.open.WithLabelValues("payments", "test")); got != 0 {
+		t.Errorf("Expected half-open breaker not to count as open, got %v", got)
+	}
+}
@@ -0,0 +1,73 @@
+package resilience
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hashicorp/go-retryablehttp"
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// attemptBuckets count attempts per request.
+var attemptBuckets = []float64{1, 2, 3, 4, 5, 6, 8, 10}
+
+// attemptsKey is the context key of the attempt count of a request sent
+// with Retries.Do.
+type attemptsKey struct{}
+
+// Retries records the retries of go-retryablehttp clients.
+type Retries struct {
+	retries  *prometheus.CounterVec
+	attempts *prometheus.HistogramVec
+	service  string
+}
+
+// NewRetries returns a recorder exporting nexen_service_http_retries_total
+// {client}, the number of retried attempts, and
+// nexen_service_http_retry_attempts{client}, a histogram of the attempts
+// requests sent with Do took.
+func NewRetries(m *metrics.Metrics) (*Retries, error) {
+	retries, err := m.GetOrRegisterCounter("http_retries_total",
+		"Total number of retried HTTP request attempts", []string{"client"})
+	if err != nil {
+		return nil, err
+	}
+	attempts, err := m.GetOrRegisterHistogram("http_retry_attempts",
+		"Histogram of the number of attempts per HTTP request, including the first", attemptBuckets, []string{"client"})
+	if err != nil {
+		return nil, err
+	}
+	return &Retries{retries: retries, attempts: attempts, service: m.ServiceName()}, nil
+}
+
+// Instrument counts the retries of c as the client name, calling the
+// RequestLogHook already set on c, if any.
+func (r *Retries) Instrument(c *retryablehttp.Client, name string) {
+	retries := r.retries.WithLabelValues(name, r.service)
+	next := c.RequestLogHook
+	c.RequestLogHook = func(logger retryablehttp.Logger, req *http.Request, retry int) {
+		if retry > 0 {
+			retries.Inc()
+		}
+		if n, ok := req.Context().Value(attemptsKey{}).(*int); ok {
+			*n = retry + 1
+		}
+		if next != nil {
+			next(logger, req, retry)
+		}
+	}
+}
+
+// Do sends req with c, instrumented as the client name with Instrument, and
+// records the number of attempts it took. Requests sent with c.Do directly are
+// counted in the retries but not in the attempts histogram.
+func (r *Retries) Do(c *retryablehttp.Client, name string, req *retryablehttp.Request) (*http.Response, error) {
+	attempts := 0
+	req = req.WithContext(context.WithValue(req.Context(), attemptsKey{}, &attempts))
+	resp, err := c.Do(req)
+	if attempts > 0 {
+		r.attempts.WithLabelValues(name, r.service).Observe(float64(attempts))
+	}
+	return resp, err
+}
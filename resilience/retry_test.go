@@ -0,0 +1,67 @@
+package resilience
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	m := metrics.New(metrics.WithServiceName("test"))
+	retries, err := NewRetries(m)
+	if err != nil {
+		t.Fatalf("NewRetries: %v", err)
+	}
+	client := retryablehttp.NewClient()
+	client.Logger = nil
+	client.RetryWaitMin, client.RetryWaitMax = time.Millisecond, time.Millisecond
+	retries.Instrument(client, "inventory")
+
+	req, err := retryablehttp.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := retries.Do(client, "inventory", req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+
+	// A request that is not sent with Do only counts its retries
+	calls.Store(1)
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+
+	if got := testutil.ToFloat64(retries.retries.WithLabelValues("inventory", "test")); got != 3 {
+		t.Errorf("Expected 3 retries, got %v", got)
+	}
+	if got := testutil.CollectAndCount(retries.attempts); got != 1 {
+		t.Fatalf("Expected 1 attempts series, got %d", got)
+	}
+	families, _ := m.Registry().Gather()
+	for _, f := range families {
+		if f.GetName() == "nexen_service_http_retry_attempts" {
+			h := f.GetMetric()[0].GetHistogram()
+			if h.GetSampleCount() != 1 || h.GetSampleSum() != 3 {
+				t.Errorf("Expected one request with 3 attempts, got %d requests with %v attempts", h.GetSampleCount(), h.GetSampleSum())
+			}
+		}
+	}
+}
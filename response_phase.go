@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithResponsePhaseMetrics makes Instrument split the duration of each request
+// at its first response byte, showing whether latency is spent computing the
+// response or streaming it:
+//
+//   - nexen_service_http_time_to_first_byte_seconds: from the start of the
+//     request until the status line is written, which includes the time spent
+//     in middleware (see MarkHandlerStart)
+//   - nexen_service_http_response_write_seconds: from the first byte until the
+//     handler returns, the time spent writing and streaming the body
+//
+// Both are labeled by method and path. Responses written after the handler
+// returns, because it wrote nothing, are recorded with their full duration as
+// time to first byte.
+func WithResponsePhaseMetrics() Option {
+	return func(m *Metrics) {
+		m.responsePhases = true
+	}
+}
+
+// registerResponsePhaseMetrics registers the response phase histograms if
+// enabled.
+func (m *Metrics) registerResponsePhaseMetrics() {
+	if !m.responsePhases {
+		return
+	}
+	m.httpFirstByte = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "http_time_to_first_byte_seconds",
+			Help:      "Histogram of time until the first byte of HTTP responses",
+			Buckets:   m.histogramBuckets,
+		},
+		[]string{"method", "path", "service"},
+	)
+	m.httpWrite = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "http_response_write_seconds",
+			Help:      "Histogram of time spent writing HTTP response bodies after the first byte",
+			Buckets:   m.histogramBuckets,
+		},
+		[]string{"method", "path", "service"},
+	)
+	m.mustRegister(m.httpFirstByte, m.httpWrite)
+}
+
+// phaseWriter records when the response starts.
+type phaseWriter struct {
+	http.ResponseWriter
+	now       func() time.Time
+	firstByte time.Time
+}
+
+// started records the first byte once.
+func (w *phaseWriter) started() {
+	if w.firstByte.IsZero() {
+		w.firstByte = w.now()
+	}
+}
+
+// WriteHeader records the first byte for final statuses and delegates to the
+// real writer.
+func (w *phaseWriter) WriteHeader(code int) {
+	if code >= 200 || code == http.StatusSwitchingProtocols {
+		w.started()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the first byte and delegates to the real writer.
+func (w *phaseWriter) Write(b []byte) (int, error) {
+	w.started()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush records the first byte, since flushing sends the headers, and flushes
+// the real writer.
+func (w *phaseWriter) Flush() {
+	w.started()
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack records the first byte and takes over the connection.
+func (w *phaseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.started()
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *phaseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestResponsePhaseMetrics(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	metrics := New(WithServiceName("test-service"), WithResponsePhaseMetrics(), WithHistogramBuckets([]float64{1, 5}),
+		WithClock(func() time.Time { return now }))
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			now = now.Add(time.Second)
+			return
+		}
+		now = now.Add(2 * time.Second)
+		w.WriteHeader(http.StatusOK)
+		now = now.Add(3 * time.Second)
+		_, _ = w.Write([]byte("streamed"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/stream", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/empty", nil))
+
+	expected := `
+# HELP nexen_service_http_response_write_seconds Histogram of time spent writing HTTP response bodies after the first byte
+# TYPE nexen_service_http_response_write_seconds histogram
+nexen_service_http_response_write_seconds_bucket{method="GET",path="/empty",service="test-service",le="1"} 1
+nexen_service_http_response_write_seconds_bucket{method="GET",path="/empty",service="test-service",le="5"} 1
+nexen_service_http_response_write_seconds_bucket{method="GET",path="/empty",service="test-service",le="+Inf"} 1
+nexen_service_http_response_write_seconds_sum{method="GET",path="/empty",service="test-service"} 0
+nexen_service_http_response_write_seconds_count{method="GET",path="/empty",service="test-service"} 1
+nexen_service_http_response_write_seconds_bucket{method="GET",path="/stream",service="test-service",le="1"} 0
+nexen_service_http_response_write_seconds_bucket{method="GET",path="/stream",service="test-service",le="5"} 1
+nexen_service_http_response_write_seconds_bucket{method="GET",path="/stream",service="test-service",le="+Inf"} 1
+nexen_service_http_response_write_seconds_sum{method="GET",path="/stream",service="test-service"} 3
+nexen_service_http_response_write_seconds_count{method="GET",path="/stream",service="test-service"} 1
+# HELP nexen_service_http_time_to_first_byte_seconds Histogram of time until the first byte of HTTP responses
+# TYPE nexen_service_http_time_to_first_byte_seconds histogram
+nexen_service_http_time_to_first_byte_seconds_bucket{method="GET",path="/empty",service="test-service",le="1"} 1
+nexen_service_http_time_to_first_byte_seconds_bucket{method="GET",path="/empty",service="test-service",le="5"} 1
+nexen_service_http_time_to_first_byte_seconds_bucket{method="GET",path="/empty",service="test-service",le="+Inf"} 1
+nexen_service_http_time_to_first_byte_seconds_sum{method="GET",path="/empty",service="test-service"} 1
+nexen_service_http_time_to_first_byte_seconds_count{method="GET",path="/empty",service="test-service"} 1
+nexen_service_http_time_to_first_byte_seconds_bucket{method="GET",path="/stream",service="test-service",le="1"} 0
+nexen_service_http_time_to_first_byte_seconds_bucket{method="GET",path="/stream",service="test-service",le="5"} 1
+nexen_service_http_time_to_first_byte_seconds_bucket{method="GET",path="/stream",service="test-service",le="+Inf"} 1
+nexen_service_http_time_to_first_byte_seconds_sum{method="GET",path="/stream",service="test-service"} 2
+nexen_service_http_time_to_first_byte_seconds_count{method="GET",path="/stream",service="test-service"} 1
+`
+	if err := testutil.GatherAndCompare(metrics.gatherer, strings.NewReader(expected),
+		"nexen_service_http_time_to_first_byte_seconds", "nexen_service_http_response_write_seconds"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResponsePhaseMetricsFlush(t *testing.T) {
+	metrics := New(WithResponsePhaseMetrics())
+	rec := httptest.NewRecorder()
+	metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Expected the writer to support flushing: %v", err)
+		}
+	})).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if !rec.Flushed {
+		t.Error("Expected the response to be flushed")
+	}
+}
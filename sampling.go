@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithDurationSampling makes Instrument observe only a random fraction rate,
+// between 0 and 1, of requests in nexen_service_http_request_duration_seconds,
+// to cut the cost of histogram observations at very high request rates.
+// http_requests_total and the other metrics still count every request.
+//
+// Sampling is uniform, so quantiles and averages computed from the histogram
+// are unbiased, but its _count and buckets hold about rate times the number of
+// requests: divide them by nexen_service_http_duration_sample_rate, or use
+// http_requests_total for request counts.
+func WithDurationSampling(rate float64) Option {
+	return func(m *Metrics) {
+		m.sampleRate = math.Max(0, math.Min(1, rate))
+		m.sampleSet = true
+	}
+}
+
+// WithAdaptiveDurationSampling lowers the duration sampling rate while the
+// instance serves more than threshold requests per second, so that about
+// threshold requests per second are observed. The rate is recomputed every
+// second from the throughput of the previous second, starting from the rate
+// of WithDurationSampling, or 1.
+func WithAdaptiveDurationSampling(threshold float64) Option {
+	return func(m *Metrics) {
+		m.sampleThreshold = threshold
+	}
+}
+
+// durationSampler decides which requests are observed in the duration
+// histogram.
+type durationSampler struct {
+	base      float64
+	threshold float64
+	now       func() time.Time
+
+	// rate holds the bits of the current rate
+	rate        atomic.Uint64
+	windowStart atomic.Int64
+	requests    atomic.Int64
+}
+
+// registerDurationSampling creates the sampler and its rate gauge if sampling
+// is configured.
+func (m *Metrics) registerDurationSampling() {
+	if !m.sampleSet && m.sampleThreshold <= 0 {
+		return
+	}
+
+	s := &durationSampler{base: 1, threshold: m.sampleThreshold, now: m.now}
+	if m.sampleSet {
+		s.base = m.sampleRate
+	}
+	s.rate.Store(math.Float64bits(s.base))
+	s.windowStart.Store(m.now().UnixNano())
+	m.sampler = s
+
+	m.mustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "http_duration_sample_rate",
+			Help:        "Fraction of requests observed in the HTTP duration histogram",
+			ConstLabels: prometheus.Labels{"service": m.serviceName},
+		},
+		s.currentRate,
+	))
+}
+
+// currentRate returns the current sampling rate.
+func (s *durationSampler) currentRate() float64 {
+	return math.Float64frombits(s.rate.Load())
+}
+
+// sample reports whether to observe the duration of a request.
+func (s *durationSampler) sample() bool {
+	if s.threshold > 0 {
+		s.adapt()
+	}
+	rate := s.currentRate()
+	return rate >= 1 || rand.Float64() < rate
+}
+
+// adapt counts a request and, once a second has passed since the current
+// window started, derives the rate from the throughput of that window.
+func (s *durationSampler) adapt() {
+	n := s.requests.Add(1)
+	start := s.windowStart.Load()
+	now := s.now().UnixNano()
+	elapsed := time.Duration(now - start)
+	if elapsed < time.Second || !s.windowStart.CompareAndSwap(start, now) {
+		return
+	}
+	// Requests counted between the swap and the reset fall into the previous
+	// window, a negligible error
+	s.requests.Store(0)
+
+	rate := s.base
+	if perSecond := float64(n) / elapsed.Seconds(); perSecond > s.threshold {
+		rate = s.base * s.threshold / perSecond
+	}
+	s.rate.Store(math.Float64bits(rate))
+}
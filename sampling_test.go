@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDurationSampling(t *testing.T) {
+	for _, c := range []struct {
+		rate     float64
+		min, max uint64
+	}{
+		{0, 0, 0},
+		{0.5, 800, 1200},
+		{1, 2000, 2000},
+	} {
+		metrics := New(WithServiceName("test-service"), WithDurationSampling(c.rate))
+		handler := metrics.Instrument(http.NotFoundHandler())
+		for i := 0; i < 2000; i++ {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		}
+
+		if got := observedHistogram(t, metrics.httpDuration.WithLabelValues("GET", "/", "test-service")).GetSampleCount(); got < c.min || got > c.max {
+			t.Errorf("rate %v: expected between %d and %d observations, got %d", c.rate, c.min, c.max, got)
+		}
+		if got := testutil.ToFloat64(metrics.httpRequests.WithLabelValues("GET", "/", "test-service")); got != 2000 {
+			t.Errorf("rate %v: expected every request to be counted, got %v", c.rate, got)
+		}
+	}
+}
+
+func TestAdaptiveDurationSampling(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	metrics := New(WithServiceName("test-service"), WithAdaptiveDurationSampling(10),
+		WithClock(func() time.Time { return now }))
+	handler := metrics.Instrument(http.NotFoundHandler())
+	serve := func(n int) {
+		for i := 0; i < n; i++ {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		}
+	}
+
+	serve(99)
+	if got := metrics.sampler.currentRate(); got != 1 {
+		t.Fatalf("Expected a rate of 1 during the first second, got %v", got)
+	}
+	now = now.Add(time.Second)
+	serve(1)
+	if got := metrics.sampler.currentRate(); got != 0.1 {
+		t.Fatalf("Expected a rate of 0.1 at 100 requests per second, got %v", got)
+	}
+
+	now = now.Add(2 * time.Second)
+	serve(1)
+	if got := metrics.sampler.currentRate(); got != 1 {
+		t.Fatalf("Expected the rate to recover below the threshold, got %v", got)
+	}
+
+	expected := `
+# HELP nexen_service_http_duration_sample_rate Fraction of requests observed in the HTTP duration histogram
+# TYPE nexen_service_http_duration_sample_rate gauge
+nexen_service_http_duration_sample_rate{service="test-service"} 1
+`
+	if err := testutil.GatherAndCompare(metrics.gatherer, strings.NewReader(expected), "nexen_service_http_duration_sample_rate"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// invalidLabel replaces label values rejected by the label sanitizer.
+const invalidLabel = "invalid"
+
+// Values of the action label of nexen_service_label_values_sanitized_total.
+const (
+	sanitizeReplaced  = "replaced"
+	sanitizeTruncated = "truncated"
+	sanitizeRejected  = "rejected"
+)
+
+// limitRegister is the metric label of names rejected by the Register methods.
+const limitRegister = "register"
+
+// WithLabelSanitizer checks the event and gauge names of RecordEvent,
+// SetGauge, IncrementGauge, DecrementGauge and AddGauge before they become
+// label values, so unchecked user input cannot produce invalid or unbounded
+// values:
+//
+//   - values longer than maxLength runes are truncated; zero means no limit
+//   - invalid UTF-8 and runes for which allowed returns false are replaced
+//     with replacement, or the value is recorded as "invalid" if replacement
+//     is zero; a nil allowed accepts every printable rune
+//
+// With a sanitizer configured, the Register methods also reject metric and
+// label names outside the classic Prometheus charset [a-zA-Z_:][a-zA-Z0-9_:]*,
+// which the registry would otherwise accept as UTF-8 names.
+//
+// Changed values are counted in
+// nexen_service_label_values_sanitized_total{metric, action}, where action is
+// "replaced", "truncated" or "rejected".
+func WithLabelSanitizer(maxLength int, allowed func(r rune) bool, replacement rune) Option {
+	return func(m *Metrics) {
+		if allowed == nil {
+			allowed = unicode.IsPrint
+		}
+		m.sanitizer = &labelSanitizer{maxLength: maxLength, allowed: allowed, replacement: replacement}
+	}
+}
+
+// SafeLabelRune reports whether r is an ASCII letter or digit or one of
+// "_-.:/", a conservative charset for WithLabelSanitizer.
+func SafeLabelRune(r rune) bool {
+	return r < utf8.RuneSelf && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_-.:/", r))
+}
+
+// labelSanitizer rewrites label values as configured with WithLabelSanitizer.
+type labelSanitizer struct {
+	maxLength   int
+	allowed     func(r rune) bool
+	replacement rune
+	sanitized   *prometheus.CounterVec
+	service     string
+}
+
+// registerLabelSanitizer registers the metrics of the label sanitizer if one
+// is configured.
+func (m *Metrics) registerLabelSanitizer() {
+	if m.sanitizer == nil {
+		return
+	}
+
+	m.sanitizer.sanitized = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "label_values_sanitized_total",
+			Help:      "Total number of label values and names changed or rejected by the label sanitizer",
+		},
+		[]string{"metric", "action", "service"},
+	)
+	m.sanitizer.service = m.serviceName
+	m.mustRegister(m.sanitizer.sanitized)
+}
+
+// sanitize returns value as it may be recorded for metric.
+func (s *labelSanitizer) sanitize(metric, value string) string {
+	var b strings.Builder
+	replaced, truncated := false, false
+	n := 0
+	for i, r := range value {
+		if s.maxLength > 0 && n == s.maxLength {
+			truncated = true
+			break
+		}
+		n++
+		if (r == utf8.RuneError && !strings.HasPrefix(value[i:], string(utf8.RuneError))) || !s.allowed(r) {
+			if s.replacement == 0 {
+				s.sanitized.WithLabelValues(metric, sanitizeRejected, s.service).Inc()
+				return invalidLabel
+			}
+			replaced = true
+			r = s.replacement
+		}
+		b.WriteRune(r)
+	}
+
+	if replaced {
+		s.sanitized.WithLabelValues(metric, sanitizeReplaced, s.service).Inc()
+	}
+	if truncated {
+		s.sanitized.WithLabelValues(metric, sanitizeTruncated, s.service).Inc()
+	}
+	if !replaced && !truncated {
+		return value
+	}
+	return b.String()
+}
+
+// sanitizeLabel returns value as it may be recorded for metric, unchanged
+// without WithLabelSanitizer.
+func (m *Metrics) sanitizeLabel(metric, value string) string {
+	if m.sanitizer == nil {
+		return value
+	}
+	return m.sanitizer.sanitize(metric, value)
+}
+
+// validateNames returns an error if a label sanitizer is configured and name
+// or one of labels is outside the classic Prometheus charset.
+func (m *Metrics) validateNames(name string, labels []string) error {
+	if m.sanitizer == nil {
+		return nil
+	}
+	if !validName(name, true) {
+		m.sanitizer.sanitized.WithLabelValues(limitRegister, sanitizeRejected, m.serviceName).Inc()
+		return fmt.Errorf("invalid metric name %q", name)
+	}
+	for _, label := range labels {
+		if !validName(label, false) {
+			m.sanitizer.sanitized.WithLabelValues(limitRegister, sanitizeRejected, m.serviceName).Inc()
+			return fmt.Errorf("invalid label name %q", label)
+		}
+	}
+	return nil
+}
+
+// validName reports whether name matches [a-zA-Z_:][a-zA-Z0-9_:]*, or
+// [a-zA-Z_][a-zA-Z0-9_]* for label names.
+func validName(name string, metric bool) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case r >= '0' && r <= '9' && i > 0:
+		case r == ':' && metric:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLabelSanitizer(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithLabelSanitizer(8, SafeLabelRune, '_'))
+
+	metrics.RecordEvent("sign up")
+	metrics.RecordEvent("checkout-completed")
+	metrics.SetGauge("queue\xffdepth", 3)
+
+	expected := `
+# HELP nexen_service_application_events_total Count of application-specific events
+# TYPE nexen_service_application_events_total counter
+nexen_service_application_events_total{event="checkout",service="test-service"} 1
+nexen_service_application_events_total{event="sign_up",service="test-service"} 1
+# HELP nexen_service_gauge Service-specific gauge for arbitrary values
+# TYPE nexen_service_gauge gauge
+nexen_service_gauge{name="queue_de",service="test-service"} 3
+# HELP nexen_service_label_values_sanitized_total Total number of label values and names changed or rejected by the label sanitizer
+# TYPE nexen_service_label_values_sanitized_total counter
+nexen_service_label_values_sanitized_total{action="replaced",metric="application_events_total",service="test-service"} 1
+nexen_service_label_values_sanitized_total{action="replaced",metric="gauge",service="test-service"} 1
+nexen_service_label_values_sanitized_total{action="truncated",metric="application_events_total",service="test-service"} 1
+nexen_service_label_values_sanitized_total{action="truncated",metric="gauge",service="test-service"} 1
+`
+	if err := testutil.GatherAndCompare(metrics.gatherer, strings.NewReader(expected),
+		"nexen_service_application_events_total", "nexen_service_gauge", "nexen_service_label_values_sanitized_total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLabelSanitizerRejects(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithLabelSanitizer(0, nil, 0))
+
+	metrics.RecordEvent("line\nbreak")
+	metrics.RecordEvent("bad\xffutf8")
+	metrics.RecordEvent("café")
+	if got := testutil.ToFloat64(metrics.applicationEvent.WithLabelValues("invalid", "test-service")); got != 2 {
+		t.Errorf("Expected 2 events recorded as invalid, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.applicationEvent.WithLabelValues("café", "test-service")); got != 1 {
+		t.Errorf("Expected printable UTF-8 to be kept, got %v", got)
+	}
+
+	if _, err := metrics.RegisterCounter("jobs-total", "Jobs", nil); err == nil {
+		t.Error("Expected an invalid metric name to be rejected")
+	}
+	if _, err := metrics.RegisterGauge("queue_depth", "Queue depth", []string{"queue:name"}); err == nil {
+		t.Error("Expected an invalid label name to be rejected")
+	}
+	if _, err := metrics.RegisterGauge("queue_depth", "Queue depth", []string{"queue"}); err != nil {
+		t.Errorf("Expected a valid gauge to be registered: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.sanitizer.sanitized.WithLabelValues("register", "rejected", "test-service")); got != 2 {
+		t.Errorf("Expected 2 rejected registrations, got %v", got)
+	}
+}
+
+func TestLabelSanitizerDisabled(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	metrics.RecordEvent("sign up")
+	if got := testutil.ToFloat64(metrics.applicationEvent.WithLabelValues("sign up", "test-service")); got != 1 {
+		t.Errorf("Expected the event to be recorded unchanged, got %v", got)
+	}
+}
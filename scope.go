@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"net/http"
+)
+
+// ServiceScope records HTTP metrics, events and gauges for one of several
+// logical services running in the same process. It shares the registry and
+// configuration of the Metrics it was created from, but stamps its own service
+// label.
+type ServiceScope struct {
+	m       *Metrics
+	service string
+}
+
+// ForService returns a scope recording with name as the service label:
+//
+//	mux.Handle("/billing/", m.ForService("billing").Instrument(billingHandler))
+//	mux.Handle("/search/", m.ForService("search").Instrument(searchHandler))
+//
+// Scopes are cheap; calling ForService again with the same name returns an
+// equivalent scope.
+func (m *Metrics) ForService(name string) *ServiceScope {
+	return &ServiceScope{m: m, service: name}
+}
+
+// ServiceName returns the service label of the scope.
+func (s *ServiceScope) ServiceName() string {
+	return s.service
+}
+
+// Instrument is like Metrics.Instrument, recording with the scope's service
+// label.
+func (s *ServiceScope) Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.m.serveInstrumented(w, r, next, s.service)
+	})
+}
+
+// InstrumentFunc is like Metrics.InstrumentFunc, recording with the scope's
+// service label.
+func (s *ServiceScope) InstrumentFunc(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.m.serveInstrumented(w, r, next, s.service)
+	}
+}
+
+// RecordEvent increments a counter for application-specific events.
+func (s *ServiceScope) RecordEvent(event string) {
+	s.m.eventCounter(event, s.service).Inc()
+}
+
+// SetGauge sets the value of a named gauge.
+func (s *ServiceScope) SetGauge(name string, value float64) {
+	s.m.gauge(name, s.service).Set(value)
+}
+
+// IncrementGauge increments a named gauge by 1.
+func (s *ServiceScope) IncrementGauge(name string) {
+	s.m.gauge(name, s.service).Inc()
+}
+
+// DecrementGauge decrements a named gauge by 1.
+func (s *ServiceScope) DecrementGauge(name string) {
+	s.m.gauge(name, s.service).Dec()
+}
+
+// AddGauge adds delta to a named gauge.
+func (s *ServiceScope) AddGauge(name string, delta float64) {
+	s.m.gauge(name, s.service).Add(delta)
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestForService(t *testing.T) {
+	metrics := New(WithServiceName("gateway"))
+	billing := metrics.ForService("billing")
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	metrics.Instrument(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+	billing.Instrument(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/invoices", nil))
+	billing.InstrumentFunc(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/invoices", nil))
+	metrics.RecordEvent("started")
+	billing.RecordEvent("invoice_sent")
+	billing.SetGauge("open_invoices", 3)
+	billing.IncrementGauge("open_invoices")
+
+	expected := `
+# HELP nexen_service_application_events_total Count of application-specific events
+# TYPE nexen_service_application_events_total counter
+nexen_service_application_events_total{event="invoice_sent",service="billing"} 1
+nexen_service_application_events_total{event="started",service="gateway"} 1
+# HELP nexen_service_gauge Service-specific gauge for arbitrary values
+# TYPE nexen_service_gauge gauge
+nexen_service_gauge{name="open_invoices",service="billing"} 4
+# HELP nexen_service_http_errors_total Total number of HTTP responses with error status codes
+# TYPE nexen_service_http_errors_total counter
+nexen_service_http_errors_total{code="I'm a teapot",method="GET",path="/health",service="gateway"} 1
+nexen_service_http_errors_total{code="I'm a teapot",method="GET",path="/invoices",service="billing"} 2
+# HELP nexen_service_http_requests_total Total number of HTTP requests received
+# TYPE nexen_service_http_requests_total counter
+nexen_service_http_requests_total{method="GET",path="/health",service="gateway"} 1
+nexen_service_http_requests_total{method="GET",path="/invoices",service="billing"} 2
+`
+	if err := testutil.GatherAndCompare(metrics.Registry(), strings.NewReader(expected),
+		"nexen_service_application_events_total",
+		"nexen_service_gauge",
+		"nexen_service_http_errors_total",
+		"nexen_service_http_requests_total",
+	); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.CollectAndCount(metrics.httpDuration); got != 2 {
+		t.Errorf("Expected a duration series per service, got %d", got)
+	}
+}
+
+func TestForServiceMetricTTL(t *testing.T) {
+	metrics := New(WithServiceName("gateway"), WithMetricTTL(time.Minute))
+	defer metrics.Close(context.Background())
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	metrics.Instrument(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users", nil))
+	metrics.ForService("billing").Instrument(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users", nil))
+	metrics.ForService("billing").RecordEvent("invoice_sent")
+
+	metrics.seriesSeen.seen[seriesKey{group: seriesHTTP, service: "gateway", a: "GET", b: "/users"}] = time.Now().Add(time.Minute)
+	metrics.expireSeries(time.Now().Add(time.Minute))
+
+	if got := testutil.ToFloat64(metrics.httpRequests.WithLabelValues("GET", "/users", "gateway")); got != 1 {
+		t.Errorf("Expected the gateway series to be kept, got %v", got)
+	}
+	if got := testutil.CollectAndCount(metrics.httpRequests); got != 1 {
+		t.Errorf("Expected only the billing series to expire, got %d series", got)
+	}
+	if got := testutil.CollectAndCount(metrics.applicationEvent); got != 0 {
+		t.Errorf("Expected the billing event to expire, got %d series", got)
+	}
+}
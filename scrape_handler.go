@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// WithScrapeTimeout bounds the time Handler spends gathering metrics. Scrapes
+// taking longer are answered with 503 Service Unavailable, while the gathering
+// itself runs to completion in the background. Zero, the default, means no
+// timeout; set it below the scrape timeout of Prometheus.
+func WithScrapeTimeout(timeout time.Duration) Option {
+	return func(m *Metrics) {
+		m.scrapeTimeout = timeout
+	}
+}
+
+// WithMaxScrapesInFlight limits the number of scrapes Handler serves
+// concurrently. Further scrapes are answered with 503 Service Unavailable.
+// Zero, the default, means no limit.
+func WithMaxScrapesInFlight(n int) Option {
+	return func(m *Metrics) {
+		m.maxScrapes = n
+	}
+}
+
+// WithOpenMetrics lets Handler answer scrapers negotiating the OpenMetrics
+// format through their Accept header in that format, which exposes exemplars.
+// WithExemplars also enables it. Other scrapers still get the Prometheus text
+// format.
+func WithOpenMetrics() Option {
+	return func(m *Metrics) {
+		m.openMetrics = true
+	}
+}
+
+// WithCreatedSamples adds a _created series, holding the creation time, to
+// every counter, histogram and summary served in the OpenMetrics format, so
+// scrapers can tell when a series was reset. It implies WithOpenMetrics. The
+// extra series increase the cardinality seen by scrapers that store them as
+// is; Prometheus converts them with created-timestamp-zero-ingestion enabled.
+func WithCreatedSamples() Option {
+	return func(m *Metrics) {
+		m.openMetrics = true
+		m.createdSamples = true
+	}
+}
+
+// WithoutScrapeCompression makes Handler always answer uncompressed, even
+// when the scraper accepts gzip, trading bandwidth for CPU.
+func WithoutScrapeCompression() Option {
+	return func(m *Metrics) {
+		m.noCompression = true
+	}
+}
+
+// handlerOpts returns the options of the scrape handlers.
+func (m *Metrics) handlerOpts() promhttp.HandlerOpts {
+	return promhttp.HandlerOpts{
+		Timeout:                             m.scrapeTimeout,
+		MaxRequestsInFlight:                 m.maxScrapes,
+		EnableOpenMetrics:                   m.openMetrics || m.exemplars,
+		DisableCompression:                  m.noCompression,
+		EnableOpenMetricsTextCreatedSamples: m.createdSamples,
+	}
+}
+
+// newScrapeHandler builds the handler returned by Handler. It registers the
+// promhttp self-metrics: promhttp_metric_handler_requests_total{code},
+// promhttp_metric_handler_requests_in_flight and
+// promhttp_metric_handler_errors_total{cause}. With WithSelfMetrics, it also
+// observes the duration and size of scrapes.
+func (m *Metrics) newScrapeHandler() http.Handler {
+	reg := trackingRegisterer{m}
+	opts := m.handlerOpts()
+	opts.Registry = reg
+	return promhttp.InstrumentMetricHandler(reg, m.observingHandler(promhttp.HandlerFor(m.gatherer, opts)))
+}
+
+// trackingRegisterer registers collectors through m so Close unregisters them.
+type trackingRegisterer struct {
+	m *Metrics
+}
+
+// Register implements prometheus.Registerer.
+func (r trackingRegisterer) Register(c prometheus.Collector) error {
+	return r.m.register(c)
+}
+
+// MustRegister implements prometheus.Registerer.
+func (r trackingRegisterer) MustRegister(cs ...prometheus.Collector) {
+	r.m.mustRegister(cs...)
+}
+
+// Unregister implements prometheus.Registerer.
+func (r trackingRegisterer) Unregister(c prometheus.Collector) bool {
+	return r.m.registerer.Unregister(c)
+}
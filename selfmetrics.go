@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/nexen-io/nexen-metrics/internal"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Values of the reason label of nexen_service_metrics_registration_failures_total.
+const (
+	registrationDuplicate = "duplicate"
+	registrationInvalid   = "invalid"
+)
+
+// WithSelfMetrics exports metrics about the instrumentation itself, to show
+// when it misbehaves:
+//
+//   - nexen_service_metrics_scrape_duration_seconds: time to serve a scrape of
+//     Handler, gathering and encoding included
+//   - nexen_service_metrics_scrape_size_bytes: size of scrape responses, after
+//     compression
+//   - nexen_service_metrics_registered_collectors: collectors registered
+//     through the instance
+//   - nexen_service_metrics_gather_errors_total: gathers of the registry that
+//     failed, fully or for some collectors
+//   - nexen_service_metrics_instrument_overhead_seconds: time Instrument spends
+//     recording a request, outside of the wrapped handler
+//   - nexen_service_metrics_registration_failures_total{reason}: rejected
+//     registrations, by reason "duplicate" or "invalid"
+//   - nexen_service_metrics_dropped_exemplars_total: exemplars returned by the
+//     ExemplarExtractor that could not be attached, being too long or invalid
+func WithSelfMetrics() Option {
+	return func(m *Metrics) {
+		m.selfEnabled = true
+	}
+}
+
+// selfMetrics are the metrics of WithSelfMetrics.
+type selfMetrics struct {
+	scrapeDuration       prometheus.Observer
+	scrapeSize           prometheus.Observer
+	gatherErrors         prometheus.Counter
+	instrumentOverhead   prometheus.Observer
+	registrationFailures *prometheus.CounterVec
+	droppedExemplars     prometheus.Counter
+}
+
+// registerSelfMetrics registers the metrics of WithSelfMetrics. It runs before
+// the other metrics are registered, so their registration failures are counted.
+func (m *Metrics) registerSelfMetrics() {
+	if !m.selfEnabled {
+		return
+	}
+
+	scrapeDuration := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "metrics_scrape_duration_seconds",
+			Help:      "Duration of scrapes of the metrics handler",
+			Buckets:   internal.DefaultHTTPBuckets(),
+		},
+		[]string{"service"},
+	)
+	scrapeSize := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "metrics_scrape_size_bytes",
+			Help:      "Size of the responses of the metrics handler",
+			Buckets:   internal.DefaultSizeBuckets(),
+		},
+		[]string{"service"},
+	)
+	registered := prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "metrics_registered_collectors",
+			Help:        "Number of collectors registered through the metrics instance",
+			ConstLabels: prometheus.Labels{"service": m.serviceName},
+		},
+		func() float64 {
+			m.registeredMu.Lock()
+			defer m.registeredMu.Unlock()
+			return float64(len(m.registered))
+		},
+	)
+	gatherErrors := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "metrics_gather_errors_total",
+			Help:      "Total number of gathers of the registry that failed",
+		},
+		[]string{"service"},
+	)
+	overhead := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "metrics_instrument_overhead_seconds",
+			Help:      "Time spent recording instrumented requests, outside of their handlers",
+			Buckets:   []float64{1e-6, 5e-6, 1e-5, 5e-5, 1e-4, 5e-4, 1e-3},
+		},
+		[]string{"service"},
+	)
+	registrationFailures := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "metrics_registration_failures_total",
+			Help:      "Total number of rejected metric registrations by reason",
+		},
+		[]string{"reason", "service"},
+	)
+	droppedExemplars := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "metrics_dropped_exemplars_total",
+			Help:      "Total number of exemplars dropped for being too long or invalid",
+		},
+		[]string{"service"},
+	)
+	m.mustRegister(scrapeDuration, scrapeSize, registered, gatherErrors, overhead, registrationFailures, droppedExemplars)
+
+	m.self = &selfMetrics{
+		scrapeDuration:       scrapeDuration.WithLabelValues(m.serviceName),
+		scrapeSize:           scrapeSize.WithLabelValues(m.serviceName),
+		gatherErrors:         gatherErrors.WithLabelValues(m.serviceName),
+		instrumentOverhead:   overhead.WithLabelValues(m.serviceName),
+		registrationFailures: registrationFailures,
+		droppedExemplars:     droppedExemplars.WithLabelValues(m.serviceName),
+	}
+}
+
+// registrationFailed counts a registration rejected with err.
+func (m *Metrics) registrationFailed(err error) {
+	if m.self == nil {
+		return
+	}
+	reason := registrationInvalid
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		reason = registrationDuplicate
+	}
+	m.self.registrationFailures.WithLabelValues(reason, m.serviceName).Inc()
+}
+
+// countingGatherer wraps g and counts its failed gathers.
+func (s *selfMetrics) countingGatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		if err != nil {
+			s.gatherErrors.Inc()
+		}
+		return families, err
+	})
+}
+
+// observingHandler wraps the scrape handler next to observe the duration and
+// size of scrapes.
+func (m *Metrics) observingHandler(next http.Handler) http.Handler {
+	if m.self == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := m.now()
+		rw := newResponseWriter(w)
+		next.ServeHTTP(rw, r)
+		m.self.scrapeDuration.Observe(m.since(start).Seconds())
+		m.self.scrapeSize.Observe(float64(rw.BytesWritten()))
+	})
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// failingCollector reports an invalid metric on every collection.
+type failingCollector struct {
+	desc *prometheus.Desc
+}
+
+func (c failingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c failingCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.NewInvalidMetric(c.desc, errors.New("backend unavailable"))
+}
+
+func TestSelfMetrics(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithSelfMetrics())
+
+	metrics.Instrument(http.NotFoundHandler()).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if got := observedHistogram(t, metrics.self.instrumentOverhead).GetSampleCount(); got != 1 {
+		t.Errorf("Expected 1 instrument overhead observation, got %d", got)
+	}
+
+	if _, err := metrics.RegisterCounter("jobs_total", "Jobs", nil); err != nil {
+		t.Fatalf("RegisterCounter: %v", err)
+	}
+	if _, err := metrics.RegisterCounter("jobs_total", "Jobs", nil); err == nil {
+		t.Fatal("Expected a duplicate registration to fail")
+	}
+	if _, err := metrics.RegisterGauge("queue_depth", "Queue depth", []string{"service"}); err == nil {
+		t.Fatal("Expected a duplicate label name to fail")
+	}
+	// Reusing a shared metric is not a failure, colliding with another type is
+	if _, err := metrics.GetOrRegisterCounter("jobs_total", "Jobs", nil); err != nil {
+		t.Fatalf("GetOrRegisterCounter: %v", err)
+	}
+	if _, err := metrics.GetOrRegisterGauge("jobs_total", "Jobs", nil); err == nil {
+		t.Fatal("Expected a gauge colliding with a counter to fail")
+	}
+	for reason, expected := range map[string]float64{"duplicate": 2, "invalid": 1} {
+		if got := testutil.ToFloat64(metrics.self.registrationFailures.WithLabelValues(reason, "test-service")); got != expected {
+			t.Errorf("Expected %v %s registration failures, got %v", expected, reason, got)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if got := observedHistogram(t, metrics.self.scrapeDuration).GetSampleCount(); got != 1 {
+		t.Errorf("Expected 1 scrape duration observation, got %d", got)
+	}
+	if got := observedHistogram(t, metrics.self.scrapeSize).GetSampleSum(); got != float64(rec.Body.Len()) {
+		t.Errorf("Expected a scrape size of %d, got %v", rec.Body.Len(), got)
+	}
+	if got := testutil.ToFloat64(metrics.self.gatherErrors); got != 0 {
+		t.Errorf("Expected no gather errors, got %v", got)
+	}
+
+	desc := prometheus.NewDesc("nexen_service_backend_up", "Backend state", nil, nil)
+	if err := metrics.Register(failingCollector{desc}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if _, err := metrics.Gatherer().Gather(); err == nil {
+		t.Fatal("Expected the gather to fail")
+	}
+	if got := testutil.ToFloat64(metrics.self.gatherErrors); got != 1 {
+		t.Errorf("Expected 1 gather error, got %v", got)
+	}
+}
+
+func TestSelfMetricsDisabled(t *testing.T) {
+	metrics := New()
+	if metrics.self != nil {
+		t.Fatal("Expected no self-metrics without WithSelfMetrics")
+	}
+}
+
+// observedHistogram returns the state of the histogram o.
+func observedHistogram(t *testing.T, o prometheus.Observer) *dto.Histogram {
+	t.Helper()
+	var metric dto.Metric
+	if err := o.(prometheus.Metric).Write(&metric); err != nil {
+		t.Fatalf("Failed to write metric: %v", err)
+	}
+	return metric.GetHistogram()
+}
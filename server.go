@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// serverShutdownTimeout bounds how long Serve waits for in-flight scrapes when
+// shutting down.
+const serverShutdownTimeout = 5 * time.Second
+
+// Serve runs an HTTP server exposing Handler at -metrics.path on
+// -metrics.listen-address, or the path and address set with WithMetricsPath and
+// WithListenAddress, and Snapshot as JSON at the same path with a .json
+// suffix. Besides TCP addresses, the listen address may be a Unix domain
+// socket, as in "unix:///run/app/metrics.sock", or a socket passed by systemd
+// socket activation, "systemd:" or "systemd:name", so sidecar scrapers can
+// collect metrics without a TCP port; WithListener sets the listener directly.
+// Scrapes are subject to the restrictions set with
+// WithBasicAuth, WithBearerToken and WithIPAllowlist, and served over HTTPS with
+// WithTLS. Liveness and readiness probes of the checks added with Health are
+// served without restrictions at /healthz and /readyz. It blocks until ctx is
+// cancelled or Close is called, then shuts the server down gracefully and
+// returns nil. It returns an error if the server fails to listen, stops serving
+// unexpectedly or does not shut down cleanly, so it can run in an errgroup
+// alongside the service:
+//
+//	g, ctx := errgroup.WithContext(ctx)
+//	g.Go(func() error { return m.Serve(ctx) })
+func (m *Metrics) Serve(ctx context.Context) error {
+	addr, path := *listenAddress, *metricsPath
+	if m.serveAddr != "" {
+		addr = m.serveAddr
+	}
+	if m.servePath != "" {
+		path = m.servePath
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, m.serverAuth.protect(m.Handler()))
+	mux.Handle(path+".json", m.serverAuth.protect(m.SnapshotHandler()))
+	checks := m.Health()
+	mux.Handle("/healthz", checks.LivenessHandler())
+	mux.Handle("/readyz", checks.ReadinessHandler())
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// Load the certificate before listening, so a bad one leaves no socket bound
+	if m.tlsCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(m.tlsCertFile, m.tlsKeyFile)
+		if err != nil {
+			// A listener set with WithListener is owned by Serve all the same
+			if m.serveListener != nil {
+				m.serveListener.Close()
+			}
+			return fmt.Errorf("failed to load metrics server certificate: %w", err)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	ln, err := m.listen(addr)
+	if err != nil {
+		return err
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			serveErr <- srv.ServeTLS(ln, "", "")
+			return
+		}
+		serveErr <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("metrics server failed: %w", err)
+	case <-ctx.Done():
+	case <-m.done:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down metrics server: %w", err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("metrics server failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// serverAuth holds the access restrictions of the server started by Serve.
+type serverAuth struct {
+	user, password string
+	token          string
+	allowed        []netip.Prefix
+}
+
+// WithBasicAuth requires scrapes of the server started by Serve to
+// authenticate with HTTP basic auth as user and password. Combined with
+// WithBearerToken, either credential is accepted.
+func WithBasicAuth(user, password string) Option {
+	return func(m *Metrics) {
+		m.serverAuth.user, m.serverAuth.password = user, password
+	}
+}
+
+// WithBearerToken requires scrapes of the server started by Serve to send
+// token in an "Authorization: Bearer" header, as configured with
+// authorization.credentials in a Prometheus scrape config.
+func WithBearerToken(token string) Option {
+	return func(m *Metrics) {
+		m.serverAuth.token = token
+	}
+}
+
+// WithIPAllowlist restricts the server started by Serve to clients whose
+// address is in one of prefixes, e.g. netip.MustParsePrefix("10.0.0.0/8").
+// Other clients are rejected with 403 Forbidden before authentication. The
+// address is taken from the connection, not from forwarding headers.
+func WithIPAllowlist(prefixes ...netip.Prefix) Option {
+	return func(m *Metrics) {
+		m.serverAuth.allowed = append(m.serverAuth.allowed, prefixes...)
+	}
+}
+
+// WithTLS makes the server started by Serve use HTTPS with the certificate and
+// key in the given PEM files.
+func WithTLS(certFile, keyFile string) Option {
+	return func(m *Metrics) {
+		m.tlsCertFile, m.tlsKeyFile = certFile, keyFile
+	}
+}
+
+// protect wraps next with the access restrictions configured for Serve.
+func (a serverAuth) protect(next http.Handler) http.Handler {
+	if a.user == "" && a.token == "" && len(a.allowed) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(a.allowed) > 0 && !a.allows(r.RemoteAddr) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		if (a.user != "" || a.token != "") && !a.authenticated(r) {
+			if a.user != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+			}
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allows reports whether the client at remoteAddr is in the allowlist.
+func (a serverAuth) allows(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range a.allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticated reports whether r carries valid credentials. Credentials are
+// compared in constant time.
+func (a serverAuth) authenticated(r *http.Request) bool {
+	if a.user != "" {
+		if user, password, ok := r.BasicAuth(); ok &&
+			secureEqual(user, a.user) && secureEqual(password, a.password) {
+			return true
+		}
+	}
+	if a.token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && secureEqual(token, a.token) {
+			return true
+		}
+	}
+	return false
+}
+
+// secureEqual compares two secrets in constant time.
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServerAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name   string
+		auth   serverAuth
+		setup  func(r *http.Request)
+		remote string
+		want   int
+	}{
+		{"open", serverAuth{}, nil, "", http.StatusOK},
+		{"basic valid", serverAuth{user: "prom", password: "secret"}, func(r *http.Request) { r.SetBasicAuth("prom", "secret") }, "", http.StatusOK},
+		{"basic wrong password", serverAuth{user: "prom", password: "secret"}, func(r *http.Request) { r.SetBasicAuth("prom", "guess") }, "", http.StatusUnauthorized},
+		{"basic missing", serverAuth{user: "prom", password: "secret"}, nil, "", http.StatusUnauthorized},
+		{"bearer valid", serverAuth{token: "t0ken"}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0ken") }, "", http.StatusOK},
+		{"bearer wrong", serverAuth{token: "t0ken"}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer other") }, "", http.StatusUnauthorized},
+		{"bearer or basic", serverAuth{user: "prom", password: "secret", token: "t0ken"}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0ken") }, "", http.StatusOK},
+		{"allowlisted", serverAuth{allowed: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}, nil, "10.1.2.3:5000", http.StatusOK},
+		{"not allowlisted", serverAuth{allowed: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}, nil, "192.168.1.1:5000", http.StatusForbidden},
+		{"allowlisted v4-mapped", serverAuth{allowed: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}, nil, "[::ffff:10.1.2.3]:5000", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/metrics", nil)
+			if tt.setup != nil {
+				tt.setup(r)
+			}
+			if tt.remote != "" {
+				r.RemoteAddr = tt.remote
+			}
+			w := httptest.NewRecorder()
+			tt.auth.protect(ok).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestServeTLSWithBasicAuth(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	metrics := New(
+		WithListenAddress(addr),
+		WithMetricsPath("/metrics"),
+		WithTLS(certFile, keyFile),
+		WithBasicAuth("prom", "secret"),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- metrics.Serve(ctx) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // self-signed test certificate
+		DisableKeepAlives: true,
+	}}
+	scrape := func(authenticate bool) int {
+		req, _ := http.NewRequest("GET", "https://"+addr+"/metrics", nil)
+		if authenticate {
+			req.SetBasicAuth("prom", "secret")
+		}
+		var resp *http.Response
+		for i := 0; i < 50; i++ {
+			if resp, err = client.Do(req); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("Failed to scrape metrics server: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := scrape(false); code != http.StatusUnauthorized {
+		t.Errorf("Expected unauthenticated scrape to be rejected, got %d", code)
+	}
+	if code := scrape(true); code != http.StatusOK {
+		t.Errorf("Expected authenticated scrape to succeed, got %d", code)
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("Expected clean shutdown, got %v", err)
+	}
+}
+
+func TestServeTLSCertificateError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	dir := t.TempDir()
+	metrics := New(WithListenAddress(addr), WithTLS(filepath.Join(dir, "missing.pem"), filepath.Join(dir, "missing-key.pem")))
+	if err := metrics.Serve(context.Background()); err == nil {
+		t.Fatal("Expected an error for a missing certificate")
+	}
+
+	// The address is still free
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Expected the address to be free after the error, got %v", err)
+	}
+	ln.Close()
+}
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1 and its
+// key to temporary PEM files.
+func writeTestCertificate(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "metrics"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setServerFlags points the metrics server flags at a free local port for the
+// duration of the test and returns the scrape URL.
+func setServerFlags(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	oldAddress, oldPath := *listenAddress, *metricsPath
+	*listenAddress, *metricsPath = addr, "/custom-metrics"
+	t.Cleanup(func() {
+		*listenAddress, *metricsPath = oldAddress, oldPath
+	})
+	return "http://" + addr + "/custom-metrics"
+}
+
+func TestServe(t *testing.T) {
+	url := setServerFlags(t)
+	metrics := New(WithServiceName("test-service"))
+	metrics.RecordEvent("served")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- metrics.Serve(ctx) }()
+
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if resp, err = http.Get(url); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Failed to scrape metrics server: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `nexen_service_application_events_total{event="served",service="test-service"} 1`) {
+		t.Fatal("Expected scrape to expose recorded metrics")
+	}
+	resp, err = http.Get(url + ".json")
+	if err != nil {
+		t.Fatalf("Failed to fetch the JSON snapshot: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "application/json" {
+		t.Fatalf("Expected a JSON snapshot, got %q", got)
+	}
+
+	cancel()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("Expected clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after the context was cancelled")
+	}
+}
+
+func TestServeStopsOnClose(t *testing.T) {
+	setServerFlags(t)
+	metrics := New()
+
+	errc := make(chan error, 1)
+	go func() { errc <- metrics.Serve(context.Background()) }()
+	time.Sleep(20 * time.Millisecond)
+
+	if err := metrics.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("Expected clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after Close")
+	}
+}
+
+func TestServeListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	setServerFlags(t)
+	*listenAddress = ln.Addr().String()
+
+	if err := New().Serve(context.Background()); err == nil {
+		t.Fatal("Expected an error when the address is in use")
+	}
+}
+
+func TestServeHealthChecks(t *testing.T) {
+	url := setServerFlags(t)
+	base := strings.TrimSuffix(url, "/custom-metrics")
+	metrics := New(WithServiceName("test-service"), WithBasicAuth("prom", "secret"))
+	var dbUp atomic.Bool
+	metrics.Health().AddCheck("db", func(ctx context.Context) error {
+		if !dbUp.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = metrics.Serve(ctx) }()
+
+	get := func(path string) int {
+		var resp *http.Response
+		var err error
+		for i := 0; i < 50; i++ {
+			if resp, err = http.Get(base + path); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("Failed to reach %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := get("/healthz"); code != http.StatusOK {
+		t.Errorf("Expected live process, got %d", code)
+	}
+	if code := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected failing check to make the service unready, got %d", code)
+	}
+	dbUp.Store(true)
+	if code := get("/readyz"); code != http.StatusOK {
+		t.Errorf("Expected passing check to make the service ready, got %d", code)
+	}
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// WithServerTiming makes Instrument add a "Server-Timing: total;dur=<ms>" header
+// to responses so browser developer tools display the server-side duration.
+//
+// Headers cannot change once the response has started, so the header is set
+// just before the status line is written: on the first WriteHeader, Write or
+// Flush, or after the handler returns if it wrote nothing. The reported duration
+// therefore covers the time until the response started, not the time spent
+// streaming the body.
+func WithServerTiming() Option {
+	return func(m *Metrics) {
+		m.serverTiming = true
+	}
+}
+
+// serverTimingWriter sets the Server-Timing header before the response starts.
+type serverTimingWriter struct {
+	http.ResponseWriter
+	now     func() time.Time
+	start   time.Time
+	written bool
+}
+
+// setHeader adds the Server-Timing header once.
+func (w *serverTimingWriter) setHeader() {
+	if w.written {
+		return
+	}
+	w.written = true
+	ms := float64(w.now().Sub(w.start).Microseconds()) / 1000
+	w.Header().Add("Server-Timing", "total;dur="+strconv.FormatFloat(ms, 'f', 3, 64))
+}
+
+// WriteHeader sets the Server-Timing header and delegates to the real writer.
+func (w *serverTimingWriter) WriteHeader(code int) {
+	if code >= 200 || code == http.StatusSwitchingProtocols {
+		w.setHeader()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write sets the Server-Timing header and delegates to the real writer.
+func (w *serverTimingWriter) Write(b []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sets the Server-Timing header, since flushing sends the headers, and
+// flushes the real writer.
+func (w *serverTimingWriter) Flush() {
+	w.setHeader()
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *serverTimingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerTiming(t *testing.T) {
+	metrics := New(WithServerTiming())
+
+	handlers := map[string]http.HandlerFunc{
+		"write header": func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusCreated) },
+		"write body":   func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("ok")) },
+		"no output":    func(w http.ResponseWriter, r *http.Request) {},
+		"flush":        func(w http.ResponseWriter, r *http.Request) { _ = http.NewResponseController(w).Flush() },
+	}
+	for name, h := range handlers {
+		rec := httptest.NewRecorder()
+		metrics.Instrument(h).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+		values := rec.Result().Header.Values("Server-Timing")
+		if len(values) != 1 || !strings.HasPrefix(values[0], "total;dur=") {
+			t.Errorf("%s: expected a single Server-Timing header, got %q", name, values)
+		}
+	}
+}
+
+func TestServerTimingDisabled(t *testing.T) {
+	rec := httptest.NewRecorder()
+	New().Instrument(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if rec.Header().Get("Server-Timing") != "" {
+		t.Fatal("Expected no Server-Timing header by default")
+	}
+}
@@ -0,0 +1,283 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand/v2"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithShardedRecording makes Instrument count requests in
+// nexen_service_http_requests_total and observe their durations in
+// nexen_service_http_request_duration_seconds through shards of atomic
+// counters, sums and bucket counts, one per CPU up to 16, merged when metrics
+// are gathered. Concurrent requests with the same labels then update separate
+// cache lines instead of contending on the same ones, at the cost of up to 1KB
+// per request counter and a few kilobytes per duration histogram, and slightly
+// more work per scrape. Use it for
+// extremely hot services where profiling shows contention on these metrics;
+// compare with BenchmarkRecordHTTP on the target hardware.
+//
+// Durations are still recorded in a client_golang histogram with WithExemplars
+// and native histograms, which shards cannot represent.
+func WithShardedRecording() Option {
+	return func(m *Metrics) {
+		m.shardedHTTP = true
+	}
+}
+
+// maxShards bounds the number of shards of each sharded metric, and so its
+// memory, on hosts with many processors.
+const maxShards = 16
+
+// shardCount returns the number of shards of each sharded metric: one per
+// processor up to maxShards, rounded up to a power of two.
+func shardCount() int {
+	return 1 << bits.Len(uint(min(runtime.GOMAXPROCS(0), maxShards)-1))
+}
+
+// paddedCounter is a counter filling a cache line, so that neighbouring shards
+// do not share one.
+type paddedCounter struct {
+	n atomic.Uint64
+	_ [56]byte
+}
+
+// shardedCounter is a counter spread over shards.
+type shardedCounter struct {
+	shards []paddedCounter
+	mask   uint32
+}
+
+// newShardedCounter returns a zero counter.
+func newShardedCounter() *shardedCounter {
+	n := shardCount()
+	return &shardedCounter{shards: make([]paddedCounter, n), mask: uint32(n - 1)}
+}
+
+// Inc increments a random shard.
+func (c *shardedCounter) Inc() {
+	c.shards[rand.Uint32()&c.mask].n.Add(1)
+}
+
+// value returns the sum of the shards.
+func (c *shardedCounter) value() uint64 {
+	var total uint64
+	for i := range c.shards {
+		total += c.shards[i].n.Load()
+	}
+	return total
+}
+
+// histogramShard holds the observations of one shard of a histogram.
+type histogramShard struct {
+	// buckets counts observations per bucket, not cumulatively, the last one
+	// counting those above every bound. It is a window of the counts of all
+	// shards, see newShardedHistogram
+	buckets []atomic.Uint64
+	// sum holds the bits of the sum of observations
+	sum atomic.Uint64
+	_   [32]byte
+}
+
+// shardedHistogram is a histogram with classic buckets spread over shards.
+type shardedHistogram struct {
+	bounds []float64
+	shards []histogramShard
+	mask   uint32
+}
+
+// newShardedHistogram returns an empty histogram with the given upper bounds.
+func newShardedHistogram(bounds []float64) *shardedHistogram {
+	n := shardCount()
+	h := &shardedHistogram{bounds: bounds, shards: make([]histogramShard, n), mask: uint32(n - 1)}
+	// Allocate the counts of all shards at once, leaving a cache line of
+	// unused counts after each shard so that separate shards never share one
+	buckets := len(bounds) + 1
+	stride := buckets + 8
+	counts := make([]atomic.Uint64, n*stride)
+	for i := range h.shards {
+		h.shards[i].buckets = counts[i*stride : i*stride+buckets : i*stride+buckets]
+	}
+	return h
+}
+
+// Observe records v in a random shard.
+func (h *shardedHistogram) Observe(v float64) {
+	shard := &h.shards[rand.Uint32()&h.mask]
+	shard.buckets[sort.SearchFloat64s(h.bounds, v)].Add(1)
+	for {
+		old := shard.sum.Load()
+		if shard.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// metric merges the shards into a constant histogram. The count is derived
+// from the bucket counts, so buckets stay cumulative while observations
+// continue; the sum may include a few observations more or less.
+func (h *shardedHistogram) metric(desc *prometheus.Desc, labelValues []string) prometheus.Metric {
+	counts := make([]uint64, len(h.bounds)+1)
+	var sum float64
+	for i := range h.shards {
+		shard := &h.shards[i]
+		for j := range counts {
+			counts[j] += shard.buckets[j].Load()
+		}
+		sum += math.Float64frombits(shard.sum.Load())
+	}
+
+	buckets := make(map[float64]uint64, len(h.bounds))
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += counts[i]
+		buckets[bound] = cumulative
+	}
+	count := cumulative + counts[len(h.bounds)]
+	metric, err := prometheus.NewConstHistogram(desc, count, sum, buckets, labelValues...)
+	if err != nil {
+		return prometheus.NewInvalidMetric(desc, err)
+	}
+	return metric
+}
+
+// shardedChild is a child of a shardedVec with its label values.
+type shardedChild[C any] struct {
+	labelValues []string
+	child       C
+}
+
+// shardedVec is a collector of sharded children partitioned by label values,
+// the sharded counterpart of a CounterVec or HistogramVec.
+type shardedVec[C any] struct {
+	desc       *prometheus.Desc
+	labelNames []string
+	newChild   func() C
+	metric     func(desc *prometheus.Desc, child C, labelValues []string) prometheus.Metric
+
+	mu       sync.RWMutex
+	children map[string]*shardedChild[C]
+}
+
+// newShardedCounterVec returns a sharded counter vector.
+func newShardedCounterVec(opts prometheus.CounterOpts, labelNames []string) *shardedVec[*shardedCounter] {
+	return &shardedVec[*shardedCounter]{
+		desc:       prometheus.NewDesc(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), opts.Help, labelNames, opts.ConstLabels),
+		labelNames: labelNames,
+		newChild:   newShardedCounter,
+		metric: func(desc *prometheus.Desc, c *shardedCounter, labelValues []string) prometheus.Metric {
+			metric, err := prometheus.NewConstMetric(desc, prometheus.CounterValue, float64(c.value()), labelValues...)
+			if err != nil {
+				return prometheus.NewInvalidMetric(desc, err)
+			}
+			return metric
+		},
+		children: make(map[string]*shardedChild[*shardedCounter]),
+	}
+}
+
+// newShardedHistogramVec returns a sharded histogram vector with the classic
+// buckets of opts.
+func newShardedHistogramVec(opts prometheus.HistogramOpts, labelNames []string) *shardedVec[*shardedHistogram] {
+	bounds := append([]float64(nil), opts.Buckets...)
+	if len(bounds) == 0 {
+		bounds = prometheus.DefBuckets
+	}
+	return &shardedVec[*shardedHistogram]{
+		desc:       prometheus.NewDesc(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), opts.Help, labelNames, opts.ConstLabels),
+		labelNames: labelNames,
+		newChild:   func() *shardedHistogram { return newShardedHistogram(bounds) },
+		metric: func(desc *prometheus.Desc, h *shardedHistogram, labelValues []string) prometheus.Metric {
+			return h.metric(desc, labelValues)
+		},
+		children: make(map[string]*shardedChild[*shardedHistogram]),
+	}
+}
+
+// WithLabelValues returns the child for labelValues, creating it if needed.
+// Like its client_golang counterpart, it panics if the number of values does
+// not match the label names or a value is not valid UTF-8, so that an invalid
+// value fails the recording rather than every later scrape.
+func (v *shardedVec[C]) WithLabelValues(labelValues ...string) C {
+	if len(labelValues) != len(v.labelNames) {
+		panic("metrics: inconsistent label cardinality for " + v.desc.String())
+	}
+	for _, value := range labelValues {
+		if !utf8.ValidString(value) {
+			panic(fmt.Sprintf("metrics: label value %q is not valid UTF-8 for %s", value, v.desc))
+		}
+	}
+	key := strings.Join(labelValues, "\xff")
+	v.mu.RLock()
+	c, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return c.child
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok := v.children[key]; ok {
+		return c.child
+	}
+	c = &shardedChild[C]{labelValues: append([]string(nil), labelValues...), child: v.newChild()}
+	v.children[key] = c
+	return c.child
+}
+
+// DeletePartialMatch deletes the children whose labels include labels and
+// returns how many were deleted.
+func (v *shardedVec[C]) DeletePartialMatch(labels prometheus.Labels) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	deleted := 0
+	for key, c := range v.children {
+		if v.matches(c.labelValues, labels) {
+			delete(v.children, key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// matches reports whether labelValues has the values of labels.
+func (v *shardedVec[C]) matches(labelValues []string, labels prometheus.Labels) bool {
+	for name, value := range labels {
+		i := 0
+		for i < len(v.labelNames) && v.labelNames[i] != name {
+			i++
+		}
+		if i == len(v.labelNames) || labelValues[i] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Describe implements prometheus.Collector.
+func (v *shardedVec[C]) Describe(ch chan<- *prometheus.Desc) {
+	ch <- v.desc
+}
+
+// Collect implements prometheus.Collector, merging the shards of each child.
+func (v *shardedVec[C]) Collect(ch chan<- prometheus.Metric) {
+	v.mu.RLock()
+	children := make([]*shardedChild[C], 0, len(v.children))
+	for _, c := range v.children {
+		children = append(children, c)
+	}
+	v.mu.RUnlock()
+
+	for _, c := range children {
+		ch <- v.metric(v.desc, c.child, c.labelValues)
+	}
+}
@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestShardedRecording(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithShardedRecording())
+	handler := metrics.Instrument(http.NotFoundHandler())
+	for i := 0; i < 10; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/sharded", nil))
+	}
+
+	families, err := metrics.Gatherer().Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %v", err)
+	}
+	requests := gatheredFamily(t, families, "nexen_service_http_requests_total")
+	if len(requests.Metric) != 1 || requests.Metric[0].GetCounter().GetValue() != 10 {
+		t.Fatalf("Expected one request series counting 10, got %v", requests.Metric)
+	}
+	duration := gatheredFamily(t, families, "nexen_service_http_request_duration_seconds")
+	if duration.GetType() != dto.MetricType_HISTOGRAM || len(duration.Metric) != 1 || duration.Metric[0].GetHistogram().GetSampleCount() != 10 {
+		t.Fatalf("Expected one duration series with 10 observations, got %v", duration.Metric)
+	}
+	if metrics.HTTPDurationCollector() != metrics.shardedDuration {
+		t.Fatal("Expected HTTPDurationCollector to return the sharded histogram")
+	}
+}
+
+func TestShardedRecordingWithExemplars(t *testing.T) {
+	metrics := New(WithShardedRecording(), WithExemplars(true))
+	if metrics.shardedRequests == nil {
+		t.Fatal("Expected requests to be sharded")
+	}
+	if metrics.shardedDuration != nil || metrics.httpDuration == nil {
+		t.Fatal("Expected durations to use a client_golang histogram with exemplars")
+	}
+}
+
+func TestShardedRecordingExpiry(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithShardedRecording(), WithMetricTTL(time.Minute))
+	defer metrics.Close(context.Background())
+	metrics.Instrument(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/old", nil))
+
+	metrics.expireSeries(time.Now().Add(2 * time.Minute))
+
+	if n := len(metrics.shardedRequests.children); n != 0 {
+		t.Fatalf("Expected expired request series to be deleted, got %d", n)
+	}
+	if n := len(metrics.shardedDuration.children); n != 0 {
+		t.Fatalf("Expected expired duration series to be deleted, got %d", n)
+	}
+}
+
+func TestShardedHistogram(t *testing.T) {
+	h := newShardedHistogram([]float64{0.1, 1})
+	// Shards are summed in any order, so use values whose sums are exact
+	for _, v := range []float64{0.0625, 0.125, 0.5, 2, 3} {
+		h.Observe(v)
+	}
+
+	desc := prometheus.NewDesc("test", "help", []string{"path"}, nil)
+	var out dto.Metric
+	if err := h.metric(desc, []string{"/"}).Write(&out); err != nil {
+		t.Fatalf("Failed to write histogram: %v", err)
+	}
+	hist := out.GetHistogram()
+	if hist.GetSampleCount() != 5 || hist.GetSampleSum() != 5.6875 {
+		t.Fatalf("Expected count 5 and sum 5.6875, got %d and %v", hist.GetSampleCount(), hist.GetSampleSum())
+	}
+	for i, want := range []uint64{1, 3} {
+		if got := hist.Bucket[i].GetCumulativeCount(); got != want {
+			t.Fatalf("Expected bucket %v to hold %d, got %d", hist.Bucket[i].GetUpperBound(), want, got)
+		}
+	}
+}
+
+func TestShardedVecDeletePartialMatch(t *testing.T) {
+	vec := newShardedCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"method", "path"})
+	vec.WithLabelValues("GET", "/a").Inc()
+	vec.WithLabelValues("POST", "/a").Inc()
+	vec.WithLabelValues("GET", "/b").Inc()
+
+	if n := vec.DeletePartialMatch(prometheus.Labels{"path": "/a"}); n != 2 {
+		t.Fatalf("Expected 2 deleted series, got %d", n)
+	}
+	if n := vec.DeletePartialMatch(prometheus.Labels{"code": "200"}); n != 0 {
+		t.Fatalf("Expected no series to match an unknown label, got %d", n)
+	}
+	if got := vec.WithLabelValues("GET", "/b").value(); got != 1 {
+		t.Fatalf("Expected the remaining series to count 1, got %d", got)
+	}
+}
+
+func TestShardedVecInvalidLabelValue(t *testing.T) {
+	vec := newShardedCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"path"})
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Expected WithLabelValues to panic on invalid UTF-8")
+			}
+		}()
+		vec.WithLabelValues("/\xff")
+	}()
+	if n := len(vec.children); n != 0 {
+		t.Fatalf("Expected no series for the invalid value, got %d", n)
+	}
+
+	// Collect reports a child it cannot represent instead of panicking
+	vec.children["invalid"] = &shardedChild[*shardedCounter]{labelValues: []string{"/\xff"}, child: newShardedCounter()}
+	ch := make(chan prometheus.Metric, 1)
+	vec.Collect(ch)
+	var out dto.Metric
+	if err := (<-ch).Write(&out); err == nil {
+		t.Fatal("Expected an invalid metric for the invalid label value")
+	}
+}
+
+// BenchmarkRecordHTTP compares recording a completed request with the default
+// client_golang metrics and with WithShardedRecording. Run it with -cpu to see
+// the effect of contention, which sharding avoids.
+func BenchmarkRecordHTTP(b *testing.B) {
+	obs := httpObservation{method: "GET", path: "/api/v1/users", service: "bench-service", status: http.StatusOK, elapsed: 100 * time.Millisecond}
+
+	for _, bench := range []struct {
+		name string
+		opts []Option
+	}{
+		{"direct", nil},
+		{"sharded", []Option{WithShardedRecording()}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			m := New(append(bench.opts, WithServiceName("bench-service"), WithoutRequestSizeHistogram(), WithoutResponseSizeHistogram())...)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					m.observeHTTP(obs)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkCounter compares a client_golang counter with a sharded counter
+// incremented concurrently.
+func BenchmarkCounter(b *testing.B) {
+	b.Run("direct", func(b *testing.B) {
+		c := prometheus.NewCounter(prometheus.CounterOpts{Name: "bench"})
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				c.Inc()
+			}
+		})
+	})
+	b.Run("sharded", func(b *testing.B) {
+		c := newShardedCounter()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				c.Inc()
+			}
+		})
+	})
+}
+
+func TestShardCount(t *testing.T) {
+	for _, procs := range []int{1, 3, 16, 64} {
+		prev := runtime.GOMAXPROCS(procs)
+		n := shardCount()
+		runtime.GOMAXPROCS(prev)
+		if n < min(procs, maxShards) || n > maxShards || n&(n-1) != 0 {
+			t.Errorf("Expected a power of two between %d and %d shards for %d processors, got %d", min(procs, maxShards), maxShards, procs, n)
+		}
+	}
+}
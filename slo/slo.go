@@ -0,0 +1,298 @@
+// Package slo derives latency SLO metrics from the HTTP duration histogram of
+// a Metrics instance: good and bad event counters and multi-window burn rates,
+// ready for the alerting rules of the multiwindow, multi-burn-rate approach.
+package slo
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// DefaultWindows are the burn rate windows used unless WithWindows is given.
+var DefaultWindows = []time.Duration{5 * time.Minute, 30 * time.Minute, time.Hour, 6 * time.Hour}
+
+// Objective declares a latency SLO: Target of the requests matching Match
+// complete within Threshold.
+type Objective struct {
+	// Name is the value of the slo label.
+	Name string
+	// Target is the fraction of good requests, e.g. 0.99.
+	Target float64
+	// Threshold is the latency of a good request. It must be a bucket
+	// boundary of the HTTP duration histogram.
+	Threshold time.Duration
+	// Match restricts the objective to requests with these label values of
+	// the HTTP duration histogram, e.g. {"path": "/api/orders"}. All requests
+	// count if empty.
+	Match map[string]string
+}
+
+// Option configures a Tracker.
+type Option func(*Tracker)
+
+// WithWindows sets the windows burn rates are computed over.
+func WithWindows(windows ...time.Duration) Option {
+	return func(t *Tracker) {
+		t.windows = windows
+	}
+}
+
+// Tracker exports the SLO metrics of a set of objectives.
+type Tracker struct {
+	source     prometheus.Collector
+	objectives []Objective
+	windows    []time.Duration
+	service    string
+	now        func() time.Time
+
+	events    *prometheus.Desc
+	burnRate  *prometheus.Desc
+	objective *prometheus.Desc
+
+	mu      sync.Mutex
+	history []sample
+}
+
+// sample holds the cumulative good and total request counts of each objective
+// at one point in time.
+type sample struct {
+	at    time.Time
+	good  []float64
+	total []float64
+}
+
+// New registers a tracker for objectives with m, exporting:
+//
+//   - nexen_service_slo_events_total{slo, result}: requests within ("good")
+//     and above ("bad") the threshold
+//   - nexen_service_slo_burn_rate{slo, window}: the ratio of bad requests in
+//     the window to the error budget, 1 - target
+//   - nexen_service_slo_objective{slo}: the target
+//
+// Burn rates are computed from the counts seen at previous scrapes, so windows
+// only cover the time since the process started until it has run for as long
+// as the window. It returns an error if an objective is invalid or its
+// threshold is not a bucket boundary of the histogram.
+func New(m *metrics.Metrics, objectives []Objective, opts ...Option) (*Tracker, error) {
+	source := m.HTTPDurationCollector()
+	if source == nil {
+		return nil, errors.New("invalid SLO: HTTP metrics are disabled")
+	}
+	t := &Tracker{
+		source:     source,
+		objectives: objectives,
+		windows:    DefaultWindows,
+		service:    m.ServiceName(),
+		now:        time.Now,
+		events: prometheus.NewDesc(
+			prometheus.BuildFQName("nexen", "service", "slo_events_total"),
+			"Total number of requests within (good) and above (bad) the latency threshold of an SLO",
+			[]string{"slo", "result", "service"}, nil,
+		),
+		burnRate: prometheus.NewDesc(
+			prometheus.BuildFQName("nexen", "service", "slo_burn_rate"),
+			"Rate at which the error budget of an SLO is consumed over a window, 1 meaning exactly on budget",
+			[]string{"slo", "window", "service"}, nil,
+		),
+		objective: prometheus.NewDesc(
+			prometheus.BuildFQName("nexen", "service", "slo_objective"),
+			"Target fraction of good requests of an SLO",
+			[]string{"slo", "service"}, nil,
+		),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.windows = slices.Clone(t.windows)
+	slices.Sort(t.windows)
+
+	if err := validate(objectives, m.HistogramBuckets()); err != nil {
+		return nil, fmt.Errorf("invalid SLO: %w", err)
+	}
+	if err := m.Register(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Objectives returns the objectives of the tracker.
+func (t *Tracker) Objectives() []Objective {
+	return slices.Clone(t.objectives)
+}
+
+// Windows returns the burn rate windows of the tracker, shortest first.
+func (t *Tracker) Windows() []time.Duration {
+	return slices.Clone(t.windows)
+}
+
+// validate reports every invalid objective.
+func validate(objectives []Objective, buckets []float64) error {
+	var errs []error
+	seen := make(map[string]bool, len(objectives))
+	for _, o := range objectives {
+		switch {
+		case o.Name == "":
+			errs = append(errs, errors.New("objective without a name"))
+			continue
+		case seen[o.Name]:
+			errs = append(errs, fmt.Errorf("objective %s: defined more than once", o.Name))
+		}
+		seen[o.Name] = true
+		if o.Target <= 0 || o.Target >= 1 {
+			errs = append(errs, fmt.Errorf("objective %s: target %v must be between 0 and 1", o.Name, o.Target))
+		}
+		if !slices.Contains(buckets, o.Threshold.Seconds()) {
+			errs = append(errs, fmt.Errorf("objective %s: threshold %v is not a bucket boundary of the HTTP duration histogram", o.Name, o.Threshold))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Describe implements prometheus.Collector.
+func (t *Tracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.events
+	ch <- t.burnRate
+	ch <- t.objective
+}
+
+// Collect implements prometheus.Collector. Each scrape records the current
+// counts, from which the burn rates are computed.
+func (t *Tracker) Collect(ch chan<- prometheus.Metric) {
+	current := t.snapshot()
+
+	t.mu.Lock()
+	t.history = append(t.history, current)
+	t.prune(current.at)
+	bases := make([]sample, len(t.windows))
+	for i, window := range t.windows {
+		bases[i] = t.base(current.at.Add(-window))
+	}
+	t.mu.Unlock()
+
+	for i, o := range t.objectives {
+		good, total := current.good[i], current.total[i]
+		ch <- prometheus.MustNewConstMetric(t.events, prometheus.CounterValue, good, o.Name, "good", t.service)
+		ch <- prometheus.MustNewConstMetric(t.events, prometheus.CounterValue, total-good, o.Name, "bad", t.service)
+		ch <- prometheus.MustNewConstMetric(t.objective, prometheus.GaugeValue, o.Target, o.Name, t.service)
+
+		for w, window := range t.windows {
+			rate := burnRate(bases[w], current, i, o.Target)
+			ch <- prometheus.MustNewConstMetric(t.burnRate, prometheus.GaugeValue, rate, o.Name, FormatWindow(window), t.service)
+		}
+	}
+}
+
+// snapshot reads the cumulative counts of every objective from the histogram.
+func (t *Tracker) snapshot() sample {
+	s := sample{
+		at:    t.now(),
+		good:  make([]float64, len(t.objectives)),
+		total: make([]float64, len(t.objectives)),
+	}
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		t.source.Collect(ch)
+		close(ch)
+	}()
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil || m.Histogram == nil {
+			continue
+		}
+		for i, o := range t.objectives {
+			if !matches(m.GetLabel(), o.Match) {
+				continue
+			}
+			s.total[i] += float64(m.Histogram.GetSampleCount())
+			s.good[i] += goodCount(m.Histogram, o.Threshold.Seconds())
+		}
+	}
+	return s
+}
+
+// matches reports whether labels include every pair of match.
+func matches(labels []*dto.LabelPair, match map[string]string) bool {
+	found := 0
+	for _, l := range labels {
+		if want, ok := match[l.GetName()]; ok {
+			if l.GetValue() != want {
+				return false
+			}
+			found++
+		}
+	}
+	return found == len(match)
+}
+
+// goodCount returns the number of observations at or below threshold.
+func goodCount(h *dto.Histogram, threshold float64) float64 {
+	for _, b := range h.GetBucket() {
+		if b.GetUpperBound() == threshold {
+			return float64(b.GetCumulativeCount())
+		}
+	}
+	return 0
+}
+
+// prune drops the samples no longer needed for the longest window, keeping
+// the newest sample at or before its start.
+func (t *Tracker) prune(now time.Time) {
+	if len(t.windows) == 0 {
+		return
+	}
+	start := now.Add(-t.windows[len(t.windows)-1])
+	keep := sort.Search(len(t.history), func(i int) bool {
+		return t.history[i].at.After(start)
+	})
+	if keep > 1 {
+		t.history = slices.Delete(t.history, 0, keep-1)
+	}
+}
+
+// base returns the newest sample at or before start, or the oldest sample if
+// there is none yet.
+func (t *Tracker) base(start time.Time) sample {
+	i := sort.Search(len(t.history), func(i int) bool {
+		return t.history[i].at.After(start)
+	})
+	if i == 0 {
+		return t.history[0]
+	}
+	return t.history[i-1]
+}
+
+// burnRate returns the burn rate of objective i between base and current.
+// Counts that decreased, because series were deleted or the histogram was
+// reset, are taken as starting from zero.
+func burnRate(base, current sample, i int, target float64) float64 {
+	good, total := current.good[i]-base.good[i], current.total[i]-base.total[i]
+	if total < 0 || good < 0 {
+		good, total = current.good[i], current.total[i]
+	}
+	if total == 0 {
+		return 0
+	}
+	return (total - good) / total / (1 - target)
+}
+
+// FormatWindow renders a window as the value of the window label, a
+// Prometheus duration such as "5m" or "6h".
+func FormatWindow(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
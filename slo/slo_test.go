@@ -0,0 +1,82 @@
+package slo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTracker(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("test"))
+	tracker, err := New(m, []Objective{
+		{Name: "api-latency", Target: 0.75, Threshold: 250 * time.Millisecond, Match: map[string]string{"path": "/api"}},
+	}, WithWindows(5*time.Minute, time.Hour))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	now := time.Now()
+	tracker.now = func() time.Time { return now }
+
+	handler := func(delay time.Duration) http.Handler {
+		return m.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+		}))
+	}
+	fast, slow := handler(0), handler(300*time.Millisecond)
+	serve := func(h http.Handler, path string, n int) {
+		for i := 0; i < n; i++ {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		}
+	}
+
+	testutil.CollectAndCount(tracker)
+
+	// First 55 minutes: 1 slow request in 4, exactly on budget
+	serve(fast, "/api", 3)
+	serve(slow, "/api", 1)
+	serve(slow, "/other", 1)
+	now = now.Add(55 * time.Minute)
+	testutil.CollectAndCount(tracker)
+	now = now.Add(5 * time.Minute)
+	serve(slow, "/api", 2)
+
+	expected := `
+# HELP nexen_service_slo_burn_rate Rate at which the error budget of an SLO is consumed over a window, 1 meaning exactly on budget
+# TYPE nexen_service_slo_burn_rate gauge
+nexen_service_slo_burn_rate{service="test",slo="api-latency",window="1h"} 2
+nexen_service_slo_burn_rate{service="test",slo="api-latency",window="5m"} 4
+# HELP nexen_service_slo_events_total Total number of requests within (good) and above (bad) the latency threshold of an SLO
+# TYPE nexen_service_slo_events_total counter
+nexen_service_slo_events_total{result="bad",service="test",slo="api-latency"} 3
+nexen_service_slo_events_total{result="good",service="test",slo="api-latency"} 3
+# HELP nexen_service_slo_objective Target fraction of good requests of an SLO
+# TYPE nexen_service_slo_objective gauge
+nexen_service_slo_objective{service="test",slo="api-latency"} 0.75
+`
+	if err := testutil.CollectAndCompare(tracker, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewValidatesObjectives(t *testing.T) {
+	m := metrics.New(metrics.WithHistogramBuckets([]float64{0.1, 0.3, 1}))
+	_, err := New(m, []Objective{
+		{Name: "ok", Target: 0.99, Threshold: 300 * time.Millisecond},
+		{Name: "ok", Target: 0.99, Threshold: 300 * time.Millisecond},
+		{Name: "target", Target: 99, Threshold: 300 * time.Millisecond},
+		{Name: "threshold", Target: 0.99, Threshold: 200 * time.Millisecond},
+	})
+	if err == nil {
+		t.Fatal("Expected invalid objectives to be rejected")
+	}
+	for _, want := range []string{"ok: defined more than once", "target 99", "threshold 200ms"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// MetricsSnapshot holds the current value of every metric exposed by Handler.
+type MetricsSnapshot struct {
+	Timestamp time.Time        `json:"timestamp"`
+	Families  []FamilySnapshot `json:"families"`
+}
+
+// FamilySnapshot holds the metrics of a metric family.
+type FamilySnapshot struct {
+	Name string `json:"name"`
+	Help string `json:"help"`
+	// Type is counter, gauge, histogram, summary or untyped.
+	Type    string           `json:"type"`
+	Metrics []MetricSnapshot `json:"metrics"`
+}
+
+// MetricSnapshot holds the value of a single label set. Counters, gauges and
+// untyped metrics have a Value; histograms and summaries have a Count, a Sum
+// and their Buckets or Quantiles.
+type MetricSnapshot struct {
+	Labels    map[string]string  `json:"labels,omitempty"`
+	Value     *SnapshotValue     `json:"value,omitempty"`
+	Count     *uint64            `json:"count,omitempty"`
+	Sum       *SnapshotValue     `json:"sum,omitempty"`
+	Buckets   []BucketSnapshot   `json:"buckets,omitempty"`
+	Quantiles []QuantileSnapshot `json:"quantiles,omitempty"`
+}
+
+// BucketSnapshot is a cumulative histogram bucket. The +Inf bucket is omitted;
+// its count is the Count of the metric.
+type BucketSnapshot struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+// QuantileSnapshot is a summary quantile.
+type QuantileSnapshot struct {
+	Quantile float64       `json:"quantile"`
+	Value    SnapshotValue `json:"value"`
+}
+
+// SnapshotValue is a sample value. It is encoded as a JSON number, or as the
+// string "NaN", "+Inf" or "-Inf", which JSON numbers cannot represent.
+type SnapshotValue float64
+
+// MarshalJSON encodes v as a number, or a string if it is not finite.
+func (v SnapshotValue) MarshalJSON() ([]byte, error) {
+	f := float64(v)
+	switch {
+	case math.IsNaN(f):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(f, +1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(f, -1):
+		return []byte(`"-Inf"`), nil
+	}
+	return strconv.AppendFloat(nil, f, 'g', -1, 64), nil
+}
+
+// UnmarshalJSON decodes a number or one of the strings of MarshalJSON.
+func (v *SnapshotValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid sample value %q", s)
+		}
+		*v = SnapshotValue(f)
+		return nil
+	}
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	*v = SnapshotValue(f)
+	return nil
+}
+
+// Snapshot returns the current value of every metric exposed by Handler, for
+// admin UIs and debug tooling that should not parse the Prometheus text
+// format. If gathering fails for some collectors, the metrics gathered from
+// the others are returned with the error.
+func (m *Metrics) Snapshot() (MetricsSnapshot, error) {
+	families, err := m.gatherer.Gather()
+	snapshot := MetricsSnapshot{
+		Timestamp: m.now(),
+		Families:  make([]FamilySnapshot, 0, len(families)),
+	}
+	for _, mf := range families {
+		snapshot.Families = append(snapshot.Families, familySnapshot(mf))
+	}
+	if err != nil {
+		return snapshot, fmt.Errorf("failed to gather metrics: %w", err)
+	}
+	return snapshot, nil
+}
+
+// SnapshotHandler returns a handler serving Snapshot as JSON. Serve exposes it
+// next to the metrics path, at /metrics.json by default.
+func (m *Metrics) SnapshotHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		snapshot, err := m.Snapshot()
+		if err != nil && len(snapshot.Families) == 0 {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(snapshot)
+	})
+}
+
+func familySnapshot(mf *dto.MetricFamily) FamilySnapshot {
+	family := FamilySnapshot{
+		Name:    mf.GetName(),
+		Help:    mf.GetHelp(),
+		Type:    snapshotType(mf.GetType()),
+		Metrics: make([]MetricSnapshot, 0, len(mf.GetMetric())),
+	}
+	value := func(f float64) *SnapshotValue {
+		v := SnapshotValue(f)
+		return &v
+	}
+	for _, metric := range mf.GetMetric() {
+		s := MetricSnapshot{}
+		if len(metric.GetLabel()) > 0 {
+			s.Labels = make(map[string]string, len(metric.GetLabel()))
+			for _, l := range metric.GetLabel() {
+				s.Labels[l.GetName()] = l.GetValue()
+			}
+		}
+
+		switch {
+		case metric.Counter != nil:
+			s.Value = value(metric.GetCounter().GetValue())
+		case metric.Gauge != nil:
+			s.Value = value(metric.GetGauge().GetValue())
+		case metric.Untyped != nil:
+			s.Value = value(metric.GetUntyped().GetValue())
+		case metric.Histogram != nil:
+			h := metric.GetHistogram()
+			count := h.GetSampleCount()
+			s.Count, s.Sum = &count, value(h.GetSampleSum())
+			for _, b := range h.GetBucket() {
+				if !math.IsInf(b.GetUpperBound(), +1) {
+					s.Buckets = append(s.Buckets, BucketSnapshot{UpperBound: b.GetUpperBound(), Count: b.GetCumulativeCount()})
+				}
+			}
+		case metric.Summary != nil:
+			summary := metric.GetSummary()
+			count := summary.GetSampleCount()
+			s.Count, s.Sum = &count, value(summary.GetSampleSum())
+			for _, q := range summary.GetQuantile() {
+				s.Quantiles = append(s.Quantiles, QuantileSnapshot{Quantile: q.GetQuantile(), Value: SnapshotValue(q.GetValue())})
+			}
+		}
+		family.Metrics = append(family.Metrics, s)
+	}
+	return family
+}
+
+func snapshotType(t dto.MetricType) string {
+	switch t {
+	case dto.MetricType_COUNTER:
+		return "counter"
+	case dto.MetricType_GAUGE:
+		return "gauge"
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		return "histogram"
+	case dto.MetricType_SUMMARY:
+		return "summary"
+	default:
+		return "untyped"
+	}
+}
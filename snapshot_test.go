@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	metrics.RecordEvent("signup")
+	latency, err := metrics.RegisterHistogram("job_seconds", "Job latency", []float64{0.1, 1}, nil)
+	if err != nil {
+		t.Fatalf("RegisterHistogram: %v", err)
+	}
+	latency.WithLabelValues("test-service").Observe(0.5)
+	ratio, err := metrics.RegisterGauge("ratio", "Ratio", nil)
+	if err != nil {
+		t.Fatalf("RegisterGauge: %v", err)
+	}
+	ratio.WithLabelValues("test-service").Set(math.NaN())
+
+	w := httptest.NewRecorder()
+	metrics.SnapshotHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics.json", nil))
+	var snapshot MetricsSnapshot
+	if err := json.NewDecoder(w.Body).Decode(&snapshot); err != nil {
+		t.Fatalf("Failed to decode snapshot: %v", err)
+	}
+
+	families := make(map[string]FamilySnapshot)
+	for _, f := range snapshot.Families {
+		families[f.Name] = f
+	}
+	events := families["nexen_service_application_events_total"]
+	if events.Type != "counter" || len(events.Metrics) != 1 {
+		t.Fatalf("Expected one event counter, got %+v", events)
+	}
+	if m := events.Metrics[0]; m.Labels["event"] != "signup" || m.Value == nil || *m.Value != 1 {
+		t.Errorf("Expected the signup event with value 1, got %+v", m)
+	}
+
+	job := families["nexen_service_job_seconds"]
+	if job.Type != "histogram" || len(job.Metrics) != 1 {
+		t.Fatalf("Expected one histogram, got %+v", job)
+	}
+	m := job.Metrics[0]
+	if m.Count == nil || *m.Count != 1 || m.Sum == nil || *m.Sum != 0.5 {
+		t.Errorf("Expected count 1 and sum 0.5, got %+v", m)
+	}
+	if len(m.Buckets) != 2 || m.Buckets[0].Count != 0 || m.Buckets[1] != (BucketSnapshot{UpperBound: 1, Count: 1}) {
+		t.Errorf("Expected cumulative buckets without +Inf, got %+v", m.Buckets)
+	}
+
+	if r := families["nexen_service_ratio"].Metrics; len(r) != 1 || r[0].Value == nil || !math.IsNaN(float64(*r[0].Value)) {
+		t.Errorf("Expected NaN to round-trip, got %+v", r)
+	}
+}
@@ -0,0 +1,253 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// StatsDFormat selects how a StatsD bridge maps labels.
+type StatsDFormat int
+
+const (
+	// PlainStatsD appends labels to the metric name, as in
+	// prefix.name.label.value:1|c.
+	PlainStatsD StatsDFormat = iota
+	// DogStatsD sends labels as tags, as in prefix.name:1|c|#label:value.
+	DogStatsD
+)
+
+// maxStatsDPacket keeps datagrams within a typical network MTU.
+const maxStatsDPacket = 1432
+
+// StatsDBridge creates a Bridge mirroring the metrics exposed by Handler to the
+// StatsD or DogStatsD agent at address (host:port) over UDP every interval,
+// with metric names prefixed by prefix. Counters are sent as the increments
+// since the previous push, gauges as their current value, and histogram
+// observations at bucket resolution, each as its bucket's upper bound with a
+// sample rate standing for the number of observations. Summaries send their
+// quantiles as gauges and their sum and count as counters. The Prometheus
+// endpoint is unaffected. A non-positive interval defaults to 15s.
+func (m *Metrics) StatsDBridge(address string, interval time.Duration, prefix string, format StatsDFormat) (*Bridge, error) {
+	interval = positiveInterval(interval, defaultInterval)
+	if address == "" {
+		return nil, errors.New("failed to create statsd bridge: missing address")
+	}
+	s := &statsdEmitter{
+		gatherer: m.gatherer,
+		address:  address,
+		prefix:   prefix,
+		format:   format,
+		last:     map[string]float64{},
+	}
+	return &Bridge{m: m, run: runEvery(interval, s.push), push: s.push}, nil
+}
+
+// statsdEmitter converts gathered metrics into StatsD datagrams, remembering
+// the counter values of the previous push to send increments.
+type statsdEmitter struct {
+	gatherer prometheus.Gatherer
+	address  string
+	prefix   string
+	format   StatsDFormat
+
+	mu   sync.Mutex
+	last map[string]float64
+}
+
+// push gathers the metrics and sends them in as few datagrams as possible.
+func (s *statsdEmitter) push() error {
+	families, err := s.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %w", err)
+	}
+
+	s.mu.Lock()
+	var lines []string
+	for _, mf := range families {
+		lines = s.appendFamily(lines, mf)
+	}
+	s.mu.Unlock()
+
+	conn, err := net.Dial("udp", s.address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to statsd: %w", err)
+	}
+	defer conn.Close()
+
+	var packet []byte
+	flush := func() error {
+		if len(packet) == 0 {
+			return nil
+		}
+		_, err := conn.Write(packet)
+		packet = packet[:0]
+		return err
+	}
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+1+len(line) > maxStatsDPacket {
+			if err := flush(); err != nil {
+				return fmt.Errorf("failed to send statsd datagram: %w", err)
+			}
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("failed to send statsd datagram: %w", err)
+	}
+	return nil
+}
+
+// appendFamily appends the lines of all metrics of mf.
+func (s *statsdEmitter) appendFamily(lines []string, mf *dto.MetricFamily) []string {
+	name := mf.GetName()
+	for _, metric := range mf.GetMetric() {
+		labels := make([][2]string, 0, len(metric.GetLabel())+1)
+		for _, l := range metric.GetLabel() {
+			labels = append(labels, [2]string{l.GetName(), l.GetValue()})
+		}
+
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			lines = s.appendCounter(lines, s.key(name, labels), metric.GetCounter().GetValue())
+		case dto.MetricType_GAUGE:
+			lines = s.appendGauge(lines, s.key(name, labels), metric.GetGauge().GetValue())
+		case dto.MetricType_UNTYPED:
+			lines = s.appendGauge(lines, s.key(name, labels), metric.GetUntyped().GetValue())
+		case dto.MetricType_SUMMARY:
+			summary := metric.GetSummary()
+			for _, q := range summary.GetQuantile() {
+				quantile := append(labels, [2]string{"quantile", strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64)})
+				lines = s.appendGauge(lines, s.key(name, quantile), q.GetValue())
+			}
+			lines = s.appendCounter(lines, s.key(name+"_sum", labels), summary.GetSampleSum())
+			lines = s.appendCounter(lines, s.key(name+"_count", labels), float64(summary.GetSampleCount()))
+		case dto.MetricType_HISTOGRAM:
+			lines = s.appendHistogram(lines, s.key(name, labels), metric.GetHistogram())
+		}
+	}
+	return lines
+}
+
+// statsdKey is the name and tags of a StatsD metric.
+type statsdKey struct {
+	name, tags string
+}
+
+// key maps a metric name and its labels to a StatsD name and tags.
+func (s *statsdEmitter) key(name string, labels [][2]string) statsdKey {
+	var b strings.Builder
+	if s.prefix != "" {
+		b.WriteString(s.prefix)
+		b.WriteByte('.')
+	}
+	b.WriteString(name)
+	if s.format == PlainStatsD {
+		for _, l := range labels {
+			b.WriteByte('.')
+			b.WriteString(l[0])
+			b.WriteByte('.')
+			b.WriteString(statsdSanitize(l[1], true))
+		}
+		return statsdKey{name: b.String()}
+	}
+
+	var tags strings.Builder
+	for i, l := range labels {
+		if i == 0 {
+			tags.WriteString("|#")
+		} else {
+			tags.WriteByte(',')
+		}
+		tags.WriteString(l[0])
+		tags.WriteByte(':')
+		tags.WriteString(statsdSanitize(l[1], false))
+	}
+	return statsdKey{name: b.String(), tags: tags.String()}
+}
+
+// statsdSanitize replaces the characters of a label value that StatsD would
+// misparse. Plain names also avoid dots, which separate path segments.
+func statsdSanitize(value string, plain bool) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', '\n', ' ':
+			return '_'
+		case '.':
+			if plain {
+				return '_'
+			}
+		}
+		return r
+	}, value)
+}
+
+func (k statsdKey) line(value float64, kind string, rate float64) string {
+	line := k.name + ":" + strconv.FormatFloat(value, 'g', -1, 64) + "|" + kind
+	if rate < 1 {
+		line += "|@" + strconv.FormatFloat(rate, 'g', -1, 64)
+	}
+	return line + k.tags
+}
+
+// delta returns the increase of a counter since the previous push. The first
+// push and counter resets send the full value.
+func (s *statsdEmitter) delta(key string, value float64) float64 {
+	prev, ok := s.last[key]
+	s.last[key] = value
+	if !ok || value < prev {
+		return value
+	}
+	return value - prev
+}
+
+func (s *statsdEmitter) appendCounter(lines []string, k statsdKey, value float64) []string {
+	if d := s.delta(k.name+k.tags, value); d > 0 {
+		lines = append(lines, k.line(d, "c", 1))
+	}
+	return lines
+}
+
+func (s *statsdEmitter) appendGauge(lines []string, k statsdKey, value float64) []string {
+	if value < 0 && s.format == PlainStatsD {
+		// A leading sign makes plain StatsD adjust the gauge instead of setting it.
+		lines = append(lines, k.line(0, "g", 1))
+	}
+	return append(lines, k.line(value, "g", 1))
+}
+
+// appendHistogram sends the observations of each bucket since the previous
+// push as one sample of the bucket's upper bound, with a sample rate of one
+// over the number of observations. Observations above the highest bound are
+// sent as that bound.
+func (s *statsdEmitter) appendHistogram(lines []string, k statsdKey, h *dto.Histogram) []string {
+	var cumulative uint64
+	bound := 0.0
+	observe := func(count uint64, upper float64) {
+		d := s.delta(k.name+k.tags+"|le="+strconv.FormatFloat(upper, 'g', -1, 64), float64(count))
+		if d > 0 {
+			lines = append(lines, k.line(bound, "h", 1/d))
+		}
+	}
+	for _, b := range h.GetBucket() {
+		if math.IsInf(b.GetUpperBound(), +1) {
+			continue
+		}
+		bound = b.GetUpperBound()
+		observe(b.GetCumulativeCount()-cumulative, bound)
+		cumulative = b.GetCumulativeCount()
+	}
+	observe(h.GetSampleCount()-cumulative, math.Inf(+1))
+	return lines
+}
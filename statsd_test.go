@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// listenStatsD returns the address of a local UDP listener and a function
+// reading the lines of the datagrams received within 100ms.
+func listenStatsD(t *testing.T) (string, func() []string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	read := func() []string {
+		var lines []string
+		buf := make([]byte, 64*1024)
+		_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return lines
+			}
+			if n > maxStatsDPacket {
+				t.Errorf("Expected datagrams of at most %d bytes, got %d", maxStatsDPacket, n)
+			}
+			lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+		}
+	}
+	return conn.LocalAddr().String(), read
+}
+
+func containsLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
+
+func TestStatsDBridge(t *testing.T) {
+	addr, read := listenStatsD(t)
+
+	metrics := New(WithServiceName("test-service"))
+	latency, err := metrics.RegisterHistogram("job_seconds", "Job latency", []float64{0.1, 1}, nil)
+	if err != nil {
+		t.Fatalf("RegisterHistogram: %v", err)
+	}
+	temperature, err := metrics.RegisterGauge("temperature", "Temperature", nil)
+	if err != nil {
+		t.Fatalf("RegisterGauge: %v", err)
+	}
+	metrics.RecordEvent("signup")
+	metrics.RecordEvent("signup")
+	latency.WithLabelValues("test-service").Observe(0.5)
+	latency.WithLabelValues("test-service").Observe(0.7)
+	temperature.WithLabelValues("test-service").Set(-3)
+
+	bridge, err := metrics.StatsDBridge(addr, time.Hour, "legacy", DogStatsD)
+	if err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+	if err := bridge.Push(); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	lines := read()
+	for _, expected := range []string{
+		"legacy.nexen_service_application_events_total:2|c|#event:signup,service:test-service",
+		"legacy.nexen_service_job_seconds:1|h|@0.5|#service:test-service",
+		"legacy.nexen_service_temperature:-3|g|#service:test-service",
+	} {
+		if !containsLine(lines, expected) {
+			t.Errorf("Expected %q in %q", expected, lines)
+		}
+	}
+
+	metrics.RecordEvent("signup")
+	if err := bridge.Push(); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	lines = read()
+	if !containsLine(lines, "legacy.nexen_service_application_events_total:1|c|#event:signup,service:test-service") {
+		t.Errorf("Expected the increment since the previous push, got %q", lines)
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "legacy.nexen_service_job_seconds:") {
+			t.Errorf("Expected no unchanged histogram buckets, got %q", line)
+		}
+	}
+}
+
+func TestStatsDBridgePlain(t *testing.T) {
+	addr, read := listenStatsD(t)
+
+	registry := prometheus.NewRegistry()
+	metrics := New(WithServiceName("api.eu"), WithRegistry(registry))
+	temperature, err := metrics.RegisterGauge("temperature", "Temperature", []string{"room"})
+	if err != nil {
+		t.Fatalf("RegisterGauge: %v", err)
+	}
+	temperature.WithLabelValues("lab:1", "api.eu").Set(-3)
+
+	bridge, err := metrics.StatsDBridge(addr, 10*time.Millisecond, "", PlainStatsD)
+	if err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+	bridge.Start()
+	defer bridge.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		lines := read()
+		if containsLine(lines, "nexen_service_temperature.room.lab_1.service.api_eu:-3|g") {
+			if !containsLine(lines, "nexen_service_temperature.room.lab_1.service.api_eu:0|g") {
+				t.Errorf("Expected a negative gauge to be reset to 0 first, got %q", lines)
+			}
+			return
+		}
+	}
+	t.Fatal("Timed out waiting for statsd push")
+}
+
+func TestStatsDBridgeRequiresAddress(t *testing.T) {
+	if _, err := New().StatsDBridge("", time.Second, "", DogStatsD); err == nil {
+		t.Fatal("Expected an error for an empty address")
+	}
+}
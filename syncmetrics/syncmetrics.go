@@ -0,0 +1,245 @@
+// Package syncmetrics provides mutexes and a semaphore that record how long
+// goroutines wait to acquire them and how long they are held, labeled by a
+// name, to diagnose contention.
+package syncmetrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// durationBuckets cover waits and holds from a microsecond to ten seconds.
+var durationBuckets = []float64{1e-6, 1e-5, 1e-4, 0.001, 0.005, 0.025, 0.1, 0.5, 1, 5, 10}
+
+// Values of the mode label of the lock metrics.
+const (
+	modeWrite = "write"
+	modeRead  = "read"
+)
+
+// histograms registers the wait and hold histograms with the given prefix and
+// label names, or returns the already registered ones.
+func histograms(m *metrics.Metrics, prefix, what string, labels []string) (wait, hold *prometheus.HistogramVec, err error) {
+	wait, err = m.GetOrRegisterHistogram(prefix+"_wait_seconds", "Histogram of the time spent waiting to acquire "+what, durationBuckets, labels)
+	if err != nil {
+		return nil, nil, err
+	}
+	hold, err = m.GetOrRegisterHistogram(prefix+"_hold_seconds", "Histogram of the time "+what+" are held", durationBuckets, labels)
+	if err != nil {
+		return nil, nil, err
+	}
+	return wait, hold, nil
+}
+
+// Mutex is a sync.Mutex recording into
+//
+//   - nexen_service_lock_wait_seconds{lock, mode="write"}: time spent in Lock
+//   - nexen_service_lock_hold_seconds{lock, mode="write"}: time from
+//     acquiring the lock to Unlock
+type Mutex struct {
+	mu       sync.Mutex
+	wait     prometheus.Observer
+	hold     prometheus.Observer
+	acquired time.Time
+}
+
+// NewMutex returns a mutex recording with name as the lock label. Locks
+// created from the same Metrics share the metrics.
+func NewMutex(m *metrics.Metrics, name string) (*Mutex, error) {
+	wait, hold, err := histograms(m, "lock", "locks", []string{"lock", "mode"})
+	if err != nil {
+		return nil, err
+	}
+	service := m.ServiceName()
+	return &Mutex{
+		wait: wait.WithLabelValues(name, modeWrite, service),
+		hold: hold.WithLabelValues(name, modeWrite, service),
+	}, nil
+}
+
+// Lock locks l, recording the time spent waiting.
+func (l *Mutex) Lock() {
+	start := time.Now()
+	l.mu.Lock()
+	l.acquired = time.Now()
+	l.wait.Observe(l.acquired.Sub(start).Seconds())
+}
+
+// TryLock tries to lock l without waiting and reports whether it succeeded.
+func (l *Mutex) TryLock() bool {
+	if !l.mu.TryLock() {
+		return false
+	}
+	l.acquired = time.Now()
+	l.wait.Observe(0)
+	return true
+}
+
+// Unlock unlocks l, recording the time it was held.
+func (l *Mutex) Unlock() {
+	held := time.Since(l.acquired)
+	l.mu.Unlock()
+	l.hold.Observe(held.Seconds())
+}
+
+// RWMutex is a sync.RWMutex recording into the metrics of Mutex, with
+// mode="write" for Lock and mode="read" for RLock. The read hold time is the
+// time the lock is held by at least one reader.
+type RWMutex struct {
+	mu        sync.RWMutex
+	wait      prometheus.Observer
+	hold      prometheus.Observer
+	readWait  prometheus.Observer
+	readHold  prometheus.Observer
+	acquired  time.Time
+	readMu    sync.Mutex
+	readers   int
+	readStart time.Time
+}
+
+// NewRWMutex returns a reader/writer mutex recording with name as the lock
+// label.
+func NewRWMutex(m *metrics.Metrics, name string) (*RWMutex, error) {
+	wait, hold, err := histograms(m, "lock", "locks", []string{"lock", "mode"})
+	if err != nil {
+		return nil, err
+	}
+	service := m.ServiceName()
+	return &RWMutex{
+		wait:     wait.WithLabelValues(name, modeWrite, service),
+		hold:     hold.WithLabelValues(name, modeWrite, service),
+		readWait: wait.WithLabelValues(name, modeRead, service),
+		readHold: hold.WithLabelValues(name, modeRead, service),
+	}, nil
+}
+
+// Lock locks l for writing, recording the time spent waiting.
+func (l *RWMutex) Lock() {
+	start := time.Now()
+	l.mu.Lock()
+	l.acquired = time.Now()
+	l.wait.Observe(l.acquired.Sub(start).Seconds())
+}
+
+// Unlock unlocks l for writing, recording the time it was held.
+func (l *RWMutex) Unlock() {
+	held := time.Since(l.acquired)
+	l.mu.Unlock()
+	l.hold.Observe(held.Seconds())
+}
+
+// RLock locks l for reading, recording the time spent waiting.
+func (l *RWMutex) RLock() {
+	start := time.Now()
+	l.mu.RLock()
+	now := time.Now()
+	l.readWait.Observe(now.Sub(start).Seconds())
+
+	l.readMu.Lock()
+	if l.readers == 0 {
+		l.readStart = now
+	}
+	l.readers++
+	l.readMu.Unlock()
+}
+
+// RUnlock undoes a single RLock call. The last reader out records the read
+// hold time.
+func (l *RWMutex) RUnlock() {
+	l.readMu.Lock()
+	l.readers--
+	if l.readers == 0 {
+		l.readHold.Observe(time.Since(l.readStart).Seconds())
+	}
+	l.readMu.Unlock()
+	l.mu.RUnlock()
+}
+
+// Semaphore limits concurrent access to n holders, recording into
+//
+//   - nexen_service_semaphore_wait_seconds{semaphore}: time spent in Acquire
+//   - nexen_service_semaphore_hold_seconds{semaphore}: time from acquiring a
+//     permit to releasing it
+//   - nexen_service_semaphore_in_use{semaphore}: permits currently held
+type Semaphore struct {
+	permits chan struct{}
+	wait    prometheus.Observer
+	hold    prometheus.Observer
+	inUse   prometheus.Gauge
+}
+
+// NewSemaphore returns a semaphore of n permits recording with name as the
+// semaphore label.
+func NewSemaphore(m *metrics.Metrics, name string, n int) (*Semaphore, error) {
+	if n <= 0 {
+		return nil, errors.New("semaphore needs at least one permit")
+	}
+	labels := []string{"semaphore"}
+	wait, hold, err := histograms(m, "semaphore", "semaphore permits", labels)
+	if err != nil {
+		return nil, err
+	}
+	inUse, err := m.GetOrRegisterGauge("semaphore_in_use", "Number of semaphore permits currently held", labels)
+	if err != nil {
+		return nil, err
+	}
+	service := m.ServiceName()
+	return &Semaphore{
+		permits: make(chan struct{}, n),
+		wait:    wait.WithLabelValues(name, service),
+		hold:    hold.WithLabelValues(name, service),
+		inUse:   inUse.WithLabelValues(name, service),
+	}, nil
+}
+
+// Acquire waits for a permit until ctx is done and returns the function
+// releasing it. Calls of release after the first have no effect:
+//
+//	release, err := sem.Acquire(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer release()
+func (s *Semaphore) Acquire(ctx context.Context) (release func(), err error) {
+	start := time.Now()
+	select {
+	case s.permits <- struct{}{}:
+	case <-ctx.Done():
+		s.wait.Observe(time.Since(start).Seconds())
+		return nil, ctx.Err()
+	}
+	acquired := time.Now()
+	s.wait.Observe(acquired.Sub(start).Seconds())
+	return s.acquired(acquired), nil
+}
+
+// TryAcquire takes a permit without waiting. It reports whether it succeeded,
+// returning the function releasing the permit if so.
+func (s *Semaphore) TryAcquire() (release func(), ok bool) {
+	select {
+	case s.permits <- struct{}{}:
+	default:
+		return nil, false
+	}
+	s.wait.Observe(0)
+	return s.acquired(time.Now()), true
+}
+
+// acquired counts a permit taken at start as in use and returns its release
+// function.
+func (s *Semaphore) acquired(start time.Time) func() {
+	s.inUse.Inc()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.hold.Observe(time.Since(start).Seconds())
+			s.inUse.Dec()
+			<-s.permits
+		})
+	}
+}
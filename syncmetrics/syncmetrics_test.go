@@ -0,0 +1,147 @@
+package syncmetrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	metrics "github.com/nexen-io/nexen-metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// histogram returns the observation count and sum of the series of name with
+// the given label values.
+func histogram(t *testing.T, m *metrics.Metrics, name string, labels map[string]string) (uint64, float64) {
+	t.Helper()
+	families, err := m.Gatherer().Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, metric := range mf.GetMetric() {
+			for _, l := range metric.GetLabel() {
+				if want, ok := labels[l.GetName()]; ok && want != l.GetValue() {
+					continue metrics
+				}
+			}
+			return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+		}
+	}
+	return 0, 0
+}
+
+func TestMutex(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("cache"))
+	mu, err := NewMutex(m, "entries")
+	if err != nil {
+		t.Fatalf("NewMutex: %v", err)
+	}
+	if _, err := NewMutex(m, "index"); err != nil {
+		t.Fatalf("Expected a second mutex to share the metrics: %v", err)
+	}
+
+	mu.Lock()
+	if mu.TryLock() {
+		t.Fatal("Expected TryLock to fail while locked")
+	}
+	locked := make(chan struct{})
+	go func() {
+		mu.Lock()
+		close(locked)
+		mu.Unlock()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	mu.Unlock()
+	<-locked
+	if !mu.TryLock() {
+		t.Fatal("Expected TryLock to succeed once unlocked")
+	}
+	mu.Unlock()
+
+	write := map[string]string{"lock": "entries", "mode": "write"}
+	count, sum := histogram(t, m, "nexen_service_lock_wait_seconds", write)
+	if count != 3 || sum < 0.01 {
+		t.Errorf("Expected 3 waits including the contended one, got %d summing to %v", count, sum)
+	}
+	if count, sum := histogram(t, m, "nexen_service_lock_hold_seconds", write); count != 3 || sum < 0.01 {
+		t.Errorf("Expected 3 holds including the long one, got %d summing to %v", count, sum)
+	}
+}
+
+func TestRWMutex(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("cache"))
+	mu, err := NewRWMutex(m, "entries")
+	if err != nil {
+		t.Fatalf("NewRWMutex: %v", err)
+	}
+
+	mu.RLock()
+	mu.RLock()
+	mu.RUnlock()
+	mu.RUnlock()
+	mu.Lock()
+	mu.Unlock()
+
+	read := map[string]string{"lock": "entries", "mode": "read"}
+	if count, _ := histogram(t, m, "nexen_service_lock_wait_seconds", read); count != 2 {
+		t.Errorf("Expected 2 read waits, got %d", count)
+	}
+	if count, _ := histogram(t, m, "nexen_service_lock_hold_seconds", read); count != 1 {
+		t.Errorf("Expected overlapping readers to record one hold, got %d", count)
+	}
+	write := map[string]string{"lock": "entries", "mode": "write"}
+	if count, _ := histogram(t, m, "nexen_service_lock_hold_seconds", write); count != 1 {
+		t.Errorf("Expected 1 write hold, got %d", count)
+	}
+}
+
+func TestSemaphore(t *testing.T) {
+	m := metrics.New(metrics.WithServiceName("worker"))
+	if _, err := NewSemaphore(m, "uploads", 0); err == nil {
+		t.Error("Expected a semaphore without permits to be rejected")
+	}
+	sem, err := NewSemaphore(m, "uploads", 1)
+	if err != nil {
+		t.Fatalf("NewSemaphore: %v", err)
+	}
+
+	release, err := sem.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if got := testutil.ToFloat64(sem.inUse); got != 1 {
+		t.Errorf("Expected 1 permit in use, got %v", got)
+	}
+	if _, ok := sem.TryAcquire(); ok {
+		t.Error("Expected TryAcquire to fail without free permits")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := sem.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Acquire to give up with the context, got %v", err)
+	}
+
+	release()
+	release()
+	if got := testutil.ToFloat64(sem.inUse); got != 0 {
+		t.Errorf("Expected releasing twice to free one permit, got %v in use", got)
+	}
+	release, ok := sem.TryAcquire()
+	if !ok {
+		t.Fatal("Expected TryAcquire to succeed once released")
+	}
+	release()
+
+	labels := map[string]string{"semaphore": "uploads"}
+	if count, sum := histogram(t, m, "nexen_service_semaphore_wait_seconds", labels); count != 3 || sum < 0.01 {
+		t.Errorf("Expected 3 waits including the timed out one, got %d summing to %v", count, sum)
+	}
+	if count, _ := histogram(t, m, "nexen_service_semaphore_hold_seconds", labels); count != 2 {
+		t.Errorf("Expected 2 holds, got %d", count)
+	}
+}
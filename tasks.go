@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/errgroup"
+)
+
+// Values of the result label of nexen_service_tasks_completed_total.
+const (
+	taskSuccess = "success"
+	taskError   = "error"
+	taskPanic   = "panic"
+)
+
+// taskMetrics are the metrics of background tasks, registered on the first
+// call to Go or NewGroup.
+type taskMetrics struct {
+	running   *prometheus.GaugeVec
+	completed *prometheus.CounterVec
+	duration  *prometheus.HistogramVec
+}
+
+// taskMetrics returns the task metrics, registering them on first use.
+func (m *Metrics) taskMetrics() *taskMetrics {
+	m.lazyMu.Lock()
+	defer m.lazyMu.Unlock()
+
+	if m.tasks != nil {
+		return m.tasks
+	}
+
+	tasks := &taskMetrics{
+		running: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "tasks_running",
+				Help:      "Number of running background tasks",
+			},
+			[]string{"task", "service"},
+		),
+		completed: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "tasks_completed_total",
+				Help:      "Total number of completed background tasks by result",
+			},
+			[]string{"task", "result", "service"},
+		),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "task_duration_seconds",
+				Help:      "Histogram of background task durations",
+				Buckets:   m.histogramBuckets,
+			},
+			[]string{"task", "service"},
+		),
+	}
+	m.mustRegister(tasks.running, tasks.completed, tasks.duration)
+	m.tasks = tasks
+	return tasks
+}
+
+// TaskPanicError is the error of a task that panicked.
+type TaskPanicError struct {
+	Task  string
+	Value any
+	Stack []byte
+}
+
+func (e *TaskPanicError) Error() string {
+	return fmt.Sprintf("task %s panicked: %v", e.Task, e.Value)
+}
+
+// run runs fn as the task name, recording it and turning a panic into an
+// error.
+func (t *taskMetrics) run(name, service string, now func() time.Time, fn func() error) (err error) {
+	running := t.running.WithLabelValues(name, service)
+	running.Inc()
+	start := now()
+	defer func() {
+		result := taskSuccess
+		if p := recover(); p != nil {
+			result = taskPanic
+			err = &TaskPanicError{Task: name, Value: p, Stack: debug.Stack()}
+		} else if err != nil {
+			result = taskError
+		}
+		running.Dec()
+		t.duration.WithLabelValues(name, service).Observe(now().Sub(start).Seconds())
+		t.completed.WithLabelValues(name, result, service).Inc()
+	}()
+	return fn()
+}
+
+// Go runs fn in a new goroutine as the background task name, recording:
+//
+//   - nexen_service_tasks_running{task}: running tasks
+//   - nexen_service_tasks_completed_total{task, result}: completed tasks, with
+//     result "success", "error" or "panic"
+//   - nexen_service_task_duration_seconds{task}: task durations
+//
+// The error of fn is only counted. A panic is recovered and logged with its
+// stack rather than crashing the process. Use NewGroup to wait for tasks and
+// collect their errors.
+func (m *Metrics) Go(name string, fn func() error) {
+	tasks := m.taskMetrics()
+	go func() {
+		var panicked *TaskPanicError
+		if err := tasks.run(name, m.serviceName, m.now, fn); errors.As(err, &panicked) {
+			log.Printf("metrics: %v\n%s", panicked, panicked.Stack)
+		}
+	}()
+}
+
+// Group is an errgroup.Group whose goroutines are recorded as background tasks
+// with the metrics of Go. A panicking goroutine fails the group with an error
+// instead of crashing the process; Wait returns it as a *TaskPanicError.
+type Group struct {
+	group   *errgroup.Group
+	tasks   *taskMetrics
+	name    string
+	service string
+	now     func() time.Time
+}
+
+// NewGroup returns a group recording its goroutines as the task name, and a
+// context cancelled when a goroutine fails or Wait returns, as with
+// errgroup.WithContext.
+func (m *Metrics) NewGroup(ctx context.Context, name string) (*Group, context.Context) {
+	group, ctx := errgroup.WithContext(ctx)
+	return &Group{group: group, tasks: m.taskMetrics(), name: name, service: m.serviceName, now: m.now}, ctx
+}
+
+// Go runs fn in a new goroutine, blocking while the limit set with SetLimit
+// is reached.
+func (g *Group) Go(fn func() error) {
+	g.group.Go(g.wrap(fn))
+}
+
+// TryGo runs fn in a new goroutine unless the limit set with SetLimit is
+// reached, and reports whether it did.
+func (g *Group) TryGo(fn func() error) bool {
+	return g.group.TryGo(g.wrap(fn))
+}
+
+// SetLimit limits the number of goroutines running at once to n. A negative
+// n removes the limit.
+func (g *Group) SetLimit(n int) {
+	g.group.SetLimit(n)
+}
+
+// Wait waits for all goroutines and returns the first error, if any.
+func (g *Group) Wait() error {
+	return g.group.Wait()
+}
+
+func (g *Group) wrap(fn func() error) func() error {
+	return func() error {
+		return g.tasks.run(g.name, g.service, g.now, fn)
+	}
+}
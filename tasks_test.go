@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGo(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	metrics := New(WithServiceName("test-service"))
+	release := make(chan struct{})
+	metrics.Go("sync", func() error {
+		<-release
+		return nil
+	})
+	metrics.Go("sync", func() error { return errors.New("failed") })
+	metrics.Go("sync", func() error { panic("boom") })
+
+	tasks := metrics.taskMetrics()
+	completed := func(result string) float64 {
+		return testutil.ToFloat64(tasks.completed.WithLabelValues("sync", result, "test-service"))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for completed("error") != 1 || completed("panic") != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for tasks, got %v errors and %v panics", completed("error"), completed("panic"))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := testutil.ToFloat64(tasks.running.WithLabelValues("sync", "test-service")); got != 1 {
+		t.Errorf("Expected 1 running task, got %v", got)
+	}
+
+	close(release)
+	for completed("success") != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the task to succeed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := testutil.ToFloat64(tasks.running.WithLabelValues("sync", "test-service")); got != 0 {
+		t.Errorf("Expected no running tasks, got %v", got)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+	group, ctx := metrics.NewGroup(context.Background(), "fetch")
+	group.SetLimit(2)
+	group.Go(func() error { return nil })
+	group.Go(func() error { panic("boom") })
+	group.Go(func() error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	var panicked *TaskPanicError
+	if err := group.Wait(); !errors.As(err, &panicked) || panicked.Value != "boom" || len(panicked.Stack) == 0 {
+		t.Fatalf("Expected the panic to fail the group, got %v", err)
+	}
+
+	tasks := metrics.taskMetrics()
+	for result, want := range map[string]float64{"success": 1, "panic": 1, "error": 1} {
+		if got := testutil.ToFloat64(tasks.completed.WithLabelValues("fetch", result, "test-service")); got != want {
+			t.Errorf("Expected %v %s completions, got %v", want, result, got)
+		}
+	}
+	if got := testutil.CollectAndCount(tasks.duration); got != 1 {
+		t.Errorf("Expected the durations of one task name, got %d", got)
+	}
+}
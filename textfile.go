@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// textfileConfig holds the file configured with WithTextfile.
+type textfileConfig struct {
+	path     string
+	interval time.Duration
+}
+
+// WithTextfile writes all metrics to path, in the text exposition format,
+// every interval and once more when the instance is closed, for the textfile
+// collector of node_exporter. It is intended for short-lived CLIs and cron jobs
+// on hosts running node_exporter, as an alternative to a Pushgateway. Failed
+// periodic writes are retried on the next interval and counted in
+// nexen_service_textfile_write_failures_total; the error of the final write is
+// returned by Close. A non-positive interval defaults to 15s.
+func WithTextfile(path string, interval time.Duration) Option {
+	return func(m *Metrics) {
+		m.textfile = &textfileConfig{path: path, interval: positiveInterval(interval, defaultInterval)}
+	}
+}
+
+// WriteTextfile writes all metrics to path in the text exposition format. The
+// file is written to a temporary file first and renamed, so the textfile
+// collector never reads a partial file; path should be in the directory of
+// --collector.textfile.directory and end in .prom.
+func (m *Metrics) WriteTextfile(path string) error {
+	if err := prometheus.WriteToTextfile(path, m.gatherer); err != nil {
+		return fmt.Errorf("failed to write metrics to %s: %w", path, err)
+	}
+	return nil
+}
+
+// startTextfile starts the periodic writes configured with WithTextfile and
+// adds a final write on Close.
+func (m *Metrics) startTextfile() {
+	cfg := m.textfile
+	if cfg == nil {
+		return
+	}
+
+	failures := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "textfile_write_failures_total",
+			Help:      "Total number of failed periodic writes of the metrics textfile",
+		},
+		[]string{"service"},
+	)
+	m.mustRegister(failures)
+	failed := failures.WithLabelValues(m.serviceName)
+
+	m.goBackground(func() {
+		ticker := time.NewTicker(cfg.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.WriteTextfile(cfg.path); err != nil {
+					failed.Inc()
+				}
+			case <-m.done:
+				return
+			}
+		}
+	})
+
+	m.onClose(func(context.Context) error {
+		return m.WriteTextfile(cfg.path)
+	})
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteTextfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.prom")
+	metrics := New(WithServiceName("test-service"))
+	metrics.RecordEvent("rows_imported")
+
+	if err := metrics.WriteTextfile(path); err != nil {
+		t.Fatalf("Failed to write textfile: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read textfile: %v", err)
+	}
+	if !strings.Contains(string(data), `nexen_service_application_events_total{event="rows_imported",service="test-service"} 1`) {
+		t.Fatalf("Expected the textfile to hold recorded metrics, got:\n%s", data)
+	}
+
+	if err := metrics.WriteTextfile(filepath.Join(t.TempDir(), "missing", "job.prom")); err == nil {
+		t.Fatal("Expected an error for a missing directory")
+	}
+}
+
+func TestWithTextfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.prom")
+	metrics := New(WithServiceName("test-service"), WithTextfile(path, time.Hour))
+	metrics.RecordEvent("rows_imported")
+
+	// Close writes the final state
+	if err := metrics.Close(context.Background()); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read textfile: %v", err)
+	}
+	if !strings.Contains(string(data), `event="rows_imported"`) {
+		t.Fatalf("Expected the final write to hold recorded metrics, got:\n%s", data)
+	}
+}
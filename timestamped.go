@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// timestampedGauge is a single gauge sample with an explicit timestamp.
+type timestampedGauge struct {
+	value float64
+	at    time.Time
+}
+
+// timestampedGaugeCollector exposes gauge samples carrying the timestamp at which
+// the value was observed rather than the scrape time.
+type timestampedGaugeCollector struct {
+	desc    *prometheus.Desc
+	service string
+
+	mu     sync.Mutex
+	gauges map[string]timestampedGauge
+}
+
+// newTimestampedGaugeCollector creates an empty collector for the given service.
+func newTimestampedGaugeCollector(service string) *timestampedGaugeCollector {
+	return &timestampedGaugeCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "timestamped_gauge"),
+			"Service-specific gauge for values observed at an explicit point in time",
+			[]string{"name", "service"},
+			nil,
+		),
+		service: service,
+		gauges:  make(map[string]timestampedGauge),
+	}
+}
+
+// set stores the value for name, ignoring samples older than the current one.
+func (c *timestampedGaugeCollector) set(name string, value float64, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cur, ok := c.gauges[name]; ok && at.Before(cur.at) {
+		return
+	}
+	c.gauges[name] = timestampedGauge{value: value, at: at}
+}
+
+// Describe implements prometheus.Collector.
+func (c *timestampedGaugeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *timestampedGaugeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, g := range c.gauges {
+		metric := prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, g.value, name, c.service)
+		ch <- prometheus.NewMetricWithTimestamp(g.at, metric)
+	}
+}
+
+// SetGaugeAt sets a named gauge to a value observed at time t, exposed as
+// nexen_service_timestamped_gauge. Samples older than the last one set for the
+// same name are ignored.
+//
+// Explicit timestamps are only meaningful for gauges. Prometheus does not apply
+// staleness handling to timestamped samples, so the last value stays visible for
+// up to five minutes after t, and samples outside the server's ingestion window
+// (typically older than one hour, or out of order) are rejected at scrape time.
+// Do not use this to backfill counters or for values that are not re-set regularly.
+func (m *Metrics) SetGaugeAt(name string, value float64, t time.Time) {
+	m.timestampedGauges.set(name, value, t)
+}
@@ -0,0 +1,269 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// seriesGroup identifies the metrics a tracked label set is recorded in.
+type seriesGroup uint8
+
+const (
+	// seriesHTTP covers the HTTP metrics of a method and path.
+	seriesHTTP seriesGroup = iota
+	seriesEvent
+	seriesGauge
+	seriesError
+	seriesBatch
+	seriesLabeledEvent
+	seriesLabeledGauge
+)
+
+// seriesKey identifies a tracked label set: the service label along with the
+// method and path for seriesHTTP, the metric and its label values joined by
+// labelValueSeparator for the labeled groups, or the single caller-provided
+// label value of the other groups.
+type seriesKey struct {
+	group   seriesGroup
+	service string
+	a, b    string
+}
+
+// seriesExpiry remembers when each label set was last recorded.
+type seriesExpiry struct {
+	ttl  time.Duration
+	mu   sync.Mutex
+	seen map[seriesKey]time.Time
+	// expiring holds the label sets an expiry is deleting, and swept is closed
+	// once they are deleted
+	expiring map[seriesKey]bool
+	swept    chan struct{}
+}
+
+// WithMetricTTL deletes label sets that have not been recorded for ttl, so
+// paths, events, gauges, error types and queues that stopped occurring do not
+// accumulate in long-running services. It covers the series recorded through
+// Instrument, RecordEvent, RecordEventWithLabels, SetGauge, SetGaugeWithLabels,
+// IncrementGauge, DecrementGauge, RecordError and ObserveBatchSize, as well as
+// the durations reported by LastLatency; metrics created with the Register
+// methods are not tracked. A background goroutine checks for expired label sets
+// every ttl/2, but at most once per second, until Close. Label set ages are
+// measured with the clock set with WithClock.
+//
+// An expired counter starts from zero when recorded again, which rate() and
+// increase() handle like a restart. Gauges are deleted as well, so only use a
+// TTL if gauge values are set regularly, or exempt them with WithoutMetricTTL.
+func WithMetricTTL(ttl time.Duration) Option {
+	return func(m *Metrics) {
+		m.metricTTL = ttl
+	}
+}
+
+// WithoutMetricTTL exempts the named metrics from WithMetricTTL. Names are
+// given without the nexen_service_ prefix, e.g. "gauge" or "http_errors_total".
+func WithoutMetricTTL(names ...string) Option {
+	return func(m *Metrics) {
+		if m.ttlExempt == nil {
+			m.ttlExempt = make(map[string]bool)
+		}
+		for _, name := range names {
+			m.ttlExempt[name] = true
+		}
+	}
+}
+
+// startMetricTTL starts the goroutine deleting expired label sets if a TTL is
+// configured.
+func (m *Metrics) startMetricTTL() {
+	if m.metricTTL <= 0 {
+		return
+	}
+	m.seriesSeen = &seriesExpiry{
+		ttl:      m.metricTTL,
+		seen:     make(map[seriesKey]time.Time),
+		expiring: make(map[seriesKey]bool),
+	}
+
+	m.goBackground(func() {
+		ticker := time.NewTicker(max(m.metricTTL/2, time.Second))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+				m.expireSeries(m.now())
+			}
+		}
+	})
+}
+
+// touchSeries marks a label set as recorded now. It must be called before the
+// label set is recorded: an expiry either sees the new time and keeps the
+// label set, or is deleting it, in which case touchSeries waits until it is
+// deleted and the recording creates it again.
+func (m *Metrics) touchSeries(key seriesKey) {
+	s := m.seriesSeen
+	if s == nil {
+		return
+	}
+	now := m.now()
+	s.mu.Lock()
+	for s.expiring[key] {
+		swept := s.swept
+		s.mu.Unlock()
+		<-swept
+		s.mu.Lock()
+	}
+	s.seen[key] = now
+	s.mu.Unlock()
+}
+
+// expireSeries deletes the label sets not recorded within the TTL before now.
+// They are collected under the lock of touchSeries but deleted after releasing
+// it, so recordings of other label sets do not wait for the deletions, while
+// those of the expired label sets wait until they are deleted.
+func (m *Metrics) expireSeries(now time.Time) {
+	s := m.seriesSeen
+	var expired []seriesKey
+	s.mu.Lock()
+	for key, last := range s.seen {
+		if now.Sub(last) >= s.ttl {
+			delete(s.seen, key)
+			s.expiring[key] = true
+			expired = append(expired, key)
+		}
+	}
+	if len(expired) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	swept := make(chan struct{})
+	s.swept = swept
+	s.mu.Unlock()
+
+	for _, key := range expired {
+		m.deleteSeries(key)
+	}
+
+	s.mu.Lock()
+	clear(s.expiring)
+	s.mu.Unlock()
+	close(swept)
+}
+
+// deleteSeries deletes an expired label set from the metrics of its group,
+// except those exempted with WithoutMetricTTL, along with any cached children.
+// Once deleted, the label set no longer counts towards the cardinality limit.
+func (m *Metrics) deleteSeries(key seriesKey) {
+	switch key.group {
+	case seriesHTTP:
+		route := prometheus.Labels{"method": key.a, "path": key.b, "service": key.service}
+		if m.expires("http_requests_total") {
+			if m.shardedRequests != nil {
+				m.shardedRequests.DeletePartialMatch(route)
+			} else {
+				m.httpRequests.DeletePartialMatch(route)
+			}
+			m.httpChildren.requests.deleteFunc(func(k requestKey) bool {
+				return k.service == key.service && k.method == key.a && k.path == key.b
+			})
+			m.forgetLabel(limitHTTP, key.service, key.a+" "+key.b)
+		}
+		if m.expires("http_request_duration_seconds") {
+			if m.shardedDuration != nil {
+				m.shardedDuration.DeletePartialMatch(route)
+			} else {
+				m.httpDuration.DeletePartialMatch(route)
+			}
+			m.httpChildren.duration.deleteFunc(func(k durationKey) bool {
+				return k.service == key.service && k.method == key.a && k.path == key.b
+			})
+		}
+		if m.httpMiddleware != nil && m.expires("http_middleware_seconds") {
+			m.httpMiddleware.DeletePartialMatch(route)
+		}
+		isRoute := func(k routeKey) bool {
+			return k.service == key.service && k.method == key.a && k.path == key.b
+		}
+		if m.httpRequestSize != nil && m.expires("http_request_size_bytes") {
+			m.httpRequestSize.DeletePartialMatch(route)
+			m.httpChildren.requestSize.deleteFunc(isRoute)
+		}
+		if m.httpResponseSize != nil && m.expires("http_response_size_bytes") {
+			m.httpResponseSize.DeletePartialMatch(route)
+			m.httpChildren.responseSize.deleteFunc(isRoute)
+		}
+		if m.expires("http_errors_total") {
+			m.httpErrors.DeletePartialMatch(route)
+		}
+		if m.latencyProbe != nil {
+			m.latencyProbe.forget(key.a, key.b)
+		}
+
+	case seriesEvent:
+		m.lazyMu.Lock()
+		typed := m.events[key.a]
+		m.lazyMu.Unlock()
+		switch {
+		case typed != nil && m.expires(key.a+"_total"):
+			typed.DeleteLabelValues(key.service)
+		case typed == nil && m.expires("application_events_total"):
+			m.applicationEvent.DeleteLabelValues(key.a, key.service)
+		default:
+			return
+		}
+		m.forgetLabel(limitEvents, key.service, key.a)
+
+	case seriesGauge:
+		m.lazyMu.Lock()
+		typed := m.gauges[key.a]
+		m.lazyMu.Unlock()
+		switch {
+		case typed != nil && m.expires(key.a):
+			typed.DeleteLabelValues(key.service)
+		case typed == nil && m.expires("gauge"):
+			m.serviceGauge.DeleteLabelValues(key.a, key.service)
+		default:
+			return
+		}
+		m.forgetLabel(limitGauges, key.service, key.a)
+
+	case seriesError:
+		if m.expires("errors_total") {
+			m.applicationError.DeleteLabelValues(key.a, key.service)
+			m.forgetLabel(limitErrors, key.service, key.a)
+		}
+
+	case seriesBatch:
+		if m.expires("batch_size") {
+			m.batchSize.DeleteLabelValues(key.a, key.service)
+		}
+
+	case seriesLabeledEvent:
+		m.lazyMu.Lock()
+		labeled := m.labeledEvents[key.a]
+		m.lazyMu.Unlock()
+		if labeled.vec != nil && m.expires(key.a+"_total") {
+			labeled.vec.DeleteLabelValues(append(strings.Split(key.b, labelValueSeparator), key.service)...)
+			m.forgetLabel(key.a+"_total", key.service, key.b)
+		}
+
+	case seriesLabeledGauge:
+		m.lazyMu.Lock()
+		labeled := m.labeledGauges[key.a]
+		m.lazyMu.Unlock()
+		if labeled.vec != nil && m.expires(key.a) {
+			labeled.vec.DeleteLabelValues(append(strings.Split(key.b, labelValueSeparator), key.service)...)
+			m.forgetLabel(key.a, key.service, key.b)
+		}
+	}
+}
+
+// expires reports whether the named metric is subject to the TTL.
+func (m *Metrics) expires(name string) bool {
+	return !m.ttlExempt[name]
+}
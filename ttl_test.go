@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricTTL(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithMetricTTL(time.Minute))
+	defer metrics.Close(context.Background())
+
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	metrics.RecordEvent("signup")
+	metrics.SetGauge("queue_depth", 3)
+	metrics.ObserveBatchSize("jobs", 10)
+
+	// Nothing has expired yet
+	metrics.expireSeries(time.Now())
+	if got := testutil.CollectAndCount(metrics.httpRequests); got != 1 {
+		t.Fatalf("Expected 1 request series before the TTL, got %d", got)
+	}
+
+	// Keep the gauge alive, let everything else expire
+	metrics.SetGauge("queue_depth", 4)
+	metrics.seriesSeen.seen[seriesKey{group: seriesGauge, service: "test-service", a: "queue_depth"}] = time.Now().Add(time.Minute)
+	metrics.expireSeries(time.Now().Add(time.Minute))
+
+	for name, got := range map[string]int{
+		"http_requests_total":           testutil.CollectAndCount(metrics.httpRequests),
+		"http_request_duration_seconds": testutil.CollectAndCount(metrics.httpDuration),
+		"http_errors_total":             testutil.CollectAndCount(metrics.httpErrors),
+		"http_response_size_bytes":      testutil.CollectAndCount(metrics.httpResponseSize),
+		"application_events_total":      testutil.CollectAndCount(metrics.applicationEvent),
+		"batch_size":                    testutil.CollectAndCount(metrics.batchSize),
+	} {
+		if got != 0 {
+			t.Errorf("Expected expired %s series to be deleted, got %d", name, got)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.serviceGauge.WithLabelValues("queue_depth", "test-service")); got != 4 {
+		t.Errorf("Expected recently set gauge to be kept, got %v", got)
+	}
+
+	// Cached children are resolved again, so the path is exported once more
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	if got := testutil.ToFloat64(metrics.httpRequests.WithLabelValues("GET", "/missing", "test-service")); got != 1 {
+		t.Errorf("Expected expired request counter to restart at 1, got %v", got)
+	}
+	if got := testutil.CollectAndCount(metrics.httpDuration); got != 1 {
+		t.Errorf("Expected duration series to be recorded again, got %d", got)
+	}
+}
+
+func TestWithoutMetricTTL(t *testing.T) {
+	metrics := New(
+		WithServiceName("test-service"),
+		WithMetricTTL(time.Minute),
+		WithoutMetricTTL("gauge", "http_requests_total"),
+	)
+	defer metrics.Close(context.Background())
+
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users", nil))
+	metrics.SetGauge("queue_depth", 3)
+	metrics.expireSeries(time.Now().Add(time.Minute))
+
+	if got := testutil.CollectAndCount(metrics.serviceGauge); got != 1 {
+		t.Errorf("Expected exempt gauge to be kept, got %d series", got)
+	}
+	if got := testutil.CollectAndCount(metrics.httpRequests); got != 1 {
+		t.Errorf("Expected exempt request counter to be kept, got %d series", got)
+	}
+	if got := testutil.CollectAndCount(metrics.httpDuration); got != 0 {
+		t.Errorf("Expected duration histogram to expire, got %d series", got)
+	}
+}
+
+func TestMetricTTLFreesCardinalitySlots(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithMetricTTL(time.Minute), WithMaxLabelCardinality(1))
+	defer metrics.Close(context.Background())
+
+	metrics.RecordEvent("signup")
+	metrics.expireSeries(time.Now().Add(time.Minute))
+	metrics.RecordEvent("login")
+
+	if got := testutil.ToFloat64(metrics.applicationEvent.WithLabelValues("login", "test-service")); got != 1 {
+		t.Errorf("Expected new event to take the expired event's slot, got %v", got)
+	}
+	if got := testutil.CollectAndCount(metrics.cardinality.dropped); got != 0 {
+		t.Errorf("Expected no dropped series, got %d", got)
+	}
+}
+
+func TestMetricTTLWithContentTypeLabel(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithMetricTTL(time.Minute), WithContentTypeLabel())
+	defer metrics.Close(context.Background())
+
+	handler := metrics.Instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("ct"))
+	}))
+	for _, target := range []string{"/a?ct=text/plain", "/a?ct=application/json"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", target, nil))
+	}
+	metrics.expireSeries(time.Now().Add(time.Minute))
+
+	if got := testutil.CollectAndCount(metrics.httpRequestSize) + testutil.CollectAndCount(metrics.httpResponseSize); got != 0 {
+		t.Fatalf("Expected expired size series of every content type to be deleted, got %d", got)
+	}
+	if n := len(metrics.httpChildren.requestSize.children) + len(metrics.httpChildren.responseSize.children); n != 0 {
+		t.Fatalf("Expected expired size children to be evicted, got %d", n)
+	}
+}
+
+func TestTouchSeriesWaitsForExpiry(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithMetricTTL(time.Minute))
+	defer metrics.Close(context.Background())
+
+	// Simulate an expiry deleting the signup event
+	expiring := seriesKey{group: seriesEvent, service: "test-service", a: "signup"}
+	swept := make(chan struct{})
+	metrics.seriesSeen.mu.Lock()
+	metrics.seriesSeen.expiring[expiring] = true
+	metrics.seriesSeen.swept = swept
+	metrics.seriesSeen.mu.Unlock()
+
+	// Other label sets are recorded during the expiry
+	metrics.touchSeries(seriesKey{group: seriesEvent, service: "test-service", a: "login"})
+
+	touched := make(chan struct{})
+	go func() {
+		metrics.touchSeries(expiring)
+		close(touched)
+	}()
+	select {
+	case <-touched:
+		t.Fatal("Expected the expiring label set to wait for the expiry")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	metrics.seriesSeen.mu.Lock()
+	clear(metrics.seriesSeen.expiring)
+	metrics.seriesSeen.mu.Unlock()
+	close(swept)
+	<-touched
+}
+
+func TestMetricTTLWithClock(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	metrics := New(WithServiceName("test-service"), WithMetricTTL(time.Minute), WithClock(func() time.Time { return now }))
+	defer metrics.Close(context.Background())
+
+	metrics.RecordEvent("signup")
+	now = now.Add(30 * time.Second)
+	metrics.RecordEvent("login")
+
+	// Ages are measured on the clock of metrics, not the wall clock
+	now = now.Add(30 * time.Second)
+	metrics.expireSeries(metrics.Now())
+	if got := testutil.CollectAndCount(metrics.applicationEvent); got != 1 {
+		t.Fatalf("Expected only the event recorded a minute ago to expire, got %d series", got)
+	}
+	if got := testutil.ToFloat64(metrics.applicationEvent.WithLabelValues("login", "test-service")); got != 1 {
+		t.Fatalf("Expected the recent event to be kept, got %v", got)
+	}
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithTypedGauges makes SetGauge, IncrementGauge and DecrementGauge record into
+// a separate nexen_service_<name> gauge per name, registered on first use,
+// instead of the shared nexen_service_gauge vector with a name label. Use
+// WithMetricHelp to give the gauges descriptive help text.
+func WithTypedGauges() Option {
+	return func(m *Metrics) {
+		m.typedGauges = true
+	}
+}
+
+// WithTypedEvents makes RecordEvent count into a separate
+// nexen_service_<event>_total counter per event, registered on first use,
+// instead of the shared nexen_service_application_events_total vector with an
+// event label. Use WithMetricHelp to give the counters descriptive help text.
+func WithTypedEvents() Option {
+	return func(m *Metrics) {
+		m.typedEvents = true
+	}
+}
+
+// WithMetricHelp sets the help text of the typed gauge or event named name. It
+// may be given multiple times and has no effect without WithTypedGauges or
+// WithTypedEvents.
+func WithMetricHelp(name, help string) Option {
+	return func(m *Metrics) {
+		if m.metricHelp == nil {
+			m.metricHelp = make(map[string]string)
+		}
+		m.metricHelp[name] = help
+	}
+}
+
+// gauge returns the gauge recording the named value of service. Typed gauges that cannot
+// be registered, for example because the name is already used by another metric,
+// fall back to the shared gauge vector so the value is not lost.
+func (m *Metrics) gauge(name, service string) prometheus.Gauge {
+	return m.limitedGauge(m.limitLabel(limitGauges, service, m.sanitizeLabel(limitGauges, name)), service)
+}
+
+// limitedGauge is like gauge for a name already sanitized and limited.
+func (m *Metrics) limitedGauge(name, service string) prometheus.Gauge {
+	m.touchSeries(seriesKey{group: seriesGauge, service: service, a: name})
+	if m.typedGauges {
+		if vec := m.typedGauge(name); vec != nil {
+			return vec.WithLabelValues(service)
+		}
+	}
+	return m.serviceGauge.WithLabelValues(name, service)
+}
+
+// typedGauge returns the lazily registered gauge for name, or nil if it could
+// not be registered.
+func (m *Metrics) typedGauge(name string) *prometheus.GaugeVec {
+	m.lazyMu.Lock()
+	defer m.lazyMu.Unlock()
+
+	if gauge, ok := m.gauges[name]; ok {
+		return gauge
+	}
+
+	help := m.metricHelp[name]
+	if help == "" {
+		help = "Service gauge " + name
+	}
+	// RegisterGauge returns nil on failure, which is cached like a success
+	gauge, _ := m.RegisterGauge(name, help, nil)
+	if m.gauges == nil {
+		m.gauges = make(map[string]*prometheus.GaugeVec)
+	}
+	m.gauges[name] = gauge
+	return gauge
+}
+
+// eventCounter returns the counter recording the named event of service. Typed counters
+// that cannot be registered fall back to the shared event vector.
+func (m *Metrics) eventCounter(event, service string) prometheus.Counter {
+	return m.limitedEventCounter(m.limitLabel(limitEvents, service, m.sanitizeLabel(limitEvents, event)), service)
+}
+
+// limitedEventCounter is like eventCounter for an event already sanitized and
+// limited.
+func (m *Metrics) limitedEventCounter(event, service string) prometheus.Counter {
+	m.touchSeries(seriesKey{group: seriesEvent, service: service, a: event})
+	if m.typedEvents {
+		if vec := m.typedEvent(event); vec != nil {
+			return vec.WithLabelValues(service)
+		}
+	}
+	return m.applicationEvent.WithLabelValues(event, service)
+}
+
+// typedEvent returns the lazily registered counter for event, or nil if it
+// could not be registered.
+func (m *Metrics) typedEvent(event string) *prometheus.CounterVec {
+	m.lazyMu.Lock()
+	defer m.lazyMu.Unlock()
+
+	if counter, ok := m.events[event]; ok {
+		return counter
+	}
+
+	help := m.metricHelp[event]
+	if help == "" {
+		help = "Total number of " + event + " events"
+	}
+	// RegisterCounter returns nil on failure, which is cached like a success
+	counter, _ := m.RegisterCounter(event+"_total", help, nil)
+	if m.events == nil {
+		m.events = make(map[string]*prometheus.CounterVec)
+	}
+	m.events[event] = counter
+	return counter
+}
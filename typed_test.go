@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTypedGaugesAndEvents(t *testing.T) {
+	metrics := New(
+		WithServiceName("test-service"),
+		WithTypedGauges(),
+		WithTypedEvents(),
+		WithMetricHelp("queue_depth", "Number of jobs waiting in the queue"),
+	)
+
+	metrics.SetGauge("queue_depth", 5)
+	metrics.IncrementGauge("queue_depth")
+	metrics.IncrementGauge("workers")
+	metrics.RecordEvent("user_signup")
+	metrics.RecordEvent("user_signup")
+	metrics.SetGauge("gauge", 1)
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Result().Body)
+	bodyStr := string(body)
+
+	for _, want := range []string{
+		"# HELP nexen_service_queue_depth Number of jobs waiting in the queue",
+		`nexen_service_queue_depth{service="test-service"} 6`,
+		"# HELP nexen_service_workers Service gauge workers",
+		`nexen_service_workers{service="test-service"} 1`,
+		`nexen_service_user_signup_total{service="test-service"} 2`,
+		`nexen_service_gauge{name="gauge",service="test-service"} 1`,
+	} {
+		if !strings.Contains(bodyStr, want) {
+			t.Errorf("Expected metrics output to contain %q", want)
+		}
+	}
+	if strings.Contains(bodyStr, `nexen_service_gauge{name="queue_depth"`) {
+		t.Error("Expected typed gauge not to be recorded in the shared gauge vector")
+	}
+}
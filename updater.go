@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"context"
+	"time"
+)
+
+// defaultInterval replaces the non-positive intervals given to periodic tasks,
+// which time.NewTicker rejects.
+const defaultInterval = 15 * time.Second
+
+// positiveInterval returns interval, or def if interval is not positive.
+func positiveInterval(interval, def time.Duration) time.Duration {
+	if interval <= 0 {
+		return def
+	}
+	return interval
+}
+
+// StartGaugeUpdater polls fn every interval and stores the result in the named
+// gauge, as if by SetGauge. The gauge is set once immediately, and polling stops
+// when ctx is cancelled or the Metrics instance is closed. It returns
+// immediately and may be called for any number of gauges. A non-positive
+// interval defaults to 15s.
+func (m *Metrics) StartGaugeUpdater(ctx context.Context, name string, interval time.Duration, fn func() float64) {
+	interval = positiveInterval(interval, defaultInterval)
+	m.goBackground(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			m.SetGauge(name, fn())
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			case <-m.done:
+				return
+			}
+		}
+	})
+}
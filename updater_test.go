@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStartGaugeUpdater(t *testing.T) {
+	metrics := New(WithServiceName("test-service"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls atomic.Int64
+	metrics.StartGaugeUpdater(ctx, "queue_depth", time.Millisecond, func() float64 {
+		return float64(calls.Add(1))
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for calls.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if calls.Load() < 3 {
+		t.Fatalf("Expected updater to poll repeatedly, got %d calls", calls.Load())
+	}
+
+	// Wait for the goroutine to exit, then the gauge must hold the last value
+	metrics.background.Wait()
+	got := testutil.ToFloat64(metrics.serviceGauge.WithLabelValues("queue_depth", "test-service"))
+	if got != float64(calls.Load()) {
+		t.Fatalf("Expected gauge to hold last polled value %d, got %v", calls.Load(), got)
+	}
+}
+
+func TestStartGaugeUpdaterStopsOnClose(t *testing.T) {
+	metrics := New()
+	metrics.StartGaugeUpdater(context.Background(), "cache_size", time.Hour, func() float64 { return 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := metrics.Close(ctx); err != nil {
+		t.Fatalf("Expected Close to stop updater, got %v", err)
+	}
+}
+
+func TestNonPositiveIntervals(t *testing.T) {
+	metrics := New(WithServiceName("test-service"), WithTextfile(t.TempDir()+"/metrics.prom", 0))
+
+	// None of these may panic in time.NewTicker
+	polled := make(chan struct{}, 1)
+	metrics.StartGaugeUpdater(context.Background(), "queue_depth", 0, func() float64 {
+		select {
+		case polled <- struct{}{}:
+		default:
+		}
+		return 1
+	})
+	metrics.StartMemoryMetrics(context.Background(), -time.Second)
+	bridge, err := metrics.StatsDBridge("127.0.0.1:8125", 0, "nexen", PlainStatsD)
+	if err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+	bridge.Start()
+	defer bridge.Stop()
+
+	<-polled
+	if err := metrics.Close(context.Background()); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if got := positiveInterval(0, defaultInterval); got != defaultInterval {
+		t.Fatalf("Expected a zero interval to default to %v, got %v", defaultInterval, got)
+	}
+}